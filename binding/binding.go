@@ -2,7 +2,7 @@ package binding
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"reflect"
 	"strings"
 
@@ -28,6 +28,8 @@ func schemaErrorToText(err error) string {
 		switch err.Type.Name() {
 		case "int":
 			return "Not a valid integer"
+		case "float32", "float64":
+			return "Not a valid number"
 		}
 	case schema.EmptyFieldError:
 		return "Required field"
@@ -51,6 +53,8 @@ func validationErrorToText(err validator.FieldError) string {
 		return fmt.Sprintf("must be <= %s", err.Param())
 	case "url":
 		return "Invalid url"
+	case "http_url":
+		return "Invalid http or https url"
 	}
 	return "Invalid"
 }
@@ -94,7 +98,7 @@ func ShouldBind(dst any, src map[string][]string) error {
 	if err := decoder.Decode(dst, src); err != nil {
 		err, ok := err.(schema.MultiError)
 		if err != nil && !ok {
-			log.Printf("ShouldBind: unknown error %s", err)
+			slog.Error("ShouldBind: unknown error", "error", err)
 			return genericError
 		}
 		b.FieldErrors = schemaMultiErrorToFieldErrors(err)
@@ -102,7 +106,7 @@ func ShouldBind(dst any, src map[string][]string) error {
 	if err := validate.Struct(dst); err != nil {
 		err, ok := err.(validator.ValidationErrors)
 		if err != nil && !ok {
-			log.Print(err)
+			slog.Error("ShouldBind: unknown validation error", "error", err)
 			return genericError
 		}
 		errs := validationErrorsToFieldErrors(err)
@@ -11,8 +11,12 @@ import jsend
 
 ZMQ_PORT = "5554"
 
+MODEL_NAME = "ViT-L/14@336px"
+
 device = "cuda" if torch.cuda.is_available() else "cpu"
-model, preprocess = clip.load("ViT-L/14@336px", device=device, download_root='models/')
+model, preprocess = clip.load(MODEL_NAME, device=device, download_root='models/')
+# Answer to "info" requests, so that clients know which model computed the embeddings
+MODEL_INFO = {"name": MODEL_NAME, "dimension": model.text_projection.shape[1]}
     
 context = zmq.Context()
 socket = context.socket(zmq.REP)
@@ -22,7 +26,18 @@ print("Image embedding daemon listening on tcp://localhost:" + ZMQ_PORT)
 
 while True:
     try:
-        image_bytes = socket.recv()
+        # An "encode" frame followed by the image, or an "info" frame alone
+        frames = socket.recv_multipart()
+        if frames == [b"info"]:
+            socket.send_string(jsend.New(MODEL_INFO))
+            continue
+        if len(frames) != 2 or frames[0] != b"encode":
+            socket.send_string(jsend.NewError("Unknown request"))
+            continue
+        image_bytes = frames[1]
+        if len(image_bytes) == 0:
+            socket.send_string(jsend.NewError("The image is empty"))
+            continue
 
         image = Image.open(io.BytesIO(image_bytes))
         image = preprocess(image).unsqueeze(0).to(device)
@@ -9,8 +9,12 @@ import jsend
 
 ZMQ_PORT = "5553"
 
+MODEL_NAME = "ViT-L/14@336px"
+
 device = "cuda" if torch.cuda.is_available() else "cpu"
-model, preprocess = clip.load("ViT-L/14@336px", device=device, download_root='models/')
+model, preprocess = clip.load(MODEL_NAME, device=device, download_root='models/')
+# Answer to "info" requests, so that clients know which model computed the embeddings
+MODEL_INFO = {"name": MODEL_NAME, "dimension": model.text_projection.shape[1]}
 
 THRESHOLD = 17
 
@@ -21,8 +25,19 @@ socket.bind("tcp://*:" + ZMQ_PORT)
 print("Text embedding daemon listening on tcp://localhost:" + ZMQ_PORT)
 
 while True:
-    prompt = socket.recv().decode("utf-8")
+    # An "encode" frame followed by the text, or an "info" frame alone
+    frames = socket.recv_multipart()
+    if frames == [b"info"]:
+        socket.send_string(jsend.New(MODEL_INFO))
+        continue
+    if len(frames) != 2 or frames[0] != b"encode":
+        socket.send_string(jsend.NewError("Unknown request"))
+        continue
+    if len(frames[1]) == 0:
+        socket.send_string(jsend.NewError("The text is empty"))
+        continue
     try:
+        prompt = frames[1].decode("utf-8")
         with torch.no_grad():
             text_features = model.encode_text(clip.tokenize(prompt))
             text_features /= text_features.norm(dim=-1, keepdim=True)
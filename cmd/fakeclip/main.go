@@ -0,0 +1,60 @@
+// Serves fake, deterministic CLIP embeddings for testing without Python or a model
+package main
+
+import (
+	"clipsearch/fakeclip"
+	"context"
+	"flag"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func main() {
+	grpcAddress := flag.String("grpc", "localhost:5555", "Address to serve the gRPC embedding protocol on, empty to disable")
+	zmqImageEndpoint := flag.String("zmq-image", "tcp://*:5554", "Endpoint to serve the zmq image embedding protocol on, empty to disable")
+	zmqTextEndpoint := flag.String("zmq-text", "tcp://*:5553", "Endpoint to serve the zmq text embedding protocol on, empty to disable")
+	flag.Parse()
+
+	if *zmqImageEndpoint != "" {
+		daemon, err := fakeclip.StartZmqImageDaemon(*zmqImageEndpoint)
+		if err != nil {
+			fatal("Failed to bind", "endpoint", *zmqImageEndpoint, "error", err)
+		}
+		defer daemon.Close()
+		slog.Info("Fake image embedding daemon listening", "endpoint", daemon.Endpoint)
+	}
+	if *zmqTextEndpoint != "" {
+		daemon, err := fakeclip.StartZmqTextDaemon(*zmqTextEndpoint)
+		if err != nil {
+			fatal("Failed to bind", "endpoint", *zmqTextEndpoint, "error", err)
+		}
+		defer daemon.Close()
+		slog.Info("Fake text embedding daemon listening", "endpoint", daemon.Endpoint)
+	}
+	if *grpcAddress != "" {
+		lis, err := net.Listen("tcp", *grpcAddress)
+		if err != nil {
+			fatal("Failed to listen", "error", err)
+		}
+		server := fakeclip.NewGrpcServer()
+		defer server.Stop()
+		go func() {
+			if err := server.Serve(lis); err != nil {
+				fatal("Server failed", "error", err)
+			}
+		}()
+		slog.Info("Fake gRPC embedding daemon listening", "address", lis.Addr().String())
+	}
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-signalCtx.Done()
+}
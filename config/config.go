@@ -1,15 +1,209 @@
 package config
 
+import "time"
+
+// Path of an optional YAML config file. Envars override the values in it
+const CONFIG_FILE_ENVAR string = "CONFIG_FILE"
+
 const PORT_ENVAR string = "PORT"
-const DEFAULT_PORT string = "3000"
+const DEFAULT_PORT int = 3000
 
 const PG_DATABASE_CONNECTION_URL_ENVAR string = "POSTGRESQL_URL"
 
-const MAX_IMAGE_FILE_SIZE int = 16 * 1024 * 1024
-const MAX_IMAGE_FILE_SIZE_MB int = MAX_IMAGE_FILE_SIZE / 1024 / 1024
-const FILE_DOWNLOAD_USERAGENT string = "Mozilla/5.0 (Windows NT 10.0; rv:108.0) Gecko/20100101 Firefox/108.0"
+// Size of the database connection pool, 0 means the pgx default
+const PG_MAX_CONNS_ENVAR string = "POSTGRESQL_MAX_CONNS"
+const PG_MIN_CONNS_ENVAR string = "POSTGRESQL_MIN_CONNS"
+
+// One of debug, info, warn, error
+const LOG_LEVEL_ENVAR string = "LOG_LEVEL"
+const DEFAULT_LOG_LEVEL string = "info"
+
+const MAX_IMAGE_FILE_SIZE_ENVAR string = "MAX_IMAGE_FILE_SIZE"
+const DEFAULT_MAX_IMAGE_FILE_SIZE int = 16 * 1024 * 1024
+const FILE_DOWNLOAD_USERAGENT_ENVAR string = "FILE_DOWNLOAD_USERAGENT"
+const DEFAULT_FILE_DOWNLOAD_USERAGENT string = "Mozilla/5.0 (Windows NT 10.0; rv:108.0) Gecko/20100101 Firefox/108.0"
+const ANIMATION_FRAMES_ENVAR string = "ANIMATION_FRAMES"
+const DEFAULT_ANIMATION_FRAMES int = 8
+const ANIMATION_EMBEDDING_ENVAR string = "ANIMATION_EMBEDDING"
+const ANIMATION_EMBEDDING_AVERAGE string = "average"
+const ANIMATION_EMBEDDING_FRAMES string = "frames"
+const DEFAULT_ANIMATION_EMBEDDING string = ANIMATION_EMBEDDING_AVERAGE
 
+const ZMQ_IMAGE_EMBEDDING_DAEMON_HOST_ENVAR string = "ZMQ_IMAGE_HOST"
 const ZMQ_IMAGE_EMBEDDING_DAEMON_PORT_ENVAR string = "ZMQ_IMAGE_PORT"
-const ZMQ_IMAGE_EMBEDDING_DAEMON_DEFAULT_PORT string = "5554"
+const ZMQ_IMAGE_EMBEDDING_DAEMON_DEFAULT_PORT int = 5554
+const ZMQ_TEXT_EMBEDDING_DAEMON_HOST_ENVAR string = "ZMQ_TEXT_HOST"
 const ZMQ_TEXT_EMBEDDING_DAEMON_PORT_ENVAR string = "ZMQ_TEXT_PORT"
-const ZMQ_TEXT_EMBEDDING_DAEMON_DEFAULT_PORT string = "5553"
+const ZMQ_TEXT_EMBEDDING_DAEMON_DEFAULT_PORT int = 5553
+const ZMQ_EMBEDDING_DAEMON_DEFAULT_HOST string = "localhost"
+
+// Comma separated host:port lists of daemons to balance requests across, replacing the host and port envars
+const ZMQ_IMAGE_EMBEDDING_DAEMON_ENDPOINTS_ENVAR string = "ZMQ_IMAGE_ENDPOINTS"
+const ZMQ_TEXT_EMBEDDING_DAEMON_ENDPOINTS_ENVAR string = "ZMQ_TEXT_ENDPOINTS"
+
+// How long the embedding daemons may take to answer before a request fails
+const ZMQ_TIMEOUT_ENVAR string = "ZMQ_TIMEOUT"
+const DEFAULT_ZMQ_TIMEOUT time.Duration = 30 * time.Second
+
+// How often daemons that stopped responding are probed
+const ZMQ_PROBE_INTERVAL_ENVAR string = "ZMQ_PROBE_INTERVAL"
+const DEFAULT_ZMQ_PROBE_INTERVAL time.Duration = 10 * time.Second
+
+// Which ClipService implementation computes embeddings
+const EMBEDDING_BACKEND_ENVAR string = "EMBEDDING_BACKEND"
+const EMBEDDING_BACKEND_ZMQ string = "zmq"
+const EMBEDDING_BACKEND_HTTP string = "http"
+const EMBEDDING_BACKEND_GRPC string = "grpc"
+const DEFAULT_EMBEDDING_BACKEND string = EMBEDDING_BACKEND_ZMQ
+
+// Settings of the http embedding backend
+const HTTP_EMBEDDING_URL_ENVAR string = "HTTP_EMBEDDING_URL"
+const HTTP_EMBEDDING_PROTOCOL_ENVAR string = "HTTP_EMBEDDING_PROTOCOL"
+const HTTP_EMBEDDING_MODEL_ENVAR string = "HTTP_EMBEDDING_MODEL"
+const HTTP_EMBEDDING_API_KEY_ENVAR string = "HTTP_EMBEDDING_API_KEY"
+const HTTP_EMBEDDING_TIMEOUT_ENVAR string = "HTTP_EMBEDDING_TIMEOUT"
+const DEFAULT_HTTP_EMBEDDING_TIMEOUT time.Duration = 30 * time.Second
+
+// An OpenAI compatible /v1/embeddings endpoint. Images are sent as {"image": <base64>} input objects,
+// which the server has to support, since OpenAI's own models only embed texts
+const HTTP_EMBEDDING_PROTOCOL_OPENAI string = "openai"
+
+// The JSend responses of the zmq daemons, with text and raw images posted to <url>/text and <url>/image
+const HTTP_EMBEDDING_PROTOCOL_JSEND string = "jsend"
+const DEFAULT_HTTP_EMBEDDING_PROTOCOL string = HTTP_EMBEDDING_PROTOCOL_JSEND
+
+// Settings of the grpc embedding backend, see embeddingpb/embedding.proto
+const GRPC_EMBEDDING_ADDRESS_ENVAR string = "GRPC_EMBEDDING_ADDRESS"
+const GRPC_EMBEDDING_TIMEOUT_ENVAR string = "GRPC_EMBEDDING_TIMEOUT"
+const DEFAULT_GRPC_EMBEDDING_TIMEOUT time.Duration = 30 * time.Second
+
+// Settings of the background job re-embedding all images with a new model, see config.ReembeddingConfig
+const REEMBEDDING_ENABLED_ENVAR string = "REEMBEDDING_ENABLED"
+const REEMBEDDING_BATCH_SIZE_ENVAR string = "REEMBEDDING_BATCH_SIZE"
+const DEFAULT_REEMBEDDING_BATCH_SIZE int = 32
+const REEMBEDDING_RETRY_INTERVAL_ENVAR string = "REEMBEDDING_RETRY_INTERVAL"
+const DEFAULT_REEMBEDDING_RETRY_INTERVAL time.Duration = 5 * time.Minute
+
+// What happens to the images that can never be re-embedded, like the ones whose source url is gone
+const REEMBEDDING_PERMANENT_FAILURES_ENVAR string = "REEMBEDDING_PERMANENT_FAILURES"
+
+// The cut-over (or the backfill) waits until they are deleted. The ones that were added without keeping
+// their original, archive entries and video frames without a blob store, are kept instead
+const REEMBEDDING_PERMANENT_FAILURES_BLOCK string = "block"
+
+// They are kept without an embedding from the new model, so searches with it don't find them
+const REEMBEDDING_PERMANENT_FAILURES_KEEP string = "keep"
+
+// They are deleted along with their original
+const REEMBEDDING_PERMANENT_FAILURES_DELETE string = "delete"
+const DEFAULT_REEMBEDDING_PERMANENT_FAILURES string = REEMBEDDING_PERMANENT_FAILURES_BLOCK
+
+// Settings of the background job checking that the urls of the images still work, see config.LinkCheckConfig
+const LINK_CHECK_ENABLED_ENVAR string = "LINK_CHECK_ENABLED"
+const LINK_CHECK_INTERVAL_ENVAR string = "LINK_CHECK_INTERVAL"
+const DEFAULT_LINK_CHECK_INTERVAL time.Duration = 24 * time.Hour
+const LINK_CHECK_BATCH_SIZE_ENVAR string = "LINK_CHECK_BATCH_SIZE"
+const DEFAULT_LINK_CHECK_BATCH_SIZE int = 32
+const LINK_CHECK_TIMEOUT_ENVAR string = "LINK_CHECK_TIMEOUT"
+const DEFAULT_LINK_CHECK_TIMEOUT time.Duration = 30 * time.Second
+const LINK_CHECK_VERIFY_SHA256_ENVAR string = "LINK_CHECK_VERIFY_SHA256"
+const LINK_CHECK_HIDE_DEAD_ENVAR string = "LINK_CHECK_HIDE_DEAD"
+
+// 0 keeps dead images
+const LINK_CHECK_PURGE_AFTER_FAILURES_ENVAR string = "LINK_CHECK_PURGE_AFTER_FAILURES"
+
+// Settings of the directory watcher, see config.WatchConfig
+const WATCH_ENABLED_ENVAR string = "WATCH_ENABLED"
+
+// Comma separated directories, replacing the ones of the config file. Their images are stored with file:// urls
+const WATCH_DIRECTORIES_ENVAR string = "WATCH_DIRECTORIES"
+const WATCH_POLL_ENVAR string = "WATCH_POLL"
+const WATCH_POLL_INTERVAL_ENVAR string = "WATCH_POLL_INTERVAL"
+const DEFAULT_WATCH_POLL_INTERVAL time.Duration = 30 * time.Second
+const WATCH_SETTLE_DELAY_ENVAR string = "WATCH_SETTLE_DELAY"
+const DEFAULT_WATCH_SETTLE_DELAY time.Duration = 2 * time.Second
+
+// Settings of the crawl command, see config.CrawlConfig. The lists are comma separated
+const CRAWL_SEEDS_ENVAR string = "CRAWL_SEEDS"
+const CRAWL_ALLOWED_DOMAINS_ENVAR string = "CRAWL_ALLOWED_DOMAINS"
+const CRAWL_MAX_DEPTH_ENVAR string = "CRAWL_MAX_DEPTH"
+const DEFAULT_CRAWL_MAX_DEPTH int = 2
+const CRAWL_MAX_PAGES_ENVAR string = "CRAWL_MAX_PAGES"
+const DEFAULT_CRAWL_MAX_PAGES int = 1000
+const CRAWL_HOST_INTERVAL_ENVAR string = "CRAWL_HOST_INTERVAL"
+const DEFAULT_CRAWL_HOST_INTERVAL time.Duration = time.Second
+const CRAWL_TIMEOUT_ENVAR string = "CRAWL_TIMEOUT"
+const DEFAULT_CRAWL_TIMEOUT time.Duration = 30 * time.Second
+
+// Limits of the archive imports, see config.ArchiveConfig. Sizes are in bytes
+const ARCHIVE_MAX_SIZE_ENVAR string = "ARCHIVE_MAX_SIZE"
+const DEFAULT_ARCHIVE_MAX_SIZE int = 1024 * 1024 * 1024
+const ARCHIVE_MAX_TOTAL_SIZE_ENVAR string = "ARCHIVE_MAX_TOTAL_SIZE"
+const DEFAULT_ARCHIVE_MAX_TOTAL_SIZE int = 4 * 1024 * 1024 * 1024
+const ARCHIVE_MAX_ENTRIES_ENVAR string = "ARCHIVE_MAX_ENTRIES"
+const DEFAULT_ARCHIVE_MAX_ENTRIES int = 100000
+const ARCHIVE_IMPORT_TIMEOUT_ENVAR string = "ARCHIVE_IMPORT_TIMEOUT"
+const DEFAULT_ARCHIVE_IMPORT_TIMEOUT time.Duration = time.Hour
+
+// Video ingestion, see config.VideoConfig
+const VIDEO_FFMPEG_PATH_ENVAR string = "VIDEO_FFMPEG_PATH"
+const DEFAULT_VIDEO_FFMPEG_PATH string = "ffmpeg"
+const VIDEO_MAX_FILE_SIZE_ENVAR string = "VIDEO_MAX_FILE_SIZE"
+const DEFAULT_VIDEO_MAX_FILE_SIZE int = 1024 * 1024 * 1024
+const VIDEO_FRAME_MODE_ENVAR string = "VIDEO_FRAME_MODE"
+const VIDEO_FRAME_MODE_INTERVAL string = "interval"
+const VIDEO_FRAME_MODE_SCENE string = "scene"
+const DEFAULT_VIDEO_FRAME_MODE string = VIDEO_FRAME_MODE_INTERVAL
+const VIDEO_FRAME_INTERVAL_ENVAR string = "VIDEO_FRAME_INTERVAL"
+const DEFAULT_VIDEO_FRAME_INTERVAL time.Duration = 5 * time.Second
+const VIDEO_SCENE_THRESHOLD_ENVAR string = "VIDEO_SCENE_THRESHOLD"
+const DEFAULT_VIDEO_SCENE_THRESHOLD float64 = 0.3
+const VIDEO_MAX_FRAMES_ENVAR string = "VIDEO_MAX_FRAMES"
+const DEFAULT_VIDEO_MAX_FRAMES int = 500
+const VIDEO_TIMEOUT_ENVAR string = "VIDEO_TIMEOUT"
+const DEFAULT_VIDEO_TIMEOUT time.Duration = 30 * time.Minute
+
+// Where the downloaded originals of the images are kept, see config.BlobStoreConfig
+const BLOB_STORE_BACKEND_ENVAR string = "BLOB_STORE_BACKEND"
+const BLOB_STORE_BACKEND_NONE string = "none"
+const BLOB_STORE_BACKEND_LOCAL string = "local"
+const BLOB_STORE_BACKEND_S3 string = "s3"
+const DEFAULT_BLOB_STORE_BACKEND string = BLOB_STORE_BACKEND_NONE
+const BLOB_STORE_DIRECTORY_ENVAR string = "BLOB_STORE_DIRECTORY"
+const DEFAULT_BLOB_STORE_DIRECTORY string = "originals"
+
+// Settings of the s3 blob store. Any S3 compatible server works, e.g. MinIO
+const S3_ENDPOINT_ENVAR string = "S3_ENDPOINT"
+const S3_BUCKET_ENVAR string = "S3_BUCKET"
+const S3_REGION_ENVAR string = "S3_REGION"
+const DEFAULT_S3_REGION string = "us-east-1"
+const S3_ACCESS_KEY_ID_ENVAR string = "S3_ACCESS_KEY_ID"
+const S3_SECRET_ACCESS_KEY_ENVAR string = "S3_SECRET_ACCESS_KEY"
+const S3_TIMEOUT_ENVAR string = "S3_TIMEOUT"
+const DEFAULT_S3_TIMEOUT time.Duration = 30 * time.Second
+
+// How many candidates are fetched per returned image when re-ranking search results for diversity
+const MMR_CANDIDATE_MULTIPLIER int = 4
+const MMR_MAX_CANDIDATES int = 1000
+
+// How long a single dependency check of the readiness probe may take
+const READINESS_CHECK_TIMEOUT_ENVAR string = "READINESS_CHECK_TIMEOUT"
+const DEFAULT_READINESS_CHECK_TIMEOUT time.Duration = 5 * time.Second
+
+// How long handling a request may take before it's cancelled, parsed with time.ParseDuration
+const REQUEST_TIMEOUT_ENVAR string = "REQUEST_TIMEOUT"
+const DEFAULT_REQUEST_TIMEOUT time.Duration = 30 * time.Second
+const SEARCH_TIMEOUT_ENVAR string = "SEARCH_TIMEOUT"
+const DEFAULT_SEARCH_TIMEOUT time.Duration = 10 * time.Second
+
+// Adding an image includes downloading it, so it gets a longer timeout
+const INGEST_TIMEOUT_ENVAR string = "INGEST_TIMEOUT"
+const DEFAULT_INGEST_TIMEOUT time.Duration = 60 * time.Second
+
+// How long in-flight requests and background jobs may take to finish after SIGINT/SIGTERM
+const SHUTDOWN_TIMEOUT_ENVAR string = "SHUTDOWN_TIMEOUT"
+const DEFAULT_SHUTDOWN_TIMEOUT time.Duration = 30 * time.Second
+
+// How long a client may take to send the request headers
+const READ_HEADER_TIMEOUT_ENVAR string = "READ_HEADER_TIMEOUT"
+const DEFAULT_READ_HEADER_TIMEOUT time.Duration = 10 * time.Second
@@ -0,0 +1,664 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server           ServerConfig        `yaml:"server"`
+	Database         DatabaseConfig      `yaml:"database"`
+	EmbeddingBackend string              `yaml:"embeddingBackend" validate:"oneof=zmq http grpc"`
+	Daemons          DaemonsConfig       `yaml:"embeddingDaemons"`
+	HttpEmbedding    HttpEmbeddingConfig `yaml:"httpEmbedding"`
+	GrpcEmbedding    GrpcEmbeddingConfig `yaml:"grpcEmbedding"`
+	// Models embedding every image next to the default one, keyed by the model name their backend reports.
+	// Searches can pick one of them by name
+	EmbeddingModels map[string]EmbeddingConfig `yaml:"embeddingModels" validate:"dive"`
+	Images          ImagesConfig               `yaml:"images"`
+	BlobStore       BlobStoreConfig            `yaml:"blobStore"`
+	Reembedding     ReembeddingConfig          `yaml:"reembedding"`
+	LinkCheck       LinkCheckConfig            `yaml:"linkCheck"`
+	Watch           WatchConfig                `yaml:"watch"`
+	Crawl           CrawlConfig                `yaml:"crawl"`
+	Archives        ArchiveConfig              `yaml:"archives"`
+	Videos          VideoConfig                `yaml:"videos"`
+	LogLevel        string                     `yaml:"logLevel" validate:"oneof=debug info warn error"`
+}
+
+// The settings of the embedding backend
+func (cfg Config) Embedding() EmbeddingConfig {
+	return EmbeddingConfig{
+		Backend:       cfg.EmbeddingBackend,
+		Daemons:       cfg.Daemons,
+		HttpEmbedding: cfg.HttpEmbedding,
+		GrpcEmbedding: cfg.GrpcEmbedding,
+	}
+}
+
+type ServerConfig struct {
+	Port                  int           `yaml:"port" validate:"min=1,max=65535"`
+	ReadHeaderTimeout     time.Duration `yaml:"readHeaderTimeout" validate:"gt=0"`
+	RequestTimeout        time.Duration `yaml:"requestTimeout" validate:"gt=0"`
+	SearchTimeout         time.Duration `yaml:"searchTimeout" validate:"gt=0"`
+	IngestTimeout         time.Duration `yaml:"ingestTimeout" validate:"gt=0"`
+	ShutdownTimeout       time.Duration `yaml:"shutdownTimeout" validate:"gt=0"`
+	ReadinessCheckTimeout time.Duration `yaml:"readinessCheckTimeout" validate:"gt=0"`
+}
+
+type DatabaseConfig struct {
+	Url      string `yaml:"url" validate:"required"`
+	MaxConns int32  `yaml:"maxConns" validate:"min=0"`
+	MinConns int32  `yaml:"minConns" validate:"min=0"`
+}
+
+type DaemonConfig struct {
+	Host string `yaml:"host" validate:"required"`
+	Port int    `yaml:"port" validate:"min=1,max=65535"`
+	// Daemons to balance requests across, as host:port. Replaces host and port when not empty
+	Endpoints []string `yaml:"endpoints" validate:"dive,hostname_port"`
+}
+
+// The zmq endpoints of the daemons
+func (d DaemonConfig) ZmqEndpoints() []string {
+	if len(d.Endpoints) == 0 {
+		return []string{"tcp://" + net.JoinHostPort(d.Host, strconv.Itoa(d.Port))}
+	}
+	endpoints := make([]string, len(d.Endpoints))
+	for i, endpoint := range d.Endpoints {
+		endpoints[i] = "tcp://" + endpoint
+	}
+	return endpoints
+}
+
+type DaemonsConfig struct {
+	Image   DaemonConfig  `yaml:"image"`
+	Text    DaemonConfig  `yaml:"text"`
+	Timeout time.Duration `yaml:"timeout" validate:"gt=0"`
+	// How often endpoints that timed out are probed to see if they can be used again
+	ProbeInterval time.Duration `yaml:"probeInterval" validate:"gt=0"`
+}
+
+type HttpEmbeddingConfig struct {
+	Url      string        `yaml:"url" validate:"omitempty,url"`
+	Protocol string        `yaml:"protocol" validate:"oneof=openai jsend"`
+	Model    string        `yaml:"model"`
+	ApiKey   string        `yaml:"apiKey"`
+	Timeout  time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+type GrpcEmbeddingConfig struct {
+	// host:port of the daemon, connected to without TLS
+	Address string        `yaml:"address" validate:"omitempty,hostname_port"`
+	Timeout time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+// Which ClipService computes embeddings, and the settings of each implementation
+type EmbeddingConfig struct {
+	Backend       string              `yaml:"embeddingBackend" validate:"oneof=zmq http grpc"`
+	Daemons       DaemonsConfig       `yaml:"embeddingDaemons"`
+	HttpEmbedding HttpEmbeddingConfig `yaml:"httpEmbedding"`
+	GrpcEmbedding GrpcEmbeddingConfig `yaml:"grpcEmbedding"`
+}
+
+// The background job re-embedding all images with the model of another backend
+type ReembeddingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// How many images are re-embedded between two checks for shutdown
+	BatchSize int `yaml:"batchSize" validate:"gt=0"`
+	// How long to wait before another pass when images failed or the target backend is unreachable
+	RetryInterval time.Duration `yaml:"retryInterval" validate:"gt=0"`
+	// What happens to the images that can never be re-embedded, see REEMBEDDING_PERMANENT_FAILURES_BLOCK and the others
+	PermanentFailures string `yaml:"permanentFailures" validate:"oneof=block keep delete"`
+	// The backend running the new model. Searches switch to it once all images are re-embedded
+	Target EmbeddingConfig `yaml:"target"`
+}
+
+// The background job checking that the urls of the images still work
+type LinkCheckConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// How long the result of a check is trusted. A pass over the images that are due runs this often
+	Interval  time.Duration `yaml:"interval" validate:"gt=0"`
+	BatchSize int           `yaml:"batchSize" validate:"gt=0"`
+	// How long checking a single url may take
+	Timeout time.Duration `yaml:"timeout" validate:"gt=0"`
+	// Downloads the source of every image to compare its sha256 hash, instead of only checking that it loads
+	VerifySha256 bool `yaml:"verifySha256"`
+	// Leaves dead images out of listings and searches
+	HideDead bool `yaml:"hideDead"`
+	// Deletes images whose urls failed this many checks in a row. 0 keeps them
+	PurgeAfterFailures int `yaml:"purgeAfterFailures" validate:"min=0"`
+}
+
+// Local directories whose image files are added, updated and deleted along with the files
+type WatchConfig struct {
+	// Runs the watcher next to the server. The watch command runs it on its own
+	Enabled     bool                   `yaml:"enabled"`
+	Directories []WatchDirectoryConfig `yaml:"directories" validate:"dive"`
+	// Scans the directories every poll interval instead of listening for file events, for file systems without
+	// inotify like network shares. The watcher also polls if listening fails
+	Poll         bool          `yaml:"poll"`
+	PollInterval time.Duration `yaml:"pollInterval" validate:"gt=0"`
+	// How long a file has to stay unchanged before it's added, so files that are still being copied are skipped
+	SettleDelay time.Duration `yaml:"settleDelay" validate:"gt=0"`
+}
+
+type WatchDirectoryConfig struct {
+	Path string `yaml:"path" validate:"required"`
+	// Url the files of the directory are served at, their urls are the paths relative to it.
+	// The images are stored with file:// urls if it's empty
+	BaseUrl string `yaml:"baseUrl" validate:"omitempty,url"`
+}
+
+// The crawl command, adding the images of web pages and of the pages they link to
+type CrawlConfig struct {
+	// The pages the crawl starts from. The urls passed to the crawl command replace them
+	Seeds []string `yaml:"seeds" validate:"dive,http_url"`
+	// Links are only followed to these domains and their subdomains. Defaults to the domains of the seeds.
+	// Images are added from any domain
+	AllowedDomains []string `yaml:"allowedDomains" validate:"dive,hostname"`
+	// How many links away from the seeds pages are still crawled. 0 only crawls the seeds
+	MaxDepth int `yaml:"maxDepth" validate:"min=0"`
+	// How many pages a crawl visits at most
+	MaxPages int `yaml:"maxPages" validate:"gt=0"`
+	// How long to wait between two requests to the same host, raised by the Crawl-delay of its robots.txt
+	HostInterval time.Duration `yaml:"hostInterval" validate:"min=0"`
+	// How long loading a single page or image may take
+	Timeout time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+// Importing zip and tar archives of image files through the API and the import command.
+// The image files are also limited to images.maxFileSize each
+type ArchiveConfig struct {
+	// The largest archive accepted
+	MaxSize int `yaml:"maxSize" validate:"gt=0"`
+	// How much the image files of an archive may unpack to in total, also bounding what a gzipped tar unpacks to
+	MaxTotalSize int `yaml:"maxTotalSize" validate:"gt=0"`
+	MaxEntries   int `yaml:"maxEntries" validate:"gt=0"`
+	// How long an import through the API may take
+	Timeout time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+// Adding videos, whose frames are embedded like images
+type VideoConfig struct {
+	// The ffmpeg binary extracting the frames, looked up in PATH unless it's a path
+	FfmpegPath  string `yaml:"ffmpegPath" validate:"required"`
+	MaxFileSize int    `yaml:"maxFileSize" validate:"gt=0"`
+	// Which frames are embedded: one every frameInterval, or the ones that differ from the previous frame by more
+	// than sceneThreshold (between 0 and 1). The first frame always is
+	FrameMode      string        `yaml:"frameMode" validate:"oneof=interval scene"`
+	FrameInterval  time.Duration `yaml:"frameInterval" validate:"gt=0"`
+	SceneThreshold float64       `yaml:"sceneThreshold" validate:"gt=0,lt=1"`
+	// How many frames of a video are embedded at most
+	MaxFrames int `yaml:"maxFrames" validate:"gt=0"`
+	// How long adding a video may take, including the download
+	Timeout time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+// Where the downloaded originals of the images are kept, keyed by their sha256 hash
+type BlobStoreConfig struct {
+	Backend string `yaml:"backend" validate:"oneof=none local s3"`
+	// Directory of the local backend, created if it doesn't exist
+	Directory string       `yaml:"directory"`
+	S3        S3BlobConfig `yaml:"s3"`
+}
+
+type S3BlobConfig struct {
+	// Url of the S3 compatible server, e.g. https://s3.us-east-1.amazonaws.com or http://localhost:9000.
+	// Buckets are addressed by path
+	Endpoint        string        `yaml:"endpoint" validate:"omitempty,url"`
+	Bucket          string        `yaml:"bucket"`
+	Region          string        `yaml:"region" validate:"required"`
+	AccessKeyId     string        `yaml:"accessKeyId"`
+	SecretAccessKey string        `yaml:"secretAccessKey"`
+	Timeout         time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+type ImagesConfig struct {
+	MaxFileSize       int    `yaml:"maxFileSize" validate:"gt=0"`
+	DownloadUserAgent string `yaml:"downloadUserAgent" validate:"required"`
+	// How many frames of animated GIF, APNG and WebP images are embedded, spread from the first to the last.
+	// 0 embeds animations like still images
+	AnimationFrames int `yaml:"animationFrames" validate:"min=0"`
+	// average stores the normalized average of the frame embeddings. frames stores the frame embeddings too,
+	// so searches match an animation by its closest frame
+	AnimationEmbedding string `yaml:"animationEmbedding" validate:"oneof=average frames"`
+}
+
+// The max file size in whole megabytes, for error messages
+func (c ImagesConfig) MaxFileSizeMB() int {
+	return c.MaxFileSize / 1024 / 1024
+}
+
+// The max file size in whole megabytes, for error messages
+func (c VideoConfig) MaxFileSizeMB() int {
+	return c.MaxFileSize / 1024 / 1024
+}
+
+type ConfigError struct {
+	FieldErrors map[string]string
+}
+
+func (e ConfigError) Error() string {
+	var fields []string
+	for field, message := range e.FieldErrors {
+		fields = append(fields, fmt.Sprintf("%s: %s", field, message))
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("Invalid config: %s", strings.Join(fields, ", "))
+}
+
+// Returns the config used when neither the config file nor the envars set a value
+func Default() Config {
+	cfg := Config{
+		Server: ServerConfig{
+			Port:                  DEFAULT_PORT,
+			ReadHeaderTimeout:     DEFAULT_READ_HEADER_TIMEOUT,
+			RequestTimeout:        DEFAULT_REQUEST_TIMEOUT,
+			SearchTimeout:         DEFAULT_SEARCH_TIMEOUT,
+			IngestTimeout:         DEFAULT_INGEST_TIMEOUT,
+			ShutdownTimeout:       DEFAULT_SHUTDOWN_TIMEOUT,
+			ReadinessCheckTimeout: DEFAULT_READINESS_CHECK_TIMEOUT,
+		},
+		Daemons: DaemonsConfig{
+			Image: DaemonConfig{
+				Host: ZMQ_EMBEDDING_DAEMON_DEFAULT_HOST,
+				Port: ZMQ_IMAGE_EMBEDDING_DAEMON_DEFAULT_PORT,
+			},
+			Text: DaemonConfig{
+				Host: ZMQ_EMBEDDING_DAEMON_DEFAULT_HOST,
+				Port: ZMQ_TEXT_EMBEDDING_DAEMON_DEFAULT_PORT,
+			},
+			Timeout:       DEFAULT_ZMQ_TIMEOUT,
+			ProbeInterval: DEFAULT_ZMQ_PROBE_INTERVAL,
+		},
+		EmbeddingBackend: DEFAULT_EMBEDDING_BACKEND,
+		HttpEmbedding: HttpEmbeddingConfig{
+			Protocol: DEFAULT_HTTP_EMBEDDING_PROTOCOL,
+			Timeout:  DEFAULT_HTTP_EMBEDDING_TIMEOUT,
+		},
+		GrpcEmbedding: GrpcEmbeddingConfig{
+			Timeout: DEFAULT_GRPC_EMBEDDING_TIMEOUT,
+		},
+		Images: ImagesConfig{
+			MaxFileSize:        DEFAULT_MAX_IMAGE_FILE_SIZE,
+			DownloadUserAgent:  DEFAULT_FILE_DOWNLOAD_USERAGENT,
+			AnimationFrames:    DEFAULT_ANIMATION_FRAMES,
+			AnimationEmbedding: DEFAULT_ANIMATION_EMBEDDING,
+		},
+		BlobStore: BlobStoreConfig{
+			Backend:   DEFAULT_BLOB_STORE_BACKEND,
+			Directory: DEFAULT_BLOB_STORE_DIRECTORY,
+			S3: S3BlobConfig{
+				Region:  DEFAULT_S3_REGION,
+				Timeout: DEFAULT_S3_TIMEOUT,
+			},
+		},
+		LinkCheck: LinkCheckConfig{
+			Interval:  DEFAULT_LINK_CHECK_INTERVAL,
+			BatchSize: DEFAULT_LINK_CHECK_BATCH_SIZE,
+			Timeout:   DEFAULT_LINK_CHECK_TIMEOUT,
+		},
+		Watch: WatchConfig{
+			PollInterval: DEFAULT_WATCH_POLL_INTERVAL,
+			SettleDelay:  DEFAULT_WATCH_SETTLE_DELAY,
+		},
+		Crawl: CrawlConfig{
+			MaxDepth:     DEFAULT_CRAWL_MAX_DEPTH,
+			MaxPages:     DEFAULT_CRAWL_MAX_PAGES,
+			HostInterval: DEFAULT_CRAWL_HOST_INTERVAL,
+			Timeout:      DEFAULT_CRAWL_TIMEOUT,
+		},
+		Archives: ArchiveConfig{
+			MaxSize:      DEFAULT_ARCHIVE_MAX_SIZE,
+			MaxTotalSize: DEFAULT_ARCHIVE_MAX_TOTAL_SIZE,
+			MaxEntries:   DEFAULT_ARCHIVE_MAX_ENTRIES,
+			Timeout:      DEFAULT_ARCHIVE_IMPORT_TIMEOUT,
+		},
+		Videos: VideoConfig{
+			FfmpegPath:     DEFAULT_VIDEO_FFMPEG_PATH,
+			MaxFileSize:    DEFAULT_VIDEO_MAX_FILE_SIZE,
+			FrameMode:      DEFAULT_VIDEO_FRAME_MODE,
+			FrameInterval:  DEFAULT_VIDEO_FRAME_INTERVAL,
+			SceneThreshold: DEFAULT_VIDEO_SCENE_THRESHOLD,
+			MaxFrames:      DEFAULT_VIDEO_MAX_FRAMES,
+			Timeout:        DEFAULT_VIDEO_TIMEOUT,
+		},
+		LogLevel: DEFAULT_LOG_LEVEL,
+	}
+	cfg.Reembedding = ReembeddingConfig{
+		BatchSize:         DEFAULT_REEMBEDDING_BATCH_SIZE,
+		RetryInterval:     DEFAULT_REEMBEDDING_RETRY_INTERVAL,
+		PermanentFailures: DEFAULT_REEMBEDDING_PERMANENT_FAILURES,
+		Target:            cfg.Embedding(),
+	}
+	return cfg
+}
+
+// Fills in the fields of an embedding config that the config file left unset with the defaults
+func (e EmbeddingConfig) withDefaults() EmbeddingConfig {
+	defaults := Default().Embedding()
+	setString := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	setInt := func(field *int, value int) {
+		if *field == 0 {
+			*field = value
+		}
+	}
+	setDuration := func(field *time.Duration, value time.Duration) {
+		if *field == 0 {
+			*field = value
+		}
+	}
+	setString(&e.Backend, defaults.Backend)
+	setString(&e.Daemons.Image.Host, defaults.Daemons.Image.Host)
+	setInt(&e.Daemons.Image.Port, defaults.Daemons.Image.Port)
+	setString(&e.Daemons.Text.Host, defaults.Daemons.Text.Host)
+	setInt(&e.Daemons.Text.Port, defaults.Daemons.Text.Port)
+	setDuration(&e.Daemons.Timeout, defaults.Daemons.Timeout)
+	setDuration(&e.Daemons.ProbeInterval, defaults.Daemons.ProbeInterval)
+	setString(&e.HttpEmbedding.Protocol, defaults.HttpEmbedding.Protocol)
+	setDuration(&e.HttpEmbedding.Timeout, defaults.HttpEmbedding.Timeout)
+	setDuration(&e.GrpcEmbedding.Timeout, defaults.GrpcEmbedding.Timeout)
+	return e
+}
+
+// Loads the config from the defaults, then the YAML file at path if it's not empty, then the envars
+// The result is validated
+func Load(path string, lookupEnv func(string) (string, bool)) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return cfg, err
+		}
+		defer file.Close()
+
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && err != io.EOF {
+			return cfg, fmt.Errorf("Failed to parse config file %s: %w", path, err)
+		}
+		// The entries are decoded into zero values rather than the defaults
+		for name, embedding := range cfg.EmbeddingModels {
+			cfg.EmbeddingModels[name] = embedding.withDefaults()
+		}
+	}
+
+	if err := applyEnvOverrides(&cfg, lookupEnv); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func applyEnvOverrides(cfg *Config, lookupEnv func(string) (string, bool)) error {
+	fieldErrors := make(map[string]string)
+
+	overrideString := func(envar string, field *string) {
+		if value, ok := lookupEnv(envar); ok && value != "" {
+			*field = value
+		}
+	}
+	overrideInt := func(envar string, field *int) {
+		if value, ok := lookupEnv(envar); ok && value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				fieldErrors[envar] = "Not a valid integer"
+				return
+			}
+			*field = parsed
+		}
+	}
+	overrideFloat64 := func(envar string, field *float64) {
+		if value, ok := lookupEnv(envar); ok && value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				fieldErrors[envar] = "Not a valid number"
+				return
+			}
+			*field = parsed
+		}
+	}
+	overrideInt32 := func(envar string, field *int32) {
+		if value, ok := lookupEnv(envar); ok && value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				fieldErrors[envar] = "Not a valid integer"
+				return
+			}
+			*field = int32(parsed)
+		}
+	}
+	overrideList := func(envar string, field *[]string) {
+		if value, ok := lookupEnv(envar); ok && value != "" {
+			*field = strings.Split(value, ",")
+		}
+	}
+	overrideBool := func(envar string, field *bool) {
+		if value, ok := lookupEnv(envar); ok && value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				fieldErrors[envar] = "Not a valid boolean"
+				return
+			}
+			*field = parsed
+		}
+	}
+	overrideDuration := func(envar string, field *time.Duration) {
+		if value, ok := lookupEnv(envar); ok && value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				fieldErrors[envar] = "Not a valid duration"
+				return
+			}
+			*field = parsed
+		}
+	}
+
+	overrideInt(PORT_ENVAR, &cfg.Server.Port)
+	overrideDuration(READ_HEADER_TIMEOUT_ENVAR, &cfg.Server.ReadHeaderTimeout)
+	overrideDuration(REQUEST_TIMEOUT_ENVAR, &cfg.Server.RequestTimeout)
+	overrideDuration(SEARCH_TIMEOUT_ENVAR, &cfg.Server.SearchTimeout)
+	overrideDuration(INGEST_TIMEOUT_ENVAR, &cfg.Server.IngestTimeout)
+	overrideDuration(SHUTDOWN_TIMEOUT_ENVAR, &cfg.Server.ShutdownTimeout)
+	overrideDuration(READINESS_CHECK_TIMEOUT_ENVAR, &cfg.Server.ReadinessCheckTimeout)
+
+	overrideString(PG_DATABASE_CONNECTION_URL_ENVAR, &cfg.Database.Url)
+	overrideInt32(PG_MAX_CONNS_ENVAR, &cfg.Database.MaxConns)
+	overrideInt32(PG_MIN_CONNS_ENVAR, &cfg.Database.MinConns)
+
+	overrideString(ZMQ_IMAGE_EMBEDDING_DAEMON_HOST_ENVAR, &cfg.Daemons.Image.Host)
+	overrideInt(ZMQ_IMAGE_EMBEDDING_DAEMON_PORT_ENVAR, &cfg.Daemons.Image.Port)
+	overrideList(ZMQ_IMAGE_EMBEDDING_DAEMON_ENDPOINTS_ENVAR, &cfg.Daemons.Image.Endpoints)
+	overrideString(ZMQ_TEXT_EMBEDDING_DAEMON_HOST_ENVAR, &cfg.Daemons.Text.Host)
+	overrideInt(ZMQ_TEXT_EMBEDDING_DAEMON_PORT_ENVAR, &cfg.Daemons.Text.Port)
+	overrideList(ZMQ_TEXT_EMBEDDING_DAEMON_ENDPOINTS_ENVAR, &cfg.Daemons.Text.Endpoints)
+	overrideDuration(ZMQ_TIMEOUT_ENVAR, &cfg.Daemons.Timeout)
+	overrideDuration(ZMQ_PROBE_INTERVAL_ENVAR, &cfg.Daemons.ProbeInterval)
+
+	overrideString(EMBEDDING_BACKEND_ENVAR, &cfg.EmbeddingBackend)
+	overrideString(HTTP_EMBEDDING_URL_ENVAR, &cfg.HttpEmbedding.Url)
+	overrideString(HTTP_EMBEDDING_PROTOCOL_ENVAR, &cfg.HttpEmbedding.Protocol)
+	overrideString(HTTP_EMBEDDING_MODEL_ENVAR, &cfg.HttpEmbedding.Model)
+	overrideString(HTTP_EMBEDDING_API_KEY_ENVAR, &cfg.HttpEmbedding.ApiKey)
+	overrideDuration(HTTP_EMBEDDING_TIMEOUT_ENVAR, &cfg.HttpEmbedding.Timeout)
+	overrideString(GRPC_EMBEDDING_ADDRESS_ENVAR, &cfg.GrpcEmbedding.Address)
+	overrideDuration(GRPC_EMBEDDING_TIMEOUT_ENVAR, &cfg.GrpcEmbedding.Timeout)
+
+	overrideInt(MAX_IMAGE_FILE_SIZE_ENVAR, &cfg.Images.MaxFileSize)
+	overrideString(FILE_DOWNLOAD_USERAGENT_ENVAR, &cfg.Images.DownloadUserAgent)
+	overrideInt(ANIMATION_FRAMES_ENVAR, &cfg.Images.AnimationFrames)
+	overrideString(ANIMATION_EMBEDDING_ENVAR, &cfg.Images.AnimationEmbedding)
+
+	overrideString(BLOB_STORE_BACKEND_ENVAR, &cfg.BlobStore.Backend)
+	overrideString(BLOB_STORE_DIRECTORY_ENVAR, &cfg.BlobStore.Directory)
+	overrideString(S3_ENDPOINT_ENVAR, &cfg.BlobStore.S3.Endpoint)
+	overrideString(S3_BUCKET_ENVAR, &cfg.BlobStore.S3.Bucket)
+	overrideString(S3_REGION_ENVAR, &cfg.BlobStore.S3.Region)
+	overrideString(S3_ACCESS_KEY_ID_ENVAR, &cfg.BlobStore.S3.AccessKeyId)
+	overrideString(S3_SECRET_ACCESS_KEY_ENVAR, &cfg.BlobStore.S3.SecretAccessKey)
+	overrideDuration(S3_TIMEOUT_ENVAR, &cfg.BlobStore.S3.Timeout)
+
+	overrideBool(REEMBEDDING_ENABLED_ENVAR, &cfg.Reembedding.Enabled)
+	overrideInt(REEMBEDDING_BATCH_SIZE_ENVAR, &cfg.Reembedding.BatchSize)
+	overrideDuration(REEMBEDDING_RETRY_INTERVAL_ENVAR, &cfg.Reembedding.RetryInterval)
+	overrideString(REEMBEDDING_PERMANENT_FAILURES_ENVAR, &cfg.Reembedding.PermanentFailures)
+
+	overrideBool(LINK_CHECK_ENABLED_ENVAR, &cfg.LinkCheck.Enabled)
+	overrideDuration(LINK_CHECK_INTERVAL_ENVAR, &cfg.LinkCheck.Interval)
+	overrideInt(LINK_CHECK_BATCH_SIZE_ENVAR, &cfg.LinkCheck.BatchSize)
+	overrideDuration(LINK_CHECK_TIMEOUT_ENVAR, &cfg.LinkCheck.Timeout)
+	overrideBool(LINK_CHECK_VERIFY_SHA256_ENVAR, &cfg.LinkCheck.VerifySha256)
+	overrideBool(LINK_CHECK_HIDE_DEAD_ENVAR, &cfg.LinkCheck.HideDead)
+	overrideInt(LINK_CHECK_PURGE_AFTER_FAILURES_ENVAR, &cfg.LinkCheck.PurgeAfterFailures)
+
+	var watchPaths []string
+	overrideList(WATCH_DIRECTORIES_ENVAR, &watchPaths)
+	if watchPaths != nil {
+		cfg.Watch.Directories = make([]WatchDirectoryConfig, len(watchPaths))
+		for i, path := range watchPaths {
+			cfg.Watch.Directories[i] = WatchDirectoryConfig{Path: path}
+		}
+	}
+	overrideBool(WATCH_ENABLED_ENVAR, &cfg.Watch.Enabled)
+	overrideBool(WATCH_POLL_ENVAR, &cfg.Watch.Poll)
+	overrideDuration(WATCH_POLL_INTERVAL_ENVAR, &cfg.Watch.PollInterval)
+	overrideDuration(WATCH_SETTLE_DELAY_ENVAR, &cfg.Watch.SettleDelay)
+
+	overrideList(CRAWL_SEEDS_ENVAR, &cfg.Crawl.Seeds)
+	overrideList(CRAWL_ALLOWED_DOMAINS_ENVAR, &cfg.Crawl.AllowedDomains)
+	overrideInt(CRAWL_MAX_DEPTH_ENVAR, &cfg.Crawl.MaxDepth)
+	overrideInt(CRAWL_MAX_PAGES_ENVAR, &cfg.Crawl.MaxPages)
+	overrideDuration(CRAWL_HOST_INTERVAL_ENVAR, &cfg.Crawl.HostInterval)
+	overrideDuration(CRAWL_TIMEOUT_ENVAR, &cfg.Crawl.Timeout)
+
+	overrideInt(ARCHIVE_MAX_SIZE_ENVAR, &cfg.Archives.MaxSize)
+	overrideInt(ARCHIVE_MAX_TOTAL_SIZE_ENVAR, &cfg.Archives.MaxTotalSize)
+	overrideInt(ARCHIVE_MAX_ENTRIES_ENVAR, &cfg.Archives.MaxEntries)
+	overrideDuration(ARCHIVE_IMPORT_TIMEOUT_ENVAR, &cfg.Archives.Timeout)
+
+	overrideString(VIDEO_FFMPEG_PATH_ENVAR, &cfg.Videos.FfmpegPath)
+	overrideInt(VIDEO_MAX_FILE_SIZE_ENVAR, &cfg.Videos.MaxFileSize)
+	overrideString(VIDEO_FRAME_MODE_ENVAR, &cfg.Videos.FrameMode)
+	overrideDuration(VIDEO_FRAME_INTERVAL_ENVAR, &cfg.Videos.FrameInterval)
+	overrideFloat64(VIDEO_SCENE_THRESHOLD_ENVAR, &cfg.Videos.SceneThreshold)
+	overrideInt(VIDEO_MAX_FRAMES_ENVAR, &cfg.Videos.MaxFrames)
+	overrideDuration(VIDEO_TIMEOUT_ENVAR, &cfg.Videos.Timeout)
+
+	overrideString(LOG_LEVEL_ENVAR, &cfg.LogLevel)
+
+	if len(fieldErrors) > 0 {
+		return ConfigError{FieldErrors: fieldErrors}
+	}
+	return nil
+}
+
+func validationErrorToText(err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return "Required field"
+	case "min":
+		return fmt.Sprintf("must be >= %s", err.Param())
+	case "max":
+		return fmt.Sprintf("must be <= %s", err.Param())
+	case "gt":
+		return fmt.Sprintf("must be > %s", err.Param())
+	case "lt":
+		return fmt.Sprintf("must be < %s", err.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", err.Param())
+	case "hostname_port":
+		return "must be host:port"
+	case "url", "http_url":
+		return "Invalid url"
+	case "hostname":
+		return "Invalid hostname"
+	}
+	return "Invalid"
+}
+
+var validate = createValidate()
+
+func createValidate() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		return strings.SplitN(fld.Tag.Get("yaml"), ",", 2)[0]
+	})
+	return validate
+}
+
+// Checks that the selected backend has the settings it needs. prefix is the path of the embedding config in the config file
+func (e EmbeddingConfig) validateBackend(prefix string, fieldErrors map[string]string) {
+	if e.Backend == EMBEDDING_BACKEND_HTTP && e.HttpEmbedding.Url == "" {
+		fieldErrors[prefix+"httpEmbedding.url"] = "Required field"
+	}
+	if e.Backend == EMBEDDING_BACKEND_GRPC && e.GrpcEmbedding.Address == "" {
+		fieldErrors[prefix+"grpcEmbedding.address"] = "Required field"
+	}
+}
+
+// Checks the values of the config. Fields are named by their path in the config file
+func (cfg Config) Validate() error {
+	fieldErrors := make(map[string]string)
+
+	err := validate.Struct(cfg)
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		for _, fieldError := range validationErrors {
+			// Drop the leading "Config."
+			field := strings.SplitN(fieldError.Namespace(), ".", 2)[1]
+			fieldErrors[field] = validationErrorToText(fieldError)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	cfg.Embedding().validateBackend("", fieldErrors)
+	if cfg.Reembedding.Enabled {
+		cfg.Reembedding.Target.validateBackend("reembedding.target.", fieldErrors)
+	}
+	for name, embedding := range cfg.EmbeddingModels {
+		if name == "" {
+			fieldErrors["embeddingModels"] = "Model names can't be empty"
+		}
+		embedding.validateBackend(fmt.Sprintf("embeddingModels[%s].", name), fieldErrors)
+	}
+	if cfg.BlobStore.Backend == BLOB_STORE_BACKEND_LOCAL && cfg.BlobStore.Directory == "" {
+		fieldErrors["blobStore.directory"] = "Required field"
+	}
+	if cfg.BlobStore.Backend == BLOB_STORE_BACKEND_S3 {
+		if cfg.BlobStore.S3.Endpoint == "" {
+			fieldErrors["blobStore.s3.endpoint"] = "Required field"
+		}
+		if cfg.BlobStore.S3.Bucket == "" {
+			fieldErrors["blobStore.s3.bucket"] = "Required field"
+		}
+	}
+	if cfg.Watch.Enabled && len(cfg.Watch.Directories) == 0 {
+		fieldErrors["watch.directories"] = "Required field"
+	}
+	if cfg.Database.MaxConns > 0 && cfg.Database.MinConns > cfg.Database.MaxConns {
+		fieldErrors["database.minConns"] = "must be <= database.maxConns"
+	}
+
+	if len(fieldErrors) > 0 {
+		return ConfigError{FieldErrors: fieldErrors}
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func envFromMap(env map[string]string) func(string) (string, bool) {
+	return func(envar string) (string, bool) {
+		value, ok := env[envar]
+		return value, ok
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://localhost/clipsearch",
+		}))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if cfg.Server.Port != DEFAULT_PORT {
+			t.Fatalf("Port = %d, want = %d", cfg.Server.Port, DEFAULT_PORT)
+		}
+		if cfg.Daemons.Image.ZmqEndpoints()[0] != "tcp://localhost:5554" {
+			t.Fatalf("Image daemon endpoint = %s, want = tcp://localhost:5554", cfg.Daemons.Image.ZmqEndpoints()[0])
+		}
+	})
+
+	t.Run("database url is required", func(t *testing.T) {
+		_, err := Load("", envFromMap(nil))
+		configErr, ok := err.(ConfigError)
+		if !ok {
+			t.Fatalf("Load error = %v, want ConfigError", err)
+		}
+		if _, ok := configErr.FieldErrors["database.url"]; !ok {
+			t.Fatalf("Field errors = %v, want an error for database.url", configErr.FieldErrors)
+		}
+	})
+
+	t.Run("envars override the config file", func(t *testing.T) {
+		path := writeConfigFile(t, `
+server:
+  port: 8080
+  searchTimeout: 5s
+database:
+  url: postgres://db/clipsearch
+  maxConns: 8
+embeddingDaemons:
+  image:
+    host: clip.internal
+  text:
+    host: clip.internal
+    port: 6000
+images:
+  maxFileSize: 1048576
+`)
+		cfg, err := Load(path, envFromMap(map[string]string{
+			PORT_ENVAR:                           "9090",
+			ZMQ_TEXT_EMBEDDING_DAEMON_HOST_ENVAR: "::1",
+		}))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if cfg.Server.Port != 9090 {
+			t.Fatalf("Port = %d, want = 9090", cfg.Server.Port)
+		}
+		if cfg.Server.SearchTimeout != 5*time.Second {
+			t.Fatalf("Search timeout = %v, want = 5s", cfg.Server.SearchTimeout)
+		}
+		if cfg.Server.RequestTimeout != DEFAULT_REQUEST_TIMEOUT {
+			t.Fatalf("Request timeout = %v, want = %v", cfg.Server.RequestTimeout, DEFAULT_REQUEST_TIMEOUT)
+		}
+		if cfg.Database.MaxConns != 8 {
+			t.Fatalf("Max conns = %d, want = 8", cfg.Database.MaxConns)
+		}
+		if cfg.Daemons.Image.ZmqEndpoints()[0] != "tcp://clip.internal:5554" {
+			t.Fatalf("Image daemon endpoint = %s, want = tcp://clip.internal:5554", cfg.Daemons.Image.ZmqEndpoints()[0])
+		}
+		if cfg.Daemons.Text.ZmqEndpoints()[0] != "tcp://[::1]:6000" {
+			t.Fatalf("Text daemon endpoint = %s, want = tcp://[::1]:6000", cfg.Daemons.Text.ZmqEndpoints()[0])
+		}
+		if cfg.Images.MaxFileSizeMB() != 1 {
+			t.Fatalf("Max file size = %d MB, want = 1 MB", cfg.Images.MaxFileSizeMB())
+		}
+	})
+
+	t.Run("endpoint lists", func(t *testing.T) {
+		path := writeConfigFile(t, `
+database:
+  url: postgres://db/clipsearch
+embeddingDaemons:
+  image:
+    endpoints: [gpu1:5554, gpu2:5554]
+`)
+		cfg, err := Load(path, envFromMap(map[string]string{
+			ZMQ_TEXT_EMBEDDING_DAEMON_ENDPOINTS_ENVAR: "gpu1:5553,gpu2:5553,gpu3:5553",
+		}))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		imageEndpoints := cfg.Daemons.Image.ZmqEndpoints()
+		if len(imageEndpoints) != 2 || imageEndpoints[1] != "tcp://gpu2:5554" {
+			t.Fatalf("Image daemon endpoints = %v, want = [tcp://gpu1:5554 tcp://gpu2:5554]", imageEndpoints)
+		}
+		if len(cfg.Daemons.Text.ZmqEndpoints()) != 3 {
+			t.Fatalf("Text daemon endpoints = %v, want 3 endpoints", cfg.Daemons.Text.ZmqEndpoints())
+		}
+
+		_, err = Load(path, envFromMap(map[string]string{
+			ZMQ_TEXT_EMBEDDING_DAEMON_ENDPOINTS_ENVAR: "gpu1",
+		}))
+		if _, ok := err.(ConfigError); !ok {
+			t.Fatalf("Load error = %v, want ConfigError", err)
+		}
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		path := writeConfigFile(t, `
+server:
+  port: 70000
+database:
+  url: postgres://db/clipsearch
+  maxConns: 2
+  minConns: 4
+logLevel: verbose
+`)
+		_, err := Load(path, envFromMap(map[string]string{
+			SEARCH_TIMEOUT_ENVAR: "soon",
+		}))
+		configErr, ok := err.(ConfigError)
+		if !ok {
+			t.Fatalf("Load error = %v, want ConfigError", err)
+		}
+		if _, ok := configErr.FieldErrors[SEARCH_TIMEOUT_ENVAR]; !ok {
+			t.Fatalf("Field errors = %v, want an error for %s", configErr.FieldErrors, SEARCH_TIMEOUT_ENVAR)
+		}
+
+		_, err = Load(path, envFromMap(nil))
+		configErr, ok = err.(ConfigError)
+		if !ok {
+			t.Fatalf("Load error = %v, want ConfigError", err)
+		}
+		for _, field := range []string{"server.port", "database.minConns", "logLevel"} {
+			if _, ok := configErr.FieldErrors[field]; !ok {
+				t.Fatalf("Field errors = %v, want an error for %s", configErr.FieldErrors, field)
+			}
+		}
+	})
+
+	t.Run("http backend needs a url", func(t *testing.T) {
+		_, err := Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://localhost/clipsearch",
+			EMBEDDING_BACKEND_ENVAR:          EMBEDDING_BACKEND_HTTP,
+		}))
+		configErr, ok := err.(ConfigError)
+		if !ok {
+			t.Fatalf("Load error = %v, want ConfigError", err)
+		}
+		if _, ok := configErr.FieldErrors["httpEmbedding.url"]; !ok {
+			t.Fatalf("Field errors = %v, want an error for httpEmbedding.url", configErr.FieldErrors)
+		}
+	})
+
+	t.Run("reembedding target", func(t *testing.T) {
+		path := writeConfigFile(t, "reembedding:\n  target:\n    embeddingBackend: grpc\n")
+		_, err := Load(path, envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://localhost/clipsearch",
+			REEMBEDDING_ENABLED_ENVAR:        "true",
+		}))
+		configErr, ok := err.(ConfigError)
+		if !ok {
+			t.Fatalf("Load error = %v, want ConfigError", err)
+		}
+		if _, ok := configErr.FieldErrors["reembedding.target.grpcEmbedding.address"]; !ok {
+			t.Fatalf("Field errors = %v, want an error for reembedding.target.grpcEmbedding.address", configErr.FieldErrors)
+		}
+
+		path = writeConfigFile(t, "reembedding:\n  target:\n    embeddingBackend: grpc\n    grpcEmbedding:\n      address: newmodel:5555\n")
+		cfg, err := Load(path, envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://localhost/clipsearch",
+			REEMBEDDING_ENABLED_ENVAR:        "true",
+		}))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if cfg.Reembedding.Target.GrpcEmbedding.Timeout != DEFAULT_GRPC_EMBEDDING_TIMEOUT {
+			t.Fatalf("Target grpc timeout = %v, want the default %v", cfg.Reembedding.Target.GrpcEmbedding.Timeout, DEFAULT_GRPC_EMBEDDING_TIMEOUT)
+		}
+	})
+
+	t.Run("named embedding models", func(t *testing.T) {
+		path := writeConfigFile(t, `
+database:
+  url: postgres://db/clipsearch
+embeddingModels:
+  ViT-B/32:
+    embeddingBackend: grpc
+    grpcEmbedding:
+      address: small:5555
+  broken:
+    embeddingBackend: http
+    httpEmbedding:
+      timeout: 0s
+`)
+		_, err := Load(path, envFromMap(nil))
+		configErr, ok := err.(ConfigError)
+		if !ok {
+			t.Fatalf("Load error = %v, want ConfigError", err)
+		}
+		if _, ok := configErr.FieldErrors["embeddingModels[broken].httpEmbedding.url"]; !ok {
+			t.Fatalf("Field errors = %v, want an error for embeddingModels[broken].httpEmbedding.url", configErr.FieldErrors)
+		}
+
+		path = writeConfigFile(t, `
+database:
+  url: postgres://db/clipsearch
+embeddingModels:
+  ViT-B/32:
+    embeddingBackend: grpc
+    grpcEmbedding:
+      address: small:5555
+`)
+		cfg, err := Load(path, envFromMap(nil))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		small, ok := cfg.EmbeddingModels["ViT-B/32"]
+		if !ok || small.GrpcEmbedding.Address != "small:5555" {
+			t.Fatalf("Embedding models = %v, want ViT-B/32 at small:5555", cfg.EmbeddingModels)
+		}
+		if small.GrpcEmbedding.Timeout != DEFAULT_GRPC_EMBEDDING_TIMEOUT {
+			t.Fatalf("Grpc timeout = %v, want the default %v", small.GrpcEmbedding.Timeout, DEFAULT_GRPC_EMBEDDING_TIMEOUT)
+		}
+	})
+
+	t.Run("watched directories", func(t *testing.T) {
+		path := writeConfigFile(t, `
+database:
+  url: postgres://db/clipsearch
+watch:
+  enabled: true
+  directories:
+    - path: /srv/photos
+      baseUrl: https://photos.example.com/
+`)
+		cfg, err := Load(path, envFromMap(nil))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(cfg.Watch.Directories) != 1 || cfg.Watch.Directories[0].BaseUrl != "https://photos.example.com/" {
+			t.Fatalf("Watched directories = %v, want /srv/photos", cfg.Watch.Directories)
+		}
+
+		cfg, err = Load(path, envFromMap(map[string]string{WATCH_DIRECTORIES_ENVAR: "/a,/b"}))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(cfg.Watch.Directories) != 2 || cfg.Watch.Directories[1].Path != "/b" || cfg.Watch.Directories[1].BaseUrl != "" {
+			t.Fatalf("Watched directories = %v, want /a and /b", cfg.Watch.Directories)
+		}
+
+		_, err = Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://db/clipsearch",
+			WATCH_ENABLED_ENVAR:              "true",
+		}))
+		configErr, ok := err.(ConfigError)
+		if !ok || configErr.FieldErrors["watch.directories"] == "" {
+			t.Fatalf("Expected the watcher to need directories, got %v", err)
+		}
+	})
+
+	t.Run("crawl seeds", func(t *testing.T) {
+		cfg, err := Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://db/clipsearch",
+			CRAWL_SEEDS_ENVAR:                "https://example.com/,https://blog.example.com/",
+			CRAWL_ALLOWED_DOMAINS_ENVAR:      "example.com",
+		}))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(cfg.Crawl.Seeds) != 2 || len(cfg.Crawl.AllowedDomains) != 1 || cfg.Crawl.MaxDepth != DEFAULT_CRAWL_MAX_DEPTH {
+			t.Fatalf("Crawl config = %+v, want 2 seeds and example.com", cfg.Crawl)
+		}
+
+		_, err = Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://db/clipsearch",
+			CRAWL_SEEDS_ENVAR:                "https://example.com/,ftp://example.com/",
+		}))
+		configErr, ok := err.(ConfigError)
+		if !ok || configErr.FieldErrors["crawl.seeds[1]"] != "Invalid url" {
+			t.Fatalf("Expected the ftp seed to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("video frames", func(t *testing.T) {
+		cfg, err := Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://db/clipsearch",
+			VIDEO_FRAME_MODE_ENVAR:           "scene",
+			VIDEO_SCENE_THRESHOLD_ENVAR:      "0.5",
+		}))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if cfg.Videos.FrameMode != VIDEO_FRAME_MODE_SCENE || cfg.Videos.SceneThreshold != 0.5 {
+			t.Fatalf("Video config = %+v, want scene changes over 0.5", cfg.Videos)
+		}
+
+		_, err = Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://db/clipsearch",
+			VIDEO_SCENE_THRESHOLD_ENVAR:      "high",
+		}))
+		configErr, ok := err.(ConfigError)
+		if !ok || configErr.FieldErrors[VIDEO_SCENE_THRESHOLD_ENVAR] == "" {
+			t.Fatalf("Expected the threshold to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("animations", func(t *testing.T) {
+		cfg, err := Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://db/clipsearch",
+			ANIMATION_FRAMES_ENVAR:           "4",
+			ANIMATION_EMBEDDING_ENVAR:        "frames",
+		}))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if cfg.Images.AnimationFrames != 4 || cfg.Images.AnimationEmbedding != ANIMATION_EMBEDDING_FRAMES {
+			t.Fatalf("Images config = %+v, want 4 frame embeddings", cfg.Images)
+		}
+
+		_, err = Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR: "postgres://db/clipsearch",
+			ANIMATION_EMBEDDING_ENVAR:        "first",
+		}))
+		configErr, ok := err.(ConfigError)
+		if !ok || configErr.FieldErrors["images.animationEmbedding"] == "" {
+			t.Fatalf("Expected the animation embedding to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("reembedding permanent failures", func(t *testing.T) {
+		cfg, err := Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR:     "postgres://db/clipsearch",
+			REEMBEDDING_PERMANENT_FAILURES_ENVAR: "keep",
+		}))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if cfg.Reembedding.PermanentFailures != REEMBEDDING_PERMANENT_FAILURES_KEEP {
+			t.Fatalf("Permanent failures = %s, want = keep", cfg.Reembedding.PermanentFailures)
+		}
+
+		_, err = Load("", envFromMap(map[string]string{
+			PG_DATABASE_CONNECTION_URL_ENVAR:     "postgres://db/clipsearch",
+			REEMBEDDING_PERMANENT_FAILURES_ENVAR: "ignore",
+		}))
+		configErr, ok := err.(ConfigError)
+		if !ok || configErr.FieldErrors["reembedding.permanentFailures"] == "" {
+			t.Fatalf("Expected the permanent failures policy to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("unknown keys are rejected", func(t *testing.T) {
+		path := writeConfigFile(t, "server:\n  prot: 8080\n")
+		_, err := Load(path, envFromMap(nil))
+		if err == nil {
+			t.Fatalf("Expected a config file with an unknown key to be rejected")
+		}
+	})
+}
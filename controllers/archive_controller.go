@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"clipsearch/binding"
+	"clipsearch/config"
+	"clipsearch/dtos"
+	"clipsearch/services"
+	"clipsearch/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Room for the other fields of the multipart form next to the archive
+const archiveFormOverhead = 1024 * 1024
+
+type ArchiveController struct {
+	importer *services.ArchiveImporter
+	config   config.ArchiveConfig
+}
+
+func NewArchiveController(importer *services.ArchiveImporter, archiveConfig config.ArchiveConfig) *ArchiveController {
+	return &ArchiveController{importer: importer, config: archiveConfig}
+}
+
+type PostImagesArchiveForm struct {
+	BaseUrl string `schema:"baseUrl" validate:"omitempty,http_url"`
+}
+
+// @Summary Import an archive of images
+// @Description Adds the image files (jpg, png, gif, webp, bmp) of a zip, tar or tar.gz archive, and returns the outcome of every entry: `added`, `duplicate` (hash match), `tooLarge` (see config), `skipped` (not an image file), `unsafePath` (absolute or leaving the archive) or `failed`.
+// @Description Archives that are corrupt or hold more entries or data than allowed are rejected as a whole (see config).
+// @Tags images
+// @Accept multipart/form-data
+// @Produce json
+// @Param archive formData file true "The zip, tar or tar.gz archive"
+// @Param baseUrl formData string false "URL the files of the archive are served at, the images are stored with their path under it. Default is archive:///<archive file name>"
+// @Success 200 {object} dtos.JsendArchiveImportResponse "Success"
+// @Failure 400 {object} dtos.JsendFailResponse "Failure (bad params or archive)"
+// @Failure 500 {object} dtos.JsendErrorResponse "Failure (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failure (timed out)"
+// @Router /api/images/archive [post]
+func (controller *ArchiveController) PostImagesArchive(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(controller.config.MaxSize)+archiveFormOverhead)
+	if err := c.Request.ParseMultipartForm(32 * 1024 * 1024); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = utils.ArchiveTooLargeError
+		}
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"archive": err.Error(),
+		}))
+		return
+	}
+	var form PostImagesArchiveForm
+	if err := binding.ShouldBind(&form, c.Request.Form); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(err.(binding.BindingError).FieldErrors))
+		return
+	}
+	file, fileHeader, err := c.Request.FormFile("archive")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"archive": "Required field",
+		}))
+		return
+	}
+	defer file.Close()
+
+	results, err := controller.importer.Import(c.Request.Context(), file, fileHeader.Size, fileHeader.Filename, form.BaseUrl)
+	if errors.Is(err, utils.UnknownArchiveFormatError) || errors.Is(err, utils.ArchiveTooLargeError) ||
+		errors.Is(err, utils.TooManyArchiveEntriesError) || errors.Is(err, utils.CorruptArchiveError) {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"archive": err.Error(),
+		}))
+		return
+	} else if err != nil {
+		respondInternalError(c, err, "archive", fileHeader.Filename)
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.NewJsendArchiveImportResponse(results))
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"clipsearch/config"
+	"clipsearch/repositories"
+	"clipsearch/services"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveController(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := repositories.NewMockImageRepository()
+	imageService := services.NewImageService(mockRepo, services.NewMockClipService(), config.Default().Images)
+	controller := NewArchiveController(services.NewArchiveImporter(imageService, config.Default().Archives), config.Default().Archives)
+	router := gin.Default()
+	router.POST("/api/images/archive", controller.PostImagesArchive)
+
+	newArchiveRequest := func(archive []byte, baseUrl string) *http.Request {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		if err := writer.WriteField("baseUrl", baseUrl); err != nil {
+			t.Fatal(err.Error())
+		}
+		part, err := writer.CreateFormFile("archive", "dataset.zip")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if _, err := part.Write(archive); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err.Error())
+		}
+		req, _ := http.NewRequest(http.MethodPost, "/api/images/archive", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req
+	}
+
+	t.Run("should return 400 if the file is not an archive", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, newArchiveRequest([]byte("not an archive"), "https://cdn.example.com/dataset"))
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+
+	t.Run("should return 400 if the base url is not an http url", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, newArchiveRequest([]byte("not an archive"), "file:///etc"))
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Body.String(), "Invalid http or https url")
+	})
+
+	t.Run("should return the outcome of every entry", func(t *testing.T) {
+		image, err := os.ReadFile(testImage.Path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var archive bytes.Buffer
+		writer := zip.NewWriter(&archive)
+		for _, name := range []string{"image.jpg", "notes.txt"} {
+			w, err := writer.Create(name)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if _, err := w.Write(image); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err.Error())
+		}
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, newArchiveRequest(archive.Bytes(), "https://cdn.example.com/dataset"))
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		result := struct {
+			Status string
+			Data   struct {
+				Counts  map[string]int
+				Entries []struct {
+					Path   string
+					Status string
+					Url    string
+				}
+			}
+		}{}
+		err = json.Unmarshal(resp.Body.Bytes(), &result)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "success", result.Status)
+		assert.Equal(t, map[string]int{"added": 1, "skipped": 1}, result.Data.Counts)
+		assert.Equal(t, "https://cdn.example.com/dataset/image.jpg", result.Data.Entries[0].Url)
+	})
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"clipsearch/dtos"
+	"clipsearch/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct {
+	healthService *services.HealthService
+}
+
+func NewHealthController(healthService *services.HealthService) *HealthController {
+	return &HealthController{healthService: healthService}
+}
+
+// @Summary Liveness probe
+// @Description Succeeds as long as the process is able to serve requests. Doesn't check any dependencies.
+// @Tags health
+// @Produce json
+// @Success 200 {object} dtos.JsendEmptySuccessResponse "Alive"
+// @Router /healthz [get]
+func (controller *HealthController) GetHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, dtos.NewJsendEmptySuccessResponse())
+}
+
+// @Summary Readiness probe
+// @Description Checks the database, its schema, and that the embedding backends embed a text and an image, and reports the status of each.
+// @Tags health
+// @Produce json
+// @Success 200 {object} dtos.JsendReadinessResponse "Ready"
+// @Failure 503 {object} dtos.JsendReadinessResponse "Not ready"
+// @Router /readyz [get]
+func (controller *HealthController) GetReadyz(c *gin.Context) {
+	ready, results := controller.healthService.CheckReadiness(c.Request.Context())
+
+	dependencies := make(map[string]string, len(results))
+	for name, err := range results {
+		if err != nil {
+			dependencies[name] = err.Error()
+		} else {
+			dependencies[name] = "ok"
+		}
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, dtos.NewJsendReadinessResponse(ready, dependencies))
+}
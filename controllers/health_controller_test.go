@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"clipsearch/config"
+	"clipsearch/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthController(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(checks ...services.DependencyCheck) *gin.Engine {
+		controller := NewHealthController(services.NewHealthService(config.DEFAULT_READINESS_CHECK_TIMEOUT, checks...))
+		router := gin.Default()
+		router.GET("/healthz", controller.GetHealthz)
+		router.GET("/readyz", controller.GetReadyz)
+		return router
+	}
+
+	t.Run("healthz", func(t *testing.T) {
+		router := newRouter()
+
+		req, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("readyz should report every dependency", func(t *testing.T) {
+		router := newRouter(
+			services.DependencyCheck{Name: "postgres", Check: func(ctx context.Context) error { return nil }},
+			services.DependencyCheck{Name: "textEmbeddingDaemon", Check: func(ctx context.Context) error { return errors.New("connection refused") }},
+		)
+
+		req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+		result := struct {
+			Status string
+			Data   map[string]string
+		}{}
+		err := json.Unmarshal(resp.Body.Bytes(), &result)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "fail", result.Status)
+		assert.Equal(t, "ok", result.Data["postgres"])
+		assert.Equal(t, "connection refused", result.Data["textEmbeddingDaemon"])
+	})
+
+	t.Run("readyz should succeed if all dependencies are usable", func(t *testing.T) {
+		mockClip := services.NewMockClipService()
+		router := newRouter(services.ClipServiceChecks(mockClip)...)
+
+		req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"bufio"
 	"clipsearch/binding"
 	"clipsearch/config"
 	"clipsearch/dtos"
@@ -9,31 +10,44 @@ import (
 	"clipsearch/utils"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 var internalErrorJson = dtos.NewJsendErrorResponse("Internal error")
 
+// Logs an unexpected error along with the route and query of the request it occurred in
+func logInternalError(c *gin.Context, err error, attrs ...any) {
+	attrs = append([]any{"route", c.FullPath(), "query", c.Request.URL.RawQuery, "error", err}, attrs...)
+	slog.ErrorContext(c.Request.Context(), "Internal error", attrs...)
+}
+
 type ImageController struct {
 	imageService *services.ImageService
+	config       config.ImagesConfig
 }
 
-func NewImageController(imageService *services.ImageService) *ImageController {
-	return &ImageController{imageService: imageService}
+func NewImageController(imageService *services.ImageService, imagesConfig config.ImagesConfig) *ImageController {
+	return &ImageController{imageService: imageService, config: imagesConfig}
 }
 
 // @Summary Get images
 // @Description Returns an array of images from the repository, ordered by ID, skipping the first `offset` images and returning at most `limit`.
+// @Description Pass the returned `nextCursor` as `cursor` to get the next page instead of using `offset`.
 // @Tags images
 // @Produce json
+// @Param cursor query string false "Cursor returned with the previous page. Overrides offset"
 // @Param offset query int false "How many images to skip"
 // @Param limit query int false "How many images to return at most"
 // @Success 200 {object} dtos.JsendImagesResponse "Success"
 // @Failure 400 {object} dtos.JsendFailResponse "Failure (bad params)"
 // @Failure 500 {object} dtos.JsendErrorResponse "Failure (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failure (timed out)"
 // @Router /api/images [get]
 func (controller *ImageController) GetImages(c *gin.Context) {
 	var query GetImagesQuery
@@ -43,32 +57,131 @@ func (controller *ImageController) GetImages(c *gin.Context) {
 		return
 	}
 
-	count, images, err := controller.imageService.GetCountAndImages(query.Offset, query.Limit)
-	if err != nil {
-		log.Print(err)
-		c.JSON(http.StatusInternalServerError, internalErrorJson)
+	count, images, nextCursor, err := controller.imageService.GetCountAndImagesPage(c.Request.Context(), query.Offset, query.Limit, query.Cursor)
+	if err == services.InvalidCursorError {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"cursor": "Invalid cursor",
+		}))
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, dtos.NewJsendImagesResponse(count, images))
+	c.JSON(http.StatusOK, dtos.NewJsendImagesResponse(count, images, nextCursor))
 }
 
 type SearchQuery struct {
-	Query  string `schema:"q"`
-	Offset int    `schema:"offset" validate:"min=0"`
-	Limit  int    `schema:"limit" validate:"min=0"`
+	Query           []string  `schema:"q,required"`
+	Weights         []float32 `schema:"w" validate:"dive,min=0"`
+	NegativeQuery   []string  `schema:"neg"`
+	NegativeWeights []float32 `schema:"negw" validate:"dive,min=0"`
+	Diversity       float32   `schema:"diversity" validate:"min=0,max=1"`
+	Model           string    `schema:"model"`
+	Cursor          string    `schema:"cursor"`
+	Offset          int       `schema:"offset" validate:"min=0"`
+	Limit           int       `schema:"limit" validate:"min=0"`
+}
+
+func (query *SearchQuery) page() services.SearchPage {
+	return services.SearchPage{
+		Offset:    query.Offset,
+		Limit:     query.Limit,
+		Cursor:    query.Cursor,
+		Diversity: query.Diversity,
+	}
+}
+
+// Writes a fail response if err is caused by bad paging parameters, missing prompts or an unknown model
+func handleSearchParamError(c *gin.Context, err error) bool {
+	switch err {
+	case services.UnknownEmbeddingModelError:
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"model": "No embedding backend is configured for this model",
+		}))
+		return true
+	case services.InvalidCursorError:
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"cursor": "Invalid cursor",
+		}))
+		return true
+	case services.CursorWithDiversityError:
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"cursor": "Can't be used together with diversity",
+		}))
+		return true
+	case services.NoPromptsError:
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"q": "At least one non-empty prompt is required",
+		}))
+		return true
+	case services.DiversityTooDeepError:
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"offset": fmt.Sprintf("Offset and limit can't add up to more than %d when diversity is set", config.MMR_MAX_CANDIDATES),
+		}))
+		return true
+	}
+	return false
+}
+
+// Pairs every prompt with its weight. Missing weights default to 1
+func toWeightedPrompts(prompts []string, weights []float32) []services.WeightedPrompt {
+	result := make([]services.WeightedPrompt, len(prompts))
+	for i, prompt := range prompts {
+		result[i] = services.WeightedPrompt{Text: prompt, Weight: 1}
+		if len(weights) > 0 {
+			result[i].Weight = weights[i]
+		}
+	}
+	return result
+}
+
+// Weights are optional, but if given there has to be one for every term
+func checkWeightCount(fieldErrors map[string]string, weightField string, weightCount int, termField string, termCount int) {
+	if weightCount > 0 && weightCount != termCount {
+		fieldErrors[weightField] = fmt.Sprintf("Expected one weight per %s", termField)
+	}
+}
+
+// How many terms of each kind a search may combine, every text term is a call to the embedding backend
+const maxSearchTerms = 16
+
+func checkTermCount(fieldErrors map[string]string, termField string, termCount int) {
+	if termCount > maxSearchTerms {
+		fieldErrors[termField] = fmt.Sprintf("Can't be repeated more than %d times", maxSearchTerms)
+	}
+}
+
+func (query *SearchQuery) validateTerms() map[string]string {
+	fieldErrors := make(map[string]string)
+	checkTermCount(fieldErrors, "q", len(query.Query))
+	checkTermCount(fieldErrors, "neg", len(query.NegativeQuery))
+	checkWeightCount(fieldErrors, "w", len(query.Weights), "q", len(query.Query))
+	checkWeightCount(fieldErrors, "negw", len(query.NegativeWeights), "neg", len(query.NegativeQuery))
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+	return fieldErrors
 }
 
 // @Summary Search the image repository (text query)
 // @Description Returns an array of images from the repository, ordered by relevance, skipping the first `offset` images and returning at most `limit`.
+// @Description Several prompts can be combined: every `q` is added to the query and every `neg` is subtracted from it, each scaled by its weight.
 // @Tags search
 // @Produce json
-// @Param q query string true "The text query"
+// @Param q query []string true "The text query. Can be repeated up to 16 times" collectionFormat(multi)
+// @Param w query []number false "Weight of each q, in the same order. Default is 1" collectionFormat(multi)
+// @Param neg query []string false "Negative text query. Can be repeated up to 16 times" collectionFormat(multi)
+// @Param negw query []number false "Weight of each neg, in the same order. Default is 1" collectionFormat(multi)
+// @Param diversity query number false "Between 0 and 1. Higher values trade relevance for variety among the results, offset and limit then adding up to at most 1000. Default is 0"
+// @Param model query string false "Name of the embedding model to search with, one of the configured embeddingModels. Default is the model of the embedding backend"
+// @Param cursor query string false "Cursor returned with the previous page of the same query. Overrides offset, can't be used with diversity"
 // @Param offset query int false "How many images to skip"
 // @Param limit query int false "How many images to return at most"
 // @Success 200 {object} dtos.JsendImagesResponse "Success"
 // @Failure 400 {object} dtos.JsendFailResponse "Failure (bad params)"
 // @Failure 500 {object} dtos.JsendErrorResponse "Failure (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failure (timed out)"
 // @Router /api/images/search [get]
 func (controller *ImageController) GetSearchImages(c *gin.Context) {
 	var query SearchQuery
@@ -76,27 +189,266 @@ func (controller *ImageController) GetSearchImages(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(err.(binding.BindingError).FieldErrors))
 		return
 	}
+	if fieldErrors := query.validateTerms(); fieldErrors != nil {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(fieldErrors))
+		return
+	}
 
-	count, err := controller.imageService.ImageRepo.Count()
+	count, err := controller.imageService.ImageRepo.Count(c.Request.Context())
 	if err != nil {
-		log.Print(err)
-		c.JSON(http.StatusInternalServerError, internalErrorJson)
+		respondInternalError(c, err)
 		return
 	}
 
-	results, err := controller.imageService.GetImagesSimilarToText(query.Query, query.Offset, query.Limit)
+	results, nextCursor, err := controller.imageService.GetImagesSimilarToPrompts(
+		c.Request.Context(),
+		query.Model,
+		toWeightedPrompts(query.Query, query.Weights),
+		toWeightedPrompts(query.NegativeQuery, query.NegativeWeights),
+		query.page())
+	if handleSearchParamError(c, err) {
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.NewJsendImagesResponse(count, results, nextCursor))
+}
+
+type RefineSearchQuery struct {
+	SearchQuery
+	Liked    []int `schema:"liked" validate:"dive,min=0"`
+	Disliked []int `schema:"disliked" validate:"dive,min=0"`
+}
+
+// @Summary Refine a search with relevance feedback
+// @Description Repeats a text search after moving the query towards the images marked as liked and away from the images marked as disliked.
+// @Description Returns an array of images from the repository, ordered by relevance to the refined query, skipping the first `offset` images and returning at most `limit`.
+// @Tags search
+// @Produce json
+// @Param q query []string true "The original text query. Can be repeated up to 16 times" collectionFormat(multi)
+// @Param w query []number false "Weight of each q, in the same order. Default is 1" collectionFormat(multi)
+// @Param neg query []string false "The original negative text query. Can be repeated up to 16 times" collectionFormat(multi)
+// @Param negw query []number false "Weight of each neg, in the same order. Default is 1" collectionFormat(multi)
+// @Param liked query []int false "IDs of images that are relevant to the query" collectionFormat(multi)
+// @Param disliked query []int false "IDs of images that are not relevant to the query" collectionFormat(multi)
+// @Param diversity query number false "Between 0 and 1. Higher values trade relevance for variety among the results, offset and limit then adding up to at most 1000. Default is 0"
+// @Param model query string false "Name of the embedding model to search with, one of the configured embeddingModels. Default is the model of the embedding backend"
+// @Param cursor query string false "Cursor returned with the previous page of the same query. Overrides offset, can't be used with diversity"
+// @Param offset query int false "How many images to skip"
+// @Param limit query int false "How many images to return at most"
+// @Success 200 {object} dtos.JsendImagesResponse "Success"
+// @Failure 400 {object} dtos.JsendFailResponse "Failure (bad params)"
+// @Failure 500 {object} dtos.JsendErrorResponse "Failure (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failure (timed out)"
+// @Router /api/images/search/refine [get]
+func (controller *ImageController) GetRefineSearchImages(c *gin.Context) {
+	var query RefineSearchQuery
+	if err := binding.ShouldBind(&query, c.Request.URL.Query()); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(err.(binding.BindingError).FieldErrors))
+		return
+	}
+	if fieldErrors := query.validateTerms(); fieldErrors != nil {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(fieldErrors))
+		return
+	}
+
+	count, err := controller.imageService.ImageRepo.Count(c.Request.Context())
 	if err != nil {
-		log.Print(err)
-		c.JSON(http.StatusInternalServerError, internalErrorJson)
+		respondInternalError(c, err)
+		return
+	}
+
+	results, nextCursor, err := controller.imageService.GetImagesSimilarToRefinedPrompts(
+		c.Request.Context(),
+		query.Model,
+		toWeightedPrompts(query.Query, query.Weights),
+		toWeightedPrompts(query.NegativeQuery, query.NegativeWeights),
+		services.RelevanceFeedback{Liked: query.Liked, Disliked: query.Disliked},
+		query.page())
+	if handleSearchParamError(c, err) {
+		return
+	} else if err == repositories.ImageNotFoundError {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"feedback": "No image with such id exists",
+		}))
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, dtos.NewJsendImagesResponse(count, results))
+	c.JSON(http.StatusOK, dtos.NewJsendImagesResponse(count, results, nextCursor))
+}
+
+type CompositeSearchForm struct {
+	Query          []string  `schema:"q"`
+	Weights        []float32 `schema:"w"`
+	ImageIds       []int     `schema:"imageId" validate:"dive,min=0"`
+	ImageIdWeights []float32 `schema:"imageIdWeight"`
+	ImageWeights   []float32 `schema:"imageWeight"`
+	Diversity      float32   `schema:"diversity" validate:"min=0,max=1"`
+	Model          string    `schema:"model"`
+	Cursor         string    `schema:"cursor"`
+	Offset         int       `schema:"offset" validate:"min=0"`
+	Limit          int       `schema:"limit" validate:"min=0"`
+}
+
+// Reads the files uploaded under field, failing if any of them is larger than maxFileSize
+func readUploadedFiles(form *multipart.Form, field string, maxFileSize int) ([][]byte, error) {
+	if form == nil {
+		return nil, nil
+	}
+	files := make([][]byte, 0, len(form.File[field]))
+	for _, fileHeader := range form.File[field] {
+		if fileHeader.Size > int64(maxFileSize) {
+			return nil, utils.FileSizeExceededError
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, data)
+	}
+	return files, nil
+}
+
+// Room for the other fields of a form next to its files
+const formOverhead = 1024 * 1024
+
+// How many images of the largest size the body of a composite search may hold
+const maxSearchUploads = 8
+
+// Parses the urlencoded or multipart form of the request, whose body is cut off after maxBytes.
+// Responds with 400 and returns false if the form can't be parsed
+func parseForm(c *gin.Context, maxBytes int64) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	// ParseMultipartForm also calls ParseForm
+	if err := c.Request.ParseMultipartForm(2048); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		message := err.Error()
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			message = fmt.Sprintf("Request is too large (>%d MB)", maxBytes/1024/1024)
+		}
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"request": message,
+		}))
+		return false
+	}
+	return true
+}
+
+// @Summary Search the image repository (composite query)
+// @Description Returns an array of images from the repository, ordered by relevance to a query combining text prompts, images from the repository and uploaded images, skipping the first `offset` images and returning at most `limit`.
+// @Description Every term is scaled by its weight (default 1). Terms with a negative weight are subtracted from the query.
+// @Tags search
+// @Accept multipart/form-data
+// @Produce json
+// @Param q formData []string false "Text prompt. Can be repeated up to 16 times" collectionFormat(multi)
+// @Param w formData []number false "Weight of each q, in the same order" collectionFormat(multi)
+// @Param imageId formData []int false "ID of an image in the repository. Can be repeated up to 16 times" collectionFormat(multi)
+// @Param imageIdWeight formData []number false "Weight of each imageId, in the same order" collectionFormat(multi)
+// @Param image formData file false "Uploaded image. Can be repeated"
+// @Param imageWeight formData []number false "Weight of each uploaded image, in the same order" collectionFormat(multi)
+// @Param diversity formData number false "Between 0 and 1. Higher values trade relevance for variety among the results, offset and limit then adding up to at most 1000. Default is 0"
+// @Param model formData string false "Name of the embedding model to search with, one of the configured embeddingModels. Default is the model of the embedding backend"
+// @Param cursor formData string false "Cursor returned with the previous page of the same query. Overrides offset, can't be used with diversity"
+// @Param offset formData int false "How many images to skip"
+// @Param limit formData int false "How many images to return at most"
+// @Success 200 {object} dtos.JsendImagesResponse "Success"
+// @Failure 400 {object} dtos.JsendFailResponse "Failure (bad params)"
+// @Failure 500 {object} dtos.JsendErrorResponse "Failure (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failure (timed out)"
+// @Router /api/images/search [post]
+func (controller *ImageController) PostSearchImages(c *gin.Context) {
+	if !parseForm(c, int64(maxSearchUploads*controller.config.MaxFileSize)+formOverhead) {
+		return
+	}
+	var form CompositeSearchForm
+	if err := binding.ShouldBind(&form, c.Request.Form); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(err.(binding.BindingError).FieldErrors))
+		return
+	}
+
+	images, err := readUploadedFiles(c.Request.MultipartForm, "image", controller.config.MaxFileSize)
+	if err == utils.FileSizeExceededError {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"image": fmt.Sprintf("Image is too large (>%d MB)", controller.config.MaxFileSizeMB()),
+		}))
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	fieldErrors := make(map[string]string)
+	checkTermCount(fieldErrors, "q", len(form.Query))
+	checkTermCount(fieldErrors, "imageId", len(form.ImageIds))
+	checkWeightCount(fieldErrors, "w", len(form.Weights), "q", len(form.Query))
+	checkWeightCount(fieldErrors, "imageIdWeight", len(form.ImageIdWeights), "imageId", len(form.ImageIds))
+	checkWeightCount(fieldErrors, "imageWeight", len(form.ImageWeights), "image", len(images))
+	if len(form.Query)+len(form.ImageIds)+len(images) == 0 {
+		fieldErrors["query"] = "Expected at least one q, imageId or image"
+	}
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(fieldErrors))
+		return
+	}
+
+	query := services.CompositeQuery{
+		Prompts:  toWeightedPrompts(form.Query, form.Weights),
+		ImageIds: make([]services.WeightedImageId, len(form.ImageIds)),
+		Images:   make([]services.WeightedImageData, len(images)),
+	}
+	for i, id := range form.ImageIds {
+		query.ImageIds[i] = services.WeightedImageId{Id: id, Weight: 1}
+		if len(form.ImageIdWeights) > 0 {
+			query.ImageIds[i].Weight = form.ImageIdWeights[i]
+		}
+	}
+	for i, data := range images {
+		query.Images[i] = services.WeightedImageData{Data: data, Weight: 1}
+		if len(form.ImageWeights) > 0 {
+			query.Images[i].Weight = form.ImageWeights[i]
+		}
+	}
+
+	count, err := controller.imageService.ImageRepo.Count(c.Request.Context())
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	results, nextCursor, err := controller.imageService.GetImagesSimilarToCompositeQuery(c.Request.Context(), form.Model, query, services.SearchPage{
+		Offset:    form.Offset,
+		Limit:     form.Limit,
+		Cursor:    form.Cursor,
+		Diversity: form.Diversity,
+	})
+	if handleSearchParamError(c, err) {
+		return
+	} else if err == repositories.ImageNotFoundError {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"imageId": "No image with such id exists",
+		}))
+		return
+	} else if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.NewJsendImagesResponse(count, results, nextCursor))
 }
 
 type PostImagesForm struct {
-	Url          string `schema:"url,required" validate:"url"`
-	ThumbnailUrl string `schema:"thumbnailUrl" validate:"omitempty,url"`
+	Url          string `schema:"url,required" validate:"http_url"`
+	ThumbnailUrl string `schema:"thumbnailUrl" validate:"omitempty,http_url"`
 }
 
 // @Summary Create image
@@ -104,19 +456,16 @@ type PostImagesForm struct {
 // @Description Image is not added if it already exists in the repository (hash match), or if the file size is larger than allowed (see config)
 // @Tags images
 // @Produce json
-// @Param sourceUrl formData string true "URL of the image to be added."
+// @Param url formData string true "URL of the image to be added."
 // @Param thumbnailUrl formData string false "URL to store as thumbnail for the image. Default is source URL."
 // @Success 200 {object} dtos.JsendEmptySuccessResponse "Success"
 // @Failure 400 {object} dtos.JsendFailResponse "Failure (bad params)"
 // @Failure 500 {object} dtos.JsendErrorResponse "Failure (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failure (timed out)"
 // @Router /api/images [post]
 func (controller *ImageController) PostImages(c *gin.Context) {
-    // ParseMultipartForm also calls ParseForm
-	if err := c.Request.ParseMultipartForm(2048); err != nil && !errors.Is(err, http.ErrNotMultipart) {
-	    c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
-	        "request": err.Error(),
-	    }))
-	    return
+	if !parseForm(c, formOverhead) {
+		return
 	}
 	var form PostImagesForm
 	if err := binding.ShouldBind(&form, c.Request.Form); err != nil {
@@ -128,10 +477,10 @@ func (controller *ImageController) PostImages(c *gin.Context) {
 		form.ThumbnailUrl = form.Url
 	}
 
-	if err := controller.imageService.AddImageByURL(form.Url, form.ThumbnailUrl); err != nil {
+	if err := controller.imageService.AddImageByURL(c.Request.Context(), form.Url, form.ThumbnailUrl); err != nil {
 		if err == utils.FileSizeExceededError {
 			c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
-				"url": fmt.Sprintf("Image at url is too large (>%d MB)", config.MAX_IMAGE_FILE_SIZE_MB),
+				"url": fmt.Sprintf("Image at url is too large (>%d MB)", controller.config.MaxFileSizeMB()),
 			}))
 			return
 		} else if err == services.ImageExistsError {
@@ -140,8 +489,7 @@ func (controller *ImageController) PostImages(c *gin.Context) {
 			}))
 			return
 		} else {
-			log.Print(err)
-			c.JSON(http.StatusInternalServerError, internalErrorJson)
+			respondInternalError(c, err, "url", form.Url)
 			return
 		}
 	}
@@ -150,8 +498,9 @@ func (controller *ImageController) PostImages(c *gin.Context) {
 }
 
 type GetImagesQuery struct {
-	Offset int `schema:"offset" validate:"min=0"`
-	Limit  int `schema:"limit" validate:"min=0"`
+	Cursor string `schema:"cursor"`
+	Offset int    `schema:"offset" validate:"min=0"`
+	Limit  int    `schema:"limit" validate:"min=0"`
 }
 
 func ginParamsToMap(params gin.Params) map[string][]string {
@@ -167,7 +516,7 @@ type ImageIdQuery struct {
 }
 
 // @Summary Get image by ID
-// @Description Returns an image with the specified ID
+// @Description Returns an image with the specified ID, along with the metadata read from its file when it was added: capture time, camera, orientation, GPS position, size, caption and keywords
 // @Tags image
 // @Produce json
 // @Param id path int true "Image ID"
@@ -175,6 +524,7 @@ type ImageIdQuery struct {
 // @Failure 400 {object} dtos.JsendFailResponse "Failure (bad params)"
 // @Failure 404 {object} dtos.JsendFailResponse "Failure (not found)"
 // @Failure 500 {object} dtos.JsendErrorResponse "Failure (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failure (timed out)"
 // @Router /api/images/{id} [get]
 func (controller *ImageController) GetImageById(c *gin.Context) {
 	var query ImageIdQuery
@@ -182,23 +532,75 @@ func (controller *ImageController) GetImageById(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(err.(binding.BindingError).FieldErrors))
 		return
 	}
-	image, err := controller.imageService.ImageRepo.GetById(query.Id)
+	image, err := controller.imageService.ImageRepo.GetById(c.Request.Context(), query.Id)
 	if err == repositories.ImageNotFoundError {
 		c.JSON(http.StatusNotFound, dtos.NewJsendFailResponse(map[string]string{
 			"id": "No image with such id exists",
 		}))
 		return
 	} else if err != nil {
-		log.Print(err)
-		c.JSON(http.StatusInternalServerError, internalErrorJson)
+		respondInternalError(c, err, "id", query.Id)
 		return
 	}
 
 	c.JSON(http.StatusOK, dtos.NewJsendImageResponse(*image))
 }
 
+// @Summary Get the original of an image
+// @Description Returns the image file as it was downloaded when the image was added, if the originals are kept (see config).
+// @Description Files that aren't images are returned as application/octet-stream. The response is sandboxed by its Content-Security-Policy
+// @Tags image
+// @Produce octet-stream
+// @Param id path int true "Image ID"
+// @Success 200 {file} file "The image file"
+// @Failure 400 {object} dtos.JsendFailResponse "Failure (bad params)"
+// @Failure 404 {object} dtos.JsendFailResponse "Failure (no such image, or its original is not kept)"
+// @Failure 500 {object} dtos.JsendErrorResponse "Failure (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failure (timed out)"
+// @Router /api/images/{id}/original [get]
+func (controller *ImageController) GetOriginalImageById(c *gin.Context) {
+	var query ImageIdQuery
+	if err := binding.ShouldBind(&query, ginParamsToMap(c.Params)); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(err.(binding.BindingError).FieldErrors))
+		return
+	}
+	reader, size, err := controller.imageService.GetOriginal(c.Request.Context(), query.Id)
+	if err == repositories.ImageNotFoundError {
+		c.JSON(http.StatusNotFound, dtos.NewJsendFailResponse(map[string]string{
+			"id": "No image with such id exists",
+		}))
+		return
+	} else if err == services.OriginalNotStoredError {
+		c.JSON(http.StatusNotFound, dtos.NewJsendFailResponse(map[string]string{
+			"id": "The original of this image is not stored",
+		}))
+		return
+	} else if err != nil {
+		respondInternalError(c, err, "id", query.Id)
+		return
+	}
+	defer reader.Close()
+
+	// The content type is sniffed since the originals are stored without one. Anything but an image, like an html
+	// or svg file served at a url that looked like an image, is sent as a download so it can't run scripts
+	buffered := bufio.NewReader(reader)
+	head, _ := buffered.Peek(512)
+	contentType := http.DetectContentType(head)
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = "application/octet-stream"
+	}
+	headers := map[string]string{
+		// Originals are stored by hash, so they never change
+		"Cache-Control":           "public, max-age=31536000, immutable",
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Disposition":     "inline",
+		"Content-Security-Policy": "sandbox; default-src 'none'; style-src 'unsafe-inline'",
+	}
+	c.DataFromReader(http.StatusOK, size, contentType, buffered, headers)
+}
+
 // @Summary Delete image by ID
-// @Description Deletes an image with the specified ID from the image repository
+// @Description Deletes an image with the specified ID from the image repository, along with its original
 // @Tags image
 // @Produce json
 // @Param id path int true "Image ID"
@@ -206,6 +608,7 @@ func (controller *ImageController) GetImageById(c *gin.Context) {
 // @Failure 400 {object} dtos.JsendFailResponse "Failed to delete image (bad params)"
 // @Failure 404 {object} dtos.JsendFailResponse "Failed to delete image (not found)"
 // @Failure 500 {object} dtos.JsendErrorResponse "Failed to delete image (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failed to delete image (timed out)"
 // @Router /api/images/{id} [delete]
 func (controller *ImageController) DeleteImageById(c *gin.Context) {
 	var query ImageIdQuery
@@ -213,15 +616,14 @@ func (controller *ImageController) DeleteImageById(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(err.(binding.BindingError).FieldErrors))
 		return
 	}
-	err := controller.imageService.ImageRepo.DeleteById(query.Id)
+	err := controller.imageService.DeleteImageById(c.Request.Context(), query.Id)
 	if err == repositories.ImageNotFoundError {
 		c.JSON(http.StatusNotFound, dtos.NewJsendFailResponse(map[string]string{
 			"id": "No image with such id exists",
 		}))
 		return
 	} else if err != nil {
-		log.Print(err)
-		c.JSON(http.StatusInternalServerError, internalErrorJson)
+		respondInternalError(c, err, "id", query.Id)
 		return
 	}
 
@@ -1,13 +1,18 @@
 package controllers
 
 import (
+	"clipsearch/config"
+	"bytes"
 	"clipsearch/models"
 	"clipsearch/repositories"
 	"clipsearch/services"
+	"context"
 	"encoding/json"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
@@ -34,8 +39,8 @@ func TestImageController(t *testing.T) {
 	t.Run("PostImages", func(t *testing.T) {
 		mockRepo := repositories.NewMockImageRepository()
 		mockClip := services.NewMockClipService()
-		imageService := services.NewImageService(mockRepo, mockClip)
-		controller := NewImageController(imageService)
+		imageService := services.NewImageService(mockRepo, mockClip, config.Default().Images)
+		controller := NewImageController(imageService, config.Default().Images)
 
 		router := gin.Default()
 		router.POST("/api/images", controller.PostImages)
@@ -70,8 +75,8 @@ func TestImageController(t *testing.T) {
 		t.Run("empty repo", func(t *testing.T) {
 			mockRepo := repositories.NewMockImageRepository()
 			mockClip := services.NewMockClipService()
-			imageService := services.NewImageService(mockRepo, mockClip)
-			controller := NewImageController(imageService)
+			imageService := services.NewImageService(mockRepo, mockClip, config.Default().Images)
+			controller := NewImageController(imageService, config.Default().Images)
 
 			router := gin.Default()
 			router.GET("/api/images", controller.GetImages)
@@ -96,22 +101,39 @@ func TestImageController(t *testing.T) {
 			assert.Equal(t, 0, result.Data.TotalCount)
 		})
 
+		t.Run("invalid cursor", func(t *testing.T) {
+			mockRepo := repositories.NewMockImageRepository()
+			mockClip := services.NewMockClipService()
+			imageService := services.NewImageService(mockRepo, mockClip, config.Default().Images)
+			controller := NewImageController(imageService, config.Default().Images)
+
+			router := gin.Default()
+			router.GET("/api/images", controller.GetImages)
+
+			req, _ := http.NewRequest(http.MethodGet, "/api/images?cursor=garbage", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+
 		t.Run("repo with image", func(t *testing.T) {
 			mockRepo := repositories.NewMockImageRepository()
 			mockClip := services.NewMockClipService()
-			imageService := services.NewImageService(mockRepo, mockClip)
+			imageService := services.NewImageService(mockRepo, mockClip, config.Default().Images)
 
-			err := imageService.AddImageByURL(testImageServer.URL, "")
+			err := imageService.AddImageByURL(context.Background(), testImageServer.URL, "")
 			if err != nil {
 				t.Errorf(err.Error())
 			}
 
-			err = imageService.AddImageByURL(testImageServer.URL, "")
+			err = imageService.AddImageByURL(context.Background(), testImageServer.URL, "")
 			if err != services.ImageExistsError {
 				t.Errorf("Expected AddImageByURL to fail with ImageExistsError")
 			}
 
-			controller := NewImageController(imageService)
+			controller := NewImageController(imageService, config.Default().Images)
 
 			router := gin.Default()
 			router.GET("/api/images", controller.GetImages)
@@ -144,8 +166,8 @@ func TestImageController(t *testing.T) {
 		t.Run("should return 404 if id is not provided", func(t *testing.T) {
 			mockRepo := repositories.NewMockImageRepository()
 			mockClip := services.NewMockClipService()
-			imageService := services.NewImageService(mockRepo, mockClip)
-			controller := NewImageController(imageService)
+			imageService := services.NewImageService(mockRepo, mockClip, config.Default().Images)
+			controller := NewImageController(imageService, config.Default().Images)
 
 			router := gin.Default()
 			router.GET("/api/images/:id", controller.GetImageById)
@@ -161,13 +183,13 @@ func TestImageController(t *testing.T) {
 		t.Run("should return data if id is valid", func(t *testing.T) {
 			mockRepo := repositories.NewMockImageRepository()
 			mockClip := services.NewMockClipService()
-			imageService := services.NewImageService(mockRepo, mockClip)
+			imageService := services.NewImageService(mockRepo, mockClip, config.Default().Images)
 
-			if err := imageService.AddImageByURL(testImageServer.URL, ""); err != nil {
+			if err := imageService.AddImageByURL(context.Background(), testImageServer.URL, ""); err != nil {
 			    t.Fatal(err.Error())
 			}
 
-			controller := NewImageController(imageService)
+			controller := NewImageController(imageService, config.Default().Images)
 
 			router := gin.Default()
 			router.GET("/api/images/:id", controller.GetImageById)
@@ -189,6 +211,317 @@ func TestImageController(t *testing.T) {
 			assert.Equal(t, testImage.Sha256, result.Data.Sha256)
 			assert.Equal(t, 1, result.Data.ImageID)
 			assert.Equal(t, testImageServer.URL, result.Data.SourceUrl)
+			if assert.NotNil(t, result.Data.Metadata) {
+				assert.Equal(t, 612, result.Data.Metadata.Width)
+				assert.Equal(t, 405, result.Data.Metadata.Height)
+			}
+		})
+	})
+
+	t.Run("GetSearchImages", func(t *testing.T) {
+		mockRepo := repositories.NewMockImageRepository()
+		mockClip := services.NewMockClipService()
+		imageService := services.NewImageService(mockRepo, mockClip, config.Default().Images)
+		controller := NewImageController(imageService, config.Default().Images)
+
+		if err := imageService.AddImageByURL(context.Background(), testImageServer.URL, ""); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		router := gin.Default()
+		router.GET("/api/images/search", controller.GetSearchImages)
+
+		t.Run("should return 400 if q is not provided", func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/search?neg=grass", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+
+		t.Run("should return 400 if q is empty", func(t *testing.T) {
+			for _, query := range []string{"q=", "q=&neg=grass"} {
+				req, _ := http.NewRequest(http.MethodGet, "/api/images/search?"+query, nil)
+				resp := httptest.NewRecorder()
+
+				router.ServeHTTP(resp, req)
+
+				assert.Equal(t, http.StatusBadRequest, resp.Code)
+				assert.Contains(t, resp.Body.String(), `"q"`)
+			}
+		})
+
+		t.Run("should return 400 if there are too many prompts", func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/search?q=dog"+strings.Repeat("&neg=grass", 17), nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+			assert.Contains(t, resp.Body.String(), `"neg"`)
+		})
+
+		t.Run("should return 400 if weights dont match prompts", func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/search?q=dog&q=cat&w=1", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+
+		t.Run("should return 400 if a weight is not a number", func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/search?q=dog&w=heavy", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+
+		t.Run("should return 400 if diversity is out of range", func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/search?q=dog&diversity=2", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+
+		t.Run("should return results for weighted prompts", func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/search?q=dog&w=2&neg=grass&negw=0.5&diversity=0.3&limit=10", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			result := struct {
+				Status string
+				Data   struct {
+					TotalCount int
+					Images     []models.Image
+				}
+			}{}
+			err := json.Unmarshal(resp.Body.Bytes(), &result)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, "success", result.Status)
+			assert.Equal(t, 1, len(result.Data.Images))
+			assert.Equal(t, testImage.Sha256, result.Data.Images[0].Sha256)
+		})
+	})
+
+	t.Run("PostSearchImages", func(t *testing.T) {
+		mockRepo := repositories.NewMockImageRepository()
+		mockClip := services.NewMockClipService()
+		imageService := services.NewImageService(mockRepo, mockClip, config.Default().Images)
+		controller := NewImageController(imageService, config.Default().Images)
+
+		if err := imageService.AddImageByURL(context.Background(), testImageServer.URL, ""); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		router := gin.Default()
+		router.POST("/api/images/search", controller.PostSearchImages)
+
+		newMultipartRequest := func(fields map[string]string, imagePath string) *http.Request {
+			var body bytes.Buffer
+			writer := multipart.NewWriter(&body)
+			for key, value := range fields {
+				if err := writer.WriteField(key, value); err != nil {
+					t.Fatal(err.Error())
+				}
+			}
+			if imagePath != "" {
+				part, err := writer.CreateFormFile("image", "image.jpg")
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+				data, err := os.ReadFile(imagePath)
+				if err != nil {
+					t.Fatal(err.Error())
+				}
+				if _, err := part.Write(data); err != nil {
+					t.Fatal(err.Error())
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err.Error())
+			}
+			req, _ := http.NewRequest(http.MethodPost, "/api/images/search", &body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			return req
+		}
+
+		t.Run("should return 400 if the query is empty", func(t *testing.T) {
+			req := newMultipartRequest(map[string]string{"limit": "10"}, "")
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+
+		t.Run("should return 400 if the image id doesnt exist", func(t *testing.T) {
+			req := newMultipartRequest(map[string]string{"imageId": "1000"}, "")
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+
+		t.Run("should return 400 if the request is too large", func(t *testing.T) {
+			imagesConfig := config.Default().Images
+			imagesConfig.MaxFileSize = 1024
+			router := gin.Default()
+			router.POST("/api/images/search", NewImageController(imageService, imagesConfig).PostSearchImages)
+			req := newMultipartRequest(map[string]string{"q": strings.Repeat("a", 2*formOverhead)}, "")
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+			assert.Contains(t, resp.Body.String(), "Request is too large")
+		})
+
+		t.Run("should return results for a mixed query", func(t *testing.T) {
+			req := newMultipartRequest(map[string]string{
+				"q":           "at night",
+				"w":           "0.5",
+				"imageId":     "1",
+				"imageWeight": "-0.2",
+				"limit":       "10",
+			}, testImage.Path)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			result := struct {
+				Status string
+				Data   struct {
+					Images []models.Image
+				}
+			}{}
+			err := json.Unmarshal(resp.Body.Bytes(), &result)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, "success", result.Status)
+			assert.Equal(t, 1, len(result.Data.Images))
+		})
+	})
+
+	t.Run("GetRefineSearchImages", func(t *testing.T) {
+		mockRepo := repositories.NewMockImageRepository()
+		mockClip := services.NewMockClipService()
+		imageService := services.NewImageService(mockRepo, mockClip, config.Default().Images)
+		controller := NewImageController(imageService, config.Default().Images)
+
+		if err := imageService.AddImageByURL(context.Background(), testImageServer.URL, ""); err != nil {
+			t.Fatal(err.Error())
+		}
+
+		router := gin.Default()
+		router.GET("/api/images/search/refine", controller.GetRefineSearchImages)
+
+		t.Run("should return 400 if q is empty", func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/search/refine?q=&liked=1", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+
+		t.Run("should return 400 if a liked image doesnt exist", func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/search/refine?q=car&liked=1000", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+
+		t.Run("should return results for a refined query", func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/search/refine?q=car&liked=1&limit=10", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			result := struct {
+				Status string
+				Data   struct {
+					Images []models.Image
+				}
+			}{}
+			err := json.Unmarshal(resp.Body.Bytes(), &result)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, "success", result.Status)
+			assert.Equal(t, 1, len(result.Data.Images))
+		})
+	})
+
+	t.Run("GetOriginalImageById", func(t *testing.T) {
+		mockRepo := repositories.NewMockImageRepository()
+		mockClip := services.NewMockClipService()
+		imageService := services.NewImageService(mockRepo, mockClip, config.Default().Images)
+		controller := NewImageController(imageService, config.Default().Images)
+
+		if err := imageService.AddImageByURL(context.Background(), testImageServer.URL, ""); err != nil {
+			t.Fatal(err.Error())
+		}
+		blobStore, err := repositories.NewLocalBlobStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		imageService.SetBlobStore(blobStore)
+
+		router := gin.Default()
+		router.GET("/api/images/:id/original", controller.GetOriginalImageById)
+
+		t.Run("should return 404 if the original was not kept", func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/1/original", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusNotFound, resp.Code)
+		})
+
+		t.Run("should return the original", func(t *testing.T) {
+			data, err := os.ReadFile(testImage.Path)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if err := blobStore.Put(context.Background(), testImage.Sha256, data); err != nil {
+				t.Fatal(err.Error())
+			}
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/1/original", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+			assert.Equal(t, "nosniff", resp.Header().Get("X-Content-Type-Options"))
+			assert.Contains(t, resp.Header().Get("Content-Security-Policy"), "sandbox")
+			assert.Equal(t, data, resp.Body.Bytes())
+		})
+
+		t.Run("should not serve other files as what they are", func(t *testing.T) {
+			page := []byte("<html><script>alert(document.cookie)</script></html>")
+			if err := blobStore.Put(context.Background(), testImage.Sha256, page); err != nil {
+				t.Fatal(err.Error())
+			}
+			req, _ := http.NewRequest(http.MethodGet, "/api/images/1/original", nil)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, "application/octet-stream", resp.Header().Get("Content-Type"))
+			assert.Equal(t, "nosniff", resp.Header().Get("X-Content-Type-Options"))
 		})
 	})
 }
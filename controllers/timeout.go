@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"clipsearch/dtos"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Status used when the client closed the connection before a response was written, as in nginx
+const statusClientClosedRequest = 499
+
+var timeoutErrorJson = dtos.NewJsendErrorResponse("Request timed out")
+
+// Returns a middleware that cancels the context of the request after timeout
+// Database queries, downloads and embedding daemon calls made while handling the request are aborted with it
+func Timeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// Responds to an unexpected error, telling timeouts and disconnected clients apart from internal errors
+func respondInternalError(c *gin.Context, err error, attrs ...any) {
+	ctx := c.Request.Context()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		attrs = append([]any{"route", c.FullPath(), "error", err}, attrs...)
+		slog.WarnContext(ctx, "Request timed out", attrs...)
+		c.JSON(http.StatusGatewayTimeout, timeoutErrorJson)
+	case errors.Is(err, context.Canceled) && ctx.Err() != nil:
+		attrs = append([]any{"route", c.FullPath()}, attrs...)
+		slog.InfoContext(ctx, "Request cancelled by client", attrs...)
+		c.AbortWithStatus(statusClientClosedRequest)
+	default:
+		logInternalError(c, err, attrs...)
+		c.JSON(http.StatusInternalServerError, internalErrorJson)
+	}
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(timeout time.Duration, handler gin.HandlerFunc) *gin.Engine {
+		router := gin.Default()
+		router.GET("/", Timeout(timeout), handler)
+		return router
+	}
+
+	t.Run("slow handlers should time out", func(t *testing.T) {
+		router := newRouter(10*time.Millisecond, func(c *gin.Context) {
+			<-c.Request.Context().Done()
+			respondInternalError(c, c.Request.Context().Err())
+		})
+
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusGatewayTimeout, resp.Code)
+	})
+
+	t.Run("cancelled requests shouldn't be reported as errors", func(t *testing.T) {
+		router := newRouter(time.Minute, func(c *gin.Context) {
+			<-c.Request.Context().Done()
+			respondInternalError(c, c.Request.Context().Err())
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, statusClientClosedRequest, resp.Code)
+	})
+
+	t.Run("other errors should be internal errors", func(t *testing.T) {
+		router := newRouter(time.Minute, func(c *gin.Context) {
+			respondInternalError(c, errors.New("Broken"))
+		})
+
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	})
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"clipsearch/binding"
+	"clipsearch/config"
+	"clipsearch/dtos"
+	"clipsearch/repositories"
+	"clipsearch/services"
+	"clipsearch/utils"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type VideoController struct {
+	videoService *services.VideoService
+	config       config.VideoConfig
+}
+
+func NewVideoController(videoService *services.VideoService, videoConfig config.VideoConfig) *VideoController {
+	return &VideoController{videoService: videoService, config: videoConfig}
+}
+
+type PostVideosForm struct {
+	Url string `schema:"url,required" validate:"http_url"`
+}
+
+// @Summary Add a video
+// @Description Downloads a video and embeds frames of it, one every frameInterval or one at every scene change (see config). The frames are stored as images with the id of the video and the time they are shown at, so searches return them along with the matching timestamp.
+// @Description The video is not added if it already exists (hash match), or if the file size is larger than allowed (see config)
+// @Tags videos
+// @Produce json
+// @Param url formData string true "URL of the video to be added"
+// @Success 200 {object} dtos.JsendVideoCreatedResponse "Success"
+// @Failure 400 {object} dtos.JsendFailResponse "Failure (bad params or video)"
+// @Failure 500 {object} dtos.JsendErrorResponse "Failure (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failure (timed out)"
+// @Router /api/videos [post]
+func (controller *VideoController) PostVideos(c *gin.Context) {
+	if !parseForm(c, formOverhead) {
+		return
+	}
+	var form PostVideosForm
+	if err := binding.ShouldBind(&form, c.Request.Form); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(err.(binding.BindingError).FieldErrors))
+		return
+	}
+
+	id, err := controller.videoService.AddVideoByURL(c.Request.Context(), form.Url)
+	if err == utils.FileSizeExceededError {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"url": fmt.Sprintf("Video at url is too large (>%d MB)", controller.config.MaxFileSizeMB()),
+		}))
+		return
+	} else if err == services.VideoExistsError {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"url": "Video already exists",
+		}))
+		return
+	} else if errors.Is(err, services.UnreadableVideoError) {
+		// The output of ffmpeg is only logged, it names the temporary file
+		slog.InfoContext(c.Request.Context(), "Unreadable video", "url", form.Url, "error", err)
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"url": services.UnreadableVideoError.Error(),
+		}))
+		return
+	} else if err == services.NoFramesError {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(map[string]string{
+			"url": err.Error(),
+		}))
+		return
+	} else if err != nil {
+		respondInternalError(c, err, "url", form.Url)
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.NewJsendVideoCreatedResponse(id))
+}
+
+type VideoIdQuery struct {
+	Id int `schema:"id" validate:"min=0"`
+}
+
+// @Summary Get video by ID
+// @Description Returns a video with the specified ID along with its frames
+// @Tags videos
+// @Produce json
+// @Param id path int true "Video ID"
+// @Success 200 {object} dtos.JsendVideoResponse "Success"
+// @Failure 400 {object} dtos.JsendFailResponse "Failure (bad params)"
+// @Failure 404 {object} dtos.JsendFailResponse "Failure (not found)"
+// @Failure 500 {object} dtos.JsendErrorResponse "Failure (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failure (timed out)"
+// @Router /api/videos/{id} [get]
+func (controller *VideoController) GetVideoById(c *gin.Context) {
+	var query VideoIdQuery
+	if err := binding.ShouldBind(&query, ginParamsToMap(c.Params)); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(err.(binding.BindingError).FieldErrors))
+		return
+	}
+	video, err := controller.videoService.GetVideoById(c.Request.Context(), query.Id)
+	if err == repositories.VideoNotFoundError {
+		c.JSON(http.StatusNotFound, dtos.NewJsendFailResponse(map[string]string{
+			"id": "No video with such id exists",
+		}))
+		return
+	} else if err != nil {
+		respondInternalError(c, err, "id", query.Id)
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.NewJsendVideoResponse(video.Video, video.Frames))
+}
+
+// @Summary Delete video by ID
+// @Description Deletes a video with the specified ID along with its frames and their originals
+// @Tags videos
+// @Produce json
+// @Param id path int true "Video ID"
+// @Success 200 {object} dtos.JsendEmptySuccessResponse "Successfully deleted video"
+// @Failure 400 {object} dtos.JsendFailResponse "Failed to delete video (bad params)"
+// @Failure 404 {object} dtos.JsendFailResponse "Failed to delete video (not found)"
+// @Failure 500 {object} dtos.JsendErrorResponse "Failed to delete video (internal error)"
+// @Failure 504 {object} dtos.JsendErrorResponse "Failed to delete video (timed out)"
+// @Router /api/videos/{id} [delete]
+func (controller *VideoController) DeleteVideoById(c *gin.Context) {
+	var query VideoIdQuery
+	if err := binding.ShouldBind(&query, ginParamsToMap(c.Params)); err != nil {
+		c.JSON(http.StatusBadRequest, dtos.NewJsendFailResponse(err.(binding.BindingError).FieldErrors))
+		return
+	}
+	err := controller.videoService.DeleteVideoById(c.Request.Context(), query.Id)
+	if err == repositories.VideoNotFoundError {
+		c.JSON(http.StatusNotFound, dtos.NewJsendFailResponse(map[string]string{
+			"id": "No video with such id exists",
+		}))
+		return
+	} else if err != nil {
+		respondInternalError(c, err, "id", query.Id)
+		return
+	}
+
+	c.JSON(http.StatusOK, dtos.NewJsendEmptySuccessResponse())
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"clipsearch/config"
+	"clipsearch/repositories"
+	"clipsearch/services"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVideoController(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockRepo := repositories.NewMockImageRepository()
+	imageService := services.NewImageService(mockRepo, services.NewMockClipService(), config.Default().Images)
+	controller := NewVideoController(services.NewVideoService(imageService, config.Default().Videos), config.Default().Videos)
+	router := gin.Default()
+	router.POST("/api/videos", controller.PostVideos)
+	router.GET("/api/videos/:id", controller.GetVideoById)
+	router.DELETE("/api/videos/:id", controller.DeleteVideoById)
+
+	t.Run("should return 400 if the url is missing or invalid", func(t *testing.T) {
+		for _, form := range []url.Values{{}, {"url": {"not a url"}}} {
+			resp := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/videos", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		}
+	})
+
+	t.Run("should return 404 for videos that don't exist", func(t *testing.T) {
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			resp := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, "/api/videos/12", nil)
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusNotFound, resp.Code)
+		}
+	})
+}
@@ -0,0 +1,8 @@
+ALTER TABLE Images DROP COLUMN IF EXISTS NextEmbeddingModel;
+ALTER TABLE Images DROP COLUMN IF EXISTS NextEmbedding;
+-- The column only fits the embeddings of the model of clip_daemons/, the others are lost
+UPDATE Images SET Embedding = NULL
+   WHERE EmbeddingModel IS DISTINCT FROM 'ViT-L/14@336px' OR vector_dims(Embedding) <> 768;
+ALTER TABLE Images DROP COLUMN IF EXISTS EmbeddingModel;
+ALTER TABLE Images ALTER COLUMN Embedding TYPE vector(768);
+DROP TABLE IF EXISTS EmbeddingModels;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS EmbeddingModels(
+   Name TEXT PRIMARY KEY,
+   Dimension INT NOT NULL CHECK (Dimension > 0),
+   Active BOOLEAN NOT NULL DEFAULT FALSE
+);
+-- Searches use the embeddings of the single active model
+CREATE UNIQUE INDEX IF NOT EXISTS EmbeddingModels_Active ON EmbeddingModels (Active) WHERE Active;
+-- Existing embeddings were computed by the model of clip_daemons/
+INSERT INTO EmbeddingModels (Name, Dimension, Active)
+   SELECT 'ViT-L/14@336px', 768, TRUE WHERE EXISTS (SELECT 1 FROM Images)
+   ON CONFLICT DO NOTHING;
+ALTER TABLE Images ALTER COLUMN Embedding TYPE vector;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS EmbeddingModel TEXT REFERENCES EmbeddingModels(Name);
+UPDATE Images SET EmbeddingModel = 'ViT-L/14@336px' WHERE EmbeddingModel IS NULL;
+-- Filled in by the re-embedding job, replaces Embedding at cut-over
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS NextEmbedding vector;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS NextEmbeddingModel TEXT REFERENCES EmbeddingModels(Name);
@@ -0,0 +1,9 @@
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS Embedding vector;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS EmbeddingModel TEXT REFERENCES EmbeddingModels(Name);
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS NextEmbedding vector;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS NextEmbeddingModel TEXT REFERENCES EmbeddingModels(Name);
+-- Only the embeddings of the active model fit in the Images table, the others are lost
+UPDATE Images SET Embedding = ImageEmbeddings.Embedding, EmbeddingModel = ImageEmbeddings.Model
+   FROM ImageEmbeddings JOIN EmbeddingModels ON EmbeddingModels.Name = ImageEmbeddings.Model AND EmbeddingModels.Active
+   WHERE ImageEmbeddings.ImageID = Images.ImageID;
+DROP TABLE IF EXISTS ImageEmbeddings;
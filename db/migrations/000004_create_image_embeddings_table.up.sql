@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS ImageEmbeddings(
+   ImageID INT NOT NULL REFERENCES Images(ImageID) ON DELETE CASCADE,
+   Model TEXT NOT NULL REFERENCES EmbeddingModels(Name),
+   Embedding vector NOT NULL,
+   PRIMARY KEY (ImageID, Model)
+);
+INSERT INTO ImageEmbeddings (ImageID, Model, Embedding)
+   SELECT ImageID, EmbeddingModel, Embedding FROM Images WHERE Embedding IS NOT NULL AND EmbeddingModel IS NOT NULL
+   ON CONFLICT DO NOTHING;
+-- Embeddings of a re-embedding in progress are kept, the job continues with the remaining images
+INSERT INTO ImageEmbeddings (ImageID, Model, Embedding)
+   SELECT ImageID, NextEmbeddingModel, NextEmbedding FROM Images WHERE NextEmbedding IS NOT NULL AND NextEmbeddingModel IS NOT NULL
+   ON CONFLICT DO NOTHING;
+ALTER TABLE Images DROP COLUMN IF EXISTS NextEmbeddingModel;
+ALTER TABLE Images DROP COLUMN IF EXISTS NextEmbedding;
+ALTER TABLE Images DROP COLUMN IF EXISTS EmbeddingModel;
+ALTER TABLE Images DROP COLUMN IF EXISTS Embedding;
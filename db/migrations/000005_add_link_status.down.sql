@@ -0,0 +1,3 @@
+ALTER TABLE Images DROP COLUMN IF EXISTS LinkFailures;
+ALTER TABLE Images DROP COLUMN IF EXISTS LinkCheckedAt;
+ALTER TABLE Images DROP COLUMN IF EXISTS LinkStatus;
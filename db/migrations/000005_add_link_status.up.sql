@@ -0,0 +1,5 @@
+-- Filled in by the link checker, see services.LinkCheckService
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS LinkStatus TEXT NOT NULL DEFAULT 'unchecked';
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS LinkCheckedAt TIMESTAMPTZ;
+-- Consecutive failed checks, dead images are purged after enough of them
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS LinkFailures INT NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE Images DROP COLUMN IF EXISTS PageUrl;
@@ -0,0 +1,2 @@
+-- The web page an image was found on by the crawler, NULL for the images added otherwise
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS PageUrl TEXT;
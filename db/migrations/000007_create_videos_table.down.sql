@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS images_video_id_idx;
+DELETE FROM Images WHERE VideoID IS NOT NULL;
+ALTER TABLE Images DROP COLUMN IF EXISTS FrameTime;
+ALTER TABLE Images DROP COLUMN IF EXISTS VideoID;
+DROP TABLE IF EXISTS Videos;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS Videos(
+   VideoID serial PRIMARY KEY,
+   SourceUrl TEXT NOT NULL,
+   Sha256 CHAR(64) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS videos_sha256_idx ON Videos (Sha256);
+-- The frames of a video are stored as images, FrameTime is the number of seconds into the video
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS VideoID INT REFERENCES Videos(VideoID) ON DELETE CASCADE;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS FrameTime DOUBLE PRECISION;
+CREATE INDEX IF NOT EXISTS images_video_id_idx ON Images (VideoID) WHERE VideoID IS NOT NULL;
@@ -0,0 +1,9 @@
+-- The embeddings of the sampled frames of animated images, next to the averaged one in ImageEmbeddings.
+-- Searches match an animation by its closest frame
+CREATE TABLE IF NOT EXISTS ImageFrameEmbeddings(
+   ImageID INT NOT NULL REFERENCES Images(ImageID) ON DELETE CASCADE,
+   Model TEXT NOT NULL REFERENCES EmbeddingModels(Name),
+   Frame INT NOT NULL,
+   Embedding vector NOT NULL,
+   PRIMARY KEY (ImageID, Model, Frame)
+);
@@ -0,0 +1,11 @@
+ALTER TABLE Images DROP COLUMN IF EXISTS Keywords;
+ALTER TABLE Images DROP COLUMN IF EXISTS Caption;
+ALTER TABLE Images DROP COLUMN IF EXISTS Height;
+ALTER TABLE Images DROP COLUMN IF EXISTS Width;
+ALTER TABLE Images DROP COLUMN IF EXISTS Altitude;
+ALTER TABLE Images DROP COLUMN IF EXISTS Longitude;
+ALTER TABLE Images DROP COLUMN IF EXISTS Latitude;
+ALTER TABLE Images DROP COLUMN IF EXISTS Orientation;
+ALTER TABLE Images DROP COLUMN IF EXISTS CameraModel;
+ALTER TABLE Images DROP COLUMN IF EXISTS CameraMake;
+ALTER TABLE Images DROP COLUMN IF EXISTS CapturedAt;
@@ -0,0 +1,12 @@
+-- The normalized subset of the EXIF, XMP and IPTC metadata of the image files, NULL where a file records nothing
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS CapturedAt TIMESTAMPTZ;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS CameraMake TEXT;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS CameraModel TEXT;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS Orientation SMALLINT;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS Latitude DOUBLE PRECISION;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS Longitude DOUBLE PRECISION;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS Altitude DOUBLE PRECISION;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS Width INT;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS Height INT;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS Caption TEXT;
+ALTER TABLE Images ADD COLUMN IF NOT EXISTS Keywords TEXT[];
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS images_source_url_idx;
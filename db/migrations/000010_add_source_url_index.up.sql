@@ -0,0 +1,2 @@
+-- The watched directories and the crawler look images up by source url. text_pattern_ops also serves prefix matches
+CREATE INDEX IF NOT EXISTS images_source_url_idx ON Images (SourceUrl text_pattern_ops);
@@ -0,0 +1,31 @@
+package dtos
+
+import "clipsearch/models"
+
+// swagger:model JsendArchiveImportResponse
+type JsendArchiveImportResponse struct {
+	// Set to "success"
+	Status string                    `json:"status" example:"success"`
+	Data   ArchiveImportResponseData `json:"data"`
+}
+
+type ArchiveImportResponseData struct {
+	// How many entries ended with each status
+	Counts map[models.ArchiveEntryStatus]int `json:"counts" example:"added:12,duplicate:1"`
+	// The outcome of every entry except the directories, in the order they are stored
+	Entries []models.ArchiveEntryResult `json:"entries"`
+}
+
+func NewJsendArchiveImportResponse(entries []models.ArchiveEntryResult) JsendArchiveImportResponse {
+	counts := make(map[models.ArchiveEntryStatus]int)
+	for _, entry := range entries {
+		counts[entry.Status]++
+	}
+	return JsendArchiveImportResponse{
+		Status: "success",
+		Data: ArchiveImportResponseData{
+			Counts:  counts,
+			Entries: entries,
+		},
+	}
+}
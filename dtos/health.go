@@ -0,0 +1,20 @@
+package dtos
+
+// swagger:model JsendReadinessResponse
+type JsendReadinessResponse struct {
+	// Set to "success" if all dependencies are usable, "fail" otherwise
+	Status string `json:"status" example:"fail"`
+	// Status of every dependency: "ok" or the reason it is not usable
+	Data map[string]string `json:"data" example:"postgres:ok,textEmbedding:Check timed out"`
+}
+
+func NewJsendReadinessResponse(ready bool, dependencies map[string]string) JsendReadinessResponse {
+	status := "success"
+	if !ready {
+		status = "fail"
+	}
+	return JsendReadinessResponse{
+		Status: status,
+		Data:   dependencies,
+	}
+}
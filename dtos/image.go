@@ -20,6 +20,8 @@ type ImagesResponseData struct {
 	// Total amount of images contained in the repository
 	TotalCount int            `json:"totalCount" example:"1234"`
 	Images     []models.Image `json:"images"`
+	// Pass as `cursor` to get the next page. Omitted if there are no more images
+	NextCursor string `json:"nextCursor,omitempty" example:"eyJpZCI6MTAyfQ"`
 }
 
 func NewJsendImageResponse(image models.Image) JsendImageResponse {
@@ -29,12 +31,13 @@ func NewJsendImageResponse(image models.Image) JsendImageResponse {
 	}
 }
 
-func NewJsendImagesResponse(totalCount int, images []models.Image) JsendImagesResponse {
+func NewJsendImagesResponse(totalCount int, images []models.Image, nextCursor string) JsendImagesResponse {
 	return JsendImagesResponse{
 		Status: "success",
 		Data: ImagesResponseData{
 			TotalCount: totalCount,
 			Images:     images,
+			NextCursor: nextCursor,
 		},
 	}
 }
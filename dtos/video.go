@@ -0,0 +1,45 @@
+package dtos
+
+import "clipsearch/models"
+
+// swagger:model JsendVideoResponse
+type JsendVideoResponse struct {
+	// Set to "success"
+	Status string            `json:"status" example:"success"`
+	Data   VideoResponseData `json:"data"`
+}
+
+type VideoResponseData struct {
+	Video models.Video `json:"video"`
+	// The frames that were embedded, ordered by frameTime
+	Frames []models.Image `json:"frames"`
+}
+
+// swagger:model JsendVideoCreatedResponse
+type JsendVideoCreatedResponse struct {
+	// Set to "success"
+	Status string                   `json:"status" example:"success"`
+	Data   VideoCreatedResponseData `json:"data"`
+}
+
+type VideoCreatedResponseData struct {
+	// ID of the added video
+	Id int `json:"id" example:"7"`
+}
+
+func NewJsendVideoResponse(video models.Video, frames []models.Image) JsendVideoResponse {
+	return JsendVideoResponse{
+		Status: "success",
+		Data: VideoResponseData{
+			Video:  video,
+			Frames: frames,
+		},
+	}
+}
+
+func NewJsendVideoCreatedResponse(id int) JsendVideoCreatedResponse {
+	return JsendVideoCreatedResponse{
+		Status: "success",
+		Data:   VideoCreatedResponseData{Id: id},
+	}
+}
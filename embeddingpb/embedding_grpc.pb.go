@@ -0,0 +1,294 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: embedding.proto
+
+package embeddingpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	EmbeddingService_EmbedText_FullMethodName       = "/clipsearch.embedding.v1.EmbeddingService/EmbedText"
+	EmbeddingService_EmbedImage_FullMethodName      = "/clipsearch.embedding.v1.EmbeddingService/EmbedImage"
+	EmbeddingService_EmbedTextBatch_FullMethodName  = "/clipsearch.embedding.v1.EmbeddingService/EmbedTextBatch"
+	EmbeddingService_EmbedImageBatch_FullMethodName = "/clipsearch.embedding.v1.EmbeddingService/EmbedImageBatch"
+	EmbeddingService_GetModelInfo_FullMethodName    = "/clipsearch.embedding.v1.EmbeddingService/GetModelInfo"
+	EmbeddingService_Health_FullMethodName          = "/clipsearch.embedding.v1.EmbeddingService/Health"
+)
+
+// EmbeddingServiceClient is the client API for EmbeddingService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EmbeddingServiceClient interface {
+	EmbedText(ctx context.Context, in *EmbedTextRequest, opts ...grpc.CallOption) (*Embedding, error)
+	EmbedImage(ctx context.Context, in *EmbedImageRequest, opts ...grpc.CallOption) (*Embedding, error)
+	EmbedTextBatch(ctx context.Context, in *EmbedTextBatchRequest, opts ...grpc.CallOption) (*EmbeddingBatch, error)
+	EmbedImageBatch(ctx context.Context, in *EmbedImageBatchRequest, opts ...grpc.CallOption) (*EmbeddingBatch, error)
+	GetModelInfo(ctx context.Context, in *GetModelInfoRequest, opts ...grpc.CallOption) (*ModelInfo, error)
+	Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error)
+}
+
+type embeddingServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEmbeddingServiceClient(cc grpc.ClientConnInterface) EmbeddingServiceClient {
+	return &embeddingServiceClient{cc}
+}
+
+func (c *embeddingServiceClient) EmbedText(ctx context.Context, in *EmbedTextRequest, opts ...grpc.CallOption) (*Embedding, error) {
+	out := new(Embedding)
+	err := c.cc.Invoke(ctx, EmbeddingService_EmbedText_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *embeddingServiceClient) EmbedImage(ctx context.Context, in *EmbedImageRequest, opts ...grpc.CallOption) (*Embedding, error) {
+	out := new(Embedding)
+	err := c.cc.Invoke(ctx, EmbeddingService_EmbedImage_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *embeddingServiceClient) EmbedTextBatch(ctx context.Context, in *EmbedTextBatchRequest, opts ...grpc.CallOption) (*EmbeddingBatch, error) {
+	out := new(EmbeddingBatch)
+	err := c.cc.Invoke(ctx, EmbeddingService_EmbedTextBatch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *embeddingServiceClient) EmbedImageBatch(ctx context.Context, in *EmbedImageBatchRequest, opts ...grpc.CallOption) (*EmbeddingBatch, error) {
+	out := new(EmbeddingBatch)
+	err := c.cc.Invoke(ctx, EmbeddingService_EmbedImageBatch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *embeddingServiceClient) GetModelInfo(ctx context.Context, in *GetModelInfoRequest, opts ...grpc.CallOption) (*ModelInfo, error) {
+	out := new(ModelInfo)
+	err := c.cc.Invoke(ctx, EmbeddingService_GetModelInfo_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *embeddingServiceClient) Health(ctx context.Context, in *HealthRequest, opts ...grpc.CallOption) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, EmbeddingService_Health_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EmbeddingServiceServer is the server API for EmbeddingService service.
+// All implementations must embed UnimplementedEmbeddingServiceServer
+// for forward compatibility
+type EmbeddingServiceServer interface {
+	EmbedText(context.Context, *EmbedTextRequest) (*Embedding, error)
+	EmbedImage(context.Context, *EmbedImageRequest) (*Embedding, error)
+	EmbedTextBatch(context.Context, *EmbedTextBatchRequest) (*EmbeddingBatch, error)
+	EmbedImageBatch(context.Context, *EmbedImageBatchRequest) (*EmbeddingBatch, error)
+	GetModelInfo(context.Context, *GetModelInfoRequest) (*ModelInfo, error)
+	Health(context.Context, *HealthRequest) (*HealthResponse, error)
+	mustEmbedUnimplementedEmbeddingServiceServer()
+}
+
+// UnimplementedEmbeddingServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedEmbeddingServiceServer struct {
+}
+
+func (UnimplementedEmbeddingServiceServer) EmbedText(context.Context, *EmbedTextRequest) (*Embedding, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EmbedText not implemented")
+}
+func (UnimplementedEmbeddingServiceServer) EmbedImage(context.Context, *EmbedImageRequest) (*Embedding, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EmbedImage not implemented")
+}
+func (UnimplementedEmbeddingServiceServer) EmbedTextBatch(context.Context, *EmbedTextBatchRequest) (*EmbeddingBatch, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EmbedTextBatch not implemented")
+}
+func (UnimplementedEmbeddingServiceServer) EmbedImageBatch(context.Context, *EmbedImageBatchRequest) (*EmbeddingBatch, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EmbedImageBatch not implemented")
+}
+func (UnimplementedEmbeddingServiceServer) GetModelInfo(context.Context, *GetModelInfoRequest) (*ModelInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetModelInfo not implemented")
+}
+func (UnimplementedEmbeddingServiceServer) Health(context.Context, *HealthRequest) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
+func (UnimplementedEmbeddingServiceServer) mustEmbedUnimplementedEmbeddingServiceServer() {}
+
+// UnsafeEmbeddingServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EmbeddingServiceServer will
+// result in compilation errors.
+type UnsafeEmbeddingServiceServer interface {
+	mustEmbedUnimplementedEmbeddingServiceServer()
+}
+
+func RegisterEmbeddingServiceServer(s grpc.ServiceRegistrar, srv EmbeddingServiceServer) {
+	s.RegisterService(&EmbeddingService_ServiceDesc, srv)
+}
+
+func _EmbeddingService_EmbedText_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmbedTextRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmbeddingServiceServer).EmbedText(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmbeddingService_EmbedText_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmbeddingServiceServer).EmbedText(ctx, req.(*EmbedTextRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmbeddingService_EmbedImage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmbedImageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmbeddingServiceServer).EmbedImage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmbeddingService_EmbedImage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmbeddingServiceServer).EmbedImage(ctx, req.(*EmbedImageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmbeddingService_EmbedTextBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmbedTextBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmbeddingServiceServer).EmbedTextBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmbeddingService_EmbedTextBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmbeddingServiceServer).EmbedTextBatch(ctx, req.(*EmbedTextBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmbeddingService_EmbedImageBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmbedImageBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmbeddingServiceServer).EmbedImageBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmbeddingService_EmbedImageBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmbeddingServiceServer).EmbedImageBatch(ctx, req.(*EmbedImageBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmbeddingService_GetModelInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetModelInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmbeddingServiceServer).GetModelInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmbeddingService_GetModelInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmbeddingServiceServer).GetModelInfo(ctx, req.(*GetModelInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EmbeddingService_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EmbeddingServiceServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EmbeddingService_Health_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EmbeddingServiceServer).Health(ctx, req.(*HealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// EmbeddingService_ServiceDesc is the grpc.ServiceDesc for EmbeddingService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EmbeddingService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "clipsearch.embedding.v1.EmbeddingService",
+	HandlerType: (*EmbeddingServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "EmbedText",
+			Handler:    _EmbeddingService_EmbedText_Handler,
+		},
+		{
+			MethodName: "EmbedImage",
+			Handler:    _EmbeddingService_EmbedImage_Handler,
+		},
+		{
+			MethodName: "EmbedTextBatch",
+			Handler:    _EmbeddingService_EmbedTextBatch_Handler,
+		},
+		{
+			MethodName: "EmbedImageBatch",
+			Handler:    _EmbeddingService_EmbedImageBatch_Handler,
+		},
+		{
+			MethodName: "GetModelInfo",
+			Handler:    _EmbeddingService_GetModelInfo_Handler,
+		},
+		{
+			MethodName: "Health",
+			Handler:    _EmbeddingService_Health_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "embedding.proto",
+}
@@ -0,0 +1,4 @@
+// Package embeddingpb contains the gRPC protocol of the embedding daemons
+package embeddingpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative embedding.proto
@@ -0,0 +1,121 @@
+// Package fakeclip computes deterministic stand-ins for CLIP embeddings, so the embedding
+// protocols and search can be tested without Python or a model
+package fakeclip
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"math/rand"
+	"strings"
+	"unicode"
+)
+
+// The dimension of ViT-L/14@336px, which the database schema expects
+const Dimension = 768
+
+const ModelName = "fakeclip"
+
+// Returns a pseudo random unit vector that only depends on seed
+func randomUnitVector(seed int64) []float64 {
+	random := rand.New(rand.NewSource(seed))
+	vector := make([]float64, Dimension)
+	for i := range vector {
+		vector[i] = random.NormFloat64()
+	}
+	return vector
+}
+
+func normalized(vector []float64) []float32 {
+	var norm float64
+	for _, x := range vector {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	result := make([]float32, len(vector))
+	for i, x := range vector {
+		if norm > 0 {
+			result[i] = float32(x / norm)
+		}
+	}
+	return result
+}
+
+func wordSeed(word string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(word))
+	return int64(h.Sum64())
+}
+
+// Returns the sum of a random vector per word, normalized. Texts sharing words get similar embeddings
+func EmbedText(text string) []float32 {
+	sum := make([]float64, Dimension)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		for i, x := range randomUnitVector(wordSeed(word)) {
+			sum[i] += x
+		}
+	}
+	return normalized(sum)
+}
+
+// Images are summarized by the mean color of each cell of a grid
+const imageGridSize = 4
+const imageFeatureCount = imageGridSize * imageGridSize * 3
+
+// Fixed random projection of the image features to the embedding space
+var imageProjection = func() [][]float64 {
+	projection := make([][]float64, imageFeatureCount)
+	for i := range projection {
+		projection[i] = randomUnitVector(int64(i))
+	}
+	return projection
+}()
+
+// Returns an embedding derived from the colors of the image, so similar looking images get similar embeddings
+// Fails like the real daemon if imageData is not a JPEG, PNG or GIF image
+func EmbedImage(imageData []byte) ([]float32, error) {
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, fmt.Errorf("cannot identify image file: %w", err)
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, fmt.Errorf("image is empty")
+	}
+
+	var sums [imageFeatureCount]float64
+	var counts [imageGridSize * imageGridSize]float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cell := (y-bounds.Min.Y)*imageGridSize/bounds.Dy()*imageGridSize + (x-bounds.Min.X)*imageGridSize/bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			sums[cell*3] += float64(r) / 0xffff
+			sums[cell*3+1] += float64(g) / 0xffff
+			sums[cell*3+2] += float64(b) / 0xffff
+			counts[cell]++
+		}
+	}
+
+	embedding := make([]float64, Dimension)
+	for i, sum := range sums {
+		count := counts[i/3]
+		if count == 0 {
+			// Images smaller than the grid leave some cells empty
+			continue
+		}
+		// Centered so that colors, not brightness, dominate
+		feature := sum/count - 0.5
+		for j, x := range imageProjection[i] {
+			embedding[j] += feature * x
+		}
+	}
+	return normalized(embedding), nil
+}
@@ -0,0 +1,65 @@
+package fakeclip
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func dot(a []float32, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func TestEmbedText(t *testing.T) {
+	t.Run("deterministic unit vectors", func(t *testing.T) {
+		a := EmbedText("A red car")
+		b := EmbedText("a red car!")
+		if len(a) != Dimension {
+			t.Fatalf("Dimension = %d, want = %d", len(a), Dimension)
+		}
+		if math.Abs(dot(a, a)-1) > 1e-5 {
+			t.Fatalf("Norm = %f, want = 1", math.Sqrt(dot(a, a)))
+		}
+		if math.Abs(dot(a, b)-1) > 1e-5 {
+			t.Fatalf("Embeddings of the same words differ")
+		}
+	})
+
+	t.Run("shared words are similar", func(t *testing.T) {
+		query := EmbedText("red car")
+		near := EmbedText("a red car on a road")
+		far := EmbedText("a cat sleeping on a sofa")
+		if dot(query, near) <= dot(query, far) {
+			t.Fatalf("Similarity to a text sharing words = %f, want > %f", dot(query, near), dot(query, far))
+		}
+	})
+}
+
+func TestEmbedImage(t *testing.T) {
+	red, err := EmbedImage(SolidColorPng(color.RGBA{R: 255, A: 255}))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	darkRed, err := EmbedImage(SolidColorPng(color.RGBA{R: 200, G: 20, A: 255}))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	blue, err := EmbedImage(SolidColorPng(color.RGBA{B: 255, A: 255}))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(red) != Dimension || math.Abs(dot(red, red)-1) > 1e-5 {
+		t.Fatalf("Expected a unit vector of dimension %d", Dimension)
+	}
+	if dot(red, darkRed) <= dot(red, blue) {
+		t.Fatalf("Similarity to a similar color = %f, want > %f", dot(red, darkRed), dot(red, blue))
+	}
+
+	if _, err := EmbedImage([]byte("not an image")); err == nil {
+		t.Fatalf("Expected data that is not an image to be rejected")
+	}
+}
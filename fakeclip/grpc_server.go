@@ -0,0 +1,74 @@
+package fakeclip
+
+import (
+	"clipsearch/embeddingpb"
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Images are sent whole, so messages may be much larger than the gRPC default of 4 MB
+const maxGrpcMessageSize = 64 * 1024 * 1024
+
+type embeddingServer struct {
+	embeddingpb.UnimplementedEmbeddingServiceServer
+}
+
+// Returns a gRPC server of the embedding protocol answering with fake embeddings
+func NewGrpcServer() *grpc.Server {
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(maxGrpcMessageSize))
+	embeddingpb.RegisterEmbeddingServiceServer(server, &embeddingServer{})
+	return server
+}
+
+func (s *embeddingServer) EmbedText(ctx context.Context, req *embeddingpb.EmbedTextRequest) (*embeddingpb.Embedding, error) {
+	if req.Text == "" {
+		return nil, status.Error(codes.InvalidArgument, "Text is empty")
+	}
+	return &embeddingpb.Embedding{Values: EmbedText(req.Text)}, nil
+}
+
+func (s *embeddingServer) EmbedImage(ctx context.Context, req *embeddingpb.EmbedImageRequest) (*embeddingpb.Embedding, error) {
+	if len(req.Image) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Image is empty")
+	}
+	embedding, err := EmbedImage(req.Image)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &embeddingpb.Embedding{Values: embedding}, nil
+}
+
+func (s *embeddingServer) EmbedTextBatch(ctx context.Context, req *embeddingpb.EmbedTextBatchRequest) (*embeddingpb.EmbeddingBatch, error) {
+	batch := &embeddingpb.EmbeddingBatch{}
+	for _, text := range req.Texts {
+		embedding, err := s.EmbedText(ctx, &embeddingpb.EmbedTextRequest{Text: text})
+		if err != nil {
+			return nil, err
+		}
+		batch.Embeddings = append(batch.Embeddings, embedding)
+	}
+	return batch, nil
+}
+
+func (s *embeddingServer) EmbedImageBatch(ctx context.Context, req *embeddingpb.EmbedImageBatchRequest) (*embeddingpb.EmbeddingBatch, error) {
+	batch := &embeddingpb.EmbeddingBatch{}
+	for _, image := range req.Images {
+		embedding, err := s.EmbedImage(ctx, &embeddingpb.EmbedImageRequest{Image: image})
+		if err != nil {
+			return nil, err
+		}
+		batch.Embeddings = append(batch.Embeddings, embedding)
+	}
+	return batch, nil
+}
+
+func (s *embeddingServer) GetModelInfo(ctx context.Context, req *embeddingpb.GetModelInfoRequest) (*embeddingpb.ModelInfo, error) {
+	return &embeddingpb.ModelInfo{Name: ModelName, Dimension: Dimension}, nil
+}
+
+func (s *embeddingServer) Health(ctx context.Context, req *embeddingpb.HealthRequest) (*embeddingpb.HealthResponse, error) {
+	return &embeddingpb.HealthResponse{Serving: true}, nil
+}
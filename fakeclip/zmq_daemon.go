@@ -0,0 +1,115 @@
+package fakeclip
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/zeromq/goczmq"
+)
+
+// How often the serving loop checks whether the daemon was closed
+const zmqPollIntervalMs = 50
+
+var modelInfo = struct {
+	Name      string `json:"name"`
+	Dimension int    `json:"dimension"`
+}{Name: ModelName, Dimension: Dimension}
+
+// A fake embedding daemon speaking the zmq protocol of clip_daemons/*.py:
+// a REP socket receiving an "encode" frame followed by the image or text, or an "info" frame asking for
+// the model info, and answering with a JSend JSON string
+type ZmqDaemon struct {
+	// The endpoint clients should connect to
+	Endpoint string
+
+	sock  *goczmq.Sock
+	embed func(request []byte) ([]float32, error)
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Starts a daemon answering like clip_daemons/image_embedding_daemon.py, bound to bindEndpoint
+// A port of * binds to a random free port, e.g. tcp://127.0.0.1:*
+func StartZmqImageDaemon(bindEndpoint string) (*ZmqDaemon, error) {
+	return startZmqDaemon(bindEndpoint, EmbedImage)
+}
+
+// Starts a daemon answering like clip_daemons/text_embedding_daemon.py, bound to bindEndpoint
+func StartZmqTextDaemon(bindEndpoint string) (*ZmqDaemon, error) {
+	return startZmqDaemon(bindEndpoint, func(request []byte) ([]float32, error) {
+		return EmbedText(string(request)), nil
+	})
+}
+
+func startZmqDaemon(bindEndpoint string, embed func(request []byte) ([]float32, error)) (*ZmqDaemon, error) {
+	sock := goczmq.NewSock(goczmq.Rep)
+	port, err := sock.Bind(bindEndpoint)
+	if err != nil {
+		sock.Destroy()
+		return nil, err
+	}
+	sock.SetRcvtimeo(zmqPollIntervalMs)
+
+	host := bindEndpoint[:strings.LastIndex(bindEndpoint, ":")]
+	host = strings.Replace(host, "tcp://*", "tcp://localhost", 1)
+	daemon := &ZmqDaemon{
+		Endpoint: host + ":" + strconv.Itoa(port),
+		sock:     sock,
+		embed:    embed,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go daemon.serve()
+	return daemon, nil
+}
+
+func jsendResponse(data any, err error) []byte {
+	var response any
+	if err != nil {
+		response = struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		}{Status: "error", Message: err.Error()}
+	} else {
+		response = struct {
+			Status string `json:"status"`
+			Data   any    `json:"data"`
+		}{Status: "success", Data: data}
+	}
+	body, _ := json.Marshal(response)
+	return body
+}
+
+func (d *ZmqDaemon) serve() {
+	defer close(d.done)
+	for {
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+
+		request, err := d.sock.RecvMessage()
+		if err != nil {
+			// Timed out, check whether the daemon was closed
+			continue
+		}
+		switch {
+		case len(request) == 1 && string(request[0]) == "info":
+			d.sock.SendFrame(jsendResponse(modelInfo, nil), goczmq.FlagNone)
+		case len(request) == 2 && string(request[0]) == "encode":
+			d.sock.SendFrame(jsendResponse(d.embed(request[1])), goczmq.FlagNone)
+		default:
+			d.sock.SendFrame(jsendResponse(nil, errors.New("Unknown request")), goczmq.FlagNone)
+		}
+	}
+}
+
+// Stops serving and closes the socket
+func (d *ZmqDaemon) Close() {
+	close(d.stop)
+	<-d.done
+	d.sock.Destroy()
+}
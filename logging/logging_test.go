@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	logger := NewLogger(&logs, slog.LevelInfo)
+
+	router := gin.New()
+	router.Use(RequestId())
+	router.GET("/", func(c *gin.Context) {
+		logger.InfoContext(c.Request.Context(), "Handling")
+		c.Status(http.StatusOK)
+	})
+
+	t.Run("should generate an id", func(t *testing.T) {
+		logs.Reset()
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		requestId := resp.Header().Get(RequestIdHeader)
+		assert.Equal(t, 32, len(requestId))
+
+		var record map[string]any
+		err := json.Unmarshal(logs.Bytes(), &record)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, requestId, record["requestId"])
+	})
+
+	t.Run("should keep a valid id sent by the client", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIdHeader, "abc-123")
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, "abc-123", resp.Header().Get(RequestIdHeader))
+	})
+
+	t.Run("should replace an invalid id sent by the client", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIdHeader, "abc\n{\"level\":\"ERROR\"}")
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, 32, len(resp.Header().Get(RequestIdHeader)))
+	})
+}
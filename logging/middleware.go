@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+// Incoming request ids are only reused if they are reasonably short and can't mess with the logs
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+func newRequestId() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// Attaches a request id to the request context and echoes it in the X-Request-ID response header.
+// The id sent by the client is kept if it's valid, otherwise a new one is generated
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(RequestIdHeader)
+		if !validRequestId.MatchString(requestId) {
+			requestId = newRequestId()
+		}
+		c.Request = c.Request.WithContext(ContextWithRequestId(c.Request.Context(), requestId))
+		c.Header(RequestIdHeader, requestId)
+		c.Next()
+	}
+}
+
+// Logs every request once it has been handled
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		slog.Log(c.Request.Context(), level, "Handled request",
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration", time.Since(start),
+			"clientIp", c.ClientIP())
+	}
+}
@@ -2,65 +2,380 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"clipsearch/config"
 	"clipsearch/controllers"
+	"clipsearch/logging"
+	"clipsearch/metrics"
 	"clipsearch/repositories"
 	"clipsearch/services"
+	"clipsearch/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-func setupRouter(imageController *controllers.ImageController) *gin.Engine {
+func setupRouter(imageController *controllers.ImageController, archiveController *controllers.ArchiveController, videoController *controllers.VideoController, healthController *controllers.HealthController, serverConfig config.ServerConfig, archiveConfig config.ArchiveConfig, videoConfig config.VideoConfig) *gin.Engine {
 	router := gin.New()
 	router.Use(gin.Recovery())
-	router.GET("/api/images", imageController.GetImages)
-	router.POST("/api/images", imageController.PostImages)
-	router.GET("/api/images/:id", imageController.GetImageById)
-	router.DELETE("/api/images/:id", imageController.DeleteImageById)
-	router.GET("/api/images/search", imageController.GetSearchImages)
+	router.Use(logging.RequestId())
+	router.Use(logging.AccessLog())
+	router.Use(metrics.GinMiddleware())
+	router.GET("/metrics", metrics.Handler())
+	router.GET("/healthz", healthController.GetHealthz)
+	router.GET("/readyz", healthController.GetReadyz)
+	requestTimeout := controllers.Timeout(serverConfig.RequestTimeout)
+	searchTimeout := controllers.Timeout(serverConfig.SearchTimeout)
+	router.GET("/api/images", requestTimeout, imageController.GetImages)
+	router.POST("/api/images", controllers.Timeout(serverConfig.IngestTimeout), imageController.PostImages)
+	router.POST("/api/images/archive", controllers.Timeout(archiveConfig.Timeout), archiveController.PostImagesArchive)
+	router.GET("/api/images/:id", requestTimeout, imageController.GetImageById)
+	router.GET("/api/images/:id/original", requestTimeout, imageController.GetOriginalImageById)
+	router.DELETE("/api/images/:id", requestTimeout, imageController.DeleteImageById)
+	router.GET("/api/images/search", searchTimeout, imageController.GetSearchImages)
+	router.POST("/api/images/search", searchTimeout, imageController.PostSearchImages)
+	router.GET("/api/images/search/refine", searchTimeout, imageController.GetRefineSearchImages)
+	router.POST("/api/videos", controllers.Timeout(videoConfig.Timeout), videoController.PostVideos)
+	router.GET("/api/videos/:id", requestTimeout, videoController.GetVideoById)
+	router.DELETE("/api/videos/:id", requestTimeout, videoController.DeleteVideoById)
 	return router
 }
 
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Creates the ClipService of the configured backend and a function that closes it
+func newClipService(cfg config.EmbeddingConfig, workers *services.Workers) (services.ClipService, func(), error) {
+	switch cfg.Backend {
+	case config.EMBEDDING_BACKEND_HTTP:
+		clipService := services.NewHttpClipService(cfg.HttpEmbedding)
+		return clipService, clipService.Close, nil
+	case config.EMBEDDING_BACKEND_GRPC:
+		clipService, err := services.NewGrpcClipService(cfg.GrpcEmbedding)
+		if err != nil {
+			return nil, nil, err
+		}
+		return clipService, clipService.Close, nil
+	}
+	clipService := services.NewZmqClipService(cfg.Daemons.Image.ZmqEndpoints(), cfg.Daemons.Text.ZmqEndpoints(), cfg.Daemons.Timeout)
+	workers.Go("embeddingDaemonProbes", func(ctx context.Context) {
+		clipService.RunProbes(ctx, cfg.Daemons.ProbeInterval)
+	})
+	return clipService, clipService.Close, nil
+}
+
+// Creates the BlobStore of the configured backend, nil if originals aren't kept
+func newBlobStore(cfg config.BlobStoreConfig) (repositories.BlobStore, error) {
+	switch cfg.Backend {
+	case config.BLOB_STORE_BACKEND_LOCAL:
+		return repositories.NewLocalBlobStore(cfg.Directory)
+	case config.BLOB_STORE_BACKEND_S3:
+		return repositories.NewS3BlobStore(cfg.S3)
+	}
+	return nil, nil
+}
+
+// Starts the background jobs of the server. The returned function closes the clients they created
+func startServerJobs(cfg config.Config, imageService *services.ImageService, workers *services.Workers) (func(), error) {
+	for _, name := range imageService.ExtraModelNames() {
+		backfillService := services.NewBackfillService(imageService, imageService.ExtraClipService(name), cfg.Reembedding)
+		workers.Go("backfill:"+name, backfillService.Run)
+	}
+
+	closeReembeddingClipService := func() {}
+	if cfg.Reembedding.Enabled {
+		targetClipService, closeTargetClipService, err := newClipService(cfg.Reembedding.Target, workers)
+		if err != nil {
+			return nil, err
+		}
+		closeReembeddingClipService = closeTargetClipService
+		reembeddingService := services.NewReembeddingService(imageService, targetClipService, cfg.Reembedding)
+		workers.Go("reembedding", reembeddingService.Run)
+	}
+
+	if cfg.LinkCheck.Enabled {
+		linkCheckService := services.NewLinkCheckService(imageService, cfg.LinkCheck)
+		workers.Go("linkCheck", linkCheckService.Run)
+	}
+
+	if cfg.Watch.Enabled {
+		if err := startDirectoryWatcher(cfg.Watch, imageService, workers); err != nil {
+			return nil, err
+		}
+	}
+	return closeReembeddingClipService, nil
+}
+
+func startDirectoryWatcher(watchConfig config.WatchConfig, imageService *services.ImageService, workers *services.Workers) error {
+	directoryWatcher, err := services.NewDirectoryWatcher(imageService, watchConfig)
+	if err != nil {
+		return err
+	}
+	workers.Go("directoryWatcher", directoryWatcher.Run)
+	return nil
+}
+
+// Imports the archive at path, printing the outcome of every entry
+func importArchive(ctx context.Context, importer *services.ArchiveImporter, path string, baseUrl string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	results, err := importer.Import(ctx, file, info.Size(), path, baseUrl)
+	for _, result := range results {
+		fmt.Printf("%s\t%s\t%s\n", result.Status, result.Path, result.Url+result.Error)
+	}
+	return err
+}
+
+// Adds the videos at the paths or http(s) urls, printing the id of every added video.
+// Adding each one may take the video timeout at most
+func addVideos(ctx context.Context, videoService *services.VideoService, timeout time.Duration, sources []string) error {
+	for _, source := range sources {
+		videoCtx, cancel := context.WithTimeout(ctx, timeout)
+		var id int
+		var err error
+		if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+			id, err = videoService.AddVideoByURL(videoCtx, source)
+		} else {
+			id, err = videoService.AddVideoFile(videoCtx, source)
+		}
+		cancel()
+		if err == services.VideoExistsError || err == utils.FileSizeExceededError || errors.Is(err, services.UnreadableVideoError) ||
+			err == services.NoFramesError {
+			fmt.Printf("skipped\t%s\t%s\n", source, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("added\t%s\t%d\n", source, id)
+	}
+	return nil
+}
+
+const usage = `Usage: clipsearch [command]
+
+Commands:
+  serve           Serve the API (default)
+  watch           Only keep the images of the watched directories in sync, see the watch config
+  crawl [url...]  Add the images of web pages and of the pages they link to, starting from the urls
+                  or the seeds of the crawl config
+  import <archive> [base url]
+                  Add the image files of a zip, tar or tar.gz archive, storing them with their path
+                  under the base url, and print the outcome of every entry
+  video <file|url>...
+                  Add videos, embedding frames of them, and print the id of every added video`
+
+// Regenerates docs/swagger.json and docs/swagger.yaml from the annotations of the handlers
+//go:generate swag init --outputTypes json,yaml
+
 // @title CLIP search API
 // @version         1.0
 func main() {
-	port := os.Getenv(config.PORT_ENVAR)
-	if port == "" {
-		port = config.DEFAULT_PORT
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
 	}
-	zmq_text_port := os.Getenv(config.ZMQ_TEXT_EMBEDDING_DAEMON_PORT_ENVAR)
-	if zmq_text_port == "" {
-		zmq_text_port = config.ZMQ_TEXT_EMBEDDING_DAEMON_DEFAULT_PORT
+	if (command != "serve" && command != "watch" && command != "crawl" && command != "import" && command != "video") ||
+		(command == "import" && (len(os.Args) < 3 || len(os.Args) > 4)) || (command == "video" && len(os.Args) < 3) {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
 	}
-	zmq_image_port := os.Getenv(config.ZMQ_IMAGE_EMBEDDING_DAEMON_PORT_ENVAR)
-	if zmq_image_port == "" {
-		zmq_image_port = config.ZMQ_IMAGE_EMBEDDING_DAEMON_DEFAULT_PORT
+
+	cfg, err := config.Load(os.Getenv(config.CONFIG_FILE_ENVAR), os.LookupEnv)
+	if err != nil {
+		fatal("Failed to load config", "error", err)
 	}
-	dbConnString := os.Getenv(config.PG_DATABASE_CONNECTION_URL_ENVAR)
-	if dbConnString == "" {
-		log.Fatalf("Please define the %v envar", config.PG_DATABASE_CONNECTION_URL_ENVAR)
+
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		fatal("Invalid log level", "error", err)
 	}
-	pgPool, err := pgxpool.New(context.Background(), dbConnString)
+	slog.SetDefault(logging.NewLogger(os.Stdout, logLevel))
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.Database.Url)
 	if err != nil {
-		log.Print("Failed to connect to db!")
-		log.Fatal(err)
+		fatal("Invalid database url", "error", err)
 	}
-	defer pgPool.Close()
+	if cfg.Database.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.Database.MaxConns
+	}
+	poolConfig.MinConns = cfg.Database.MinConns
+	pgPool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		fatal("Failed to connect to db!", "error", err)
+	}
+	prometheus.MustRegister(metrics.NewPgxPoolCollector(pgPool))
 
-	clipService := services.NewZmqClipService("tcp://localhost:"+zmq_image_port, "tcp://localhost:"+zmq_text_port)
+	workers := services.NewWorkers()
+	clipService, closeClipService, err := newClipService(cfg.Embedding(), workers)
+	if err != nil {
+		fatal("Failed to create the embedding client", "error", err)
+	}
 
 	imageRepository := repositories.NewPgImageRepository(pgPool)
-	imageService := services.NewImageService(imageRepository, clipService)
-	imageController := controllers.NewImageController(imageService)
+	imageRepository.SetHideDeadImages(cfg.LinkCheck.HideDead)
+	imageService := services.NewImageService(imageRepository, clipService, cfg.Images)
+	blobStore, err := newBlobStore(cfg.BlobStore)
+	if err != nil {
+		fatal("Failed to create the blob store", "error", err)
+	}
+	if blobStore != nil {
+		imageService.SetBlobStore(blobStore)
+	}
+	// Also when watching is disabled, so that the images of the watched directories are still checked and re-embedded
+	localDirectories := make([]string, len(cfg.Watch.Directories))
+	for i, directory := range cfg.Watch.Directories {
+		if localDirectories[i], err = filepath.Abs(directory.Path); err != nil {
+			fatal("Failed to resolve a watched directory", "path", directory.Path, "error", err)
+		}
+	}
+	imageService.SetLocalDirectories(localDirectories)
+
+	closeExtraClipServices := make([]func(), 0, len(cfg.EmbeddingModels))
+	for name, embeddingConfig := range cfg.EmbeddingModels {
+		extraClipService, closeExtraClipService, err := newClipService(embeddingConfig, workers)
+		if err != nil {
+			fatal("Failed to create the embedding client of a named model", "model", name, "error", err)
+		}
+		closeExtraClipServices = append(closeExtraClipServices, closeExtraClipService)
+		imageService.AddClipService(name, extraClipService)
+	}
+	closeClipServices := func() {
+		closeClipService()
+		for _, closeExtraClipService := range closeExtraClipServices {
+			closeExtraClipService()
+		}
+	}
 
-	router := setupRouter(imageController)
-	err = router.Run(":" + port)
-	
+	signalCtx, stopListeningForSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopListeningForSignals()
+
+	if command == "watch" || command == "crawl" || command == "import" || command == "video" {
+		switch command {
+		case "watch":
+			if len(cfg.Watch.Directories) == 0 {
+				fatal("No directories to watch, see the watch config")
+			}
+			if err := startDirectoryWatcher(cfg.Watch, imageService, workers); err != nil {
+				fatal("Failed to start the directory watcher", "error", err)
+			}
+			<-signalCtx.Done()
+		case "crawl":
+			seeds := cfg.Crawl.Seeds
+			if len(os.Args) > 2 {
+				seeds = os.Args[2:]
+			}
+			if len(seeds) == 0 {
+				fatal("No urls to crawl, see the crawl config")
+			}
+			err := services.NewCrawler(imageService, cfg.Crawl).Crawl(signalCtx, seeds)
+			if err != nil && signalCtx.Err() == nil {
+				fatal("Failed to crawl", "error", err)
+			}
+		case "import":
+			baseUrl := ""
+			if len(os.Args) > 3 {
+				baseUrl = os.Args[3]
+			}
+			if err := importArchive(signalCtx, services.NewArchiveImporter(imageService, cfg.Archives), os.Args[2], baseUrl); err != nil {
+				fatal("Failed to import the archive", "error", err)
+			}
+		case "video":
+			if err := addVideos(signalCtx, services.NewVideoService(imageService, cfg.Videos), cfg.Videos.Timeout, os.Args[2:]); err != nil {
+				fatal("Failed to add the videos", "error", err)
+			}
+		}
+		stopListeningForSignals()
+
+		slog.Info("Shutting down", "timeout", cfg.Server.ShutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := workers.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to drain background jobs", "error", err)
+		}
+		closeClipServices()
+		pgPool.Close()
+		slog.Info("Shut down")
+		return
+	}
+
+	closeReembeddingClipService, err := startServerJobs(cfg, imageService, workers)
 	if err != nil {
-	    log.Fatal(err.Error())
+		fatal("Failed to start the background jobs", "error", err)
+	}
+
+	imageController := controllers.NewImageController(imageService, cfg.Images)
+	healthChecks := []services.DependencyCheck{
+		{Name: "postgres", Check: imageRepository.Ping},
+		{Name: "imagesSchema", Check: imageRepository.CheckSchema},
+		{Name: "embeddingModel", Check: imageService.CheckEmbeddingModel},
+	}
+	healthChecks = append(healthChecks, services.CurrentClipServiceChecks(imageService.ClipService)...)
+	for _, name := range imageService.ExtraModelNames() {
+		for _, check := range services.ClipServiceChecks(imageService.ExtraClipService(name)) {
+			check.Name = "embeddingModels[" + name + "]." + check.Name
+			healthChecks = append(healthChecks, check)
+		}
+	}
+	healthController := controllers.NewHealthController(services.NewHealthService(cfg.Server.ReadinessCheckTimeout, healthChecks...))
+
+	archiveController := controllers.NewArchiveController(services.NewArchiveImporter(imageService, cfg.Archives), cfg.Archives)
+	videoController := controllers.NewVideoController(services.NewVideoService(imageService, cfg.Videos), cfg.Videos)
+	router := setupRouter(imageController, archiveController, videoController, healthController, cfg.Server, cfg.Archives, cfg.Videos)
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Listening", "port", cfg.Server.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal("Server failed", "error", err)
+	case <-signalCtx.Done():
+	}
+	// A second signal kills the process right away
+	stopListeningForSignals()
+
+	slog.Info("Shutting down", "timeout", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Stops accepting connections and waits for the in-flight requests
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to drain in-flight requests", "error", err)
+	}
+	if err := workers.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to drain background jobs", "error", err)
 	}
+	closeClipServices()
+	closeReembeddingClipService()
+	pgPool.Close()
+	slog.Info("Shut down")
 }
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "clipsearch"
+
+var httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "http_requests_total",
+	Help:      "Number of handled HTTP requests by route, method and status code.",
+}, []string{"route", "method", "status"})
+
+var httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "http_request_duration_seconds",
+	Help:      "Latency of handled HTTP requests by route, method and status code.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"route", "method", "status"})
+
+var clipCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "clip_call_duration_seconds",
+	Help:      "Latency of calls to the embedding daemons by daemon.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"daemon"})
+
+var clipCallErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "clip_call_errors_total",
+	Help:      "Number of failed calls to the embedding daemons by daemon.",
+}, []string{"daemon"})
+
+var embeddingDaemonEndpointHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "embedding_daemon_endpoint_healthy",
+	Help:      "Whether an embedding daemon endpoint receives requests (1) or was taken out after failing to respond (0).",
+}, []string{"daemon", "endpoint"})
+
+var repositoryQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "repository_query_duration_seconds",
+	Help:      "Latency of image repository queries by method.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method"})
+
+var ingestionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "ingestions_total",
+	Help:      "Number of attempts to add an image by outcome.",
+}, []string{"outcome"})
+
+var linkChecksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "link_checks_total",
+	Help:      "Number of checked images by the resulting link status.",
+}, []string{"status"})
+
+var reembeddingFailedImages = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "reembedding_failed_images",
+	Help:      "Number of images the last re-embedding pass failed to embed by model, and whether retrying can fix them (transient) or not (permanent).",
+}, []string{"model", "kind"})
+
+// Ingestion outcomes
+const (
+	IngestionCreated   = "created"
+	IngestionDuplicate = "duplicate"
+	IngestionTooLarge  = "too_large"
+	IngestionError     = "error"
+)
+
+// Records the count and latency of every request, labeled with the route pattern rather than the raw path
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequestsTotal.WithLabelValues(route, c.Request.Method, status).Inc()
+		httpRequestDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Serves all registered metrics in the prometheus text format
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// Records the latency and outcome of a call to an embedding daemon
+func ObserveClipCall(daemon string, start time.Time, err error) {
+	clipCallDuration.WithLabelValues(daemon).Observe(time.Since(start).Seconds())
+	if err != nil {
+		clipCallErrorsTotal.WithLabelValues(daemon).Inc()
+	}
+}
+
+func SetEmbeddingDaemonEndpointHealthy(daemon string, endpoint string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	embeddingDaemonEndpointHealthy.WithLabelValues(daemon, endpoint).Set(value)
+}
+
+// Records the latency of an image repository query. Meant to be deferred:
+//
+//	defer metrics.ObserveRepositoryQuery("Count", time.Now())
+func ObserveRepositoryQuery(method string, start time.Time) {
+	repositoryQueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+func CountIngestion(outcome string) {
+	ingestionsTotal.WithLabelValues(outcome).Inc()
+}
+
+func CountLinkCheck(status string) {
+	linkChecksTotal.WithLabelValues(status).Inc()
+}
+
+func SetReembeddingFailedImages(model string, transient int, permanent int) {
+	reembeddingFailedImages.WithLabelValues(model, "transient").Set(float64(transient))
+	reembeddingFailedImages.WithLabelValues(model, "permanent").Set(float64(permanent))
+}
@@ -0,0 +1,26 @@
+package models
+
+// The outcome of importing an entry of an archive
+type ArchiveEntryResult struct {
+	// The path of the entry in the archive
+	Path   string             `json:"path" example:"cats/1.jpg"`
+	Status ArchiveEntryStatus `json:"status" example:"added"`
+	// The url the image was stored with, omitted unless it was added
+	Url string `json:"url,omitempty" example:"archive:///dataset.zip/cats/1.jpg"`
+	// Why the entry failed, omitted unless it did
+	Error string `json:"error,omitempty" example:"Max file size was exceeded"`
+}
+
+type ArchiveEntryStatus string
+
+const (
+	ArchiveEntryAdded ArchiveEntryStatus = "added"
+	// The image already exists (hash match)
+	ArchiveEntryDuplicate ArchiveEntryStatus = "duplicate"
+	ArchiveEntryTooLarge  ArchiveEntryStatus = "tooLarge"
+	// Not an image file, a hidden file or a link
+	ArchiveEntrySkipped ArchiveEntryStatus = "skipped"
+	// The path is absolute or leaves the archive through ".."
+	ArchiveEntryUnsafePath ArchiveEntryStatus = "unsafePath"
+	ArchiveEntryFailed     ArchiveEntryStatus = "failed"
+)
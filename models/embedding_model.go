@@ -0,0 +1,7 @@
+package models
+
+// The CLIP model that produced an embedding
+type EmbeddingModel struct {
+	Name      string `json:"name" example:"ViT-L/14@336px"`
+	Dimension int    `json:"dimension" example:"768"`
+}
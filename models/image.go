@@ -1,10 +1,48 @@
 package models
 
+import "time"
+
 // swagger:model Image
 type Image struct {
-	ImageID      int       `json:"id" example:"102"`
-	SourceUrl    string    `json:"sourceUrl" example:"http://localhost:8080/example/image.jpg"`
-	ThumbnailUrl string    `json:"thumbnailUrl" example:"http://localhost:8080/example/image_thumb.jpg"`
-	Sha256       string    `json:"sha256" example:"671797905015849a2e772d7e152ad3289e7d71703b49c8fb607d00265769c1fb"`
-	Embedding    []float32 `json:"-"`
+	ImageID      int    `json:"id" example:"102"`
+	SourceUrl    string `json:"sourceUrl" example:"http://localhost:8080/example/image.jpg"`
+	ThumbnailUrl string `json:"thumbnailUrl" example:"http://localhost:8080/example/image_thumb.jpg"`
+	Sha256       string `json:"sha256" example:"671797905015849a2e772d7e152ad3289e7d71703b49c8fb607d00265769c1fb"`
+	// The web page the crawler found the image on, omitted for the images added otherwise
+	PageUrl string `json:"pageUrl,omitempty" example:"http://localhost:8080/example/"`
+	// The video the image is a frame of, omitted for the images that aren't frames
+	VideoID *int `json:"videoId,omitempty" example:"7"`
+	// Seconds into the video the frame is shown at, omitted for the images that aren't frames
+	FrameTime *float64 `json:"frameTime,omitempty" example:"12.5"`
+	// Result of the last check of the urls, see LinkStatus
+	LinkStatus LinkStatus `json:"linkStatus" example:"alive"`
+	// When the urls were last checked, omitted if they weren't yet
+	LinkCheckedAt *time.Time `json:"linkCheckedAt,omitempty" example:"2024-01-02T15:04:05Z"`
+	// Only returned for a single image, omitted if the file had none
+	Metadata  *ImageMetadata `json:"metadata,omitempty"`
+	Embedding []float32      `json:"-"`
+	// Name of the EmbeddingModel that produced Embedding
+	EmbeddingModel string `json:"-"`
+	// Embeddings from other models than EmbeddingModel, keyed by model name. Only used when creating images
+	ExtraEmbeddings map[string][]float32 `json:"-"`
+	// Embeddings of the sampled frames of an animated image keyed by model name, searched next to Embedding.
+	// Only used when creating images, nil unless frame embeddings are kept (see config)
+	FrameEmbeddings map[string][][]float32 `json:"-"`
+	// Negative inner product with the query embedding. Only set by similarity searches
+	Distance float64 `json:"-"`
 }
+
+// Whether the urls of an image still work
+type LinkStatus string
+
+const (
+	LinkStatusUnchecked LinkStatus = "unchecked"
+	LinkStatusAlive     LinkStatus = "alive"
+	// The source or the thumbnail url is gone, the server answered 404 or 410 or the local file was removed
+	LinkStatusDead LinkStatus = "dead"
+	// The source or the thumbnail url couldn't be loaded this time, e.g. the server timed out or answered 5xx.
+	// Doesn't count as a failed check, so images aren't purged because of an outage
+	LinkStatusUnreachable LinkStatus = "unreachable"
+	// The source url serves another file than the one that was added
+	LinkStatusChanged LinkStatus = "changed"
+)
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// The normalized subset of the EXIF, XMP and IPTC metadata of an image file, read when the image is added.
+// Fields the file doesn't record are omitted
+//
+// swagger:model ImageMetadata
+type ImageMetadata struct {
+	// When the photo was taken. Stored as UTC if the file doesn't record the offset of the camera's clock
+	CapturedAt  *time.Time `json:"capturedAt,omitempty" example:"2024-01-02T15:04:05+01:00"`
+	CameraMake  string     `json:"cameraMake,omitempty" example:"Canon"`
+	CameraModel string     `json:"cameraModel,omitempty" example:"Canon EOS 5D Mark IV"`
+	// EXIF orientation from 1 to 8, 1 being upright. The embeddings are computed from the image turned upright
+	Orientation int `json:"orientation,omitempty" example:"6"`
+	// In degrees, negative south of the equator
+	Latitude *float64 `json:"latitude,omitempty" example:"48.8584"`
+	// In degrees, negative west of Greenwich
+	Longitude *float64 `json:"longitude,omitempty" example:"2.2945"`
+	// In meters, negative below sea level
+	Altitude *float64 `json:"altitude,omitempty" example:"35"`
+	// Size in pixels of the image as shown, after the orientation is applied
+	Width    int      `json:"width,omitempty" example:"4032"`
+	Height   int      `json:"height,omitempty" example:"3024"`
+	Caption  string   `json:"caption,omitempty" example:"The Eiffel Tower at dusk"`
+	Keywords []string `json:"keywords,omitempty" example:"paris,tower"`
+}
+
+// Whether none of the fields are set
+func (m ImageMetadata) IsEmpty() bool {
+	return m.CapturedAt == nil && m.CameraMake == "" && m.CameraModel == "" && m.Orientation == 0 &&
+		m.Latitude == nil && m.Longitude == nil && m.Altitude == nil && m.Width == 0 && m.Height == 0 &&
+		m.Caption == "" && len(m.Keywords) == 0
+}
@@ -0,0 +1,9 @@
+package models
+
+// A video whose frames are stored as images, see Image.VideoID
+// swagger:model Video
+type Video struct {
+	VideoID   int    `json:"id" example:"7"`
+	SourceUrl string `json:"sourceUrl" example:"http://localhost:8080/example/video.mp4"`
+	Sha256    string `json:"sha256" example:"671797905015849a2e772d7e152ad3289e7d71703b49c8fb607d00265769c1fb"`
+}
@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Stores binary objects, like the originals of the images, by key
+type BlobStore interface {
+	// Stores data under key, replacing what was stored under it
+	Put(ctx context.Context, key string, data []byte) error
+	// Returns a reader of the data stored under key and its size.
+	// Fails with BlobNotFoundError if nothing is stored under key. The reader has to be closed
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	// Removes the data stored under key. Fails with BlobNotFoundError if nothing is stored under key
+	Delete(ctx context.Context, key string) error
+}
+
+var BlobNotFoundError = errors.New("No blob is stored under this key")
+var InvalidBlobKeyError = errors.New("Blob keys may only contain letters, digits, '-', '_' and '.'")
+
+// Keys are used as file names and in urls, so they are restricted to characters that need no escaping
+func checkBlobKey(key string) error {
+	if key == "" || key == "." || key == ".." {
+		return InvalidBlobKeyError
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return InvalidBlobKeyError
+		}
+	}
+	return nil
+}
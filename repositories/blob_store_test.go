@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+// Checks the behavior every BlobStore shares
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	key := "671797905015849a2e772d7e152ad3289e7d71703b49c8fb607d00265769c1fb"
+	data := []byte("\x89PNG\r\n\x1a\nnot really a png")
+
+	if _, _, err := store.Get(ctx, key); err != BlobNotFoundError {
+		t.Fatalf("Get error before Put = %v, want = %v", err, BlobNotFoundError)
+	}
+	if err := store.Put(ctx, key, data); err != nil {
+		t.Fatalf(err.Error())
+	}
+	reader, size, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	stored, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !bytes.Equal(stored, data) || size != int64(len(data)) {
+		t.Fatalf("Get = %q (%d bytes), want = %q", stored, size, data)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := store.Delete(ctx, key); err != BlobNotFoundError {
+		t.Fatalf("Second Delete error = %v, want = %v", err, BlobNotFoundError)
+	}
+	if err := store.Put(ctx, "../escape", data); err != InvalidBlobKeyError {
+		t.Fatalf("Put error with a path as key = %v, want = %v", err, InvalidBlobKeyError)
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	testBlobStore(t, store)
+}
@@ -2,18 +2,82 @@ package repositories
 
 import (
 	"clipsearch/models"
+	"context"
 	"errors"
+	"time"
 )
 
 type ImageRepository interface {
-	Count() (int, error)
-	CountWithSha256(sha256 string) (int, error)
-	// the int is the id of the newly created image
-	Create(image *models.Image) (int, error)
-	GetImages(offset int, limit int) ([]models.Image, error)
-	GetSimilarImages(embedding []float32, offset int, limit int) ([]models.Image, error)
-	GetById(id int) (*models.Image, error)
-	DeleteById(id int) error
+	Count(ctx context.Context) (int, error)
+	CountWithSha256(ctx context.Context, sha256 string) (int, error)
+	// the int is the id of the newly created image.
+	// The embedding must be from the active model, which the first created image sets if there is none.
+	// Fails with EmbeddingModelMismatchError or EmbeddingDimensionMismatchError otherwise.
+	// The extra and the frame embeddings are stored too, their models have to be registered
+	Create(ctx context.Context, image *models.Image) (int, error)
+	GetImages(ctx context.Context, offset int, limit int) ([]models.Image, error)
+	// Returns at most limit images with an id greater than id, ordered by ID
+	GetImagesAfterId(ctx context.Context, id int, limit int) ([]models.Image, error)
+	// Orders images by Distance (negative inner product with embedding), then by ID. The Distance of an image with
+	// frame embeddings is the smallest one of its embedding and its frames.
+	// Compares embedding with the embeddings from the named model, or from the active model if model is "".
+	// Images without an embedding from that model are left out
+	GetSimilarImages(ctx context.Context, model string, embedding []float32, offset int, limit int) ([]models.Image, error)
+	// Same as GetSimilarImages, but the Embedding field of the returned images is filled in
+	GetSimilarImagesWithEmbeddings(ctx context.Context, model string, embedding []float32, offset int, limit int) ([]models.Image, error)
+	// Same as GetSimilarImages, but starts right after the image with the given distance and id
+	GetSimilarImagesAfter(ctx context.Context, model string, embedding []float32, distance float64, id int, limit int) ([]models.Image, error)
+	// Unlike the other methods returning images, fills in the Metadata of the image
+	GetById(ctx context.Context, id int) (*models.Image, error)
+	// Returns the images with the given source url, ordered by ID. Hidden images are included
+	GetImagesBySourceUrl(ctx context.Context, sourceUrl string) ([]models.Image, error)
+	// Returns the images whose source url starts with prefix, ordered by ID. Hidden images are included
+	GetImagesBySourceUrlPrefix(ctx context.Context, prefix string) ([]models.Image, error)
+	// Returns the stored embeddings from the named model (the active one if model is "") of the images with the given ids, keyed by id.
+	// Ids that don't exist or have no embedding from that model are left out of the map
+	GetEmbeddings(ctx context.Context, model string, ids []int) (map[int][]float32, error)
+	DeleteById(ctx context.Context, id int) error
+
+	// Returns the model of the embeddings searches use, nil if no image was created yet
+	GetActiveEmbeddingModel(ctx context.Context) (*models.EmbeddingModel, error)
+	// Registers a model to store embeddings from besides the active one. Fails with EmbeddingDimensionMismatchError
+	// if a model of the same name but another dimension is registered
+	RegisterEmbeddingModel(ctx context.Context, model models.EmbeddingModel) error
+	// Returns at most limit images with an id greater than id and no embedding from the given model, ordered by ID
+	GetImagesToReembed(ctx context.Context, model string, id int, limit int) ([]models.Image, error)
+	// Stores the embedding of the image by a registered model, replacing the one it had from that model
+	SetEmbedding(ctx context.Context, id int, model string, embedding []float32) error
+	// Replaces the frame embeddings of the image by a registered model, an empty slice removes them
+	SetFrameEmbeddings(ctx context.Context, id int, model string, embeddings [][]float32) error
+	// Makes the given model the active one, which searches use by default. The embeddings from the previous
+	// model are kept. Fails with ReembeddingIncompleteError if an image other than the skipped ones has no
+	// embedding from that model. The skipped images are left out of searches until they get one
+	CutOverEmbeddingModel(ctx context.Context, model string, skipped []int) error
+
+	// Returns at most limit images with an id greater than id whose urls weren't checked since checkedBefore, ordered by ID.
+	// Dead images are included
+	GetImagesToCheck(ctx context.Context, checkedBefore time.Time, id int, limit int) ([]models.Image, error)
+	// Records the result of checking the urls of the image. A dead status counts as another failed check,
+	// an unreachable status leaves the count as is and any other status resets it
+	SetLinkStatus(ctx context.Context, id int, status models.LinkStatus, checkedAt time.Time) error
+	// Returns the dead images that failed at least minFailures checks in a row
+	GetDeadImages(ctx context.Context, minFailures int) ([]models.Image, error)
+	// Whether dead images are left out of Count, GetImages, GetImagesAfterId and the similarity searches
+	SetHideDeadImages(hide bool)
+
+	CountVideosWithSha256(ctx context.Context, sha256 string) (int, error)
+	// Creates the video along with its frames, which are created like Create does, all or nothing.
+	// Returns the id of the video, the VideoID of the frames is set to it
+	CreateVideo(ctx context.Context, video *models.Video, frames []models.Image) (int, error)
+	GetVideoById(ctx context.Context, id int) (*models.Video, error)
+	// Returns the frames of the video ordered by FrameTime. Hidden images are included
+	GetVideoFrames(ctx context.Context, id int) ([]models.Image, error)
+	// Deletes the video along with its frames
+	DeleteVideoById(ctx context.Context, id int) error
 }
 
 var ImageNotFoundError = errors.New("Image with such id was not found")
+var VideoNotFoundError = errors.New("Video with such id was not found")
+var EmbeddingModelMismatchError = errors.New("The embedding is not from the active embedding model")
+var EmbeddingDimensionMismatchError = errors.New("The embedding doesn't have the dimension of its model")
+var ReembeddingIncompleteError = errors.New("Not all images were re-embedded with the new model")
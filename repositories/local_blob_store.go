@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// A BlobStore keeping every blob in a file of a local directory
+type LocalBlobStore struct {
+	directory string
+}
+
+// Creates directory if it doesn't exist
+func NewLocalBlobStore(directory string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, fmt.Errorf("Failed to create the blob directory: %w", err)
+	}
+	return &LocalBlobStore{directory: directory}, nil
+}
+
+func (store *LocalBlobStore) path(key string) (string, error) {
+	if err := checkBlobKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(store.directory, key), nil
+}
+
+// Writes to a temporary file first, so readers never see a partially written blob
+func (store *LocalBlobStore) Put(ctx context.Context, key string, data []byte) error {
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(store.directory, ".put-*")
+	if err != nil {
+		return fmt.Errorf("Failed to store blob: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("Failed to store blob: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("Failed to store blob: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("Failed to store blob: %w", err)
+	}
+	return nil
+}
+
+func (store *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	path, err := store.path(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, BlobNotFoundError
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to get blob: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("Failed to get blob: %w", err)
+	}
+	return file, info.Size(), nil
+}
+
+func (store *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return BlobNotFoundError
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to delete blob: %w", err)
+	}
+	return nil
+}
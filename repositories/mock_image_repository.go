@@ -2,26 +2,162 @@ package repositories
 
 import (
 	"clipsearch/models"
+	"clipsearch/utils"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
+// An in-memory ImageRepository for tests, safe for concurrent use
 type MockImageRepository struct {
+	mutex  sync.Mutex
 	images []models.Image
 	ct     int
+
+	embeddingModels map[string]models.EmbeddingModel
+	activeModel     string
+	// Keyed by image id, then by model name
+	embeddings map[int]map[string][]float32
+	// Keyed by image id, then by model name
+	frameEmbeddings map[int]map[string][][]float32
+	// Consecutive failed link checks, keyed by image id
+	linkFailures   map[int]int
+	hideDeadImages bool
+
+	videos  []models.Video
+	videoCt int
 }
 
 func NewMockImageRepository() *MockImageRepository {
-	return &MockImageRepository{images: make([]models.Image, 0, 16), ct: 0}
+	return &MockImageRepository{
+		images:          make([]models.Image, 0, 16),
+		ct:              0,
+		embeddingModels: make(map[string]models.EmbeddingModel),
+		embeddings:      make(map[int]map[string][]float32),
+		frameEmbeddings: make(map[int]map[string][][]float32),
+		linkFailures:    make(map[int]int),
+	}
+}
+
+func (repo *MockImageRepository) SetHideDeadImages(hide bool) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.hideDeadImages = hide
 }
 
-func (repo *MockImageRepository) Count() (int, error) {
-	return len(repo.images), nil
+// The images that aren't hidden, see SetHideDeadImages
+func (repo *MockImageRepository) visibleImages() []models.Image {
+	if !repo.hideDeadImages {
+		return repo.images
+	}
+	images := make([]models.Image, 0, len(repo.images))
+	for _, image := range repo.images {
+		if image.LinkStatus != models.LinkStatusDead {
+			images = append(images, image)
+		}
+	}
+	return images
 }
 
-func (repo *MockImageRepository) GetSimilarImages(embedding []float32, offset int, limit int) ([]models.Image, error) {
-	return nil, nil
+func (repo *MockImageRepository) Count(ctx context.Context) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return len(repo.visibleImages()), nil
 }
 
-func (repo *MockImageRepository) CountWithSha256(sha256 string) (int, error) {
+func page(images []models.Image, offset int, limit int) []models.Image {
+	if offset > len(images) {
+		offset = len(images)
+	}
+	if offset+limit > len(images) {
+		limit = len(images) - offset
+	}
+	return images[offset : offset+limit]
+}
+
+// Resolves "" to the active model
+func (repo *MockImageRepository) modelName(model string) string {
+	if model == "" {
+		return repo.activeModel
+	}
+	return model
+}
+
+// Orders the images with an embedding from model like the <#> operator does in postgres, by their closest frame
+// if they have frame embeddings, breaking ties by ID. The Embedding field of the returned images is filled in
+func (repo *MockImageRepository) similarImages(model string, embedding []float32) ([]models.Image, error) {
+	model = repo.modelName(model)
+	images := make([]models.Image, 0, len(repo.images))
+	for _, image := range repo.visibleImages() {
+		imageEmbedding, ok := repo.embeddings[image.ImageID][model]
+		if !ok {
+			continue
+		}
+		score, err := utils.Dot(imageEmbedding, embedding)
+		if err != nil {
+			return nil, err
+		}
+		for _, frameEmbedding := range repo.frameEmbeddings[image.ImageID][model] {
+			frameScore, err := utils.Dot(frameEmbedding, embedding)
+			if err != nil {
+				return nil, err
+			}
+			score = max(score, frameScore)
+		}
+		image.Embedding = imageEmbedding
+		image.EmbeddingModel = model
+		image.Distance = -float64(score)
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].Distance != images[j].Distance {
+			return images[i].Distance < images[j].Distance
+		}
+		return images[i].ImageID < images[j].ImageID
+	})
+	return images, nil
+}
+
+func (repo *MockImageRepository) GetSimilarImages(ctx context.Context, model string, embedding []float32, offset int, limit int) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return repo.getSimilarImages(model, embedding, offset, limit)
+}
+
+func (repo *MockImageRepository) getSimilarImages(model string, embedding []float32, offset int, limit int) ([]models.Image, error) {
+	images, err := repo.similarImages(model, embedding)
+	if err != nil {
+		return nil, err
+	}
+	return page(images, offset, limit), nil
+}
+
+func (repo *MockImageRepository) GetSimilarImagesAfter(ctx context.Context, model string, embedding []float32, distance float64, id int, limit int) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	images, err := repo.similarImages(model, embedding)
+	if err != nil {
+		return nil, err
+	}
+	start := sort.Search(len(images), func(i int) bool {
+		return images[i].Distance > distance || (images[i].Distance == distance && images[i].ImageID > id)
+	})
+	return page(images, start, limit), nil
+}
+
+func (repo *MockImageRepository) GetSimilarImagesWithEmbeddings(ctx context.Context, model string, embedding []float32, offset int, limit int) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return repo.getSimilarImages(model, embedding, offset, limit)
+}
+
+func (repo *MockImageRepository) CountWithSha256(ctx context.Context, sha256 string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
 	counter := 0
 	for _, image := range repo.images {
 		if image.Sha256 == sha256 {
@@ -31,19 +167,111 @@ func (repo *MockImageRepository) CountWithSha256(sha256 string) (int, error) {
 	return counter, nil
 }
 
-func (repo *MockImageRepository) Create(image *models.Image) (int, error) {
-	newImage := *image
-	newImage.ImageID = repo.ct + 1
+func (repo *MockImageRepository) Create(ctx context.Context, image *models.Image) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if err := repo.checkEmbeddings(image); err != nil {
+		return 0, err
+	}
+	return repo.insertImage(image), nil
+}
+
+// Fails like Create does for image, making its model the active one if there is none
+func (repo *MockImageRepository) checkEmbeddings(image *models.Image) error {
+	active, ok := repo.embeddingModels[repo.activeModel]
+	if !ok {
+		if err := repo.registerEmbeddingModel(models.EmbeddingModel{Name: image.EmbeddingModel, Dimension: len(image.Embedding)}); err != nil {
+			return err
+		}
+		repo.activeModel = image.EmbeddingModel
+	} else if active.Name != image.EmbeddingModel {
+		return EmbeddingModelMismatchError
+	} else if active.Dimension != len(image.Embedding) {
+		return EmbeddingDimensionMismatchError
+	}
+
+	for model, embedding := range image.ExtraEmbeddings {
+		registered, ok := repo.embeddingModels[model]
+		if !ok {
+			return fmt.Errorf("Embedding model %s is not registered", model)
+		}
+		if registered.Dimension != len(embedding) {
+			return EmbeddingDimensionMismatchError
+		}
+	}
+	for model, embeddings := range image.FrameEmbeddings {
+		registered, ok := repo.embeddingModels[model]
+		if !ok {
+			return fmt.Errorf("Embedding model %s is not registered", model)
+		}
+		for _, embedding := range embeddings {
+			if registered.Dimension != len(embedding) {
+				return EmbeddingDimensionMismatchError
+			}
+		}
+	}
+	return nil
+}
+
+// Stores an image that passed checkEmbeddings, returning its id
+func (repo *MockImageRepository) insertImage(image *models.Image) int {
+	newImage := models.Image{
+		ImageID:      repo.ct + 1,
+		SourceUrl:    image.SourceUrl,
+		ThumbnailUrl: image.ThumbnailUrl,
+		Sha256:       image.Sha256,
+		PageUrl:      image.PageUrl,
+		VideoID:      image.VideoID,
+		FrameTime:    image.FrameTime,
+		Metadata:     image.Metadata,
+		LinkStatus:   models.LinkStatusUnchecked,
+	}
 	repo.ct++
 	repo.images = append(repo.images, newImage)
-	return newImage.ImageID, nil
+	repo.embeddings[newImage.ImageID] = map[string][]float32{image.EmbeddingModel: image.Embedding}
+	for model, embedding := range image.ExtraEmbeddings {
+		repo.embeddings[newImage.ImageID][model] = embedding
+	}
+	repo.frameEmbeddings[newImage.ImageID] = make(map[string][][]float32, len(image.FrameEmbeddings))
+	for model, embeddings := range image.FrameEmbeddings {
+		repo.frameEmbeddings[newImage.ImageID][model] = embeddings
+	}
+	return newImage.ImageID
+}
+
+func (repo *MockImageRepository) GetImages(ctx context.Context, offset int, limit int) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return slices.Clone(page(repo.visibleImages(), offset, limit)), nil
+}
+
+// Returns the images with an id greater than id, ordered by ID
+func imagesAfterId(images []models.Image, id int) []models.Image {
+	after := make([]models.Image, 0, len(images))
+	for _, image := range images {
+		if image.ImageID > id {
+			after = append(after, image)
+		}
+	}
+	sort.Slice(after, func(i, j int) bool {
+		return after[i].ImageID < after[j].ImageID
+	})
+	return after
+}
+
+func (repo *MockImageRepository) GetImagesAfterId(ctx context.Context, id int, limit int) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return page(imagesAfterId(repo.visibleImages(), id), 0, limit), nil
 }
 
-func (repo *MockImageRepository) GetImages(offset int, limit int) ([]models.Image, error) {
-	return repo.images[offset : offset+limit], nil
+func (repo *MockImageRepository) GetById(ctx context.Context, id int) (*models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return repo.getById(id)
 }
 
-func (repo *MockImageRepository) GetById(id int) (*models.Image, error) {
+func (repo *MockImageRepository) getById(id int) (*models.Image, error) {
 	for _, image := range repo.images {
 		if image.ImageID == id {
 			return &image, nil
@@ -52,13 +280,276 @@ func (repo *MockImageRepository) GetById(id int) (*models.Image, error) {
 	return nil, ImageNotFoundError
 }
 
-func (repo *MockImageRepository) DeleteById(id int) error {
+func (repo *MockImageRepository) GetImagesBySourceUrl(ctx context.Context, sourceUrl string) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	images := make([]models.Image, 0)
+	for _, image := range imagesAfterId(repo.images, 0) {
+		if image.SourceUrl == sourceUrl {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+func (repo *MockImageRepository) GetImagesBySourceUrlPrefix(ctx context.Context, prefix string) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	images := make([]models.Image, 0)
+	for _, image := range imagesAfterId(repo.images, 0) {
+		if strings.HasPrefix(image.SourceUrl, prefix) {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+func (repo *MockImageRepository) GetEmbeddings(ctx context.Context, model string, ids []int) (map[int][]float32, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	model = repo.modelName(model)
+	embeddings := make(map[int][]float32, len(ids))
+	for _, id := range ids {
+		if embedding, ok := repo.embeddings[id][model]; ok {
+			embeddings[id] = embedding
+		}
+	}
+	return embeddings, nil
+}
+
+func (repo *MockImageRepository) DeleteById(ctx context.Context, id int) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return repo.deleteById(id)
+}
+
+func (repo *MockImageRepository) deleteById(id int) error {
 	for i, image := range repo.images {
 		if image.ImageID == id {
 			repo.images[i] = repo.images[len(repo.images)-1]
 			repo.images = repo.images[:len(repo.images)-1]
+			delete(repo.embeddings, id)
+			delete(repo.frameEmbeddings, id)
+			delete(repo.linkFailures, id)
 			return nil
 		}
 	}
 	return ImageNotFoundError
 }
+
+func (repo *MockImageRepository) GetActiveEmbeddingModel(ctx context.Context) (*models.EmbeddingModel, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	active, ok := repo.embeddingModels[repo.activeModel]
+	if !ok {
+		return nil, nil
+	}
+	return &active, nil
+}
+
+func (repo *MockImageRepository) RegisterEmbeddingModel(ctx context.Context, model models.EmbeddingModel) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return repo.registerEmbeddingModel(model)
+}
+
+func (repo *MockImageRepository) registerEmbeddingModel(model models.EmbeddingModel) error {
+	registered, ok := repo.embeddingModels[model.Name]
+	if !ok {
+		repo.embeddingModels[model.Name] = model
+		return nil
+	}
+	if registered.Dimension != model.Dimension {
+		return EmbeddingDimensionMismatchError
+	}
+	return nil
+}
+
+func (repo *MockImageRepository) GetImagesToReembed(ctx context.Context, model string, id int, limit int) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	images := imagesAfterId(repo.images, id)
+	toReembed := make([]models.Image, 0, len(images))
+	for _, image := range images {
+		if _, ok := repo.embeddings[image.ImageID][model]; !ok {
+			toReembed = append(toReembed, image)
+		}
+	}
+	return page(toReembed, 0, limit), nil
+}
+
+func (repo *MockImageRepository) SetEmbedding(ctx context.Context, id int, model string, embedding []float32) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	registered, ok := repo.embeddingModels[model]
+	if !ok {
+		return fmt.Errorf("Embedding model %s is not registered", model)
+	}
+	if registered.Dimension != len(embedding) {
+		return EmbeddingDimensionMismatchError
+	}
+	if _, err := repo.getById(id); err != nil {
+		return err
+	}
+	repo.embeddings[id][model] = embedding
+	return nil
+}
+
+func (repo *MockImageRepository) SetFrameEmbeddings(ctx context.Context, id int, model string, embeddings [][]float32) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	registered, ok := repo.embeddingModels[model]
+	if !ok {
+		return fmt.Errorf("Embedding model %s is not registered", model)
+	}
+	for _, embedding := range embeddings {
+		if registered.Dimension != len(embedding) {
+			return EmbeddingDimensionMismatchError
+		}
+	}
+	if _, err := repo.getById(id); err != nil {
+		return err
+	}
+	repo.frameEmbeddings[id][model] = embeddings
+	return nil
+}
+
+func (repo *MockImageRepository) CutOverEmbeddingModel(ctx context.Context, model string, skipped []int) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.embeddingModels[model]; !ok {
+		return fmt.Errorf("Embedding model %s is not registered", model)
+	}
+	for _, image := range repo.images {
+		if _, ok := repo.embeddings[image.ImageID][model]; !ok && !slices.Contains(skipped, image.ImageID) {
+			return ReembeddingIncompleteError
+		}
+	}
+	repo.activeModel = model
+	return nil
+}
+
+func (repo *MockImageRepository) GetImagesToCheck(ctx context.Context, checkedBefore time.Time, id int, limit int) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	images := imagesAfterId(repo.images, id)
+	toCheck := make([]models.Image, 0, len(images))
+	for _, image := range images {
+		if image.LinkCheckedAt == nil || image.LinkCheckedAt.Before(checkedBefore) {
+			toCheck = append(toCheck, image)
+		}
+	}
+	return page(toCheck, 0, limit), nil
+}
+
+func (repo *MockImageRepository) SetLinkStatus(ctx context.Context, id int, status models.LinkStatus, checkedAt time.Time) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	for i, image := range repo.images {
+		if image.ImageID == id {
+			repo.images[i].LinkStatus = status
+			repo.images[i].LinkCheckedAt = &checkedAt
+			switch status {
+			case models.LinkStatusDead:
+				repo.linkFailures[id]++
+			case models.LinkStatusUnreachable:
+				// Neither a failure nor a success
+			default:
+				delete(repo.linkFailures, id)
+			}
+			return nil
+		}
+	}
+	return ImageNotFoundError
+}
+
+func (repo *MockImageRepository) GetDeadImages(ctx context.Context, minFailures int) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	dead := make([]models.Image, 0)
+	for _, image := range imagesAfterId(repo.images, 0) {
+		if image.LinkStatus == models.LinkStatusDead && repo.linkFailures[image.ImageID] >= minFailures {
+			dead = append(dead, image)
+		}
+	}
+	return dead, nil
+}
+
+func (repo *MockImageRepository) CountVideosWithSha256(ctx context.Context, sha256 string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	counter := 0
+	for _, video := range repo.videos {
+		if video.Sha256 == sha256 {
+			counter++
+		}
+	}
+	return counter, nil
+}
+
+func (repo *MockImageRepository) CreateVideo(ctx context.Context, video *models.Video, frames []models.Image) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	// Checked up front, nothing is stored if a frame fails
+	for i := range frames {
+		if err := repo.checkEmbeddings(&frames[i]); err != nil {
+			return 0, err
+		}
+	}
+	repo.videoCt++
+	id := repo.videoCt
+	repo.videos = append(repo.videos, models.Video{VideoID: id, SourceUrl: video.SourceUrl, Sha256: video.Sha256})
+	for i := range frames {
+		frames[i].VideoID = &id
+		repo.insertImage(&frames[i])
+	}
+	return id, nil
+}
+
+func (repo *MockImageRepository) GetVideoById(ctx context.Context, id int) (*models.Video, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	for _, video := range repo.videos {
+		if video.VideoID == id {
+			return &video, nil
+		}
+	}
+	return nil, VideoNotFoundError
+}
+
+func (repo *MockImageRepository) GetVideoFrames(ctx context.Context, id int) ([]models.Image, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return repo.getVideoFrames(id)
+}
+
+func (repo *MockImageRepository) getVideoFrames(id int) ([]models.Image, error) {
+	frames := make([]models.Image, 0)
+	for _, image := range imagesAfterId(repo.images, 0) {
+		if image.VideoID != nil && *image.VideoID == id {
+			frames = append(frames, image)
+		}
+	}
+	sort.SliceStable(frames, func(i, j int) bool {
+		return *frames[i].FrameTime < *frames[j].FrameTime
+	})
+	return frames, nil
+}
+
+func (repo *MockImageRepository) DeleteVideoById(ctx context.Context, id int) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	for i, video := range repo.videos {
+		if video.VideoID == id {
+			repo.videos = append(repo.videos[:i], repo.videos[i+1:]...)
+			frames, _ := repo.getVideoFrames(id)
+			for _, frame := range frames {
+				if err := repo.deleteById(frame.ImageID); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return VideoNotFoundError
+}
@@ -4,24 +4,51 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
+	"clipsearch/metrics"
 	"clipsearch/models"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Records the latency of a query in the metrics and the debug log
+func observeQuery(ctx context.Context, method string, start time.Time) {
+	metrics.ObserveRepositoryQuery(method, start)
+	slog.DebugContext(ctx, "Repository query", "method", method, "duration", time.Since(start))
+}
+
 type PgImageRepository struct {
 	pool *pgxpool.Pool
+	// Set before the repository is used, see SetHideDeadImages
+	hideDeadImages bool
 }
 
 func NewPgImageRepository(pool *pgxpool.Pool) *PgImageRepository {
 	return &PgImageRepository{pool: pool}
 }
 
-func (repo *PgImageRepository) Count() (int, error) {
-	query := `SELECT COUNT(*) FROM Images`
-	row := repo.pool.QueryRow(context.Background(), query)
+func (repo *PgImageRepository) SetHideDeadImages(hide bool) {
+	repo.hideDeadImages = hide
+}
+
+// Returns the condition leaving out dead images, joined to the query by keyword, or "" if they aren't hidden
+func (repo *PgImageRepository) linkFilter(keyword string) string {
+	if !repo.hideDeadImages {
+		return ""
+	}
+	return " " + keyword + " LinkStatus <> '" + string(models.LinkStatusDead) + "'"
+}
+
+func (repo *PgImageRepository) Count(ctx context.Context) (int, error) {
+	defer observeQuery(ctx, "Count", time.Now())
+	query := `SELECT COUNT(*) FROM Images` + repo.linkFilter("WHERE")
+	row := repo.pool.QueryRow(ctx, query)
 	var count int
 	if err := row.Scan(&count); err != nil {
 		return 0, fmt.Errorf("Failed to count images: %w", err)
@@ -29,9 +56,10 @@ func (repo *PgImageRepository) Count() (int, error) {
 	return count, nil
 }
 
-func (repo *PgImageRepository) CountWithSha256(sha256 string) (int, error) {
+func (repo *PgImageRepository) CountWithSha256(ctx context.Context, sha256 string) (int, error) {
+	defer observeQuery(ctx, "CountWithSha256", time.Now())
 	query := `SELECT COUNT(*) FROM Images WHERE Sha256=$1`
-	row := repo.pool.QueryRow(context.Background(), query, sha256)
+	row := repo.pool.QueryRow(ctx, query, sha256)
 	var count int
 	if err := row.Scan(&count); err != nil {
 		return 0, fmt.Errorf("Failed to count images: %w", err)
@@ -52,73 +80,218 @@ func embeddingToString(embedding []float32) string {
 	return builder.String()
 }
 
-func (repo *PgImageRepository) Create(image *models.Image) (int, error) {
-	query := `INSERT INTO Images (SourceUrl,ThumbnailUrl,Sha256,Embedding) VALUES ($1,$2,$3,$4) RETURNING ImageID;`
-	rows, err := repo.pool.Query(
-		context.Background(),
+func parseEmbedding(text string) ([]float32, error) {
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "["), "]")
+	if text == "" {
+		return []float32{}, nil
+	}
+	values := strings.Split(text, ",")
+	embedding := make([]float32, len(values))
+	for i, value := range values {
+		val, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse embedding: %w", err)
+		}
+		embedding[i] = float32(val)
+	}
+	return embedding, nil
+}
+
+// Implemented by pgxpool.Pool and pgx.Tx
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Returns nil if there is no active model. lock keeps other transactions from changing the active model
+// until the transaction of q ends
+func getActiveEmbeddingModel(ctx context.Context, q queryRower, lock bool) (*models.EmbeddingModel, error) {
+	query := `SELECT Name, Dimension FROM EmbeddingModels WHERE Active`
+	if lock {
+		query += ` FOR SHARE`
+	}
+	var model models.EmbeddingModel
+	if err := q.QueryRow(ctx, query).Scan(&model.Name, &model.Dimension); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to get the active embedding model: %w", err)
+	}
+	return &model, nil
+}
+
+// Fails with EmbeddingModelMismatchError or EmbeddingDimensionMismatchError unless the embedding of image is from
+// the active model, making its model the active one if there is none. The lock on the active model is held
+// until the transaction ends, which keeps a cut-over from missing the images it inserts
+func checkActiveEmbeddingModel(ctx context.Context, tx pgx.Tx, image *models.Image) error {
+	active, err := getActiveEmbeddingModel(ctx, tx, true)
+	if err != nil {
+		return err
+	}
+	if active == nil {
+		query := `INSERT INTO EmbeddingModels (Name, Dimension, Active) VALUES ($1,$2,TRUE)
+			ON CONFLICT (Name) DO UPDATE SET Active = TRUE WHERE EmbeddingModels.Dimension = EXCLUDED.Dimension;`
+		commandTag, err := tx.Exec(ctx, query, image.EmbeddingModel, len(image.Embedding))
+		if err != nil {
+			return fmt.Errorf("Failed to activate embedding model: %w", err)
+		}
+		if commandTag.RowsAffected() == 0 {
+			return EmbeddingDimensionMismatchError
+		}
+	} else if active.Name != image.EmbeddingModel {
+		return EmbeddingModelMismatchError
+	} else if active.Dimension != len(image.Embedding) {
+		return EmbeddingDimensionMismatchError
+	}
+	return nil
+}
+
+// Inserts the image along with its embeddings, once checkActiveEmbeddingModel passed
+func insertImage(ctx context.Context, tx pgx.Tx, image *models.Image) (int, error) {
+	var metadata models.ImageMetadata
+	if image.Metadata != nil {
+		metadata = *image.Metadata
+	}
+	query := `INSERT INTO Images (SourceUrl,ThumbnailUrl,Sha256,PageUrl,VideoID,FrameTime,
+		CapturedAt,CameraMake,CameraModel,Orientation,Latitude,Longitude,Altitude,Width,Height,Caption,Keywords)
+		VALUES ($1,$2,$3,NULLIF($4, ''),$5,$6,
+		$7,NULLIF($8, ''),NULLIF($9, ''),NULLIF($10, 0),$11,$12,$13,NULLIF($14, 0),NULLIF($15, 0),NULLIF($16, ''),NULLIF($17::text[], '{}'))
+		RETURNING ImageID;`
+	var id int
+	err := tx.QueryRow(
+		ctx,
 		query, image.SourceUrl,
 		image.ThumbnailUrl,
 		image.Sha256,
-		embeddingToString(image.Embedding))
-
+		image.PageUrl,
+		image.VideoID,
+		image.FrameTime,
+		metadata.CapturedAt,
+		metadata.CameraMake,
+		metadata.CameraModel,
+		metadata.Orientation,
+		metadata.Latitude,
+		metadata.Longitude,
+		metadata.Altitude,
+		metadata.Width,
+		metadata.Height,
+		metadata.Caption,
+		metadata.Keywords).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("Failed to create image: %w", err)
 	}
-	defer rows.Close()
-	if !rows.Next() {
-		return 0, errors.New("Failed to get id of newly created image")
+	if err := setEmbedding(ctx, tx, id, image.EmbeddingModel, image.Embedding); err != nil {
+		return 0, err
 	}
-	if rows.Err() != nil {
-		return 0, rows.Err()
+	for model, embedding := range image.ExtraEmbeddings {
+		if err := setEmbedding(ctx, tx, id, model, embedding); err != nil {
+			return 0, err
+		}
 	}
-	var id int
-	err = rows.Scan(&id)
-	if err != nil {
-		return 0, errors.New("Failed to get id of newly created image")
+	for model, embeddings := range image.FrameEmbeddings {
+		if err := setFrameEmbeddings(ctx, tx, id, model, embeddings); err != nil {
+			return 0, err
+		}
 	}
 	return id, nil
 }
 
-func (repo *PgImageRepository) GetImages(offset int, limit int) ([]models.Image, error) {
-	query := `SELECT ImageID, SourceUrl, ThumbnailUrl, Sha256 FROM Images ORDER BY ImageID LIMIT $1 OFFSET $2;`
-	rows, err := repo.pool.Query(context.Background(), query, limit, offset)
-	
+func (repo *PgImageRepository) Create(ctx context.Context, image *models.Image) (int, error) {
+	defer observeQuery(ctx, "Create", time.Now())
+	tx, err := repo.pool.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to get images: %w", err)
+		return 0, fmt.Errorf("Failed to create image: %w", err)
 	}
-	
+	defer tx.Rollback(ctx)
+
+	if err := checkActiveEmbeddingModel(ctx, tx, image); err != nil {
+		return 0, err
+	}
+	id, err := insertImage(ctx, tx, image)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("Failed to create image: %w", err)
+	}
+	return id, nil
+}
+
+// The columns scanned into the fields of models.Image by imageFields
+const imageColumns = `Images.ImageID, SourceUrl, ThumbnailUrl, Sha256, COALESCE(PageUrl, ''), LinkStatus, LinkCheckedAt,
+	VideoID, FrameTime`
+
+// The scan destinations of imageColumns
+func imageFields(image *models.Image) []any {
+	return []any{&image.ImageID, &image.SourceUrl, &image.ThumbnailUrl, &image.Sha256, &image.PageUrl, &image.LinkStatus, &image.LinkCheckedAt,
+		&image.VideoID, &image.FrameTime}
+}
+
+// The columns scanned into the fields of models.ImageMetadata by metadataFields
+const metadataColumns = `CapturedAt, COALESCE(CameraMake, ''), COALESCE(CameraModel, ''), COALESCE(Orientation, 0),
+	Latitude, Longitude, Altitude, COALESCE(Width, 0), COALESCE(Height, 0), COALESCE(Caption, ''), COALESCE(Keywords, '{}')`
+
+// The scan destinations of metadataColumns
+func metadataFields(metadata *models.ImageMetadata) []any {
+	return []any{&metadata.CapturedAt, &metadata.CameraMake, &metadata.CameraModel, &metadata.Orientation,
+		&metadata.Latitude, &metadata.Longitude, &metadata.Altitude, &metadata.Width, &metadata.Height, &metadata.Caption, &metadata.Keywords}
+}
+
+// Scans rows of imageColumns
+func scanImages(rows pgx.Rows) ([]models.Image, error) {
 	defer rows.Close()
 
 	images := make([]models.Image, 0, 32)
 
 	for rows.Next() {
 		var image models.Image
-		if err := rows.Scan(&image.ImageID, &image.SourceUrl, &image.ThumbnailUrl, &image.Sha256); err != nil {
+		if err := rows.Scan(imageFields(&image)...); err != nil {
 			return nil, fmt.Errorf("Failed to get images: %w", err)
 		}
 		images = append(images, image)
 	}
 
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
 	return images, nil
 }
 
-func (repo *PgImageRepository) GetSimilarImages(embedding []float32, offset int, limit int) ([]models.Image, error) {
-	query := `SELECT ImageID, SourceUrl, ThumbnailUrl, Sha256 FROM Images ORDER BY Embedding <#> $1 LIMIT $2 OFFSET $3;`
-	rows, err := repo.pool.Query(context.Background(), query, embeddingToString(embedding), limit, offset)
+func (repo *PgImageRepository) GetImages(ctx context.Context, offset int, limit int) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetImages", time.Now())
+	query := `SELECT ` + imageColumns + ` FROM Images` + repo.linkFilter("WHERE") + ` ORDER BY ImageID LIMIT $1 OFFSET $2;`
+	rows, err := repo.pool.Query(ctx, query, limit, offset)
 	
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get images: %w", err)
 	}
-	
+
+	return scanImages(rows)
+}
+
+// Scans rows of imageColumns, distance and, if withEmbeddings is set, Embedding::text
+func scanSimilarImages(rows pgx.Rows, withEmbeddings bool) ([]models.Image, error) {
 	defer rows.Close()
 
 	images := make([]models.Image, 0, 32)
 
 	for rows.Next() {
 		var image models.Image
-		if err := rows.Scan(&image.ImageID, &image.SourceUrl, &image.ThumbnailUrl, &image.Sha256); err != nil {
+		var embeddingText string
+		dst := append(imageFields(&image), &image.Distance)
+		if withEmbeddings {
+			dst = append(dst, &embeddingText)
+		}
+		if err := rows.Scan(dst...); err != nil {
 			return nil, fmt.Errorf("Failed to get images: %w", err)
 		}
+		if withEmbeddings {
+			embedding, err := parseEmbedding(embeddingText)
+			if err != nil {
+				return nil, err
+			}
+			image.Embedding = embedding
+		}
 		images = append(images, image)
 	}
 
@@ -129,9 +302,104 @@ func (repo *PgImageRepository) GetSimilarImages(embedding []float32, offset int,
 	return images, nil
 }
 
-func (repo *PgImageRepository) GetById(id int) (*models.Image, error) {
-	query := "SELECT ImageID,SourceUrl,ThumbnailUrl,Sha256 FROM Images WHERE ImageID=$1"
-	rows, err := repo.pool.Query(context.Background(), query, id)
+func (repo *PgImageRepository) GetImagesAfterId(ctx context.Context, id int, limit int) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetImagesAfterId", time.Now())
+	query := `SELECT ` + imageColumns + ` FROM Images WHERE ImageID > $1` + repo.linkFilter("AND") + ` ORDER BY ImageID LIMIT $2;`
+	rows, err := repo.pool.Query(ctx, query, id, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get images: %w", err)
+	}
+
+	return scanImages(rows)
+}
+
+// The model named by the $2 parameter, or the active model if it's empty
+const queryModel = `COALESCE(NULLIF($2, ''), (SELECT Name FROM EmbeddingModels WHERE Active))`
+
+// Joins the images with their embeddings from queryModel
+const imageEmbeddingsOfModel = `Images JOIN ImageEmbeddings ON ImageEmbeddings.ImageID = Images.ImageID
+	AND ImageEmbeddings.Model = ` + queryModel
+
+// Selects the ImageID and Distance of the images closest to the $1 parameter, each through its closest vector from
+// queryModel: its embedding or one of its frames. Every branch orders by the distance of a single vector column,
+// so that a vector index can serve it, and checks the other vectors of an image only for the rows it reaches.
+// after is an extra condition on the rows, which use the placeholders {distance} and {id}, and limit the
+// placeholder of how many rows each branch returns at most
+func (repo *PgImageRepository) closestImages(after string, limit string) string {
+	join, filter := "", ""
+	if repo.hideDeadImages {
+		join = " JOIN Images ON Images.ImageID = E.ImageID"
+		filter = repo.linkFilter("AND")
+	}
+	condition := func(distance string, id string) string {
+		if after == "" {
+			return ""
+		}
+		return " AND " + strings.NewReplacer("{distance}", distance, "{id}", id).Replace(after)
+	}
+	return `(SELECT E.ImageID, E.Embedding <#> $1 AS Distance FROM ImageEmbeddings E` + join + `
+		WHERE E.Model = ` + queryModel + filter + condition("E.Embedding <#> $1", "E.ImageID") + `
+			AND NOT EXISTS (SELECT 1 FROM ImageFrameEmbeddings F WHERE F.ImageID = E.ImageID AND F.Model = E.Model
+				AND F.Embedding <#> $1 < E.Embedding <#> $1)
+		ORDER BY E.Embedding <#> $1 LIMIT ` + limit + `)
+	UNION ALL
+	(SELECT F.ImageID, F.Embedding <#> $1 AS Distance FROM ImageFrameEmbeddings F
+		JOIN ImageEmbeddings E ON E.ImageID = F.ImageID AND E.Model = F.Model` + join + `
+		WHERE F.Model = ` + queryModel + filter + condition("F.Embedding <#> $1", "F.ImageID") + `
+			AND F.Embedding <#> $1 < E.Embedding <#> $1
+			AND NOT EXISTS (SELECT 1 FROM ImageFrameEmbeddings O WHERE O.ImageID = F.ImageID AND O.Model = F.Model
+				AND (O.Embedding <#> $1, O.Frame) < (F.Embedding <#> $1, F.Frame))
+		ORDER BY F.Embedding <#> $1 LIMIT ` + limit + `)`
+}
+
+func (repo *PgImageRepository) GetSimilarImages(ctx context.Context, model string, embedding []float32, offset int, limit int) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetSimilarImages", time.Now())
+	query := `SELECT ` + imageColumns + `, Closest.Distance FROM (` + repo.closestImages("", "$3") + `) AS Closest
+		JOIN Images ON Images.ImageID = Closest.ImageID
+		ORDER BY Closest.Distance, Images.ImageID LIMIT $4 OFFSET $5;`
+	rows, err := repo.pool.Query(ctx, query, embeddingToString(embedding), model, offset+limit, limit, offset)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get images: %w", err)
+	}
+
+	return scanSimilarImages(rows, false)
+}
+
+func (repo *PgImageRepository) GetSimilarImagesWithEmbeddings(ctx context.Context, model string, embedding []float32, offset int, limit int) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetSimilarImagesWithEmbeddings", time.Now())
+	query := `SELECT ` + imageColumns + `, Closest.Distance, ImageEmbeddings.Embedding::text FROM (` + repo.closestImages("", "$3") + `) AS Closest
+		JOIN Images ON Images.ImageID = Closest.ImageID
+		JOIN ImageEmbeddings ON ImageEmbeddings.ImageID = Closest.ImageID AND ImageEmbeddings.Model = ` + queryModel + `
+		ORDER BY Closest.Distance, Images.ImageID LIMIT $4 OFFSET $5;`
+	rows, err := repo.pool.Query(ctx, query, embeddingToString(embedding), model, offset+limit, limit, offset)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get images: %w", err)
+	}
+
+	return scanSimilarImages(rows, true)
+}
+
+func (repo *PgImageRepository) GetSimilarImagesAfter(ctx context.Context, model string, embedding []float32, distance float64, id int, limit int) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetSimilarImagesAfter", time.Now())
+	query := `SELECT ` + imageColumns + `, Closest.Distance FROM (` + repo.closestImages("({distance}, {id}) > ($3, $4)", "$5") + `) AS Closest
+		JOIN Images ON Images.ImageID = Closest.ImageID
+		ORDER BY Closest.Distance, Images.ImageID LIMIT $5;`
+	rows, err := repo.pool.Query(ctx, query, embeddingToString(embedding), model, distance, id, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get images: %w", err)
+	}
+
+	return scanSimilarImages(rows, false)
+}
+
+func (repo *PgImageRepository) GetById(ctx context.Context, id int) (*models.Image, error) {
+	defer observeQuery(ctx, "GetById", time.Now())
+	query := "SELECT " + imageColumns + ", " + metadataColumns + " FROM Images WHERE ImageID=$1"
+	rows, err := repo.pool.Query(ctx, query, id)
 
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get image by id: %w", err)
@@ -143,15 +411,81 @@ func (repo *PgImageRepository) GetById(id int) (*models.Image, error) {
 		return nil, ImageNotFoundError
 	}
 	var image models.Image
-	if err := rows.Scan(&image.ImageID, &image.SourceUrl, &image.ThumbnailUrl, &image.Sha256); err != nil {
+	var metadata models.ImageMetadata
+	if err := rows.Scan(append(imageFields(&image), metadataFields(&metadata)...)...); err != nil {
 		return nil, fmt.Errorf("Failed to get image by id: %w", err)
 	}
+	if !metadata.IsEmpty() {
+		image.Metadata = &metadata
+	}
 	return &image, nil
 }
 
-func (repo *PgImageRepository) DeleteById(id int) error {
+func (repo *PgImageRepository) GetImagesBySourceUrl(ctx context.Context, sourceUrl string) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetImagesBySourceUrl", time.Now())
+	query := `SELECT ` + imageColumns + ` FROM Images WHERE SourceUrl = $1 ORDER BY ImageID;`
+	rows, err := repo.pool.Query(ctx, query, sourceUrl)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get images: %w", err)
+	}
+
+	return scanImages(rows)
+}
+
+// Escapes the wildcards of LIKE patterns, with the default escape character
+var likePatternEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (repo *PgImageRepository) GetImagesBySourceUrlPrefix(ctx context.Context, prefix string) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetImagesBySourceUrlPrefix", time.Now())
+	// LIKE rather than starts_with, so that the index on SourceUrl is used
+	query := `SELECT ` + imageColumns + ` FROM Images WHERE SourceUrl LIKE $1 ORDER BY ImageID;`
+	rows, err := repo.pool.Query(ctx, query, likePatternEscaper.Replace(prefix)+"%")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get images: %w", err)
+	}
+
+	return scanImages(rows)
+}
+
+func (repo *PgImageRepository) GetEmbeddings(ctx context.Context, model string, ids []int) (map[int][]float32, error) {
+	defer observeQuery(ctx, "GetEmbeddings", time.Now())
+	query := `SELECT Images.ImageID, Embedding::text FROM ` + imageEmbeddingsOfModel + ` WHERE Images.ImageID = ANY($1);`
+	rows, err := repo.pool.Query(ctx, query, ids, model)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get embeddings: %w", err)
+	}
+
+	defer rows.Close()
+
+	embeddings := make(map[int][]float32, len(ids))
+
+	for rows.Next() {
+		var id int
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			return nil, fmt.Errorf("Failed to get embeddings: %w", err)
+		}
+		embedding, err := parseEmbedding(text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[id] = embedding
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	return embeddings, nil
+}
+
+func (repo *PgImageRepository) DeleteById(ctx context.Context, id int) error {
+	defer observeQuery(ctx, "DeleteById", time.Now())
 	query := "DELETE FROM Images WHERE ImageID=$1"
-	commandTag, err := repo.pool.Exec(context.Background(), query, id)
+	commandTag, err := repo.pool.Exec(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -161,3 +495,363 @@ func (repo *PgImageRepository) DeleteById(id int) error {
 		return nil
 	}
 }
+
+func (repo *PgImageRepository) GetActiveEmbeddingModel(ctx context.Context) (*models.EmbeddingModel, error) {
+	defer observeQuery(ctx, "GetActiveEmbeddingModel", time.Now())
+	return getActiveEmbeddingModel(ctx, repo.pool, false)
+}
+
+// Returns the dimension of a registered model
+func getEmbeddingModelDimension(ctx context.Context, q queryRower, model string) (int, error) {
+	var dimension int
+	err := q.QueryRow(ctx, `SELECT Dimension FROM EmbeddingModels WHERE Name=$1`, model).Scan(&dimension)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("Embedding model %s is not registered", model)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get embedding model: %w", err)
+	}
+	return dimension, nil
+}
+
+func (repo *PgImageRepository) RegisterEmbeddingModel(ctx context.Context, model models.EmbeddingModel) error {
+	defer observeQuery(ctx, "RegisterEmbeddingModel", time.Now())
+	query := `INSERT INTO EmbeddingModels (Name, Dimension) VALUES ($1,$2) ON CONFLICT (Name) DO NOTHING;`
+	if _, err := repo.pool.Exec(ctx, query, model.Name, model.Dimension); err != nil {
+		return fmt.Errorf("Failed to register embedding model: %w", err)
+	}
+	dimension, err := getEmbeddingModelDimension(ctx, repo.pool, model.Name)
+	if err != nil {
+		return err
+	}
+	if dimension != model.Dimension {
+		return EmbeddingDimensionMismatchError
+	}
+	return nil
+}
+
+func (repo *PgImageRepository) GetImagesToReembed(ctx context.Context, model string, id int, limit int) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetImagesToReembed", time.Now())
+	query := `SELECT ` + imageColumns + ` FROM Images
+		WHERE ImageID > $1 AND NOT EXISTS (SELECT 1 FROM ImageEmbeddings WHERE ImageEmbeddings.ImageID = Images.ImageID AND Model = $2)
+		ORDER BY ImageID LIMIT $3;`
+	rows, err := repo.pool.Query(ctx, query, id, model, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get images: %w", err)
+	}
+
+	return scanImages(rows)
+}
+
+// Implemented by pgxpool.Pool and pgx.Tx
+type queryExecer interface {
+	queryRower
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Stores the embedding of an image by a registered model, replacing the one it had from that model
+func setEmbedding(ctx context.Context, q queryExecer, id int, model string, embedding []float32) error {
+	query := `INSERT INTO ImageEmbeddings (ImageID, Model, Embedding)
+		SELECT Images.ImageID, EmbeddingModels.Name, $1::vector FROM Images, EmbeddingModels
+		WHERE Images.ImageID=$2 AND EmbeddingModels.Name=$3 AND EmbeddingModels.Dimension=$4
+		ON CONFLICT (ImageID, Model) DO UPDATE SET Embedding = EXCLUDED.Embedding;`
+	commandTag, err := q.Exec(ctx, query, embeddingToString(embedding), id, model, len(embedding))
+	if err != nil {
+		return fmt.Errorf("Failed to set embedding: %w", err)
+	}
+	if commandTag.RowsAffected() > 0 {
+		return nil
+	}
+
+	dimension, err := getEmbeddingModelDimension(ctx, q, model)
+	if err != nil {
+		return err
+	}
+	if dimension != len(embedding) {
+		return EmbeddingDimensionMismatchError
+	}
+	return ImageNotFoundError
+}
+
+func (repo *PgImageRepository) SetEmbedding(ctx context.Context, id int, model string, embedding []float32) error {
+	defer observeQuery(ctx, "SetEmbedding", time.Now())
+	return setEmbedding(ctx, repo.pool, id, model, embedding)
+}
+
+// Replaces the frame embeddings of an image by a registered model
+func setFrameEmbeddings(ctx context.Context, q queryExecer, id int, model string, embeddings [][]float32) error {
+	if _, err := q.Exec(ctx, `DELETE FROM ImageFrameEmbeddings WHERE ImageID=$1 AND Model=$2;`, id, model); err != nil {
+		return fmt.Errorf("Failed to set frame embeddings: %w", err)
+	}
+	query := `INSERT INTO ImageFrameEmbeddings (ImageID, Model, Frame, Embedding)
+		SELECT Images.ImageID, EmbeddingModels.Name, $1, $2::vector FROM Images, EmbeddingModels
+		WHERE Images.ImageID=$3 AND EmbeddingModels.Name=$4 AND EmbeddingModels.Dimension=$5;`
+	for frame, embedding := range embeddings {
+		commandTag, err := q.Exec(ctx, query, frame, embeddingToString(embedding), id, model, len(embedding))
+		if err != nil {
+			return fmt.Errorf("Failed to set frame embeddings: %w", err)
+		}
+		if commandTag.RowsAffected() > 0 {
+			continue
+		}
+
+		dimension, err := getEmbeddingModelDimension(ctx, q, model)
+		if err != nil {
+			return err
+		}
+		if dimension != len(embedding) {
+			return EmbeddingDimensionMismatchError
+		}
+		return ImageNotFoundError
+	}
+	return nil
+}
+
+func (repo *PgImageRepository) SetFrameEmbeddings(ctx context.Context, id int, model string, embeddings [][]float32) error {
+	defer observeQuery(ctx, "SetFrameEmbeddings", time.Now())
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to set frame embeddings: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := setFrameEmbeddings(ctx, tx, id, model, embeddings); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed to set frame embeddings: %w", err)
+	}
+	return nil
+}
+
+func (repo *PgImageRepository) CutOverEmbeddingModel(ctx context.Context, model string, skipped []int) error {
+	defer observeQuery(ctx, "CutOverEmbeddingModel", time.Now())
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to cut over: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Waits for the images being created and blocks new ones until the cut-over is committed
+	if _, err := tx.Exec(ctx, `SELECT Name FROM EmbeddingModels WHERE Active FOR UPDATE;`); err != nil {
+		return fmt.Errorf("Failed to cut over: %w", err)
+	}
+
+	var incomplete bool
+	query := `SELECT EXISTS (SELECT 1 FROM Images
+		WHERE NOT EXISTS (SELECT 1 FROM ImageEmbeddings WHERE ImageEmbeddings.ImageID = Images.ImageID AND Model = $1)
+		AND NOT ImageID = ANY($2));`
+	if skipped == nil {
+		skipped = []int{}
+	}
+	if err := tx.QueryRow(ctx, query, model, skipped).Scan(&incomplete); err != nil {
+		return fmt.Errorf("Failed to cut over: %w", err)
+	}
+	if incomplete {
+		return ReembeddingIncompleteError
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE EmbeddingModels SET Active=FALSE WHERE Active;`); err != nil {
+		return fmt.Errorf("Failed to cut over: %w", err)
+	}
+	commandTag, err := tx.Exec(ctx, `UPDATE EmbeddingModels SET Active=TRUE WHERE Name=$1;`, model)
+	if err != nil {
+		return fmt.Errorf("Failed to cut over: %w", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return fmt.Errorf("Embedding model %s is not registered", model)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("Failed to cut over: %w", err)
+	}
+	return nil
+}
+
+func (repo *PgImageRepository) GetImagesToCheck(ctx context.Context, checkedBefore time.Time, id int, limit int) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetImagesToCheck", time.Now())
+	query := `SELECT ` + imageColumns + ` FROM Images
+		WHERE ImageID > $1 AND (LinkCheckedAt IS NULL OR LinkCheckedAt < $2)
+		ORDER BY ImageID LIMIT $3;`
+	rows, err := repo.pool.Query(ctx, query, id, checkedBefore, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get images: %w", err)
+	}
+
+	return scanImages(rows)
+}
+
+func (repo *PgImageRepository) SetLinkStatus(ctx context.Context, id int, status models.LinkStatus, checkedAt time.Time) error {
+	defer observeQuery(ctx, "SetLinkStatus", time.Now())
+	query := `UPDATE Images SET LinkStatus=$1, LinkCheckedAt=$2,
+		LinkFailures = CASE WHEN $1 = 'dead' THEN LinkFailures + 1 WHEN $1 = 'unreachable' THEN LinkFailures ELSE 0 END
+		WHERE ImageID=$3;`
+	commandTag, err := repo.pool.Exec(ctx, query, string(status), checkedAt, id)
+	if err != nil {
+		return fmt.Errorf("Failed to set link status: %w", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return ImageNotFoundError
+	}
+	return nil
+}
+
+func (repo *PgImageRepository) GetDeadImages(ctx context.Context, minFailures int) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetDeadImages", time.Now())
+	query := `SELECT ` + imageColumns + ` FROM Images WHERE LinkStatus = 'dead' AND LinkFailures >= $1 ORDER BY ImageID;`
+	rows, err := repo.pool.Query(ctx, query, minFailures)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get dead images: %w", err)
+	}
+
+	return scanImages(rows)
+}
+
+func (repo *PgImageRepository) CountVideosWithSha256(ctx context.Context, sha256 string) (int, error) {
+	defer observeQuery(ctx, "CountVideosWithSha256", time.Now())
+	query := `SELECT COUNT(*) FROM Videos WHERE Sha256=$1`
+	row := repo.pool.QueryRow(ctx, query, sha256)
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, fmt.Errorf("Failed to count videos: %w", err)
+	}
+	return count, nil
+}
+
+func (repo *PgImageRepository) CreateVideo(ctx context.Context, video *models.Video, frames []models.Image) (int, error) {
+	defer observeQuery(ctx, "CreateVideo", time.Now())
+	tx, err := repo.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create video: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO Videos (SourceUrl,Sha256) VALUES ($1,$2) RETURNING VideoID;`
+	var id int
+	if err := tx.QueryRow(ctx, query, video.SourceUrl, video.Sha256).Scan(&id); err != nil {
+		return 0, fmt.Errorf("Failed to create video: %w", err)
+	}
+	for i := range frames {
+		if i == 0 {
+			if err := checkActiveEmbeddingModel(ctx, tx, &frames[i]); err != nil {
+				return 0, err
+			}
+		} else if frames[i].EmbeddingModel != frames[0].EmbeddingModel || len(frames[i].Embedding) != len(frames[0].Embedding) {
+			return 0, EmbeddingModelMismatchError
+		}
+		frames[i].VideoID = &id
+		if _, err := insertImage(ctx, tx, &frames[i]); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("Failed to create video: %w", err)
+	}
+	return id, nil
+}
+
+func (repo *PgImageRepository) GetVideoById(ctx context.Context, id int) (*models.Video, error) {
+	defer observeQuery(ctx, "GetVideoById", time.Now())
+	query := `SELECT VideoID, SourceUrl, Sha256 FROM Videos WHERE VideoID=$1`
+	var video models.Video
+	err := repo.pool.QueryRow(ctx, query, id).Scan(&video.VideoID, &video.SourceUrl, &video.Sha256)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, VideoNotFoundError
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get video by id: %w", err)
+	}
+	return &video, nil
+}
+
+func (repo *PgImageRepository) GetVideoFrames(ctx context.Context, id int) ([]models.Image, error) {
+	defer observeQuery(ctx, "GetVideoFrames", time.Now())
+	query := `SELECT ` + imageColumns + ` FROM Images WHERE VideoID=$1 ORDER BY FrameTime, ImageID;`
+	rows, err := repo.pool.Query(ctx, query, id)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get video frames: %w", err)
+	}
+
+	return scanImages(rows)
+}
+
+func (repo *PgImageRepository) DeleteVideoById(ctx context.Context, id int) error {
+	defer observeQuery(ctx, "DeleteVideoById", time.Now())
+	// The frames are deleted by the foreign key
+	commandTag, err := repo.pool.Exec(ctx, `DELETE FROM Videos WHERE VideoID=$1`, id)
+	if err != nil {
+		return fmt.Errorf("Failed to delete video: %w", err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return VideoNotFoundError
+	}
+	return nil
+}
+
+func (repo *PgImageRepository) Ping(ctx context.Context) error {
+	return repo.pool.Ping(ctx)
+}
+
+// Checks that the vector extension is installed and that the tables have all the columns the repository uses
+func (repo *PgImageRepository) CheckSchema(ctx context.Context) error {
+	var hasVector bool
+	row := repo.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'vector');`)
+	if err := row.Scan(&hasVector); err != nil {
+		return fmt.Errorf("Failed to check for the vector extension: %w", err)
+	}
+	if !hasVector {
+		return errors.New("The vector extension is not installed")
+	}
+
+	query := `SELECT ` + imageColumns + `, ` + metadataColumns + `, LinkFailures FROM Images LIMIT 0;`
+	rows, err := repo.pool.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("The Images table is missing or outdated: %w", err)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	query = `SELECT Name, Dimension, Active FROM EmbeddingModels LIMIT 0;`
+	rows, err = repo.pool.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("The EmbeddingModels table is missing or outdated: %w", err)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	query = `SELECT ImageID, Model, Embedding FROM ImageEmbeddings LIMIT 0;`
+	rows, err = repo.pool.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("The ImageEmbeddings table is missing or outdated: %w", err)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	query = `SELECT VideoID, SourceUrl, Sha256 FROM Videos LIMIT 0;`
+	rows, err = repo.pool.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("The Videos table is missing or outdated: %w", err)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return rows.Err()
+	}
+
+	query = `SELECT ImageID, Model, Frame, Embedding FROM ImageFrameEmbeddings LIMIT 0;`
+	rows, err = repo.pool.Query(ctx, query)
+	if err != nil {
+		return fmt.Errorf("The ImageFrameEmbeddings table is missing or outdated: %w", err)
+	}
+	rows.Close()
+	return rows.Err()
+}
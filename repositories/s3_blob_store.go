@@ -0,0 +1,236 @@
+package repositories
+
+import (
+	"bytes"
+	"clipsearch/config"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Error responses are small XML documents, anything bigger is cut off
+const maxS3ErrorResponseSize = 64 * 1024
+
+// A BlobStore keeping every blob in an object of an S3 compatible bucket.
+// Requests are signed with AWS Signature Version 4 and address the bucket by path, which MinIO and AWS both support
+type S3BlobStore struct {
+	client   *http.Client
+	config   config.S3BlobConfig
+	endpoint *url.URL
+	// Overridden by tests
+	now func() time.Time
+}
+
+func NewS3BlobStore(s3Config config.S3BlobConfig) (*S3BlobStore, error) {
+	endpoint, err := url.Parse(s3Config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid S3 endpoint: %w", err)
+	}
+	return &S3BlobStore{
+		client:   &http.Client{Timeout: s3Config.Timeout},
+		config:   s3Config,
+		endpoint: endpoint,
+		now:      time.Now,
+	}, nil
+}
+
+// The error document S3 responds with
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// Sends a request for the object stored under key
+func (store *S3BlobStore) do(ctx context.Context, method string, key string, body []byte) (*http.Response, error) {
+	if err := checkBlobKey(key); err != nil {
+		return nil, err
+	}
+	objectUrl := *store.endpoint
+	objectUrl.Path = strings.TrimSuffix(objectUrl.Path, "/") + "/" + store.config.Bucket + "/" + key
+
+	req, err := http.NewRequestWithContext(ctx, method, objectUrl.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", http.DetectContentType(body))
+	}
+	signS3Request(req, body, store.config, store.now())
+
+	resp, err := store.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// Turns an unsuccessful response into an error, closing its body
+func s3ResponseError(resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return BlobNotFoundError
+	}
+	var s3Err s3Error
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxS3ErrorResponseSize))
+	if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("S3 request failed with status code %d: %s: %s", resp.StatusCode, s3Err.Code, s3Err.Message)
+	}
+	return fmt.Errorf("S3 request failed with status code %d", resp.StatusCode)
+}
+
+func (store *S3BlobStore) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := store.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return s3ResponseError(resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (store *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	resp, err := store.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, s3ResponseError(resp)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// S3 doesn't report whether a deleted object existed, so it's checked for first
+func (store *S3BlobStore) Delete(ctx context.Context, key string) error {
+	resp, err := store.do(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return s3ResponseError(resp)
+	}
+	resp.Body.Close()
+
+	resp, err = store.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3ResponseError(resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256HexString(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// Escapes a path like S3 expects in canonical requests: everything but unreserved characters and '/'
+func s3EscapePath(path string) string {
+	var builder strings.Builder
+	for _, b := range []byte(path) {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			builder.WriteByte(b)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+// Builds the canonical request of AWS Signature Version 4 out of req and the names of the headers it signs
+func s3CanonicalRequest(req *http.Request, payloadHash string) (string, string) {
+	headers := make(map[string]string, len(req.Header)+1)
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	headers["host"] = req.URL.Host
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if name == "authorization" || name == "user-agent" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	queryKeys := make([]string, 0, len(query))
+	for key := range query {
+		queryKeys = append(queryKeys, key)
+	}
+	sort.Strings(queryKeys)
+	canonicalQuery := make([]string, 0, len(queryKeys))
+	for _, key := range queryKeys {
+		for _, value := range query[key] {
+			canonicalQuery = append(canonicalQuery, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	return strings.Join([]string{
+		req.Method,
+		s3EscapePath(path),
+		strings.Join(canonicalQuery, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n"), signedHeaders
+}
+
+// Returns the Authorization header of req, signing the headers it already has
+func s3Authorization(req *http.Request, payloadHash string, s3Config config.S3BlobConfig, now time.Time) string {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	scope := date + "/" + s3Config.Region + "/s3/aws4_request"
+
+	canonicalRequest, signedHeaders := s3CanonicalRequest(req, payloadHash)
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256HexString([]byte(canonicalRequest))
+
+	key := hmacSha256([]byte("AWS4"+s3Config.SecretAccessKey), date)
+	key = hmacSha256(key, s3Config.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Config.AccessKeyId, scope, signedHeaders, signature)
+}
+
+// Adds the headers of AWS Signature Version 4 to req
+func signS3Request(req *http.Request, body []byte, s3Config config.S3BlobConfig, now time.Time) {
+	payloadHash := sha256HexString(body)
+	req.Header.Set("X-Amz-Date", now.UTC().Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("Authorization", s3Authorization(req, payloadHash, s3Config, now))
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/models"
+	"clipsearch/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+// Adds the image files of zip and tar archives
+type ArchiveImporter struct {
+	imageService *ImageService
+	config       config.ArchiveConfig
+}
+
+func NewArchiveImporter(imageService *ImageService, archiveConfig config.ArchiveConfig) *ArchiveImporter {
+	return &ArchiveImporter{imageService: imageService, config: archiveConfig}
+}
+
+// Adds the image files of the archive named name in r, storing them with their path under baseUrl, or under the
+// archive:// url of the archive if it's empty. Returns the outcome of every entry except the directories.
+// Fails with utils.UnknownArchiveFormatError, utils.ArchiveTooLargeError, utils.TooManyArchiveEntriesError or
+// utils.CorruptArchiveError, before adding anything unless the sizes stored in the archive are wrong
+func (i *ArchiveImporter) Import(ctx context.Context, r io.ReaderAt, size int64, name string, baseUrl string) ([]models.ArchiveEntryResult, error) {
+	if size > int64(i.config.MaxSize) {
+		return nil, utils.ArchiveTooLargeError
+	}
+	limits := utils.ArchiveLimits{MaxTotalSize: int64(i.config.MaxTotalSize), MaxEntries: i.config.MaxEntries}
+
+	// Counts the entries and their stored sizes first, so archives over the limits are rejected as a whole.
+	// Gzipped tars are unpacked to do so, which the total size limit bounds
+	var totalSize int64
+	err := utils.WalkArchive(r, size, limits, func(entry *utils.ArchiveEntry) error {
+		if entry.IsFile && isImageEntry(entry.Name) {
+			totalSize += entry.Size
+			if totalSize > limits.MaxTotalSize {
+				return utils.ArchiveTooLargeError
+			}
+		}
+		return ctx.Err()
+	})
+	if err != nil && ctx.Err() == nil && !errors.Is(err, utils.UnknownArchiveFormatError) &&
+		!errors.Is(err, utils.ArchiveTooLargeError) && !errors.Is(err, utils.TooManyArchiveEntriesError) {
+		return nil, fmt.Errorf("%w: %v", utils.CorruptArchiveError, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if baseUrl == "" {
+		baseUrl = utils.ArchiveUrl(name)
+	}
+	results := make([]models.ArchiveEntryResult, 0, 64)
+	err = utils.WalkArchive(r, size, limits, func(entry *utils.ArchiveEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !entry.IsFile && strings.HasSuffix(entry.Name, "/") {
+			return nil
+		}
+		result, err := i.importEntry(ctx, entry, baseUrl)
+		results = append(results, result)
+		return err
+	})
+	slog.InfoContext(ctx, "Imported archive", "name", name, "entries", len(results), "error", err)
+	return results, err
+}
+
+// Adds the image file of entry. Only fails for errors that end the import
+func (i *ArchiveImporter) importEntry(ctx context.Context, entry *utils.ArchiveEntry, baseUrl string) (models.ArchiveEntryResult, error) {
+	entryPath, ok := utils.SafeArchivePath(entry.Name)
+	if !ok {
+		return models.ArchiveEntryResult{Path: entry.Name, Status: models.ArchiveEntryUnsafePath}, nil
+	}
+	result := models.ArchiveEntryResult{Path: entryPath}
+	if !entry.IsFile || !isImageEntry(entryPath) {
+		result.Status = models.ArchiveEntrySkipped
+		return result, nil
+	}
+
+	data, err := entry.Read(i.imageService.config.MaxFileSize)
+	if err == utils.ArchiveTooLargeError {
+		return result, err
+	}
+	if err == nil {
+		result.Url = utils.JoinUrlPath(baseUrl, entryPath)
+		err = i.imageService.AddImageData(ctx, data, result.Url, result.Url)
+	}
+	switch {
+	case err == nil:
+		result.Status = models.ArchiveEntryAdded
+	case err == ImageExistsError:
+		result.Status = models.ArchiveEntryDuplicate
+	case err == utils.FileSizeExceededError:
+		result.Status = models.ArchiveEntryTooLarge
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return result, err
+	default:
+		result.Status = models.ArchiveEntryFailed
+		result.Error = err.Error()
+	}
+	if result.Status != models.ArchiveEntryAdded {
+		result.Url = ""
+	}
+	return result, nil
+}
+
+// Whether the archive entry at name is an image file that isn't hidden, like the files macOS adds to zips
+func isImageEntry(name string) bool {
+	for _, segment := range strings.Split(strings.ReplaceAll(name, `\`, "/"), "/") {
+		if (strings.HasPrefix(segment, ".") && segment != ".") || segment == "__MACOSX" {
+			return false
+		}
+	}
+	return imageFileExtensions[strings.ToLower(path.Ext(name))]
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"clipsearch/config"
+	"clipsearch/fakeclip"
+	"clipsearch/models"
+	"clipsearch/repositories"
+	"clipsearch/utils"
+	"context"
+	"errors"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestArchiveImporter(t *testing.T) {
+	ctx := context.Background()
+	red := fakeclip.SolidColorPng(color.RGBA{R: 255, A: 255})
+	green := fakeclip.SolidColorPng(color.RGBA{G: 255, A: 255})
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"cats/", nil},
+		{"cats/red.png", red},
+		{"cats/red copy.png", red},
+		{"green.PNG", green},
+		{"notes.txt", []byte("not an image")},
+		{"__MACOSX/cats/._red.png", red},
+		{"../evil.png", red},
+		{"large.png", make([]byte, 4096)},
+	} {
+		w, err := writer.Create(file.name)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err := w.Write(file.data); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	archive := buf.Bytes()
+
+	newImporter := func(archiveConfig config.ArchiveConfig) (*repositories.MockImageRepository, *ArchiveImporter) {
+		imagesConfig := config.Default().Images
+		imagesConfig.MaxFileSize = 2048
+		mockRepo := repositories.NewMockImageRepository()
+		return mockRepo, NewArchiveImporter(NewImageService(mockRepo, NewMockClipService(), imagesConfig), archiveConfig)
+	}
+
+	t.Run("entry outcomes", func(t *testing.T) {
+		mockRepo, importer := newImporter(config.Default().Archives)
+		results, err := importer.Import(ctx, bytes.NewReader(archive), int64(len(archive)), "/tmp/data set.zip", "")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		want := []models.ArchiveEntryResult{
+			{Path: "cats/red.png", Status: models.ArchiveEntryAdded, Url: "archive:///data%20set.zip/cats/red.png"},
+			{Path: "cats/red copy.png", Status: models.ArchiveEntryDuplicate},
+			{Path: "green.PNG", Status: models.ArchiveEntryAdded, Url: "archive:///data%20set.zip/green.PNG"},
+			{Path: "notes.txt", Status: models.ArchiveEntrySkipped},
+			{Path: "__MACOSX/cats/._red.png", Status: models.ArchiveEntrySkipped},
+			{Path: "../evil.png", Status: models.ArchiveEntryUnsafePath},
+			{Path: "large.png", Status: models.ArchiveEntryTooLarge},
+		}
+		if !reflect.DeepEqual(results, want) {
+			t.Fatalf("Results = %v, want = %v", results, want)
+		}
+		if count, _ := mockRepo.Count(ctx); count != 2 {
+			t.Fatalf("Stored %d images, want 2", count)
+		}
+	})
+
+	t.Run("base url", func(t *testing.T) {
+		mockRepo, importer := newImporter(config.Default().Archives)
+		if _, err := importer.Import(ctx, bytes.NewReader(archive), int64(len(archive)), "dataset.zip", "https://cdn.example.com/dataset/"); err != nil {
+			t.Fatalf(err.Error())
+		}
+		images, err := mockRepo.GetImagesBySourceUrl(ctx, "https://cdn.example.com/dataset/cats/red.png")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 1 {
+			t.Fatalf("Expected cats/red.png to be stored under the base url")
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		archiveConfig := config.Default().Archives
+		archiveConfig.MaxTotalSize = 1024
+		mockRepo, importer := newImporter(archiveConfig)
+		if _, err := importer.Import(ctx, bytes.NewReader(archive), int64(len(archive)), "dataset.zip", ""); err != utils.ArchiveTooLargeError {
+			t.Fatalf("Expected Import to fail with ArchiveTooLargeError, got %v", err)
+		}
+		if count, _ := mockRepo.Count(ctx); count != 0 {
+			t.Fatalf("Stored %d images, want none", count)
+		}
+
+		archiveConfig = config.Default().Archives
+		archiveConfig.MaxSize = len(archive) - 1
+		_, importer = newImporter(archiveConfig)
+		if _, err := importer.Import(ctx, bytes.NewReader(archive), int64(len(archive)), "dataset.zip", ""); err != utils.ArchiveTooLargeError {
+			t.Fatalf("Expected Import to fail with ArchiveTooLargeError, got %v", err)
+		}
+
+		_, importer = newImporter(config.Default().Archives)
+		corrupt := append([]byte("PK\x03\x04"), make([]byte, 64)...)
+		if _, err := importer.Import(ctx, bytes.NewReader(corrupt), int64(len(corrupt)), "dataset.zip", ""); !errors.Is(err, utils.CorruptArchiveError) {
+			t.Fatalf("Expected Import to fail with CorruptArchiveError, got %v", err)
+		}
+	})
+}
@@ -1,6 +1,52 @@
 package services
 
+import (
+	"clipsearch/models"
+	"context"
+)
+
 type ClipService interface {
-	EncodeImage(imageData []byte) ([]float32, error)
-	EncodeText(text string) ([]float32, error)
+	EncodeImage(ctx context.Context, imageData []byte) ([]float32, error)
+	EncodeText(ctx context.Context, text string) ([]float32, error)
+	// Returns the model the embeddings are computed with
+	ModelInfo(ctx context.Context) (models.EmbeddingModel, error)
+}
+
+// Implemented by the ClipServices that can encode several inputs in one call.
+// The embeddings are in the order of the inputs
+type BatchClipService interface {
+	EncodeImages(ctx context.Context, images [][]byte) ([][]float32, error)
+	EncodeTexts(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Encodes the texts in one call if clip is a BatchClipService, one at a time otherwise
+func encodeTexts(ctx context.Context, clip ClipService, texts []string) ([][]float32, error) {
+	if batch, ok := clip.(BatchClipService); ok && len(texts) > 1 {
+		return batch.EncodeTexts(ctx, texts)
+	}
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embedding, err := clip.EncodeText(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
+}
+
+// Encodes the images in one call if clip is a BatchClipService, one at a time otherwise
+func encodeImages(ctx context.Context, clip ClipService, images [][]byte) ([][]float32, error) {
+	if batch, ok := clip.(BatchClipService); ok && len(images) > 1 {
+		return batch.EncodeImages(ctx, images)
+	}
+	embeddings := make([][]float32, len(images))
+	for i, image := range images {
+		embedding, err := clip.EncodeImage(ctx, image)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
 }
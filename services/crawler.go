@@ -0,0 +1,279 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/utils"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// The most of a robots.txt that is read, as recommended by RFC 9309
+const maxRobotsSize = 500 * 1024
+
+// Adds the images of web pages, following their links within the allowed domains. Respects robots.txt
+// and waits between two requests to the same host
+type Crawler struct {
+	imageService *ImageService
+	config       config.CrawlConfig
+	userAgent    string
+	client       *http.Client
+	// Keyed by scheme and host
+	robots      map[string]*utils.RobotsRules
+	nextRequest map[string]time.Time
+}
+
+// A page to crawl, depth links away from a seed
+type crawlPage struct {
+	url   *url.URL
+	depth int
+}
+
+func NewCrawler(imageService *ImageService, crawlConfig config.CrawlConfig) *Crawler {
+	return &Crawler{
+		imageService: imageService,
+		config:       crawlConfig,
+		userAgent:    imageService.config.DownloadUserAgent,
+		client:       &http.Client{},
+		robots:       make(map[string]*utils.RobotsRules),
+		nextRequest:  make(map[string]time.Time),
+	}
+}
+
+// Crawls the pages reachable from seeds until there are none left, MaxPages were visited or ctx is done.
+// Failures of single pages and images are logged
+func (c *Crawler) Crawl(ctx context.Context, seeds []string) error {
+	queue := make([]crawlPage, 0, len(seeds))
+	visited := make(map[string]bool)
+	allowedDomains := c.config.AllowedDomains
+	for _, seed := range seeds {
+		seedUrl, err := url.Parse(seed)
+		if err != nil || (seedUrl.Scheme != "http" && seedUrl.Scheme != "https") {
+			return fmt.Errorf("Invalid seed url %s", seed)
+		}
+		seedUrl.Fragment = ""
+		if len(c.config.AllowedDomains) == 0 {
+			allowedDomains = append(allowedDomains, seedUrl.Hostname())
+		}
+		if !visited[seedUrl.String()] {
+			visited[seedUrl.String()] = true
+			queue = append(queue, crawlPage{url: seedUrl})
+		}
+	}
+
+	addedImages := make(map[string]bool)
+	pages, images := 0, 0
+	for len(queue) > 0 && pages < c.config.MaxPages && ctx.Err() == nil {
+		page := queue[0]
+		queue = queue[1:]
+		if !c.allowed(ctx, page.url) {
+			slog.DebugContext(ctx, "Page is disallowed by robots.txt", "url", page.url.String())
+			continue
+		}
+
+		pageUrl, links, err := c.fetchPage(ctx, page.url)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.WarnContext(ctx, "Failed to crawl page", "url", page.url.String(), "error", err)
+			}
+			continue
+		}
+		if pageUrl.String() != page.url.String() {
+			// Redirected
+			if visited[pageUrl.String()] {
+				continue
+			}
+			visited[pageUrl.String()] = true
+		}
+		pages++
+
+		for _, link := range links.Links {
+			if isImageLink(link) {
+				// Links to the full size versions of the images of galleries
+				links.Images = append(links.Images, link)
+				continue
+			}
+			linkUrl, err := url.Parse(link)
+			if err != nil || visited[link] || page.depth >= c.config.MaxDepth || !domainAllowed(linkUrl.Hostname(), allowedDomains) {
+				continue
+			}
+			visited[link] = true
+			queue = append(queue, crawlPage{url: linkUrl, depth: page.depth + 1})
+		}
+		for _, image := range links.Images {
+			if addedImages[image] {
+				continue
+			}
+			addedImages[image] = true
+			if c.addImage(ctx, image, pageUrl.String()) {
+				images++
+			}
+		}
+		slog.DebugContext(ctx, "Crawled page", "url", pageUrl.String(), "depth", page.depth, "links", len(links.Links), "images", len(links.Images))
+	}
+
+	slog.InfoContext(ctx, "Crawl finished", "pages", pages, "imagesAdded", images, "pagesLeft", len(queue))
+	return ctx.Err()
+}
+
+// Whether host is one of domains or a subdomain of one of them
+func domainAllowed(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the link points at an image file rather than a page, going by its extension
+func isImageLink(link string) bool {
+	linkUrl, err := url.Parse(link)
+	return err == nil && imageFileExtensions[strings.ToLower(path.Ext(linkUrl.Path))]
+}
+
+// Loads the page at pageUrl and extracts its links. Returns the url of the page after redirects
+func (c *Crawler) fetchPage(ctx context.Context, pageUrl *url.URL) (*url.URL, utils.PageLinks, error) {
+	if err := c.wait(ctx, pageUrl); err != nil {
+		return nil, utils.PageLinks{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+	resp, err := c.get(ctx, pageUrl.String())
+	if err != nil {
+		return nil, utils.PageLinks{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, utils.PageLinks{}, fmt.Errorf("Request wasn't completed successfully, status code %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, utils.PageLinks{}, fmt.Errorf("Not an html page but %s", mediaType)
+	}
+
+	links, err := utils.ExtractPageLinks(resp.Request.URL, &utils.LimitedReader{
+		Reader:             resp.Body,
+		MaxBytesLeftToRead: c.imageService.config.MaxFileSize,
+	})
+	if err != nil {
+		return nil, utils.PageLinks{}, err
+	}
+	return resp.Request.URL, links, nil
+}
+
+// Adds the image at imageUrl found on the page at pageUrl, unless it was added before.
+// Returns whether the image was added
+func (c *Crawler) addImage(ctx context.Context, imageUrl string, pageUrl string) bool {
+	parsed, err := url.Parse(imageUrl)
+	if err != nil {
+		return false
+	}
+	stored, err := c.imageService.ImageRepo.GetImagesBySourceUrl(ctx, imageUrl)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to look up a crawled image", "url", imageUrl, "error", err)
+		return false
+	}
+	if len(stored) > 0 {
+		return false
+	}
+	if !c.allowed(ctx, parsed) {
+		slog.DebugContext(ctx, "Image is disallowed by robots.txt", "url", imageUrl)
+		return false
+	}
+
+	if err := c.wait(ctx, parsed); err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+	err = c.imageService.AddPageImageByURL(ctx, imageUrl, imageUrl, pageUrl)
+	if err != nil && err != ImageExistsError && err != utils.FileSizeExceededError {
+		slog.WarnContext(ctx, "Failed to add crawled image", "url", imageUrl, "page", pageUrl, "error", err)
+	}
+	return err == nil
+}
+
+// Whether the robots.txt of the host of u allows crawling u, loading it the first time the host is crawled
+func (c *Crawler) allowed(ctx context.Context, u *url.URL) bool {
+	key := u.Scheme + "://" + u.Host
+	rules, ok := c.robots[key]
+	if !ok {
+		rules = c.fetchRobots(ctx, key)
+		c.robots[key] = rules
+	}
+	return rules.Allowed(u)
+}
+
+// Loads the robots.txt of the host at origin. A missing robots.txt allows everything, one that fails to load
+// disallows everything
+func (c *Crawler) fetchRobots(ctx context.Context, origin string) *utils.RobotsRules {
+	robotsUrl, err := url.Parse(origin + "/robots.txt")
+	if err != nil {
+		return utils.DisallowAllRobotsRules
+	}
+	if err := c.wait(ctx, robotsUrl); err != nil {
+		return utils.DisallowAllRobotsRules
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+	resp, err := c.get(ctx, robotsUrl.String())
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load robots.txt, skipping the host", "url", robotsUrl.String(), "error", err)
+		return utils.DisallowAllRobotsRules
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return utils.AllowAllRobotsRules
+	}
+	if resp.StatusCode != http.StatusOK {
+		slog.WarnContext(ctx, "Failed to load robots.txt, skipping the host", "url", robotsUrl.String(), "status", resp.StatusCode)
+		return utils.DisallowAllRobotsRules
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+	if err != nil {
+		return utils.DisallowAllRobotsRules
+	}
+	return utils.ParseRobots(data, c.userAgent)
+}
+
+func (c *Crawler) get(ctx context.Context, rawUrl string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	return c.client.Do(req)
+}
+
+// Waits until the next request to the host of u may be sent. The hosts are sent a request every HostInterval
+// at most, or every Crawl-delay of their robots.txt if it's longer
+func (c *Crawler) wait(ctx context.Context, u *url.URL) error {
+	key := u.Scheme + "://" + u.Host
+	interval := c.config.HostInterval
+	if rules, ok := c.robots[key]; ok && rules.CrawlDelay > interval {
+		interval = rules.CrawlDelay
+	}
+
+	now := time.Now()
+	next := c.nextRequest[key]
+	if next.After(now) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(next.Sub(now)):
+		}
+		now = next
+	}
+	c.nextRequest[key] = now.Add(interval)
+	return nil
+}
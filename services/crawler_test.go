@@ -0,0 +1,148 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/fakeclip"
+	"clipsearch/repositories"
+	"context"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCrawler(t *testing.T) {
+	ctx := context.Background()
+	red := fakeclip.SolidColorPng(color.RGBA{R: 255, A: 255})
+	green := fakeclip.SolidColorPng(color.RGBA{G: 255, A: 255})
+	blue := fakeclip.SolidColorPng(color.RGBA{B: 255, A: 255})
+	white := fakeclip.SolidColorPng(color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	black := fakeclip.SolidColorPng(color.RGBA{A: 255})
+
+	// The pages link to each other through 127.0.0.1, and to /other/ through localhost, another domain of the same server
+	var server *httptest.Server
+	pages := map[string]string{
+		"/robots.txt": "User-agent: *\nDisallow: /private/\n",
+		"/": `<meta property="og:image" content="/red.png">
+			<a href="/gallery/">Gallery</a> <a href="/private/">Private</a> <a href="LOCALHOST/other/">Other domain</a>`,
+		"/gallery/":      `<img src="/green.png"><a href="/blue.png">Full size</a> <a href="/gallery/more/">More</a>`,
+		"/gallery/more/": `<img src="/white.png">`,
+		"/private/":      `<img src="/black.png">`,
+		"/other/":        `<img src="/black.png">`,
+	}
+	images := map[string][]byte{"/red.png": red, "/green.png": green, "/blue.png": blue, "/white.png": white, "/black.png": black}
+	var requestsMutex sync.Mutex
+	requests := make(map[string]int)
+	// Requests sent to the path, on 127.0.0.1
+	requestCount := func(path string) int {
+		requestsMutex.Lock()
+		defer requestsMutex.Unlock()
+		return requests[strings.TrimPrefix(server.URL, "http://")+path]
+	}
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requestsMutex.Lock()
+		requests[req.Host+req.URL.Path]++
+		requestsMutex.Unlock()
+		if page, ok := pages[req.URL.Path]; ok {
+			if req.URL.Path == "/robots.txt" {
+				rw.Header().Set("Content-Type", "text/plain")
+			} else {
+				rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+			}
+			rw.Write([]byte(strings.ReplaceAll(page, "LOCALHOST", strings.Replace(server.URL, "127.0.0.1", "localhost", 1))))
+			return
+		}
+		if image, ok := images[req.URL.Path]; ok {
+			rw.Write(image)
+			return
+		}
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	newCrawler := func(crawlConfig config.CrawlConfig) (*repositories.MockImageRepository, *Crawler) {
+		mockRepo := repositories.NewMockImageRepository()
+		imageService := NewImageService(mockRepo, NewMockClipService(), config.Default().Images)
+		return mockRepo, NewCrawler(imageService, crawlConfig)
+	}
+
+	// Returns the page urls of the stored images keyed by their path
+	storedPages := func(t *testing.T, repo *repositories.MockImageRepository) map[string]string {
+		stored, err := repo.GetImagesBySourceUrlPrefix(ctx, "")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		pageUrls := make(map[string]string, len(stored))
+		for _, image := range stored {
+			pageUrls[strings.TrimPrefix(image.SourceUrl, server.URL)] = strings.TrimPrefix(image.PageUrl, server.URL)
+		}
+		return pageUrls
+	}
+
+	t.Run("depth and robots.txt", func(t *testing.T) {
+		crawlConfig := config.Default().Crawl
+		crawlConfig.MaxDepth = 1
+		crawlConfig.HostInterval = 0
+		mockRepo, crawler := newCrawler(crawlConfig)
+		if err := crawler.Crawl(ctx, []string{server.URL + "/"}); err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		stored := storedPages(t, mockRepo)
+		want := map[string]string{"/red.png": "/", "/green.png": "/gallery/", "/blue.png": "/gallery/"}
+		if len(stored) != len(want) {
+			t.Fatalf("Stored images = %v, want = %v", stored, want)
+		}
+		for imagePath, pagePath := range want {
+			if stored[imagePath] != pagePath {
+				t.Fatalf("Stored images = %v, want = %v", stored, want)
+			}
+		}
+		for _, path := range []string{"/private/", "/gallery/more/"} {
+			if requestCount(path) != 0 {
+				t.Fatalf("Expected %s not to be crawled", path)
+			}
+		}
+
+		// Images that were added before aren't downloaded again
+		before := requestCount("/red.png")
+		if err := crawler.Crawl(ctx, []string{server.URL + "/"}); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if requestCount("/red.png") != before {
+			t.Fatalf("Expected /red.png not to be downloaded again")
+		}
+	})
+
+	t.Run("allowed domains", func(t *testing.T) {
+		crawlConfig := config.Default().Crawl
+		crawlConfig.AllowedDomains = []string{"localhost", "127.0.0.1"}
+		crawlConfig.HostInterval = 0
+		mockRepo, crawler := newCrawler(crawlConfig)
+		if err := crawler.Crawl(ctx, []string{server.URL + "/"}); err != nil {
+			t.Fatalf(err.Error())
+		}
+		stored := storedPages(t, mockRepo)
+		if len(stored) != 5 {
+			t.Fatalf("Stored images = %v, want the images of both domains", stored)
+		}
+	})
+
+	t.Run("host interval", func(t *testing.T) {
+		crawlConfig := config.Default().Crawl
+		crawlConfig.MaxDepth = 0
+		crawlConfig.HostInterval = 50 * time.Millisecond
+		_, crawler := newCrawler(crawlConfig)
+		start := time.Now()
+		// robots.txt, the page and its image
+		if err := crawler.Crawl(ctx, []string{server.URL + "/gallery/more/"}); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Fatalf("Crawl took %s, want >= 100ms for 3 requests", elapsed)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"clipsearch/models"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var InvalidCursorError = errors.New("Invalid cursor")
+
+// Points at the last image of a page. Listings only need the id,
+// searches also need the distance of the image to the query and the key of the query, see searchKey
+type Cursor struct {
+	Id       int      `json:"id"`
+	Distance *float64 `json:"d,omitempty"`
+	Query    string   `json:"q,omitempty"`
+}
+
+// Encodes the cursor as an opaque url-safe token
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decodes a cursor of the query with the given key, "" for listings.
+// Fails with InvalidCursorError if token is malformed or was returned with another query
+func DecodeCursor(token string, query string) (Cursor, error) {
+	var cursor Cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, InvalidCursorError
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, InvalidCursorError
+	}
+	if cursor.Query != query {
+		return Cursor{}, InvalidCursorError
+	}
+	return cursor, nil
+}
+
+// Identifies a search by the model and the parameters its results are ranked by,
+// so that its cursors can't be used to page through the results of another one
+func searchKey(model string, params any) string {
+	data, _ := json.Marshal(struct {
+		Model  string
+		Params any
+	}{model, params})
+	hash := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(hash[:12])
+}
+
+// Returns the cursor of the page following images, or "" if images is not a full page
+func nextListingCursor(images []models.Image, limit int) string {
+	if limit == 0 || len(images) < limit {
+		return ""
+	}
+	return Cursor{Id: images[len(images)-1].ImageID}.Encode()
+}
+
+func nextSearchCursor(images []models.Image, limit int, query string) string {
+	if limit == 0 || len(images) < limit {
+		return ""
+	}
+	last := images[len(images)-1]
+	distance := last.Distance
+	return Cursor{Id: last.ImageID, Distance: &distance, Query: query}.Encode()
+}
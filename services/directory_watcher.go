@@ -0,0 +1,387 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/models"
+	"clipsearch/utils"
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Extensions of the image files the directory watcher and the archive importer add, and of the links the crawler
+// takes for images
+var imageFileExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+	".bmp":  true,
+}
+
+// Keeps the images in sync with the image files of local directories: new files are added, modified files
+// replace their image and deleted files delete it. Images are identified by the url of their file
+type DirectoryWatcher struct {
+	imageService *ImageService
+	config       config.WatchConfig
+	directories  []watchedDirectory
+	// Size and modification time of the files seen by the last scan, keyed by path
+	snapshot map[string]fileState
+	// Paths of the directories whose images of deleted files were deleted, see deleteMissing
+	scanned map[string]bool
+}
+
+type watchedDirectory struct {
+	// Absolute and cleaned
+	path    string
+	baseUrl string
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+func NewDirectoryWatcher(imageService *ImageService, watchConfig config.WatchConfig) (*DirectoryWatcher, error) {
+	directories := make([]watchedDirectory, len(watchConfig.Directories))
+	for i, directory := range watchConfig.Directories {
+		path, err := filepath.Abs(directory.Path)
+		if err != nil {
+			return nil, err
+		}
+		directories[i] = watchedDirectory{path: path, baseUrl: strings.TrimSuffix(directory.BaseUrl, "/")}
+	}
+	return &DirectoryWatcher{
+		imageService: imageService,
+		config:       watchConfig,
+		directories:  directories,
+		snapshot:     make(map[string]fileState),
+		scanned:      make(map[string]bool),
+	}, nil
+}
+
+// Returns the url of a directory, which the urls of its files start with
+func (directory watchedDirectory) url() string {
+	if directory.baseUrl != "" {
+		return directory.baseUrl
+	}
+	return utils.FileUrl(directory.path)
+}
+
+// Returns the url of the file or directory at path, "" if it's not in a watched directory
+func (w *DirectoryWatcher) fileUrl(path string) string {
+	for _, directory := range w.directories {
+		relative, err := filepath.Rel(directory.path, path)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if relative == "." {
+			return directory.url()
+		}
+		if directory.baseUrl == "" {
+			return utils.FileUrl(path)
+		}
+		return utils.JoinUrlPath(directory.baseUrl, filepath.ToSlash(relative))
+	}
+	return ""
+}
+
+// Hidden files are skipped, they are often temporary files of programs writing to the directory
+func isHidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
+
+func isWatchedImageFile(path string) bool {
+	return !isHidden(path) && imageFileExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// Scans the directories and keeps watching them until ctx is done. Meant to be run as a background job
+func (w *DirectoryWatcher) Run(ctx context.Context) {
+	if !w.config.Poll {
+		err := w.watchEvents(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.WarnContext(ctx, "Failed to watch for file events, polling instead", "error", err, "pollInterval", w.config.PollInterval)
+	}
+	for {
+		w.scan(ctx, nil)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.config.PollInterval):
+		}
+	}
+}
+
+// Syncs every file that changed since the last scan and deletes the images of the files that are gone.
+// The first complete scan of a directory also deletes the images of files that were deleted before it.
+// Nothing is deleted in a directory that couldn't be read completely, its unreadable files would look deleted.
+// Files that are still being written are added to pending if it's not nil, otherwise the next scan looks at them
+func (w *DirectoryWatcher) scan(ctx context.Context, pending map[string]time.Time) {
+	current := make(map[string]fileState, len(w.snapshot))
+	for _, directory := range w.directories {
+		files := make(map[string]fileState)
+		failed := false
+		err := filepath.WalkDir(directory.path, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to read a watched directory", "path", path, "error", err)
+				failed = true
+				return nil
+			}
+			if entry.IsDir() {
+				if path != directory.path && isHidden(path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !isWatchedImageFile(path) {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				failed = true
+				return nil
+			}
+			files[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+			return nil
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to scan a watched directory", "path", directory.path, "error", err)
+			failed = true
+		}
+
+		if failed {
+			// Kept as they were until a scan reads them again
+			for path, state := range w.snapshot {
+				if _, ok := files[path]; !ok && isInDirectory(path, directory.path) {
+					files[path] = state
+				}
+			}
+		} else if !w.scanned[directory.path] {
+			w.deleteMissing(ctx, directory, files)
+			w.scanned[directory.path] = true
+		}
+		for path, state := range files {
+			current[path] = state
+		}
+	}
+
+	for path, state := range current {
+		if ctx.Err() != nil {
+			return
+		}
+		previous, seen := w.snapshot[path]
+		if seen && previous == state {
+			continue
+		}
+		if time.Since(state.modTime) < w.config.SettleDelay {
+			if pending != nil {
+				pending[path] = state.modTime
+			}
+			// Looked at again by the next scan
+			delete(current, path)
+			if seen {
+				current[path] = previous
+			}
+			continue
+		}
+		w.sync(ctx, path)
+	}
+	for path := range w.snapshot {
+		if _, ok := current[path]; !ok {
+			w.remove(ctx, path)
+		}
+	}
+	w.snapshot = current
+}
+
+// Whether path is directory or in it
+func isInDirectory(path string, directory string) bool {
+	return path == directory || strings.HasPrefix(path, directory+string(filepath.Separator))
+}
+
+// Deletes the images of the directory whose files aren't in files, e.g. because they were deleted
+// while the watcher wasn't running
+func (w *DirectoryWatcher) deleteMissing(ctx context.Context, directory watchedDirectory, files map[string]fileState) {
+	urls := make(map[string]bool, len(files))
+	for path := range files {
+		urls[w.fileUrl(path)] = true
+	}
+	images, err := w.imageService.ImageRepo.GetImagesBySourceUrlPrefix(ctx, directory.url()+"/")
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get the images of a watched directory", "path", directory.path, "error", err)
+		return
+	}
+	for _, image := range images {
+		if !urls[image.SourceUrl] {
+			w.deleteImage(ctx, image, "deleted")
+		}
+	}
+}
+
+// Listens for file events until ctx is done or listening fails
+func (w *DirectoryWatcher) watchEvents(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	for _, directory := range w.directories {
+		if err := w.addRecursive(ctx, watcher, directory.path, nil); err != nil {
+			return err
+		}
+	}
+	// Time of the last event of the files to sync, keyed by path
+	pending := make(map[string]time.Time)
+	// Scanned once the events are listened for, so no file is missed
+	w.scan(ctx, pending)
+
+	tick := w.config.SettleDelay / 2
+	if tick <= 0 {
+		tick = w.config.SettleDelay
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("The file event channel was closed")
+			}
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				delete(pending, event.Name)
+				w.remove(ctx, event.Name)
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					// Files moved in along with the directory don't have their own events
+					if err := w.addRecursive(ctx, watcher, event.Name, pending); err != nil {
+						slog.WarnContext(ctx, "Failed to watch a new directory", "path", event.Name, "error", err)
+					}
+					continue
+				}
+			}
+			if (event.Has(fsnotify.Create) || event.Has(fsnotify.Write)) && isWatchedImageFile(event.Name) {
+				pending[event.Name] = time.Now()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("The file event channel was closed")
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				slog.WarnContext(ctx, "Missed file events, rescanning the watched directories")
+				w.scan(ctx, pending)
+				continue
+			}
+			return err
+		case now := <-ticker.C:
+			for path, lastEvent := range pending {
+				if now.Sub(lastEvent) >= w.config.SettleDelay {
+					delete(pending, path)
+					w.sync(ctx, path)
+				}
+			}
+		}
+	}
+}
+
+// Watches the directory at path and its subdirectories. The image files in them are added to pending if it's not nil
+func (w *DirectoryWatcher) addRecursive(ctx context.Context, watcher *fsnotify.Watcher, root string, pending map[string]time.Time) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && isHidden(path) {
+				return filepath.SkipDir
+			}
+			return watcher.Add(path)
+		}
+		if pending != nil && isWatchedImageFile(path) {
+			pending[path] = time.Now()
+		}
+		return nil
+	})
+}
+
+// Adds the file at path, replacing the image of its previous content. Failures are logged
+func (w *DirectoryWatcher) sync(ctx context.Context, path string) {
+	if err := w.syncFile(ctx, path); err != nil && err != ImageExistsError {
+		slog.WarnContext(ctx, "Failed to add a file of a watched directory", "path", path, "error", err)
+	}
+}
+
+func (w *DirectoryWatcher) syncFile(ctx context.Context, path string) error {
+	fileUrl := w.fileUrl(path)
+	if fileUrl == "" {
+		return nil
+	}
+	data, err := utils.ReadLocalFile(path, w.imageService.config.MaxFileSize)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Deleted in the meantime, which has its own event
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	images, err := w.imageService.ImageRepo.GetImagesBySourceUrl(ctx, fileUrl)
+	if err != nil {
+		return err
+	}
+	previous := make([]models.Image, 0, 1)
+	for _, image := range images {
+		if image.Sha256 == sha256Hex(data) {
+			return nil
+		}
+		previous = append(previous, image)
+	}
+
+	// The previous image is only deleted once the new content was added
+	if err := w.imageService.AddImageData(ctx, data, fileUrl, fileUrl); err != nil {
+		return err
+	}
+	for _, image := range previous {
+		w.deleteImage(ctx, image, "modified")
+	}
+	return nil
+}
+
+// Deletes the images of the file or directory at path. Failures are logged
+func (w *DirectoryWatcher) remove(ctx context.Context, path string) {
+	fileUrl := w.fileUrl(path)
+	if fileUrl == "" {
+		return
+	}
+	images, err := w.imageService.ImageRepo.GetImagesBySourceUrlPrefix(ctx, fileUrl)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to get the images of a deleted file", "path", path, "error", err)
+		return
+	}
+	for _, image := range images {
+		if image.SourceUrl == fileUrl || strings.HasPrefix(image.SourceUrl, fileUrl+"/") {
+			w.deleteImage(ctx, image, "deleted")
+		}
+	}
+}
+
+// Deletes the image of a file that was deleted or modified, as told by reason
+func (w *DirectoryWatcher) deleteImage(ctx context.Context, image models.Image, reason string) {
+	if err := w.imageService.DeleteImageById(ctx, image.ImageID); err != nil {
+		slog.WarnContext(ctx, "Failed to delete the image of a watched file", "id", image.ImageID, "url", image.SourceUrl, "reason", reason, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "Deleted the image of a watched file", "id", image.ImageID, "url", image.SourceUrl, "reason", reason)
+}
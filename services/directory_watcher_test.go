@@ -0,0 +1,211 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/fakeclip"
+	"clipsearch/models"
+	"clipsearch/repositories"
+	"clipsearch/utils"
+	"context"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Reports every created and deleted image, so tests can wait for the watcher
+type notifyingImageRepository struct {
+	*repositories.MockImageRepository
+	changes chan string
+}
+
+func (repo *notifyingImageRepository) Create(ctx context.Context, image *models.Image) (int, error) {
+	id, err := repo.MockImageRepository.Create(ctx, image)
+	repo.changes <- "create"
+	return id, err
+}
+
+func (repo *notifyingImageRepository) DeleteById(ctx context.Context, id int) error {
+	err := repo.MockImageRepository.DeleteById(ctx, id)
+	repo.changes <- "delete"
+	return err
+}
+
+func TestDirectoryWatcher(t *testing.T) {
+	ctx := context.Background()
+	red := fakeclip.SolidColorPng(color.RGBA{R: 255, A: 255})
+	green := fakeclip.SolidColorPng(color.RGBA{G: 255, A: 255})
+	blue := fakeclip.SolidColorPng(color.RGBA{B: 255, A: 255})
+
+	// Writes a file that was last modified long enough ago to be added
+	writeFile := func(t *testing.T, path string, data []byte) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf(err.Error())
+		}
+		modTime := time.Now().Add(-time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+
+	newWatcher := func(t *testing.T, repo repositories.ImageRepository, directories ...config.WatchDirectoryConfig) *DirectoryWatcher {
+		watchConfig := config.Default().Watch
+		watchConfig.Directories = directories
+		watchConfig.SettleDelay = 10 * time.Millisecond
+		watcher, err := NewDirectoryWatcher(NewImageService(repo, NewMockClipService(), config.Default().Images), watchConfig)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		return watcher
+	}
+
+	// Returns the sha256 hashes of the stored images keyed by source url
+	storedImages := func(t *testing.T, repo repositories.ImageRepository) map[string]string {
+		images, err := repo.GetImagesBySourceUrlPrefix(ctx, "")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		hashes := make(map[string]string, len(images))
+		for _, image := range images {
+			hashes[image.SourceUrl] = image.Sha256
+		}
+		return hashes
+	}
+
+	t.Run("polling", func(t *testing.T) {
+		dir := t.TempDir()
+		redPath := filepath.Join(dir, "red.png")
+		bluePath := filepath.Join(dir, "sub", "blue.png")
+		writeFile(t, redPath, red)
+		writeFile(t, filepath.Join(dir, ".red.png.part"), red)
+		writeFile(t, filepath.Join(dir, "notes.txt"), []byte("not an image"))
+		mockRepo := repositories.NewMockImageRepository()
+		watcher := newWatcher(t, mockRepo, config.WatchDirectoryConfig{Path: dir})
+
+		watcher.scan(ctx, nil)
+		stored := storedImages(t, mockRepo)
+		if len(stored) != 1 || stored[utils.FileUrl(redPath)] != sha256Hex(red) {
+			t.Fatalf("Stored images = %v, want red.png", stored)
+		}
+
+		// Modified files replace their image
+		writeFile(t, redPath, green)
+		writeFile(t, bluePath, blue)
+		watcher.scan(ctx, nil)
+		stored = storedImages(t, mockRepo)
+		if len(stored) != 2 || stored[utils.FileUrl(redPath)] != sha256Hex(green) || stored[utils.FileUrl(bluePath)] != sha256Hex(blue) {
+			t.Fatalf("Stored images = %v, want the new content of red.png and sub/blue.png", stored)
+		}
+
+		if err := os.RemoveAll(filepath.Join(dir, "sub")); err != nil {
+			t.Fatalf(err.Error())
+		}
+		watcher.scan(ctx, nil)
+		stored = storedImages(t, mockRepo)
+		if len(stored) != 1 || stored[utils.FileUrl(redPath)] == "" {
+			t.Fatalf("Stored images = %v, want only red.png", stored)
+		}
+	})
+
+	t.Run("files deleted while not watching", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "red.png"), red)
+		writeFile(t, filepath.Join(dir, "a b", "green.png"), green)
+		mockRepo := repositories.NewMockImageRepository()
+		directory := config.WatchDirectoryConfig{Path: dir, BaseUrl: "http://photos.example.com/shared/"}
+		newWatcher(t, mockRepo, directory).scan(ctx, nil)
+		stored := storedImages(t, mockRepo)
+		if len(stored) != 2 || stored["http://photos.example.com/shared/a%20b/green.png"] != sha256Hex(green) {
+			t.Fatalf("Stored images = %v, want red.png and a b/green.png under the base url", stored)
+		}
+
+		if err := os.Remove(filepath.Join(dir, "red.png")); err != nil {
+			t.Fatalf(err.Error())
+		}
+		newWatcher(t, mockRepo, directory).scan(ctx, nil)
+		stored = storedImages(t, mockRepo)
+		if len(stored) != 1 || stored["http://photos.example.com/shared/red.png"] != "" {
+			t.Fatalf("Stored images = %v, want only a b/green.png", stored)
+		}
+	})
+
+	t.Run("unreadable directories", func(t *testing.T) {
+		parent := t.TempDir()
+		dir := filepath.Join(parent, "photos")
+		moved := filepath.Join(parent, "unmounted")
+		writeFile(t, filepath.Join(dir, "red.png"), red)
+		writeFile(t, filepath.Join(dir, "green.png"), green)
+		mockRepo := repositories.NewMockImageRepository()
+		directory := config.WatchDirectoryConfig{Path: dir}
+		watcher := newWatcher(t, mockRepo, directory)
+		watcher.scan(ctx, nil)
+
+		// Like an unmounted drive, while watching and when the watcher starts
+		if err := os.Rename(dir, moved); err != nil {
+			t.Fatalf(err.Error())
+		}
+		watcher.scan(ctx, nil)
+		restarted := newWatcher(t, mockRepo, directory)
+		restarted.scan(ctx, nil)
+		if stored := storedImages(t, mockRepo); len(stored) != 2 {
+			t.Fatalf("Stored images = %v, want both images kept while the directory can't be read", stored)
+		}
+
+		if err := os.Rename(moved, dir); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := os.Remove(filepath.Join(dir, "red.png")); err != nil {
+			t.Fatalf(err.Error())
+		}
+		restarted.scan(ctx, nil)
+		stored := storedImages(t, mockRepo)
+		if len(stored) != 1 || stored[utils.FileUrl(filepath.Join(dir, "green.png"))] == "" {
+			t.Fatalf("Stored images = %v, want only green.png once the directory is read again", stored)
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		dir := t.TempDir()
+		repo := &notifyingImageRepository{MockImageRepository: repositories.NewMockImageRepository(), changes: make(chan string, 16)}
+		watcher := newWatcher(t, repo, config.WatchDirectoryConfig{Path: dir})
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			watcher.Run(runCtx)
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		waitFor := func(t *testing.T, change string) {
+			select {
+			case got := <-repo.changes:
+				if got != change {
+					t.Fatalf("Change = %s, want = %s", got, change)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out waiting for the watcher to %s an image", change)
+			}
+		}
+
+		path := filepath.Join(dir, "red.png")
+		if err := os.WriteFile(path, red, 0o644); err != nil {
+			t.Fatalf(err.Error())
+		}
+		waitFor(t, "create")
+		if stored := storedImages(t, repo); stored[utils.FileUrl(path)] != sha256Hex(red) {
+			t.Fatalf("Stored images = %v, want red.png", stored)
+		}
+
+		if err := os.Remove(path); err != nil {
+			t.Fatalf(err.Error())
+		}
+		waitFor(t, "delete")
+	})
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/embeddingpb"
+	"clipsearch/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var DaemonNotServingError = errors.New("Embedding daemon is not serving")
+
+// A ClipService backed by a daemon speaking the gRPC protocol in embeddingpb/embedding.proto
+type GrpcClipService struct {
+	conn    *grpc.ClientConn
+	client  embeddingpb.EmbeddingServiceClient
+	timeout time.Duration
+}
+
+// Doesn't wait for the daemon, calls fail until it can be reached
+func NewGrpcClipService(grpcConfig config.GrpcEmbeddingConfig) (*GrpcClipService, error) {
+	conn, err := grpc.Dial(grpcConfig.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &GrpcClipService{
+		conn:    conn,
+		client:  embeddingpb.NewEmbeddingServiceClient(conn),
+		timeout: grpcConfig.Timeout,
+	}, nil
+}
+
+// Bounds a call by the timeout. The returned error is ctx.Err() if the caller's context ended
+func (gcs *GrpcClipService) call(ctx context.Context, call func(ctx context.Context) error) error {
+	callCtx, cancel := context.WithTimeout(ctx, gcs.timeout)
+	defer cancel()
+	err := call(callCtx)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (gcs *GrpcClipService) EncodeImage(ctx context.Context, imageData []byte) ([]float32, error) {
+	start := time.Now()
+	var embedding *embeddingpb.Embedding
+	err := gcs.call(ctx, func(ctx context.Context) (err error) {
+		embedding, err = gcs.client.EmbedImage(ctx, &embeddingpb.EmbedImageRequest{Image: imageData})
+		return err
+	})
+	observeClipCall(ctx, "image", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return embedding.Values, nil
+}
+
+func (gcs *GrpcClipService) EncodeText(ctx context.Context, text string) ([]float32, error) {
+	start := time.Now()
+	var embedding *embeddingpb.Embedding
+	err := gcs.call(ctx, func(ctx context.Context) (err error) {
+		embedding, err = gcs.client.EmbedText(ctx, &embeddingpb.EmbedTextRequest{Text: text})
+		return err
+	})
+	observeClipCall(ctx, "text", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return embedding.Values, nil
+}
+
+func batchValues(batch *embeddingpb.EmbeddingBatch, inputCount int) ([][]float32, error) {
+	if len(batch.Embeddings) != inputCount {
+		return nil, fmt.Errorf("Got %d embeddings for %d inputs", len(batch.Embeddings), inputCount)
+	}
+	embeddings := make([][]float32, len(batch.Embeddings))
+	for i, embedding := range batch.Embeddings {
+		embeddings[i] = embedding.Values
+	}
+	return embeddings, nil
+}
+
+// Encodes several images in one call. The embeddings are in the order of the images
+func (gcs *GrpcClipService) EncodeImages(ctx context.Context, images [][]byte) ([][]float32, error) {
+	start := time.Now()
+	var batch *embeddingpb.EmbeddingBatch
+	err := gcs.call(ctx, func(ctx context.Context) (err error) {
+		batch, err = gcs.client.EmbedImageBatch(ctx, &embeddingpb.EmbedImageBatchRequest{Images: images})
+		return err
+	})
+	observeClipCall(ctx, "image", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return batchValues(batch, len(images))
+}
+
+// Encodes several texts in one call. The embeddings are in the order of the texts
+func (gcs *GrpcClipService) EncodeTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	start := time.Now()
+	var batch *embeddingpb.EmbeddingBatch
+	err := gcs.call(ctx, func(ctx context.Context) (err error) {
+		batch, err = gcs.client.EmbedTextBatch(ctx, &embeddingpb.EmbedTextBatchRequest{Texts: texts})
+		return err
+	})
+	observeClipCall(ctx, "text", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return batchValues(batch, len(texts))
+}
+
+func (gcs *GrpcClipService) ModelInfo(ctx context.Context) (models.EmbeddingModel, error) {
+	var info *embeddingpb.ModelInfo
+	err := gcs.call(ctx, func(ctx context.Context) (err error) {
+		info, err = gcs.client.GetModelInfo(ctx, &embeddingpb.GetModelInfoRequest{})
+		return err
+	})
+	if err != nil {
+		return models.EmbeddingModel{}, err
+	}
+	return models.EmbeddingModel{Name: info.Name, Dimension: int(info.Dimension)}, nil
+}
+
+// Returns nil if the daemon reports that it's serving
+func (gcs *GrpcClipService) Ping(ctx context.Context) error {
+	var health *embeddingpb.HealthResponse
+	err := gcs.call(ctx, func(ctx context.Context) (err error) {
+		health, err = gcs.client.Health(ctx, &embeddingpb.HealthRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !health.Serving {
+		return DaemonNotServingError
+	}
+	return nil
+}
+
+func (gcs *GrpcClipService) Close() {
+	gcs.conn.Close()
+}
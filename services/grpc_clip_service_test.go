@@ -0,0 +1,97 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/fakeclip"
+	"context"
+	"image/color"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGrpcClipService(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	server := fakeclip.NewGrpcServer()
+	go server.Serve(lis)
+	defer server.Stop()
+
+	clip, err := NewGrpcClipService(config.GrpcEmbeddingConfig{Address: lis.Addr().String(), Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer clip.Close()
+	ctx := context.Background()
+
+	t.Run("single", func(t *testing.T) {
+		embedding, err := clip.EncodeText(ctx, "a red car")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(embedding) != fakeclip.Dimension {
+			t.Fatalf("Dimension = %d, want = %d", len(embedding), fakeclip.Dimension)
+		}
+		if embedding[0] != fakeclip.EmbedText("a red car")[0] {
+			t.Fatalf("Embedding differs from the one of the daemon")
+		}
+
+		imageEmbedding, err := clip.EncodeImage(ctx, tinyPng)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		want, _ := fakeclip.EmbedImage(tinyPng)
+		if imageEmbedding[0] != want[0] {
+			t.Fatalf("Image embedding differs from the one of the daemon")
+		}
+
+		if _, err := clip.EncodeText(ctx, ""); err == nil {
+			t.Fatalf("Expected an empty text to be rejected")
+		}
+		if _, err := clip.EncodeImage(ctx, []byte("not an image")); err == nil {
+			t.Fatalf("Expected data that is not an image to be rejected")
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		texts := []string{"a red car", "a cat"}
+		embeddings, err := clip.EncodeTexts(ctx, texts)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(embeddings) != 2 || embeddings[1][0] != fakeclip.EmbedText("a cat")[0] {
+			t.Fatalf("Batch embeddings are not in the order of the texts")
+		}
+
+		images, err := clip.EncodeImages(ctx, [][]byte{tinyPng, fakeclip.SolidColorPng(color.White)})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 2 {
+			t.Fatalf("Got %d image embeddings, want = 2", len(images))
+		}
+	})
+
+	t.Run("model info and health", func(t *testing.T) {
+		model, err := clip.ModelInfo(ctx)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if model.Name != fakeclip.ModelName || model.Dimension != fakeclip.Dimension {
+			t.Fatalf("Model info = %v, want = %s %d", model, fakeclip.ModelName, fakeclip.Dimension)
+		}
+		if err := clip.Ping(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := clip.EncodeText(cancelledCtx, "a red car"); err != context.Canceled {
+			t.Fatalf("EncodeText error = %v, want = %v", err, context.Canceled)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A named dependency check. Check returns nil if the dependency is usable, and must return once ctx is done
+type DependencyCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type HealthService struct {
+	checks  []DependencyCheck
+	timeout time.Duration
+}
+
+// Each check may take at most timeout
+func NewHealthService(timeout time.Duration, checks ...DependencyCheck) *HealthService {
+	return &HealthService{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+var CheckTimedOutError = fmt.Errorf("Check timed out")
+
+// Waits for the check to return, so that no check outlives the probe that started it
+func (s *HealthService) runCheck(ctx context.Context, check DependencyCheck) error {
+	checkCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	err := check.Check(checkCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(checkCtx.Err(), context.DeadlineExceeded) {
+		return CheckTimedOutError
+	}
+	return err
+}
+
+// Runs all checks concurrently. Returns whether all of them passed and the error of each failed check by name
+func (s *HealthService) CheckReadiness(ctx context.Context) (bool, map[string]error) {
+	results := make(map[string]error, len(s.checks))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, check := range s.checks {
+		wg.Add(1)
+		go func(check DependencyCheck) {
+			defer wg.Done()
+			err := s.runCheck(ctx, check)
+			mutex.Lock()
+			results[check.Name] = err
+			mutex.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	ready := true
+	for _, err := range results {
+		if err != nil {
+			ready = false
+		}
+	}
+	return ready, results
+}
+
+// Implemented by the ClipServices whose backend can tell whether it's serving
+type PingableClipService interface {
+	Ping(ctx context.Context) error
+}
+
+// Checks that the embedding backend computes both text and image embeddings, with a round-trip of a tiny
+// request each, so that a backend whose text or image daemon is down or can't embed isn't reported ready.
+// ClipServices that can be pinged are pinged first, for a clearer error
+func ClipServiceChecks(clip ClipService) []DependencyCheck {
+	return CurrentClipServiceChecks(func() ClipService { return clip })
+}
+
+// Same as ClipServiceChecks, for the ClipService current returns at the time of the check
+func CurrentClipServiceChecks(current func() ClipService) []DependencyCheck {
+	return []DependencyCheck{
+		{
+			Name: "textEmbedding",
+			Check: func(ctx context.Context) error {
+				return checkEmbeddingRoundTrip(ctx, current(), func(clip ClipService) ([]float32, error) {
+					return clip.EncodeText(ctx, "ping")
+				})
+			},
+		},
+		{
+			Name: "imageEmbedding",
+			Check: func(ctx context.Context) error {
+				return checkEmbeddingRoundTrip(ctx, current(), func(clip ClipService) ([]float32, error) {
+					return clip.EncodeImage(ctx, tinyPng)
+				})
+			},
+		},
+	}
+}
+
+func checkEmbeddingRoundTrip(ctx context.Context, clip ClipService, encode func(clip ClipService) ([]float32, error)) error {
+	if pingable, ok := clip.(PingableClipService); ok {
+		if err := pingable.Ping(ctx); err != nil {
+			return err
+		}
+	}
+	embedding, err := encode(clip)
+	if err != nil {
+		return err
+	}
+	if len(embedding) == 0 {
+		return fmt.Errorf("The embedding backend returned an empty embedding")
+	}
+	return nil
+}
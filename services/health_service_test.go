@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Counts the embeddings it computes, failing the image ones if failImages is set
+type countingClipService struct {
+	MockClipService
+	texts      atomic.Int32
+	images     atomic.Int32
+	failImages bool
+}
+
+func (ccs *countingClipService) EncodeImage(ctx context.Context, imageData []byte) ([]float32, error) {
+	ccs.images.Add(1)
+	if ccs.failImages {
+		return nil, DaemonUnreachableError
+	}
+	return ccs.MockClipService.EncodeImage(ctx, imageData)
+}
+
+func (ccs *countingClipService) EncodeText(ctx context.Context, text string) ([]float32, error) {
+	ccs.texts.Add(1)
+	return ccs.MockClipService.EncodeText(ctx, text)
+}
+
+type pingableClipService struct {
+	countingClipService
+	pings atomic.Int32
+}
+
+func (pcs *pingableClipService) Ping(ctx context.Context) error {
+	pcs.pings.Add(1)
+	return nil
+}
+
+func TestHealthService(t *testing.T) {
+	t.Run("timed out checks are waited for", func(t *testing.T) {
+		var finished atomic.Bool
+		slow := DependencyCheck{Name: "slow", Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			finished.Store(true)
+			return ctx.Err()
+		}}
+		healthService := NewHealthService(10*time.Millisecond, slow)
+
+		ready, results := healthService.CheckReadiness(context.Background())
+		if ready || results["slow"] != CheckTimedOutError {
+			t.Fatalf("Expected the slow check to time out, got %v", results)
+		}
+		if !finished.Load() {
+			t.Fatalf("Expected CheckReadiness to return after the check")
+		}
+	})
+
+	t.Run("clip checks embed a text and an image", func(t *testing.T) {
+		clip := &countingClipService{}
+		ready, results := NewHealthService(time.Second, ClipServiceChecks(clip)...).CheckReadiness(context.Background())
+		if !ready || len(results) != 2 {
+			t.Fatalf("Expected the text and the image embedding to be ready, got %v", results)
+		}
+		if clip.texts.Load() != 1 || clip.images.Load() != 1 {
+			t.Fatalf("Embedded %d texts and %d images, want one of each", clip.texts.Load(), clip.images.Load())
+		}
+
+		pingable := &pingableClipService{}
+		ready, results = NewHealthService(time.Second, ClipServiceChecks(pingable)...).CheckReadiness(context.Background())
+		if !ready || pingable.pings.Load() != 2 || pingable.texts.Load() != 1 || pingable.images.Load() != 1 {
+			t.Fatalf("Expected each check to ping the clip service and embed, got %v", results)
+		}
+	})
+
+	t.Run("a failing daemon fails its check only", func(t *testing.T) {
+		clip := &countingClipService{failImages: true}
+		ready, results := NewHealthService(time.Second, ClipServiceChecks(clip)...).CheckReadiness(context.Background())
+		if ready || results["imageEmbedding"] == nil || results["textEmbedding"] != nil {
+			t.Fatalf("Expected only the image embedding check to fail, got %v", results)
+		}
+	})
+}
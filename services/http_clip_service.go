@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bytes"
+	"clipsearch/config"
+	"clipsearch/models"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Embedding responses are a few KB, anything bigger is not an embedding
+const maxEmbeddingResponseSize = 1024 * 1024
+
+// A ClipService backed by a model server speaking HTTP
+// See config.HTTP_EMBEDDING_PROTOCOL_OPENAI and config.HTTP_EMBEDDING_PROTOCOL_JSEND for the supported protocols
+type HttpClipService struct {
+	client *http.Client
+	config config.HttpEmbeddingConfig
+}
+
+func NewHttpClipService(httpConfig config.HttpEmbeddingConfig) *HttpClipService {
+	return &HttpClipService{
+		client: &http.Client{Timeout: httpConfig.Timeout},
+		config: httpConfig,
+	}
+}
+
+func (hcs *HttpClipService) EncodeImage(ctx context.Context, imageData []byte) ([]float32, error) {
+	start := time.Now()
+	var embedding []float32
+	var err error
+	if hcs.config.Protocol == config.HTTP_EMBEDDING_PROTOCOL_OPENAI {
+		// A multimodal input object, so that a server that only embeds texts fails instead of embedding the base64 text
+		embedding, err = hcs.encodeOpenAI(ctx, struct {
+			Image string `json:"image"`
+		}{Image: base64.StdEncoding.EncodeToString(imageData)})
+	} else {
+		embedding, err = hcs.encodeJsend(ctx, "/image", "application/octet-stream", imageData)
+	}
+	observeClipCall(ctx, "image", start, err)
+	return embedding, err
+}
+
+func (hcs *HttpClipService) EncodeText(ctx context.Context, text string) ([]float32, error) {
+	start := time.Now()
+	var embedding []float32
+	var err error
+	if hcs.config.Protocol == config.HTTP_EMBEDDING_PROTOCOL_OPENAI {
+		embedding, err = hcs.encodeOpenAI(ctx, text)
+	} else {
+		body, _ := json.Marshal(struct {
+			Text string `json:"text"`
+		}{Text: text})
+		embedding, err = hcs.encodeJsend(ctx, "/text", "application/json", body)
+	}
+	observeClipCall(ctx, "text", start, err)
+	return embedding, err
+}
+
+// With the openai protocol, the model is the configured one (or the url if none is configured)
+// and its dimension is the one of an embedding. jsend servers answer GET <url>/model
+func (hcs *HttpClipService) ModelInfo(ctx context.Context) (models.EmbeddingModel, error) {
+	if hcs.config.Protocol == config.HTTP_EMBEDDING_PROTOCOL_OPENAI {
+		embedding, err := hcs.encodeOpenAI(ctx, "ping")
+		if err != nil {
+			return models.EmbeddingModel{}, err
+		}
+		name := hcs.config.Model
+		if name == "" {
+			name = hcs.config.Url
+		}
+		return models.EmbeddingModel{Name: name, Dimension: len(embedding)}, nil
+	}
+
+	var model models.EmbeddingModel
+	if err := hcs.requestJsend(ctx, http.MethodGet, "/model", "", nil, &model); err != nil {
+		return models.EmbeddingModel{}, err
+	}
+	if model.Name == "" || model.Dimension <= 0 {
+		return models.EmbeddingModel{}, fmt.Errorf("The embedding server doesn't report its model")
+	}
+	return model, nil
+}
+
+// Closes the idle keep-alive connections to the model server
+func (hcs *HttpClipService) Close() {
+	hcs.client.CloseIdleConnections()
+}
+
+// Sends body to url and returns the response body if the status is 2xx
+func (hcs *HttpClipService) send(ctx context.Context, method string, url string, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if hcs.config.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+hcs.config.ApiKey)
+	}
+
+	resp, err := hcs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxEmbeddingResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return respBody, fmt.Errorf("Embedding server responded with status code %d", resp.StatusCode)
+	}
+	return respBody, nil
+}
+
+func (hcs *HttpClipService) encodeJsend(ctx context.Context, path string, contentType string, body []byte) ([]float32, error) {
+	var embedding []float32
+	if err := hcs.requestJsend(ctx, http.MethodPost, path, contentType, body, &embedding); err != nil {
+		return nil, err
+	}
+	return embedding, nil
+}
+
+// Decodes the data of the JSend response into data
+func (hcs *HttpClipService) requestJsend(ctx context.Context, method string, path string, contentType string, body []byte, data any) error {
+	respBody, sendErr := hcs.send(ctx, method, strings.TrimSuffix(hcs.config.Url, "/")+path, contentType, body)
+	if sendErr != nil && respBody == nil {
+		return sendErr
+	}
+
+	response := struct {
+		Status  string
+		Message string
+		Data    json.RawMessage
+	}{}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		if sendErr != nil {
+			return sendErr
+		}
+		return err
+	}
+
+	if response.Status == "error" {
+		return fmt.Errorf("Failed to compute embedding: %s", response.Message)
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	if response.Status != "success" {
+		return fmt.Errorf("Unexpected response format")
+	}
+	return json.Unmarshal(response.Data, data)
+}
+
+// Texts are sent as strings and images as {"image": <base64>} objects, the multimodal input of e.g. the Jina embeddings API
+func (hcs *HttpClipService) encodeOpenAI(ctx context.Context, input any) ([]float32, error) {
+	body, err := json.Marshal(struct {
+		Model string `json:"model,omitempty"`
+		Input []any  `json:"input"`
+	}{Model: hcs.config.Model, Input: []any{input}})
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, postErr := hcs.send(ctx, http.MethodPost, hcs.config.Url, "application/json", body)
+	if postErr != nil && respBody == nil {
+		return nil, postErr
+	}
+
+	response := struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}{}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		if postErr != nil {
+			return nil, postErr
+		}
+		return nil, err
+	}
+
+	if response.Error != nil {
+		return nil, fmt.Errorf("Failed to compute embedding: %s", response.Error.Message)
+	}
+	if postErr != nil {
+		return nil, postErr
+	}
+	if len(response.Data) != 1 {
+		return nil, fmt.Errorf("Unexpected response format")
+	}
+	return response.Data[0].Embedding, nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"clipsearch/config"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newHttpEmbeddingConfig(url string, protocol string) config.HttpEmbeddingConfig {
+	httpConfig := config.Default().HttpEmbedding
+	httpConfig.Url = url
+	httpConfig.Protocol = protocol
+	return httpConfig
+}
+
+func TestHttpClipService(t *testing.T) {
+	t.Run("jsend", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			switch req.URL.Path {
+			case "/text":
+				var request struct{ Text string }
+				if err := json.Unmarshal(body, &request); err != nil || request.Text != "a cat" {
+					rw.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(rw, `{"status": "fail", "data": {"text": "Required field"}}`)
+					return
+				}
+				fmt.Fprint(rw, `{"status": "success", "data": [0.6, 0.8]}`)
+			case "/image":
+				if string(body) != "not an image" {
+					t.Errorf("Posted image = %q, want = %q", body, "not an image")
+				}
+				rw.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(rw, `{"status": "error", "message": "cannot identify image file"}`)
+			case "/model":
+				if req.Method != http.MethodGet {
+					t.Errorf("Model info method = %s, want = GET", req.Method)
+				}
+				fmt.Fprint(rw, `{"status": "success", "data": {"name": "tiny", "dimension": 2}}`)
+			default:
+				rw.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		clip := NewHttpClipService(newHttpEmbeddingConfig(server.URL+"/", config.HTTP_EMBEDDING_PROTOCOL_JSEND))
+		embedding, err := clip.EncodeText(context.Background(), "a cat")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if fmt.Sprint(embedding) != "[0.6 0.8]" {
+			t.Fatalf("Embedding = %v, want = [0.6 0.8]", embedding)
+		}
+
+		_, err = clip.EncodeImage(context.Background(), []byte("not an image"))
+		if err == nil || !strings.Contains(err.Error(), "cannot identify image file") {
+			t.Fatalf("EncodeImage error = %v, want the message of the server", err)
+		}
+
+		model, err := clip.ModelInfo(context.Background())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if model.Name != "tiny" || model.Dimension != 2 {
+			t.Fatalf("Model info = %v, want = tiny 2", model)
+		}
+	})
+
+	t.Run("openai", func(t *testing.T) {
+		var inputs []string
+		var images []string
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/v1/embeddings" || req.Header.Get("Authorization") != "Bearer secret" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(rw, `{"error": {"message": "Invalid api key"}}`)
+				return
+			}
+			var request struct {
+				Model string
+				Input []json.RawMessage
+			}
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil || request.Model != "clip" || len(request.Input) != 1 {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var text string
+			var image struct{ Image string }
+			if json.Unmarshal(request.Input[0], &text) == nil {
+				inputs = append(inputs, text)
+			} else if json.Unmarshal(request.Input[0], &image) == nil && image.Image != "" {
+				images = append(images, image.Image)
+			} else {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(rw, `{"object": "list", "data": [{"object": "embedding", "index": 0, "embedding": [1, 0]}], "model": "clip"}`)
+		}))
+		defer server.Close()
+
+		httpConfig := newHttpEmbeddingConfig(server.URL+"/v1/embeddings", config.HTTP_EMBEDDING_PROTOCOL_OPENAI)
+		httpConfig.Model = "clip"
+		httpConfig.ApiKey = "secret"
+		clip := NewHttpClipService(httpConfig)
+
+		if _, err := clip.EncodeText(context.Background(), "a cat"); err != nil {
+			t.Fatalf(err.Error())
+		}
+		embedding, err := clip.EncodeImage(context.Background(), tinyPng)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if fmt.Sprint(embedding) != "[1 0]" {
+			t.Fatalf("Embedding = %v, want = [1 0]", embedding)
+		}
+		if len(inputs) != 1 || inputs[0] != "a cat" {
+			t.Fatalf("Text inputs = %v, want the text", inputs)
+		}
+		if len(images) != 1 || images[0] != base64.StdEncoding.EncodeToString(tinyPng) {
+			t.Fatalf("Image inputs = %v, want the base64 of the image", images)
+		}
+
+		httpConfig.ApiKey = "wrong"
+		_, err = NewHttpClipService(httpConfig).EncodeText(context.Background(), "a cat")
+		if err == nil || !strings.Contains(err.Error(), "Invalid api key") {
+			t.Fatalf("EncodeText error = %v, want the message of the server", err)
+		}
+	})
+
+	t.Run("non json error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.Error(rw, "Bad gateway", http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		clip := NewHttpClipService(newHttpEmbeddingConfig(server.URL, config.HTTP_EMBEDDING_PROTOCOL_JSEND))
+		_, err := clip.EncodeText(context.Background(), "a cat")
+		if err == nil || !strings.Contains(err.Error(), "502") {
+			t.Fatalf("EncodeText error = %v, want the status code", err)
+		}
+	})
+}
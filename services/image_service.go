@@ -3,59 +3,302 @@ package services
 import (
 	"bytes"
 	"clipsearch/config"
+	"clipsearch/metrics"
 	"clipsearch/models"
 	"clipsearch/repositories"
 	"clipsearch/utils"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"sort"
+	"sync"
 )
 
 type ImageService struct {
 	ImageRepo repositories.ImageRepository
+	config    config.ImagesConfig
+
+	clipMutex sync.RWMutex
 	clip      ClipService
+	// The model of clip, nil until it was asked for
+	clipModel *models.EmbeddingModel
+	// The models embedding images next to the default one, keyed by model name
+	extraClips map[string]*extraClipService
+	// Keeps the originals of the added images keyed by their sha256 hash, nil if they aren't kept
+	blobStore repositories.BlobStore
+	// The absolute paths of the directories the stored file:// urls may point into
+	localDirectories []string
+}
+
+// A ClipService of a model configured next to the default one
+type extraClipService struct {
+	clip ClipService
+	// Set once the ClipService reported the expected model and the model was registered
+	model *models.EmbeddingModel
 }
 
-func NewImageService(imageRepo repositories.ImageRepository, clipService ClipService) *ImageService {
+func NewImageService(imageRepo repositories.ImageRepository, clipService ClipService, imagesConfig config.ImagesConfig) *ImageService {
 	return &ImageService{
 		ImageRepo: imageRepo,
 		clip:      clipService,
+		config:    imagesConfig,
+	}
+}
+
+// Returns the ClipService computing the embeddings, which changes at the cut-over to a new model
+func (s *ImageService) ClipService() ClipService {
+	s.clipMutex.RLock()
+	defer s.clipMutex.RUnlock()
+	return s.clip
+}
+
+// Returns the ClipService and the model it runs, asking it for the model the first time
+func (s *ImageService) embeddingModel(ctx context.Context) (ClipService, models.EmbeddingModel, error) {
+	s.clipMutex.RLock()
+	clip, model := s.clip, s.clipModel
+	s.clipMutex.RUnlock()
+	if model != nil {
+		return clip, *model, nil
+	}
+
+	info, err := clip.ModelInfo(ctx)
+	if err != nil {
+		return nil, models.EmbeddingModel{}, err
+	}
+	s.clipMutex.Lock()
+	defer s.clipMutex.Unlock()
+	if s.clip == clip {
+		s.clipModel = &info
+	}
+	return clip, info, nil
+}
+
+// Makes clip, which runs model, compute the embeddings of all following calls.
+// Used at the cut-over to a new model
+func (s *ImageService) SwitchClipService(clip ClipService, model models.EmbeddingModel) {
+	s.clipMutex.Lock()
+	defer s.clipMutex.Unlock()
+	s.clip = clip
+	s.clipModel = &model
+}
+
+// Makes the service keep the original of every added image in store. Must be called before the service is used
+func (s *ImageService) SetBlobStore(store repositories.BlobStore) {
+	s.blobStore = store
+}
+
+// Lets the stored file:// urls of the files in the directories be read, like the ones of the watched directories.
+// Must be called before the service is used
+func (s *ImageService) SetLocalDirectories(directories []string) {
+	s.localDirectories = directories
+}
+
+// Returns the path of a stored file:// url, false if it's not one. Fails with utils.LocalFileNotAllowedError if the file
+// is outside of the local directories, so that a url pointing anywhere else doesn't tell whether a file exists
+func (s *ImageService) localFilePath(url string) (string, bool, error) {
+	path, ok := utils.LocalFilePath(url)
+	if !ok {
+		return "", false, nil
+	}
+	if !utils.IsInDirectories(path, s.localDirectories) {
+		return "", true, utils.LocalFileNotAllowedError
+	}
+	return path, true, nil
+}
+
+// Makes clip embed every added image with the named model next to the default one, and lets searches pick that model.
+// Must be called before the service is used
+func (s *ImageService) AddClipService(name string, clip ClipService) {
+	if s.extraClips == nil {
+		s.extraClips = make(map[string]*extraClipService)
+	}
+	s.extraClips[name] = &extraClipService{clip: clip}
+}
+
+// Names of the models added with AddClipService
+func (s *ImageService) ExtraModelNames() []string {
+	names := make([]string, 0, len(s.extraClips))
+	for name := range s.extraClips {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the ClipService added with AddClipService under name, nil if there is none
+func (s *ImageService) ExtraClipService(name string) ClipService {
+	extra, ok := s.extraClips[name]
+	if !ok {
+		return nil
+	}
+	return extra.clip
+}
+
+// Returns the model of the named extra ClipService, checking that it runs the model of that name and
+// registering the model the first time
+func (s *ImageService) extraEmbeddingModel(ctx context.Context, name string) (ClipService, models.EmbeddingModel, error) {
+	extra := s.extraClips[name]
+	s.clipMutex.RLock()
+	model := extra.model
+	s.clipMutex.RUnlock()
+	if model != nil {
+		return extra.clip, *model, nil
+	}
+
+	info, err := extra.clip.ModelInfo(ctx)
+	if err != nil {
+		return nil, models.EmbeddingModel{}, err
+	}
+	if info.Name != name {
+		return nil, models.EmbeddingModel{}, fmt.Errorf("%w: the embedding backend of %s runs %s",
+			repositories.EmbeddingModelMismatchError, name, info.Name)
+	}
+	if err := s.ImageRepo.RegisterEmbeddingModel(ctx, info); err != nil {
+		return nil, models.EmbeddingModel{}, err
+	}
+	s.clipMutex.Lock()
+	defer s.clipMutex.Unlock()
+	extra.model = &info
+	return extra.clip, info, nil
+}
+
+var UnknownEmbeddingModelError = errors.New("No embedding backend is configured for this model")
+
+// Returns the ClipService running the named model, "" being the model of the default ClipService.
+// Fails with UnknownEmbeddingModelError if no ClipService runs the model
+func (s *ImageService) modelClipService(ctx context.Context, model string) (ClipService, error) {
+	if model == "" {
+		return s.ClipService(), nil
+	}
+	if _, ok := s.extraClips[model]; ok {
+		clip, _, err := s.extraEmbeddingModel(ctx, model)
+		return clip, err
+	}
+	clip, defaultModel, err := s.embeddingModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if defaultModel.Name != model {
+		return nil, UnknownEmbeddingModelError
 	}
+	return clip, nil
 }
 
-func (s *ImageService) GetCountAndImages(offset int, limit int) (int, []models.Image, error) {
-	count, err := s.ImageRepo.Count()
+// Fails with repositories.EmbeddingModelMismatchError if the ClipService doesn't run the model of the stored embeddings
+func (s *ImageService) CheckEmbeddingModel(ctx context.Context) error {
+	_, model, err := s.embeddingModel(ctx)
 	if err != nil {
-		return 0, nil, err
+		return err
+	}
+	active, err := s.ImageRepo.GetActiveEmbeddingModel(ctx)
+	if err != nil {
+		return err
 	}
+	if active != nil && *active != model {
+		return fmt.Errorf("%w: the embedding backend runs %s (%d dimensions), the stored embeddings are from %s (%d dimensions)",
+			repositories.EmbeddingModelMismatchError, model.Name, model.Dimension, active.Name, active.Dimension)
+	}
+	return nil
+}
+
+func (s *ImageService) GetCountAndImages(ctx context.Context, offset int, limit int) (int, []models.Image, error) {
+	count, images, _, err := s.GetCountAndImagesPage(ctx, offset, limit, "")
+	return count, images, err
+}
 
-	images, err := s.ImageRepo.GetImages(offset, limit)
+// Same as GetCountAndImages, but also returns the cursor of the next page ("" if there is none).
+// If cursor is set, the page starts right after the image it points to and offset is ignored
+func (s *ImageService) GetCountAndImagesPage(ctx context.Context, offset int, limit int, cursor string) (int, []models.Image, string, error) {
+	count, err := s.ImageRepo.Count(ctx)
 	if err != nil {
-		return 0, nil, err
+		return 0, nil, "", err
+	}
+
+	var images []models.Image
+	if cursor != "" {
+		decoded, err := DecodeCursor(cursor, "")
+		if err != nil {
+			return 0, nil, "", err
+		}
+		images, err = s.ImageRepo.GetImagesAfterId(ctx, decoded.Id, limit)
+		if err != nil {
+			return 0, nil, "", err
+		}
+	} else {
+		images, err = s.ImageRepo.GetImages(ctx, offset, limit)
+		if err != nil {
+			return 0, nil, "", err
+		}
 	}
 
-	return count, images, nil
+	return count, images, nextListingCursor(images, limit), nil
+}
+
+// The hex encoded sha256 hash of data, as stored in models.Image.Sha256
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
 }
 
 var ImageExistsError = fmt.Errorf("This image already exists (hash match)")
 
-func (s *ImageService) AddImageByURL(url string, thumbnailUrl string) error {
+func (s *ImageService) AddImageByURL(ctx context.Context, url string, thumbnailUrl string) error {
+	return s.AddPageImageByURL(ctx, url, thumbnailUrl, "")
+}
+
+// Same as AddImageByURL, but also records the web page the image was found on
+func (s *ImageService) AddPageImageByURL(ctx context.Context, url string, thumbnailUrl string, pageUrl string) error {
+	err := s.addImageByURL(ctx, url, thumbnailUrl, pageUrl)
+	countIngestion(ctx, url, err)
+	return err
+}
+
+// Adds an image from a file that was already read, like the ones of the watched directories.
+// url and thumbnailUrl are stored as they are
+func (s *ImageService) AddImageData(ctx context.Context, data []byte, url string, thumbnailUrl string) error {
+	err := s.addImage(ctx, data, url, thumbnailUrl, "")
+	countIngestion(ctx, url, err)
+	return err
+}
+
+// Records the outcome of adding the image at url in the metrics
+func countIngestion(ctx context.Context, url string, err error) {
+	switch err {
+	case nil:
+		metrics.CountIngestion(metrics.IngestionCreated)
+	case ImageExistsError:
+		metrics.CountIngestion(metrics.IngestionDuplicate)
+		slog.InfoContext(ctx, "Image already exists", "url", url)
+	case utils.FileSizeExceededError:
+		metrics.CountIngestion(metrics.IngestionTooLarge)
+		slog.InfoContext(ctx, "Image is too large", "url", url)
+	default:
+		metrics.CountIngestion(metrics.IngestionError)
+	}
+}
+
+func (s *ImageService) addImageByURL(ctx context.Context, url string, thumbnailUrl string, pageUrl string) error {
 	var buf bytes.Buffer
 
-	err := utils.DownloadFile(&buf, url, config.MAX_IMAGE_FILE_SIZE)
+	err := utils.DownloadFile(ctx, &buf, url, s.config.MaxFileSize, s.config.DownloadUserAgent)
 	if err != nil {
 		return err
 	}
 
-	hashSHA256 := sha256.New()
-	if _, err := io.Copy(hashSHA256, bytes.NewReader(buf.Bytes())); err != nil {
-		return err
+	return s.addImage(ctx, buf.Bytes(), url, thumbnailUrl, pageUrl)
+}
+
+func (s *ImageService) addImage(ctx context.Context, data []byte, url string, thumbnailUrl string, pageUrl string) error {
+	if len(data) > s.config.MaxFileSize {
+		return utils.FileSizeExceededError
 	}
-	hashBytes := hashSHA256.Sum(nil)
-	hashString := hex.EncodeToString(hashBytes)
+	hashString := sha256Hex(data)
 
-	count, err := s.ImageRepo.CountWithSha256(hashString)
+	count, err := s.ImageRepo.CountWithSha256(ctx, hashString)
 	if err != nil {
 		return err
 	}
@@ -63,32 +306,542 @@ func (s *ImageService) AddImageByURL(url string, thumbnailUrl string) error {
 		return ImageExistsError
 	}
 
-	embedding, err := s.clip.EncodeImage(buf.Bytes())
-	if err != nil {
-		return err
-	}
-
 	image := models.Image{
 		SourceUrl:    url,
 		ThumbnailUrl: thumbnailUrl,
-		Sha256:       hashString,
-		Embedding:    embedding,
+		PageUrl:      pageUrl,
+	}
+	if err := s.embedImage(ctx, data, &image); err != nil {
+		return err
+	}
+
+	id, err := s.ImageRepo.Create(ctx, &image)
+	if err != nil {
+		return err
 	}
+	slog.InfoContext(ctx, "Added image", "id", id, "url", url, "sha256", hashString)
+
+	return nil
+}
 
-	_, err = s.ImageRepo.Create(&image)
+// Fills in the hash, the metadata and the embeddings of the image file data, and keeps data as the original of the image
+func (s *ImageService) embedImage(ctx context.Context, data []byte, image *models.Image) error {
+	image.Sha256 = sha256Hex(data)
+	image.Metadata = utils.ReadImageMetadata(data)
+	still, frames := s.embeddingInput(ctx, data, image.Metadata)
+
+	clip, model, err := s.embeddingModel(ctx)
+	if err != nil {
+		return err
+	}
+	embedding, frameEmbeddings, err := s.encodeImage(ctx, clip, still, frames)
 	if err != nil {
 		return err
 	}
+	image.Embedding = embedding
+	image.EmbeddingModel = model.Name
+	if frameEmbeddings != nil {
+		image.FrameEmbeddings = map[string][][]float32{model.Name: frameEmbeddings}
+	}
+
+	image.ExtraEmbeddings = make(map[string][]float32, len(s.extraClips))
+	for name := range s.extraClips {
+		extraClip, _, err := s.extraEmbeddingModel(ctx, name)
+		if err != nil {
+			return err
+		}
+		embedding, frameEmbeddings, err := s.encodeImage(ctx, extraClip, still, frames)
+		if err != nil {
+			return err
+		}
+		image.ExtraEmbeddings[name] = embedding
+		if frameEmbeddings != nil {
+			if image.FrameEmbeddings == nil {
+				image.FrameEmbeddings = make(map[string][][]float32, len(s.extraClips)+1)
+			}
+			image.FrameEmbeddings[name] = frameEmbeddings
+		}
+	}
+
+	// Stored before the image is created, so every image has its original. An original left behind by a failed
+	// creation is reused when the image is added again
+	if s.blobStore != nil {
+		if err := s.blobStore.Put(ctx, image.Sha256, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns what the image file data is embedded from: the frames sampled from an animation (see config), or else
+// the image turned upright according to the orientation in metadata, which may be nil. Animations that fail to
+// decode are embedded like still images, and images that fail to be turned as they are
+func (s *ImageService) embeddingInput(ctx context.Context, data []byte, metadata *models.ImageMetadata) ([]byte, [][]byte) {
+	if s.config.AnimationFrames > 0 {
+		frames, err := utils.SampleAnimationFrames(data, s.config.AnimationFrames)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to decode the frames of an animation, embedding it as a still image", "error", err)
+		} else if frames != nil {
+			return nil, frames
+		}
+	}
+	if metadata == nil {
+		return data, nil
+	}
+	upright, err := utils.ApplyOrientation(data, metadata.Orientation)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to turn the image upright, embedding it as it is stored", "orientation", metadata.Orientation, "error", err)
+		return data, nil
+	}
+	return upright, nil
+}
+
+// Embeds the still image data with clip, or the frames if there are any (see embeddingInput). The embedding of an
+// animation is the normalized average of its frame embeddings, which are returned too if they are kept (see config)
+func (s *ImageService) encodeImage(ctx context.Context, clip ClipService, data []byte, frames [][]byte) ([]float32, [][]float32, error) {
+	if frames == nil {
+		embedding, err := clip.EncodeImage(ctx, data)
+		return embedding, nil, err
+	}
+	frameEmbeddings, err := encodeImages(ctx, clip, frames)
+	if err != nil {
+		return nil, nil, err
+	}
+	weights := make([]float32, len(frames))
+	for i := range weights {
+		weights[i] = 1 / float32(len(frames))
+	}
+	embedding, err := utils.WeightedSum(frameEmbeddings, weights)
+	if err != nil {
+		return nil, nil, err
+	}
+	utils.Normalize(embedding)
+	if s.config.AnimationEmbedding != config.ANIMATION_EMBEDDING_FRAMES {
+		return embedding, nil, nil
+	}
+	return embedding, frameEmbeddings, nil
+}
+
+var OriginalNotStoredError = errors.New("The original of this image is not stored")
+
+// Returns a reader of the original of the image and its size. Fails with repositories.ImageNotFoundError
+// if there is no such image and with OriginalNotStoredError if its original wasn't kept
+func (s *ImageService) GetOriginal(ctx context.Context, id int) (io.ReadCloser, int64, error) {
+	image, err := s.ImageRepo.GetById(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if s.blobStore == nil {
+		return nil, 0, OriginalNotStoredError
+	}
+	reader, size, err := s.blobStore.Get(ctx, image.Sha256)
+	if err == repositories.BlobNotFoundError {
+		return nil, 0, OriginalNotStoredError
+	}
+	return reader, size, err
+}
+
+// Whether the original of the image is kept in the blob store
+func (s *ImageService) hasOriginal(ctx context.Context, image models.Image) (bool, error) {
+	if s.blobStore == nil {
+		return false, nil
+	}
+	reader, _, err := s.blobStore.Get(ctx, image.Sha256)
+	if err == repositories.BlobNotFoundError {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	reader.Close()
+	return true, nil
+}
+
+// Returns the image file, from the blob store if its original is kept there, downloaded from its source url otherwise.
+// Fails with SourceChangedError if the downloaded file is not the one that was added
+func (s *ImageService) loadImageData(ctx context.Context, image models.Image) ([]byte, error) {
+	if s.blobStore != nil {
+		reader, _, err := s.blobStore.Get(ctx, image.Sha256)
+		if err == nil {
+			defer reader.Close()
+			return io.ReadAll(reader)
+		}
+		if err != repositories.BlobNotFoundError {
+			slog.WarnContext(ctx, "Failed to get the original of an image, downloading it", "id", image.ImageID, "error", err)
+		}
+	}
 
+	// The source url of a frame is the one of its video
+	if image.VideoID != nil {
+		return nil, OriginalNotStoredError
+	}
+	data, err := s.readSource(ctx, image.SourceUrl)
+	if err != nil {
+		return nil, err
+	}
+	if sha256Hex(data) != image.Sha256 {
+		return nil, SourceChangedError
+	}
+	return data, nil
+}
+
+// Downloads the file at the stored source url of an image, reading it from the disk if it's a file:// url
+// of a local directory, see SetLocalDirectories
+func (s *ImageService) readSource(ctx context.Context, url string) ([]byte, error) {
+	// Imported from an archive that isn't kept
+	if utils.IsArchiveUrl(url) {
+		return nil, OriginalNotStoredError
+	}
+	if path, ok, err := s.localFilePath(url); ok {
+		if err != nil {
+			return nil, err
+		}
+		return utils.ReadLocalFile(path, s.config.MaxFileSize)
+	}
+	var buf bytes.Buffer
+	err := utils.DownloadFile(ctx, &buf, url, s.config.MaxFileSize, s.config.DownloadUserAgent)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Deletes the image along with its original
+func (s *ImageService) DeleteImageById(ctx context.Context, id int) error {
+	image, err := s.ImageRepo.GetById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.ImageRepo.DeleteById(ctx, id); err != nil {
+		return err
+	}
+	s.deleteOriginal(ctx, *image)
 	return nil
 }
 
-func (s *ImageService) GetImagesSimilarToText(textPrompt string, offset int, limit int) ([]models.Image, error) {
-	textEmbedding, err := s.clip.EncodeText(textPrompt)
+// Deletes the original of a deleted image if it's kept
+func (s *ImageService) deleteOriginal(ctx context.Context, image models.Image) {
+	if s.blobStore == nil {
+		return
+	}
+	// Kept while other images share it, like identical frames of videos
+	if count, err := s.ImageRepo.CountWithSha256(ctx, image.Sha256); err == nil && count > 0 {
+		return
+	}
+	// The image is gone either way, a leftover original only takes up space
+	err := s.blobStore.Delete(ctx, image.Sha256)
+	if err != nil && err != repositories.BlobNotFoundError {
+		slog.WarnContext(ctx, "Failed to delete the original of an image", "id", image.ImageID, "sha256", image.Sha256, "error", err)
+	}
+}
+
+// Selects a page of search results.
+// If Cursor is set, the page starts right after the image it points to and Offset is ignored
+type SearchPage struct {
+	Offset int
+	Limit  int
+	Cursor string
+	// Between 0 and 1, see GetImagesSimilarToEmbedding
+	Diversity float32
+}
+
+var CursorWithDiversityError = errors.New("Cursors can't be used with diversified results")
+var DiversityTooDeepError = errors.New("Diversified results can't be paged past the re-ranked candidates")
+
+// Returns a page of images ordered by relevance to embedding, and the cursor of the next page ("" if there is none).
+// A diversity above 0 over-fetches candidates and re-ranks them with maximal marginal relevance,
+// trading relevance for variety; 1 ignores relevance after the first result entirely.
+// Diversified pages have no cursor, and can't reach past config.MMR_MAX_CANDIDATES results.
+// embedding is compared with the embeddings from the named model, "" being the model of the default ClipService.
+// The cursors are only valid for the same model and embedding
+func (s *ImageService) GetImagesSimilarToEmbedding(ctx context.Context, model string, embedding []float32, page SearchPage) ([]models.Image, string, error) {
+	return s.getImagesSimilarToEmbedding(ctx, model, embedding, searchKey(model, embedding), page)
+}
+
+// Same as GetImagesSimilarToEmbedding, with the cursors bound to the search with the given key
+func (s *ImageService) getImagesSimilarToEmbedding(ctx context.Context, model string, embedding []float32, query string, page SearchPage) ([]models.Image, string, error) {
+	if page.Diversity > 0 {
+		if page.Cursor != "" {
+			return nil, "", CursorWithDiversityError
+		}
+		images, err := s.getDiverseImagesSimilarToEmbedding(ctx, model, embedding, page.Offset, page.Limit, page.Diversity)
+		return images, "", err
+	}
+
+	var images []models.Image
+	if page.Cursor != "" {
+		cursor, err := DecodeCursor(page.Cursor, query)
+		if err != nil {
+			return nil, "", err
+		}
+		if cursor.Distance == nil {
+			return nil, "", InvalidCursorError
+		}
+		images, err = s.ImageRepo.GetSimilarImagesAfter(ctx, model, embedding, *cursor.Distance, cursor.Id, page.Limit)
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		var err error
+		images, err = s.ImageRepo.GetSimilarImages(ctx, model, embedding, page.Offset, page.Limit)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return images, nextSearchCursor(images, page.Limit, query), nil
+}
+
+// Pages reaching past config.MMR_MAX_CANDIDATES results fail, as they couldn't be ordered like the previous ones
+func (s *ImageService) getDiverseImagesSimilarToEmbedding(ctx context.Context, model string, embedding []float32, offset int, limit int, diversity float32) ([]models.Image, error) {
+	if offset+limit > config.MMR_MAX_CANDIDATES {
+		return nil, DiversityTooDeepError
+	}
+	candidateCount := (offset + limit) * config.MMR_CANDIDATE_MULTIPLIER
+	if candidateCount > config.MMR_MAX_CANDIDATES {
+		candidateCount = config.MMR_MAX_CANDIDATES
+	}
+
+	candidates, err := s.ImageRepo.GetSimilarImagesWithEmbeddings(ctx, model, embedding, 0, candidateCount)
+	if err != nil {
+		return nil, err
+	}
+
+	candidateEmbeddings := make([][]float32, len(candidates))
+	for i, candidate := range candidates {
+		candidateEmbeddings[i] = candidate.Embedding
+	}
+	order, err := utils.MaximalMarginalRelevance(embedding, candidateEmbeddings, 1-diversity, offset+limit)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]models.Image, 0, limit)
+	for i := offset; i < len(order); i++ {
+		image := candidates[order[i]]
+		image.Embedding = nil
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+func (s *ImageService) GetImagesSimilarToText(ctx context.Context, textPrompt string, offset int, limit int) ([]models.Image, error) {
+	textEmbedding, err := s.ClipService().EncodeText(ctx, textPrompt)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return s.ImageRepo.GetSimilarImages(textEmbedding, offset, limit)
+	return s.ImageRepo.GetSimilarImages(ctx, "", textEmbedding, offset, limit)
+}
+
+type WeightedPrompt struct {
+	Text   string
+	Weight float32
+}
+
+type WeightedImageId struct {
+	Id     int
+	Weight float32
+}
+
+type WeightedImageData struct {
+	Data   []byte
+	Weight float32
+}
+
+// A query made up of any mix of text prompts, images from the repository and new images.
+// Terms with a negative weight are subtracted from the query
+type CompositeQuery struct {
+	Prompts  []WeightedPrompt
+	ImageIds []WeightedImageId
+	Images   []WeightedImageData
+}
+
+var NoPromptsError = errors.New("At least one positive prompt is required")
+var EmptyQueryError = errors.New("The query has no terms")
+
+// Encodes every prompt and combines the embeddings into a single unit vector:
+// positive prompts are added and negative prompts are subtracted, each scaled by its weight
+func (s *ImageService) EncodePrompts(ctx context.Context, model string, positive []WeightedPrompt, negative []WeightedPrompt) ([]float32, error) {
+	if len(positive) == 0 {
+		return nil, NoPromptsError
+	}
+
+	query := CompositeQuery{Prompts: make([]WeightedPrompt, 0, len(positive)+len(negative))}
+	query.Prompts = append(query.Prompts, positive...)
+	for _, prompt := range negative {
+		query.Prompts = append(query.Prompts, WeightedPrompt{Text: prompt.Text, Weight: -prompt.Weight})
+	}
+
+	return s.EncodeCompositeQuery(ctx, model, query)
+}
+
+func (s *ImageService) GetImagesSimilarToPrompts(ctx context.Context, model string, positive []WeightedPrompt, negative []WeightedPrompt, page SearchPage) ([]models.Image, string, error) {
+	embedding, err := s.EncodePrompts(ctx, model, positive, negative)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := searchKey(model, struct{ Positive, Negative []WeightedPrompt }{positive, negative})
+	return s.getImagesSimilarToEmbedding(ctx, model, embedding, query, page)
+}
+
+// Combines the embeddings of all terms of the query, computed with the named model, into a single unit vector.
+// Fails with repositories.ImageNotFoundError if one of the image ids doesn't exist or has no embedding from the model
+func (s *ImageService) EncodeCompositeQuery(ctx context.Context, model string, query CompositeQuery) ([]float32, error) {
+	termCount := len(query.Prompts) + len(query.ImageIds) + len(query.Images)
+	if termCount == 0 {
+		return nil, EmptyQueryError
+	}
+
+	clip, err := s.modelClipService(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	embeddings := make([][]float32, 0, termCount)
+	weights := make([]float32, 0, termCount)
+
+	texts := make([]string, len(query.Prompts))
+	for i, prompt := range query.Prompts {
+		texts[i] = prompt.Text
+	}
+	textEmbeddings, err := encodeTexts(ctx, clip, texts)
+	if err != nil {
+		return nil, err
+	}
+	for i, prompt := range query.Prompts {
+		embeddings = append(embeddings, textEmbeddings[i])
+		weights = append(weights, prompt.Weight)
+	}
+
+	if len(query.ImageIds) > 0 {
+		ids := make([]int, len(query.ImageIds))
+		for i, imageId := range query.ImageIds {
+			ids[i] = imageId.Id
+		}
+		stored, err := s.ImageRepo.GetEmbeddings(ctx, model, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, imageId := range query.ImageIds {
+			embedding, ok := stored[imageId.Id]
+			if !ok {
+				return nil, repositories.ImageNotFoundError
+			}
+			embeddings = append(embeddings, embedding)
+			weights = append(weights, imageId.Weight)
+		}
+	}
+
+	for _, image := range query.Images {
+		// Embedded like the stored images, so animations stand for their frames and photos are upright
+		still, frames := s.embeddingInput(ctx, image.Data, utils.ReadImageMetadata(image.Data))
+		embedding, _, err := s.encodeImage(ctx, clip, still, frames)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, embedding)
+		weights = append(weights, image.Weight)
+	}
+
+	composite, err := utils.WeightedSum(embeddings, weights)
+	if err != nil {
+		return nil, err
+	}
+	utils.Normalize(composite)
+
+	return composite, nil
+}
+
+func (s *ImageService) GetImagesSimilarToCompositeQuery(ctx context.Context, model string, query CompositeQuery, page SearchPage) ([]models.Image, string, error) {
+	embedding, err := s.EncodeCompositeQuery(ctx, model, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return s.getImagesSimilarToEmbedding(ctx, model, embedding, searchKey(model, query), page)
+}
+
+// Image ids that the user marked as relevant or irrelevant to a query
+type RelevanceFeedback struct {
+	Liked    []int
+	Disliked []int
+}
+
+// Rocchio weights of the original query, the liked images and the disliked images
+const RocchioQueryWeight float32 = 1
+const RocchioLikedWeight float32 = 0.75
+const RocchioDislikedWeight float32 = 0.15
+
+// Returns the mean of the stored embeddings from the named model of the images with the given ids
+func (s *ImageService) meanEmbedding(ctx context.Context, model string, ids []int) ([]float32, error) {
+	stored, err := s.ImageRepo.GetEmbeddings(ctx, model, ids)
+	if err != nil {
+		return nil, err
+	}
+	embeddings := make([][]float32, len(ids))
+	weights := make([]float32, len(ids))
+	for i, id := range ids {
+		embedding, ok := stored[id]
+		if !ok {
+			return nil, repositories.ImageNotFoundError
+		}
+		embeddings[i] = embedding
+		weights[i] = 1 / float32(len(ids))
+	}
+	return utils.WeightedSum(embeddings, weights)
+}
+
+// Moves the query towards the mean of the liked images and away from the mean of the disliked images (Rocchio algorithm).
+// query and the stored embeddings are from the named model.
+// Fails with repositories.ImageNotFoundError if one of the image ids doesn't exist
+func (s *ImageService) RefineQuery(ctx context.Context, model string, query []float32, feedback RelevanceFeedback) ([]float32, error) {
+	embeddings := [][]float32{query}
+	weights := []float32{RocchioQueryWeight}
+
+	if len(feedback.Liked) > 0 {
+		liked, err := s.meanEmbedding(ctx, model, feedback.Liked)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, liked)
+		weights = append(weights, RocchioLikedWeight)
+	}
+
+	if len(feedback.Disliked) > 0 {
+		disliked, err := s.meanEmbedding(ctx, model, feedback.Disliked)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, disliked)
+		weights = append(weights, -RocchioDislikedWeight)
+	}
+
+	refined, err := utils.WeightedSum(embeddings, weights)
+	if err != nil {
+		return nil, err
+	}
+	utils.Normalize(refined)
+
+	return refined, nil
+}
+
+func (s *ImageService) GetImagesSimilarToRefinedPrompts(ctx context.Context, model string, positive []WeightedPrompt, negative []WeightedPrompt, feedback RelevanceFeedback, page SearchPage) ([]models.Image, string, error) {
+	embedding, err := s.EncodePrompts(ctx, model, positive, negative)
+	if err != nil {
+		return nil, "", err
+	}
+
+	embedding, err = s.RefineQuery(ctx, model, embedding, feedback)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := searchKey(model, struct {
+		Positive, Negative []WeightedPrompt
+		Feedback           RelevanceFeedback
+	}{positive, negative, feedback})
+	return s.getImagesSimilarToEmbedding(ctx, model, embedding, query, page)
 }
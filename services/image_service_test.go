@@ -1,9 +1,23 @@
 package services
 
 import (
+	"bytes"
+	"clipsearch/config"
+	"clipsearch/fakeclip"
+	"clipsearch/models"
 	"clipsearch/repositories"
+	"clipsearch/utils"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 )
 
@@ -23,15 +37,15 @@ func TestImageService(t *testing.T) {
 
 		mockRepo := repositories.NewMockImageRepository()
 		mockClip := NewMockClipService()
-		imageService := NewImageService(mockRepo, mockClip)
+		imageService := NewImageService(mockRepo, mockClip, config.Default().Images)
 
 		defer server.Close()
 
-		err := imageService.AddImageByURL(server.URL, "")
+		err := imageService.AddImageByURL(context.Background(), server.URL, "")
 		if err != nil {
 			t.Fatalf(err.Error())
 		}
-		count, images, err := imageService.GetCountAndImages(0, 1)
+		count, images, err := imageService.GetCountAndImages(context.Background(), 0, 1)
 		if err != nil {
 			t.Fatalf(err.Error())
 		}
@@ -46,4 +60,563 @@ func TestImageService(t *testing.T) {
 			t.Fatalf("Returned image sha256 hash = %s, want = %s", image.Sha256, testImage.Sha256)
 		}
 	})
+
+	t.Run("originals", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeFile(rw, req, "../test/test_image.jpg")
+		}))
+		defer server.Close()
+
+		mockRepo := repositories.NewMockImageRepository()
+		imageService := NewImageService(mockRepo, NewMockClipService(), config.Default().Images)
+		if _, _, err := imageService.GetOriginal(context.Background(), 1); err != repositories.ImageNotFoundError {
+			t.Fatalf("Expected GetOriginal to fail with ImageNotFoundError")
+		}
+		blobStore, err := repositories.NewLocalBlobStore(t.TempDir())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		imageService.SetBlobStore(blobStore)
+
+		if err := imageService.AddImageByURL(context.Background(), server.URL, ""); err != nil {
+			t.Fatalf(err.Error())
+		}
+		// Only the stored original is used from now on
+		server.Close()
+
+		reader, size, err := imageService.GetOriginal(context.Background(), 1)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if sha256Hex(data) != "671797905015849a2e772d7e152ad3289e7d71703b49c8fb607d00265769c1fb" || size != int64(len(data)) {
+			t.Fatalf("The original doesn't match the added image")
+		}
+		image, err := mockRepo.GetById(context.Background(), 1)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err := imageService.loadImageData(context.Background(), *image); err != nil {
+			t.Fatalf("Failed to load the image without its source: %v", err)
+		}
+
+		if err := imageService.DeleteImageById(context.Background(), 1); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, _, err := blobStore.Get(context.Background(), image.Sha256); err != repositories.BlobNotFoundError {
+			t.Fatalf("Expected the original to be deleted along with the image")
+		}
+	})
+
+	t.Run("weighted prompts", func(t *testing.T) {
+		mockRepo := repositories.NewMockImageRepository()
+		clip := &promptClipService{embeddings: map[string][]float32{
+			"dog":   {1, 0, 0},
+			"grass": {0, 1, 0},
+			"snow":  {0, 0, 1},
+		}}
+		imageService := NewImageService(mockRepo, clip, config.Default().Images)
+
+		dogOnGrass, _ := mockRepo.Create(context.Background(), &models.Image{Embedding: []float32{0.7, 0.7, 0}})
+		dogOnSnow, _ := mockRepo.Create(context.Background(), &models.Image{Embedding: []float32{0.6, 0, 0.6}})
+
+		images, _, err := imageService.GetImagesSimilarToPrompts(
+			context.Background(),
+			"",
+			[]WeightedPrompt{{Text: "dog", Weight: 1}},
+			[]WeightedPrompt{{Text: "grass", Weight: 1}},
+			SearchPage{Limit: 2})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 2 || images[0].ImageID != dogOnSnow || images[1].ImageID != dogOnGrass {
+			t.Fatalf("Expected image %d to rank above image %d, got %v", dogOnSnow, dogOnGrass, images)
+		}
+
+		images, _, err = imageService.GetImagesSimilarToPrompts(
+			context.Background(),
+			"",
+			[]WeightedPrompt{{Text: "dog", Weight: 1}, {Text: "grass", Weight: 2}},
+			nil,
+			SearchPage{Limit: 1})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 1 || images[0].ImageID != dogOnGrass {
+			t.Fatalf("Expected image %d to rank first, got %v", dogOnGrass, images)
+		}
+
+		_, _, err = imageService.GetImagesSimilarToPrompts(context.Background(), "", nil, []WeightedPrompt{{Text: "grass", Weight: 1}}, SearchPage{Limit: 1})
+		if err != NoPromptsError {
+			t.Fatalf("Expected GetImagesSimilarToPrompts to fail with NoPromptsError")
+		}
+	})
+
+	t.Run("composite query", func(t *testing.T) {
+		mockRepo := repositories.NewMockImageRepository()
+		clip := &promptClipService{embeddings: map[string][]float32{
+			"at night": {0, 0, 1},
+		}}
+		imageService := NewImageService(mockRepo, clip, config.Default().Images)
+
+		carByDay, _ := mockRepo.Create(context.Background(), &models.Image{Embedding: []float32{1, 0, 0}})
+		carAtNight, _ := mockRepo.Create(context.Background(), &models.Image{Embedding: []float32{0.7, 0, 0.7}})
+		mockRepo.Create(context.Background(), &models.Image{Embedding: []float32{0, 1, 0}})
+
+		images, _, err := imageService.GetImagesSimilarToCompositeQuery(context.Background(), "", CompositeQuery{
+			Prompts:  []WeightedPrompt{{Text: "at night", Weight: 1}},
+			ImageIds: []WeightedImageId{{Id: carByDay, Weight: 1}},
+		}, SearchPage{Limit: 1})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 1 || images[0].ImageID != carAtNight {
+			t.Fatalf("Expected image %d to rank first, got %v", carAtNight, images)
+		}
+
+		_, _, err = imageService.GetImagesSimilarToCompositeQuery(context.Background(), "", CompositeQuery{
+			ImageIds: []WeightedImageId{{Id: 1000, Weight: 1}},
+		}, SearchPage{Limit: 1})
+		if err != repositories.ImageNotFoundError {
+			t.Fatalf("Expected GetImagesSimilarToCompositeQuery to fail with ImageNotFoundError")
+		}
+
+		_, _, err = imageService.GetImagesSimilarToCompositeQuery(context.Background(), "", CompositeQuery{}, SearchPage{Limit: 1})
+		if err != EmptyQueryError {
+			t.Fatalf("Expected GetImagesSimilarToCompositeQuery to fail with EmptyQueryError")
+		}
+	})
+
+	t.Run("relevance feedback", func(t *testing.T) {
+		mockRepo := repositories.NewMockImageRepository()
+		clip := &promptClipService{embeddings: map[string][]float32{
+			"car": {1, 0, 0},
+		}}
+		imageService := NewImageService(mockRepo, clip, config.Default().Images)
+
+		redCar, _ := mockRepo.Create(context.Background(), &models.Image{Embedding: []float32{0.8, 0.6, 0}})
+		blueCar, _ := mockRepo.Create(context.Background(), &models.Image{Embedding: []float32{0.9, 0, 0.44}})
+
+		positive := []WeightedPrompt{{Text: "car", Weight: 1}}
+		images, _, err := imageService.GetImagesSimilarToRefinedPrompts(context.Background(), "", positive, nil, RelevanceFeedback{}, SearchPage{Limit: 1})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 1 || images[0].ImageID != blueCar {
+			t.Fatalf("Expected image %d to rank first without feedback, got %v", blueCar, images)
+		}
+
+		feedback := RelevanceFeedback{Liked: []int{redCar}, Disliked: []int{blueCar}}
+		images, _, err = imageService.GetImagesSimilarToRefinedPrompts(context.Background(), "", positive, nil, feedback, SearchPage{Limit: 1})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 1 || images[0].ImageID != redCar {
+			t.Fatalf("Expected image %d to rank first after feedback, got %v", redCar, images)
+		}
+
+		_, _, err = imageService.GetImagesSimilarToRefinedPrompts(context.Background(), "", positive, nil, RelevanceFeedback{Liked: []int{1000}}, SearchPage{Limit: 1})
+		if err != repositories.ImageNotFoundError {
+			t.Fatalf("Expected GetImagesSimilarToRefinedPrompts to fail with ImageNotFoundError")
+		}
+	})
+
+	t.Run("diversity", func(t *testing.T) {
+		mockRepo := repositories.NewMockImageRepository()
+		clip := &promptClipService{embeddings: map[string][]float32{
+			"beach": {1, 0},
+		}}
+		imageService := NewImageService(mockRepo, clip, config.Default().Images)
+
+		frame1, _ := mockRepo.Create(context.Background(), &models.Image{Embedding: []float32{0.99, 0.14}})
+		mockRepo.Create(context.Background(), &models.Image{Embedding: []float32{0.98, 0.2}})
+		other, _ := mockRepo.Create(context.Background(), &models.Image{Embedding: []float32{0.6, -0.8}})
+
+		positive := []WeightedPrompt{{Text: "beach", Weight: 1}}
+		images, _, err := imageService.GetImagesSimilarToPrompts(context.Background(), "", positive, nil, SearchPage{Limit: 2, Diversity: 0.5})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 2 || images[0].ImageID != frame1 || images[1].ImageID != other {
+			t.Fatalf("Expected images %d and %d, got %v", frame1, other, images)
+		}
+
+		images, _, err = imageService.GetImagesSimilarToPrompts(context.Background(), "", positive, nil, SearchPage{Offset: 1, Limit: 1, Diversity: 0.5})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 1 || images[0].ImageID != other {
+			t.Fatalf("Expected image %d on the second page, got %v", other, images)
+		}
+
+		_, _, err = imageService.GetImagesSimilarToPrompts(context.Background(), "", positive, nil, SearchPage{Offset: config.MMR_MAX_CANDIDATES, Limit: 1, Diversity: 0.5})
+		if err != DiversityTooDeepError {
+			t.Fatalf("Expected GetImagesSimilarToPrompts to fail with DiversityTooDeepError")
+		}
+	})
+
+	t.Run("cursors", func(t *testing.T) {
+		mockRepo := repositories.NewMockImageRepository()
+		clip := &promptClipService{embeddings: map[string][]float32{
+			"cat": {1, 0},
+			"dog": {0, 1},
+		}}
+		imageService := NewImageService(mockRepo, clip, config.Default().Images)
+
+		for _, embedding := range [][]float32{{0.6, 0.8}, {1, 0}, {0.8, 0.6}, {0.6, 0.8}, {0, 1}} {
+			mockRepo.Create(context.Background(), &models.Image{Embedding: embedding})
+		}
+
+		positive := []WeightedPrompt{{Text: "cat", Weight: 1}}
+		all, _, err := imageService.GetImagesSimilarToPrompts(context.Background(), "", positive, nil, SearchPage{Limit: 5})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		paged := make([]models.Image, 0, 5)
+		page := SearchPage{Limit: 2}
+		for {
+			images, nextCursor, err := imageService.GetImagesSimilarToPrompts(context.Background(), "", positive, nil, page)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			paged = append(paged, images...)
+			if nextCursor == "" {
+				break
+			}
+			page.Cursor = nextCursor
+		}
+		if len(paged) != len(all) {
+			t.Fatalf("Paging with cursors returned %d images, want = %d", len(paged), len(all))
+		}
+		for i := range all {
+			if paged[i].ImageID != all[i].ImageID {
+				t.Fatalf("Image %d when paging with cursors = %d, want = %d", i, paged[i].ImageID, all[i].ImageID)
+			}
+		}
+
+		_, _, err = imageService.GetImagesSimilarToPrompts(context.Background(), "", positive, nil, SearchPage{Limit: 2, Cursor: "garbage"})
+		if err != InvalidCursorError {
+			t.Fatalf("Expected GetImagesSimilarToPrompts to fail with InvalidCursorError")
+		}
+
+		_, _, err = imageService.GetImagesSimilarToPrompts(context.Background(), "", positive, nil, SearchPage{Limit: 2, Cursor: page.Cursor, Diversity: 0.5})
+		if err != CursorWithDiversityError {
+			t.Fatalf("Expected GetImagesSimilarToPrompts to fail with CursorWithDiversityError")
+		}
+
+		// Cursors only page through the results of the query they were returned with
+		_, searchCursor, err := imageService.GetImagesSimilarToPrompts(context.Background(), "", positive, nil, SearchPage{Limit: 2})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, query := range []CompositeQuery{
+			{Prompts: []WeightedPrompt{{Text: "dog", Weight: 1}}},
+			{Prompts: []WeightedPrompt{{Text: "cat", Weight: 1}, {Text: "dog", Weight: -1}}},
+			{Prompts: []WeightedPrompt{{Text: "cat", Weight: 2}}},
+		} {
+			_, _, err = imageService.GetImagesSimilarToCompositeQuery(context.Background(), "", query, SearchPage{Limit: 2, Cursor: searchCursor})
+			if err != InvalidCursorError {
+				t.Fatalf("Expected a cursor of another query to fail with InvalidCursorError, got %v", err)
+			}
+		}
+		_, _, err = imageService.GetImagesSimilarToRefinedPrompts(context.Background(), "", positive, nil, RelevanceFeedback{Liked: []int{1}}, SearchPage{Limit: 2, Cursor: searchCursor})
+		if err != InvalidCursorError {
+			t.Fatalf("Expected a cursor of the unrefined query to fail with InvalidCursorError, got %v", err)
+		}
+		if _, _, _, err = imageService.GetCountAndImagesPage(context.Background(), 0, 3, searchCursor); err != InvalidCursorError {
+			t.Fatalf("Expected a search cursor to fail with InvalidCursorError when listing, got %v", err)
+		}
+
+		_, images, nextCursor, err := imageService.GetCountAndImagesPage(context.Background(), 0, 3, "")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, _, err = imageService.GetImagesSimilarToPrompts(context.Background(), "", positive, nil, SearchPage{Limit: 2, Cursor: nextCursor}); err != InvalidCursorError {
+			t.Fatalf("Expected a listing cursor to fail with InvalidCursorError when searching, got %v", err)
+		}
+		_, images, nextCursor, err = imageService.GetCountAndImagesPage(context.Background(), 0, 3, nextCursor)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 2 || images[0].ImageID != 4 || nextCursor != "" {
+			t.Fatalf("Expected the last page to hold images 4 and 5 without a next cursor, got %v %q", images, nextCursor)
+		}
+	})
+	t.Run("named models", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeFile(rw, req, "../test/test_image.jpg")
+		}))
+		defer server.Close()
+
+		mockRepo := repositories.NewMockImageRepository()
+		imageService := NewImageService(mockRepo, NewMockClipService(), config.Default().Images)
+		imageService.AddClipService(fakeclip.ModelName, &fakeClipService{})
+
+		if err := imageService.AddImageByURL(context.Background(), server.URL, ""); err != nil {
+			t.Fatalf(err.Error())
+		}
+		embeddings, err := mockRepo.GetEmbeddings(context.Background(), fakeclip.ModelName, []int{1})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(embeddings[1]) != fakeclip.Dimension {
+			t.Fatalf("Embedding from %s = %v, want one with %d dimensions", fakeclip.ModelName, embeddings[1], fakeclip.Dimension)
+		}
+
+		positive := []WeightedPrompt{{Text: "a photo", Weight: 1}}
+		for _, model := range []string{"", MockClipModel.Name, fakeclip.ModelName} {
+			images, _, err := imageService.GetImagesSimilarToPrompts(context.Background(), model, positive, nil, SearchPage{Limit: 1})
+			if err != nil {
+				t.Fatalf("Search with model %q failed: %v", model, err)
+			}
+			if len(images) != 1 {
+				t.Fatalf("Search with model %q returned %v, want the image", model, images)
+			}
+		}
+
+		_, _, err = imageService.GetImagesSimilarToPrompts(context.Background(), "unknown", positive, nil, SearchPage{Limit: 1})
+		if err != UnknownEmbeddingModelError {
+			t.Fatalf("Expected GetImagesSimilarToPrompts to fail with UnknownEmbeddingModelError")
+		}
+
+		imageService.AddClipService("misnamed", &fakeClipService{})
+		_, _, err = imageService.GetImagesSimilarToPrompts(context.Background(), "misnamed", positive, nil, SearchPage{Limit: 1})
+		if !errors.Is(err, repositories.EmbeddingModelMismatchError) {
+			t.Fatalf("Search error = %v, want = %v", err, repositories.EmbeddingModelMismatchError)
+		}
+	})
+
+	t.Run("animations", func(t *testing.T) {
+		ctx := context.Background()
+		colors := []color.Color{color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}, color.RGBA{B: 255, A: 255}}
+		animation := &gif.GIF{}
+		for _, c := range colors {
+			frame := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{c})
+			animation.Image = append(animation.Image, frame)
+			animation.Delay = append(animation.Delay, 10)
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, animation); err != nil {
+			t.Fatalf(err.Error())
+		}
+		green, err := fakeclip.EmbedImage(fakeclip.SolidColorPng(colors[1]))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		newImageService := func(animationEmbedding string) *ImageService {
+			imagesConfig := config.Default().Images
+			imagesConfig.AnimationFrames = 3
+			imagesConfig.AnimationEmbedding = animationEmbedding
+			imageService := NewImageService(repositories.NewMockImageRepository(), &fakeClipService{}, imagesConfig)
+			if err := imageService.AddImageData(ctx, buf.Bytes(), "http://localhost/animation.gif", ""); err != nil {
+				t.Fatalf(err.Error())
+			}
+			if err := imageService.AddImageData(ctx, fakeclip.SolidColorPng(color.Gray{Y: 128}), "http://localhost/gray.png", ""); err != nil {
+				t.Fatalf(err.Error())
+			}
+			return imageService
+		}
+
+		// The averaged embedding is a unit vector that stands for all frames, but matches none of them exactly
+		imageService := newImageService(config.ANIMATION_EMBEDDING_AVERAGE)
+		embeddings, err := imageService.ImageRepo.GetEmbeddings(ctx, "", []int{1})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var norm float64
+		for _, val := range embeddings[1] {
+			norm += float64(val) * float64(val)
+		}
+		if math.Abs(norm-1) > 1e-4 {
+			t.Fatalf("Averaged embedding has a squared norm of %v, want a unit vector", norm)
+		}
+		images, _, err := imageService.GetImagesSimilarToEmbedding(ctx, "", green, SearchPage{Limit: 2})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if images[0].ImageID != 1 || images[0].Distance < -0.999 {
+			t.Fatalf("Search results = %+v, want the animation without an exact match", images)
+		}
+
+		// The frame embeddings let any frame surface the animation
+		imageService = newImageService(config.ANIMATION_EMBEDDING_FRAMES)
+		images, _, err = imageService.GetImagesSimilarToEmbedding(ctx, "", green, SearchPage{Limit: 2})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if images[0].ImageID != 1 || images[0].Distance > -0.999 {
+			t.Fatalf("Search results = %+v, want the animation matched by its green frame", images)
+		}
+	})
+
+	t.Run("batched encoding", func(t *testing.T) {
+		ctx := context.Background()
+		clip := &batchingClipService{ClipService: &fakeClipService{}}
+		imagesConfig := config.Default().Images
+		imagesConfig.AnimationFrames = 3
+		imageService := NewImageService(repositories.NewMockImageRepository(), clip, imagesConfig)
+
+		// The prompts of a query are encoded in one call
+		_, err := imageService.EncodePrompts(ctx, "",
+			[]WeightedPrompt{{Text: "dog", Weight: 1}, {Text: "grass", Weight: 1}},
+			[]WeightedPrompt{{Text: "snow", Weight: 1}})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(clip.textBatches) != 1 || clip.textBatches[0] != 3 || clip.texts != 0 {
+			t.Fatalf("Text batches = %v with %d single calls, want one batch of 3", clip.textBatches, clip.texts)
+		}
+
+		// So are the frames of an animation
+		animation := &gif.GIF{}
+		for _, c := range []color.Color{color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}, color.RGBA{B: 255, A: 255}} {
+			animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{c}))
+			animation.Delay = append(animation.Delay, 10)
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, animation); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if err := imageService.AddImageData(ctx, buf.Bytes(), "http://localhost/animation.gif", ""); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(clip.imageBatches) != 1 || clip.imageBatches[0] != 3 || clip.images != 0 {
+			t.Fatalf("Image batches = %v with %d single calls, want one batch of 3", clip.imageBatches, clip.images)
+		}
+
+		// A single input needs no batch
+		if _, err := imageService.EncodePrompts(ctx, "", []WeightedPrompt{{Text: "dog", Weight: 1}}, nil); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(clip.textBatches) != 1 || clip.texts != 1 {
+			t.Fatalf("Text batches = %v with %d single calls, want a single call", clip.textBatches, clip.texts)
+		}
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		ctx := context.Background()
+		// A photo stored on its side, red on the left and blue on the right, with an EXIF orientation of 6
+		img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 16; x++ {
+				img.Set(x, y, color.RGBA{R: uint8(255 * (1 - x/8)), B: uint8(255 * (x / 8)), A: 255})
+			}
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			t.Fatalf(err.Error())
+		}
+		exif := []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00\x00\x00\x00\x00")
+		data := append([]byte{0xff, 0xd8, 0xff, 0xe1, 0x00, byte(len(exif) + 2)}, exif...)
+		data = append(data, buf.Bytes()[2:]...)
+
+		mockRepo := repositories.NewMockImageRepository()
+		imageService := NewImageService(mockRepo, &fakeClipService{}, config.Default().Images)
+		if err := imageService.AddImageData(ctx, data, "http://localhost/photo.jpg", ""); err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		added, err := mockRepo.GetById(ctx, 1)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if added.Metadata == nil || added.Metadata.Orientation != 6 || added.Metadata.Width != 8 || added.Metadata.Height != 16 {
+			t.Fatalf("Metadata = %+v, want an 8x16 photo with orientation 6", added.Metadata)
+		}
+
+		// The embedding is computed from the photo turned upright
+		upright, err := utils.ApplyOrientation(data, 6)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		want, err := fakeclip.EmbedImage(upright)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		stored, err := fakeclip.EmbedImage(data)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		embeddings, err := mockRepo.GetEmbeddings(ctx, "", []int{1})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if !reflect.DeepEqual(embeddings[1], want) || reflect.DeepEqual(embeddings[1], stored) {
+			t.Fatalf("Expected the embedding of the upright photo")
+		}
+	})
+}
+
+// Returns a fixed embedding for each known prompt
+type promptClipService struct {
+	embeddings map[string][]float32
+}
+
+func (pcs *promptClipService) EncodeImage(ctx context.Context, imageData []byte) ([]float32, error) {
+	return nil, errors.New("Not implemented")
+}
+
+func (pcs *promptClipService) EncodeText(ctx context.Context, text string) ([]float32, error) {
+	embedding, ok := pcs.embeddings[text]
+	if !ok {
+		return nil, errors.New("Unknown prompt")
+	}
+	return embedding, nil
+}
+
+func (pcs *promptClipService) ModelInfo(ctx context.Context) (models.EmbeddingModel, error) {
+	for _, embedding := range pcs.embeddings {
+		return models.EmbeddingModel{Name: "prompts", Dimension: len(embedding)}, nil
+	}
+	return models.EmbeddingModel{}, errors.New("No prompts")
+}
+
+// Counts the single and batched calls to the ClipService it wraps
+type batchingClipService struct {
+	ClipService
+	texts        int
+	images       int
+	textBatches  []int
+	imageBatches []int
+}
+
+func (bcs *batchingClipService) EncodeText(ctx context.Context, text string) ([]float32, error) {
+	bcs.texts++
+	return bcs.ClipService.EncodeText(ctx, text)
+}
+
+func (bcs *batchingClipService) EncodeImage(ctx context.Context, imageData []byte) ([]float32, error) {
+	bcs.images++
+	return bcs.ClipService.EncodeImage(ctx, imageData)
+}
+
+func (bcs *batchingClipService) EncodeTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	bcs.textBatches = append(bcs.textBatches, len(texts))
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embedding, err := bcs.ClipService.EncodeText(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
+}
+
+func (bcs *batchingClipService) EncodeImages(ctx context.Context, images [][]byte) ([][]float32, error) {
+	bcs.imageBatches = append(bcs.imageBatches, len(images))
+	embeddings := make([][]float32, len(images))
+	for i, imageData := range images {
+		embedding, err := bcs.ClipService.EncodeImage(ctx, imageData)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
 }
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/metrics"
+	"clipsearch/models"
+	"clipsearch/repositories"
+	"clipsearch/utils"
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Periodically checks that the source and thumbnail urls of the images still work and records the result,
+// optionally purging the images that stay dead
+type LinkCheckService struct {
+	imageService *ImageService
+	config       config.LinkCheckConfig
+}
+
+func NewLinkCheckService(imageService *ImageService, linkCheckConfig config.LinkCheckConfig) *LinkCheckService {
+	return &LinkCheckService{
+		imageService: imageService,
+		config:       linkCheckConfig,
+	}
+}
+
+// Checks the images that are due every interval until ctx is done. Meant to be run as a background job
+func (s *LinkCheckService) Run(ctx context.Context) {
+	for {
+		err := s.checkPass(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Link check failed, retrying later", "error", err, "retryInterval", s.config.Interval)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.config.Interval):
+		}
+	}
+}
+
+// Checks every image that wasn't checked within the interval, then purges the dead images if configured to
+func (s *LinkCheckService) checkPass(ctx context.Context) error {
+	repo := s.imageService.ImageRepo
+	checkedBefore := time.Now().Add(-s.config.Interval)
+	lastId := 0
+	checked := 0
+	notAlive := 0
+	for {
+		images, err := repo.GetImagesToCheck(ctx, checkedBefore, lastId, s.config.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(images) == 0 {
+			break
+		}
+
+		for _, image := range images {
+			lastId = image.ImageID
+			status, err := s.checkImage(ctx, image)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if status != models.LinkStatusAlive {
+				notAlive++
+				slog.InfoContext(ctx, "Image link is not alive", "id", image.ImageID, "url", image.SourceUrl, "status", status, "error", err)
+			}
+			err = repo.SetLinkStatus(ctx, image.ImageID, status, time.Now())
+			if err == repositories.ImageNotFoundError {
+				// Deleted in the meantime
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			metrics.CountLinkCheck(string(status))
+			checked++
+		}
+	}
+	if checked > 0 {
+		slog.InfoContext(ctx, "Checked image links", "checked", checked, "notAlive", notAlive)
+	}
+
+	if s.config.PurgeAfterFailures == 0 {
+		return nil
+	}
+	dead, err := repo.GetDeadImages(ctx, s.config.PurgeAfterFailures)
+	if err != nil {
+		return err
+	}
+	for _, image := range dead {
+		// Still served from its stored original, so nothing is lost by keeping it
+		stored, err := s.imageService.hasOriginal(ctx, image)
+		if err != nil {
+			return err
+		}
+		if stored {
+			continue
+		}
+		err = s.imageService.DeleteImageById(ctx, image.ImageID)
+		if err == repositories.ImageNotFoundError {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "Purged dead image", "id", image.ImageID, "url", image.SourceUrl)
+	}
+	return nil
+}
+
+// Returns the link status of the image and, unless it's alive, the error that caused it
+func (s *LinkCheckService) checkImage(ctx context.Context, image models.Image) (models.LinkStatus, error) {
+	// Imported from an archive, there is nothing to load
+	if utils.IsArchiveUrl(image.SourceUrl) {
+		return models.LinkStatusAlive, nil
+	}
+
+	// A local file outside of the directories files are read from, e.g. a video added from the command line, can't be checked
+	for _, url := range []string{image.SourceUrl, image.ThumbnailUrl} {
+		if _, ok, err := s.imageService.localFilePath(url); ok && err != nil {
+			return models.LinkStatusUnchecked, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	// The source url of a frame is the one of its video, which has another hash
+	if s.config.VerifySha256 && image.VideoID == nil {
+		data, err := s.imageService.readSource(ctx, image.SourceUrl)
+		if err == utils.FileSizeExceededError {
+			return models.LinkStatusChanged, err
+		}
+		if err != nil {
+			return failureStatus(err), err
+		}
+		if sha256Hex(data) != image.Sha256 {
+			return models.LinkStatusChanged, SourceChangedError
+		}
+	} else if err := s.checkUrl(ctx, image.SourceUrl); err != nil {
+		return failureStatus(err), err
+	}
+
+	if image.ThumbnailUrl != image.SourceUrl {
+		if err := s.checkUrl(ctx, image.ThumbnailUrl); err != nil {
+			return failureStatus(err), err
+		}
+	}
+	return models.LinkStatusAlive, nil
+}
+
+// Only a url that is gone counts as dead, any other failure may be an outage of the server or of the network
+func failureStatus(err error) models.LinkStatus {
+	if errors.Is(err, utils.UrlGoneError) || errors.Is(err, fs.ErrNotExist) {
+		return models.LinkStatusDead
+	}
+	return models.LinkStatusUnreachable
+}
+
+// Checks a stored url, which is a file:// url for the images of watched directories
+func (s *LinkCheckService) checkUrl(ctx context.Context, url string) error {
+	if path, ok, err := s.imageService.localFilePath(url); ok {
+		if err != nil {
+			return err
+		}
+		_, err := os.Stat(path)
+		return err
+	}
+	return utils.CheckUrl(ctx, url, s.imageService.config.DownloadUserAgent)
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/fakeclip"
+	"clipsearch/models"
+	"clipsearch/repositories"
+	"clipsearch/utils"
+	"context"
+	"errors"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLinkCheckService(t *testing.T) {
+	ctx := context.Background()
+	var filesMutex sync.Mutex
+	files := map[string][]byte{}
+	statuses := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		filesMutex.Lock()
+		file, ok := files[req.URL.Path]
+		status, failing := statuses[req.URL.Path]
+		filesMutex.Unlock()
+		if failing {
+			rw.WriteHeader(status)
+			return
+		}
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Write(file)
+	}))
+	defer server.Close()
+	setFile := func(path string, file []byte) {
+		filesMutex.Lock()
+		defer filesMutex.Unlock()
+		if file == nil {
+			delete(files, path)
+		} else {
+			files[path] = file
+		}
+	}
+	// Makes the server answer path with status until it's set to 0
+	setStatus := func(path string, status int) {
+		filesMutex.Lock()
+		defer filesMutex.Unlock()
+		if status == 0 {
+			delete(statuses, path)
+		} else {
+			statuses[path] = status
+		}
+	}
+
+	red := fakeclip.SolidColorPng(color.RGBA{R: 255, A: 255})
+	green := fakeclip.SolidColorPng(color.RGBA{G: 255, A: 255})
+	blue := fakeclip.SolidColorPng(color.RGBA{B: 255, A: 255})
+
+	// Adds /red, /green with the thumbnail /green_thumb, and /blue
+	setup := func(t *testing.T, linkCheckConfig config.LinkCheckConfig) (*repositories.MockImageRepository, *ImageService, *LinkCheckService) {
+		setFile("/red", red)
+		setFile("/green", green)
+		setFile("/green_thumb", green)
+		setFile("/blue", blue)
+		mockRepo := repositories.NewMockImageRepository()
+		imageService := NewImageService(mockRepo, NewMockClipService(), config.Default().Images)
+		for _, urls := range [][2]string{{"/red", "/red"}, {"/green", "/green_thumb"}, {"/blue", "/blue"}} {
+			if err := imageService.AddImageByURL(ctx, server.URL+urls[0], server.URL+urls[1]); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		return mockRepo, imageService, NewLinkCheckService(imageService, linkCheckConfig)
+	}
+
+	checkStatuses := func(t *testing.T, repo *repositories.MockImageRepository, want map[int]models.LinkStatus) {
+		for id, status := range want {
+			image, err := repo.GetById(ctx, id)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			if image.LinkStatus != status {
+				t.Fatalf("Link status of image %d = %s, want = %s", id, image.LinkStatus, status)
+			}
+			if image.LinkCheckedAt == nil {
+				t.Fatalf("Check time of image %d wasn't recorded", id)
+			}
+		}
+	}
+
+	t.Run("statuses", func(t *testing.T) {
+		linkCheckConfig := config.Default().LinkCheck
+		linkCheckConfig.VerifySha256 = true
+		mockRepo, _, linkCheckService := setup(t, linkCheckConfig)
+		setFile("/green_thumb", nil)
+		setFile("/blue", red)
+
+		if err := linkCheckService.checkPass(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+		checkStatuses(t, mockRepo, map[int]models.LinkStatus{
+			1: models.LinkStatusAlive,
+			2: models.LinkStatusDead,
+			3: models.LinkStatusChanged,
+		})
+
+		// The results are trusted for the interval
+		toCheck, err := mockRepo.GetImagesToCheck(ctx, time.Now().Add(-linkCheckConfig.Interval), 0, 10)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(toCheck) != 0 {
+			t.Fatalf("Images due for a check = %v, want none", toCheck)
+		}
+	})
+
+	t.Run("changes are only noticed with verifySha256", func(t *testing.T) {
+		mockRepo, _, linkCheckService := setup(t, config.Default().LinkCheck)
+		setFile("/blue", red)
+
+		if err := linkCheckService.checkPass(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+		checkStatuses(t, mockRepo, map[int]models.LinkStatus{3: models.LinkStatusAlive})
+	})
+
+	t.Run("hide dead images", func(t *testing.T) {
+		mockRepo, imageService, linkCheckService := setup(t, config.Default().LinkCheck)
+		mockRepo.SetHideDeadImages(true)
+		setFile("/red", nil)
+
+		if err := linkCheckService.checkPass(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+		count, images, err := imageService.GetCountAndImages(ctx, 0, 2)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if count != 2 || len(images) != 2 || images[0].ImageID != 2 || images[1].ImageID != 3 {
+			t.Fatalf("Listed %d of %d images (%v), want images 2 and 3", len(images), count, images)
+		}
+		results, _, err := imageService.GetImagesSimilarToEmbedding(ctx, "", make([]float32, MockClipModel.Dimension), SearchPage{Limit: 10})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, result := range results {
+			if result.ImageID == 1 {
+				t.Fatalf("Search results = %v, want the dead image left out", results)
+			}
+		}
+	})
+
+	t.Run("purge after failures", func(t *testing.T) {
+		linkCheckConfig := config.Default().LinkCheck
+		linkCheckConfig.PurgeAfterFailures = 2
+		// Every image is due again on the next pass
+		linkCheckConfig.Interval = time.Nanosecond
+		mockRepo, imageService, linkCheckService := setup(t, linkCheckConfig)
+		blobStore, err := repositories.NewLocalBlobStore(t.TempDir())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		imageService.SetBlobStore(blobStore)
+		if err := blobStore.Put(ctx, sha256Hex(red), red); err != nil {
+			t.Fatalf(err.Error())
+		}
+		setFile("/red", nil)
+		setFile("/green", nil)
+		setFile("/blue", nil)
+
+		if err := linkCheckService.checkPass(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+		// Back after a single failure
+		setFile("/green", green)
+		if err := linkCheckService.checkPass(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		if _, err := mockRepo.GetById(ctx, 3); err != repositories.ImageNotFoundError {
+			t.Fatalf("Expected the image that failed twice to be purged")
+		}
+		// Still served from its original
+		checkStatuses(t, mockRepo, map[int]models.LinkStatus{
+			1: models.LinkStatusDead,
+			2: models.LinkStatusAlive,
+		})
+		reader, _, err := blobStore.Get(ctx, sha256Hex(red))
+		if err != nil {
+			t.Fatalf("Expected the original of the kept image to stay stored, got %v", err)
+		}
+		reader.Close()
+	})
+
+	t.Run("outages don't count as failures", func(t *testing.T) {
+		linkCheckConfig := config.Default().LinkCheck
+		linkCheckConfig.PurgeAfterFailures = 2
+		linkCheckConfig.Interval = time.Nanosecond
+		mockRepo, _, linkCheckService := setup(t, linkCheckConfig)
+		defer setStatus("/red", 0)
+
+		for _, status := range []int{http.StatusNotFound, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+			setStatus("/red", status)
+			if err := linkCheckService.checkPass(ctx); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		checkStatuses(t, mockRepo, map[int]models.LinkStatus{1: models.LinkStatusUnreachable})
+
+		// The failure before the outage still counts
+		setStatus("/red", http.StatusGone)
+		if err := linkCheckService.checkPass(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err := mockRepo.GetById(ctx, 1); err != repositories.ImageNotFoundError {
+			t.Fatalf("Expected the image that was gone twice to be purged")
+		}
+	})
+
+	t.Run("local files are only read in the local directories", func(t *testing.T) {
+		linkCheckConfig := config.Default().LinkCheck
+		linkCheckConfig.VerifySha256 = true
+		mockRepo, imageService, linkCheckService := setup(t, linkCheckConfig)
+		allowed, other := t.TempDir(), t.TempDir()
+		imageService.SetLocalDirectories([]string{allowed})
+		black := fakeclip.SolidColorPng(color.Black)
+		white := fakeclip.SolidColorPng(color.White)
+		for _, file := range []struct {
+			path string
+			data []byte
+		}{{filepath.Join(allowed, "black.png"), black}, {filepath.Join(other, "white.png"), white}} {
+			if err := os.WriteFile(file.path, file.data, 0o644); err != nil {
+				t.Fatalf(err.Error())
+			}
+			if err := imageService.AddImageData(ctx, file.data, utils.FileUrl(file.path), utils.FileUrl(file.path)); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		if _, err := imageService.readSource(ctx, utils.FileUrl(filepath.Join(allowed, "..", filepath.Base(other), "white.png"))); !errors.Is(err, utils.LocalFileNotAllowedError) {
+			t.Fatalf("readSource error = %v, want = %v", err, utils.LocalFileNotAllowedError)
+		}
+
+		if err := linkCheckService.checkPass(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+		images, err := mockRepo.GetImagesAfterId(ctx, 3, 10)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(images) != 2 || images[0].LinkStatus != models.LinkStatusAlive || images[1].LinkStatus != models.LinkStatusUnchecked {
+			t.Fatalf("Images = %v, want the file outside of the local directories left unchecked", images)
+		}
+	})
+}
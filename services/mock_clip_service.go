@@ -1,5 +1,12 @@
 package services
 
+import (
+	"clipsearch/models"
+	"context"
+)
+
+var MockClipModel = models.EmbeddingModel{Name: "mock", Dimension: 3}
+
 type MockClipService struct {
 }
 
@@ -7,10 +14,14 @@ func NewMockClipService() *MockClipService {
 	return &MockClipService{}
 }
 
-func (mcs *MockClipService) EncodeImage(imageData []byte) ([]float32, error) {
+func (mcs *MockClipService) EncodeImage(ctx context.Context, imageData []byte) ([]float32, error) {
 	return []float32{1, 2, 3}, nil
 }
 
-func (mcs *MockClipService) EncodeText(text string) ([]float32, error) {
+func (mcs *MockClipService) EncodeText(ctx context.Context, text string) ([]float32, error) {
 	return []float32{3, 2, 1}, nil
 }
+
+func (mcs *MockClipService) ModelInfo(ctx context.Context) (models.EmbeddingModel, error) {
+	return MockClipModel, nil
+}
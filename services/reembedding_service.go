@@ -0,0 +1,243 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/metrics"
+	"clipsearch/models"
+	"clipsearch/repositories"
+	"clipsearch/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+var SourceChangedError = errors.New("The image at the source url changed since it was added")
+var PermanentFailuresError = errors.New("Images that can never be re-embedded block the re-embedding")
+
+// Re-embeds all images with the model of another ClipService. Searches keep using the current embeddings
+// until every image has one from the new model, then the new embeddings and ClipService replace the current ones
+type ReembeddingService struct {
+	imageService *ImageService
+	target       ClipService
+	config       config.ReembeddingConfig
+	// Whether searches switch to the model of target once every image has an embedding from it
+	cutOver bool
+	// The images that failed in a way retrying can't fix, by id. They are skipped by the following passes
+	permanentFailures map[int]error
+}
+
+func NewReembeddingService(imageService *ImageService, target ClipService, reembeddingConfig config.ReembeddingConfig) *ReembeddingService {
+	return &ReembeddingService{
+		imageService:      imageService,
+		target:            target,
+		config:            reembeddingConfig,
+		cutOver:           true,
+		permanentFailures: make(map[int]error),
+	}
+}
+
+// Embeds the images added before target was configured with its model, without a cut-over.
+// Used for the models configured next to the default one, see ImageService.AddClipService
+func NewBackfillService(imageService *ImageService, target ClipService, reembeddingConfig config.ReembeddingConfig) *ReembeddingService {
+	service := NewReembeddingService(imageService, target, reembeddingConfig)
+	service.cutOver = false
+	return service
+}
+
+// Re-embeds the images until the cut-over (or the backfill) succeeds or ctx is done, retrying after failures.
+// The images that can never be re-embedded aren't retried, config.ReembeddingConfig.PermanentFailures tells what
+// happens to them. Meant to be run as a background job
+func (s *ReembeddingService) Run(ctx context.Context) {
+	for {
+		err := s.reembed(ctx)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		slog.ErrorContext(ctx, "Re-embedding failed, retrying later", "error", err, "retryInterval", s.config.RetryInterval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.config.RetryInterval):
+		}
+	}
+}
+
+// Re-embeds all images and cuts over to the model of the target
+func (s *ReembeddingService) reembed(ctx context.Context) error {
+	repo := s.imageService.ImageRepo
+	model, err := s.target.ModelInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if !s.cutOver {
+		return s.backfill(ctx, model)
+	}
+	active, err := repo.GetActiveEmbeddingModel(ctx)
+	if err != nil {
+		return err
+	}
+	if active != nil && *active == model {
+		slog.InfoContext(ctx, "Images are already embedded with the new model", "model", model.Name)
+		s.imageService.SwitchClipService(s.target, model)
+		return nil
+	}
+	if err := repo.RegisterEmbeddingModel(ctx, model); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Re-embedding images", "model", model.Name, "dimension", model.Dimension)
+	for {
+		skipped, err := s.reembedPass(ctx, model)
+		if err != nil {
+			return err
+		}
+
+		err = repo.CutOverEmbeddingModel(ctx, model.Name, skipped)
+		if errors.Is(err, repositories.ReembeddingIncompleteError) {
+			// Images were added during the pass
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.imageService.SwitchClipService(s.target, model)
+		slog.InfoContext(ctx, "Cut over to the new embedding model", "model", model.Name, "withoutEmbedding", len(skipped))
+		return nil
+	}
+}
+
+// Embeds the images without an embedding from model
+func (s *ReembeddingService) backfill(ctx context.Context, model models.EmbeddingModel) error {
+	if err := s.imageService.ImageRepo.RegisterEmbeddingModel(ctx, model); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Backfilling embeddings", "model", model.Name, "dimension", model.Dimension)
+	skipped, err := s.reembedPass(ctx, model)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Every image has an embedding from the model", "model", model.Name, "withoutEmbedding", len(skipped))
+	return nil
+}
+
+// Whether re-embedding an image failed in a way retrying can't fix
+func isPermanentFailure(err error) bool {
+	return errors.Is(err, SourceChangedError) || errors.Is(err, OriginalNotStoredError) ||
+		errors.Is(err, utils.UrlGoneError) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, utils.FileSizeExceededError) ||
+		errors.Is(err, utils.LocalFileNotAllowedError)
+}
+
+// Re-embeds every image without an embedding from model, then applies the configured policy to the ones that can never be.
+// Fails if images failed and retrying could fix them, or if the policy is to block on the others.
+// Returns the ids of the images kept without an embedding from model
+func (s *ReembeddingService) reembedPass(ctx context.Context, model models.EmbeddingModel) ([]int, error) {
+	repo := s.imageService.ImageRepo
+	lastId := 0
+	reembedded := 0
+	failed := 0
+	var permanent []int
+	for {
+		images, err := repo.GetImagesToReembed(ctx, model.Name, lastId, s.config.BatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(images) == 0 {
+			break
+		}
+
+		for _, image := range images {
+			lastId = image.ImageID
+			if _, ok := s.permanentFailures[image.ImageID]; ok {
+				permanent = append(permanent, image.ImageID)
+				continue
+			}
+			if err := s.reembedImage(ctx, image, model); err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				if isPermanentFailure(err) {
+					s.permanentFailures[image.ImageID] = err
+					permanent = append(permanent, image.ImageID)
+					slog.WarnContext(ctx, "Image can't be re-embedded, not retrying it", "id", image.ImageID, "url", image.SourceUrl, "error", err)
+					continue
+				}
+				failed++
+				slog.WarnContext(ctx, "Failed to re-embed image", "id", image.ImageID, "url", image.SourceUrl, "error", err)
+				continue
+			}
+			reembedded++
+		}
+		slog.InfoContext(ctx, "Re-embedding progress", "model", model.Name, "reembedded", reembedded, "failed", failed, "permanentlyFailed", len(permanent))
+	}
+
+	// Forgets the images deleted since they failed
+	for id := range s.permanentFailures {
+		if !slices.Contains(permanent, id) {
+			delete(s.permanentFailures, id)
+		}
+	}
+	metrics.SetReembeddingFailedImages(model.Name, failed, len(permanent))
+	if failed > 0 {
+		return nil, fmt.Errorf("%d images couldn't be re-embedded", failed)
+	}
+	if len(permanent) == 0 {
+		return nil, nil
+	}
+
+	switch s.config.PermanentFailures {
+	case config.REEMBEDDING_PERMANENT_FAILURES_KEEP:
+		slog.WarnContext(ctx, "Keeping the images that can't be re-embedded, searches with the model won't find them", "model", model.Name, "count", len(permanent))
+		return permanent, nil
+	case config.REEMBEDDING_PERMANENT_FAILURES_DELETE:
+		for _, id := range permanent {
+			err := s.imageService.DeleteImageById(ctx, id)
+			if err != nil && err != repositories.ImageNotFoundError {
+				return nil, err
+			}
+			delete(s.permanentFailures, id)
+			slog.WarnContext(ctx, "Deleted image that can't be re-embedded", "id", id)
+		}
+		metrics.SetReembeddingFailedImages(model.Name, 0, 0)
+		return nil, nil
+	default:
+		// Archive entries and video frames added without a blob store never have an original, waiting for them
+		// would block forever, so they are kept
+		blocking := 0
+		for _, id := range permanent {
+			if !errors.Is(s.permanentFailures[id], OriginalNotStoredError) {
+				blocking++
+			}
+		}
+		if blocking > 0 {
+			return nil, fmt.Errorf("%w: %d images, delete them or change reembedding.permanentFailures", PermanentFailuresError, blocking)
+		}
+		slog.WarnContext(ctx, "Keeping the images whose original isn't stored, searches with the model won't find them", "model", model.Name, "count", len(permanent))
+		return permanent, nil
+	}
+}
+
+func (s *ReembeddingService) reembedImage(ctx context.Context, image models.Image, model models.EmbeddingModel) error {
+	data, err := s.imageService.loadImageData(ctx, image)
+	if err != nil {
+		return err
+	}
+
+	still, frames := s.imageService.embeddingInput(ctx, data, utils.ReadImageMetadata(data))
+	embedding, frameEmbeddings, err := s.imageService.encodeImage(ctx, s.target, still, frames)
+	if err != nil {
+		return err
+	}
+	err = s.imageService.ImageRepo.SetEmbedding(ctx, image.ImageID, model.Name, embedding)
+	if err == nil && frameEmbeddings != nil {
+		err = s.imageService.ImageRepo.SetFrameEmbeddings(ctx, image.ImageID, model.Name, frameEmbeddings)
+	}
+	if err == repositories.ImageNotFoundError {
+		// Deleted in the meantime
+		return nil
+	}
+	return err
+}
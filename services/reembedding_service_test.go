@@ -0,0 +1,288 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/fakeclip"
+	"clipsearch/models"
+	"clipsearch/repositories"
+	"context"
+	"errors"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Computes fakeclip embeddings in-process
+type fakeClipService struct{}
+
+func (fcs *fakeClipService) EncodeImage(ctx context.Context, imageData []byte) ([]float32, error) {
+	return fakeclip.EmbedImage(imageData)
+}
+
+func (fcs *fakeClipService) EncodeText(ctx context.Context, text string) ([]float32, error) {
+	return fakeclip.EmbedText(text), nil
+}
+
+func (fcs *fakeClipService) ModelInfo(ctx context.Context) (models.EmbeddingModel, error) {
+	return models.EmbeddingModel{Name: fakeclip.ModelName, Dimension: fakeclip.Dimension}, nil
+}
+
+func TestReembeddingService(t *testing.T) {
+	ctx := context.Background()
+	images := map[string][]byte{
+		"/red":   fakeclip.SolidColorPng(color.RGBA{R: 255, A: 255}),
+		"/green": fakeclip.SolidColorPng(color.RGBA{G: 255, A: 255}),
+		"/blue":  fakeclip.SolidColorPng(color.RGBA{B: 255, A: 255}),
+	}
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		downloads.Add(1)
+		image, ok := images[req.URL.Path]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Write(image)
+	}))
+	defer server.Close()
+
+	setup := func(t *testing.T, paths ...string) (*repositories.MockImageRepository, *ImageService, *ReembeddingService) {
+		mockRepo := repositories.NewMockImageRepository()
+		imageService := NewImageService(mockRepo, NewMockClipService(), config.Default().Images)
+		for _, path := range paths {
+			if err := imageService.AddImageByURL(ctx, server.URL+path, ""); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		reembeddingService := NewReembeddingService(imageService, &fakeClipService{}, config.Default().Reembedding)
+		return mockRepo, imageService, reembeddingService
+	}
+
+	t.Run("cut over", func(t *testing.T) {
+		mockRepo, imageService, reembeddingService := setup(t, "/red", "/green", "/blue")
+
+		if err := reembeddingService.reembed(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		active, err := mockRepo.GetActiveEmbeddingModel(ctx)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if active == nil || active.Name != fakeclip.ModelName || active.Dimension != fakeclip.Dimension {
+			t.Fatalf("Active model = %v, want = %s", active, fakeclip.ModelName)
+		}
+		if err := imageService.CheckEmbeddingModel(ctx); err != nil {
+			t.Fatalf("The image service doesn't use the new model: %v", err)
+		}
+
+		query := CompositeQuery{Images: []WeightedImageData{{Data: images["/blue"], Weight: 1}}}
+		results, _, err := imageService.GetImagesSimilarToCompositeQuery(ctx, "", query, SearchPage{Limit: 1})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(results) != 1 || results[0].SourceUrl != server.URL+"/blue" {
+			t.Fatalf("Results = %v, want the blue image", results)
+		}
+	})
+
+	t.Run("failed images keep the old model", func(t *testing.T) {
+		mockRepo, imageService, reembeddingService := setup(t, "/red", "/green")
+		images["/gone"] = fakeclip.SolidColorPng(color.Black)
+		if err := imageService.AddImageByURL(ctx, server.URL+"/gone", ""); err != nil {
+			t.Fatalf(err.Error())
+		}
+		delete(images, "/gone")
+
+		if err := reembeddingService.reembed(ctx); err == nil {
+			t.Fatalf("Expected re-embedding to fail when an image can't be downloaded")
+		}
+		active, err := mockRepo.GetActiveEmbeddingModel(ctx)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if *active != MockClipModel {
+			t.Fatalf("Active model = %v, want = %v", active, MockClipModel)
+		}
+		if err := imageService.CheckEmbeddingModel(ctx); err != nil {
+			t.Fatalf("The image service switched models before the cut-over: %v", err)
+		}
+		toReembed, err := mockRepo.GetImagesToReembed(ctx, fakeclip.ModelName, 0, 10)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(toReembed) != 1 || toReembed[0].SourceUrl != server.URL+"/gone" {
+			t.Fatalf("Images left to re-embed = %v, want the missing one", toReembed)
+		}
+	})
+
+	// Adds an image whose source url is gone right after
+	addGoneImage := func(t *testing.T, imageService *ImageService) {
+		images["/gone"] = fakeclip.SolidColorPng(color.Black)
+		if err := imageService.AddImageByURL(ctx, server.URL+"/gone", ""); err != nil {
+			t.Fatalf(err.Error())
+		}
+		delete(images, "/gone")
+	}
+
+	t.Run("permanent failures aren't retried", func(t *testing.T) {
+		_, imageService, reembeddingService := setup(t, "/red")
+		addGoneImage(t, imageService)
+
+		if err := reembeddingService.reembed(ctx); !errors.Is(err, PermanentFailuresError) {
+			t.Fatalf("Re-embedding error = %v, want = %v", err, PermanentFailuresError)
+		}
+		downloads.Store(0)
+		if err := reembeddingService.reembed(ctx); !errors.Is(err, PermanentFailuresError) {
+			t.Fatalf("Re-embedding error = %v, want = %v", err, PermanentFailuresError)
+		}
+		if downloads.Load() != 0 {
+			t.Fatalf("Downloads when retrying = %d, want none", downloads.Load())
+		}
+	})
+
+	t.Run("images without a stored original don't block", func(t *testing.T) {
+		mockRepo, _, reembeddingService := setup(t, "/red")
+		videoId := 1
+		_, err := mockRepo.Create(ctx, &models.Image{
+			SourceUrl:      server.URL + "/video.mp4#t=5",
+			ThumbnailUrl:   server.URL + "/video.mp4#t=5",
+			Sha256:         "frame",
+			VideoID:        &videoId,
+			Embedding:      make([]float32, MockClipModel.Dimension),
+			EmbeddingModel: MockClipModel.Name,
+		})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		if err := reembeddingService.reembed(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+		active, err := mockRepo.GetActiveEmbeddingModel(ctx)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if active.Name != fakeclip.ModelName {
+			t.Fatalf("Active model = %v, want = %s", active, fakeclip.ModelName)
+		}
+		if count, _ := mockRepo.Count(ctx); count != 2 {
+			t.Fatalf("Image count = %d, want the frame kept", count)
+		}
+	})
+
+	t.Run("permanent failures kept", func(t *testing.T) {
+		mockRepo, imageService, reembeddingService := setup(t, "/red")
+		addGoneImage(t, imageService)
+		reembeddingService.config.PermanentFailures = config.REEMBEDDING_PERMANENT_FAILURES_KEEP
+
+		if err := reembeddingService.reembed(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+		active, err := mockRepo.GetActiveEmbeddingModel(ctx)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if active.Name != fakeclip.ModelName {
+			t.Fatalf("Active model = %v, want = %s", active, fakeclip.ModelName)
+		}
+		if count, _ := mockRepo.Count(ctx); count != 2 {
+			t.Fatalf("Image count = %d, want the image that can't be re-embedded kept", count)
+		}
+	})
+
+	t.Run("permanent failures deleted", func(t *testing.T) {
+		mockRepo, imageService, _ := setup(t, "/red")
+		addGoneImage(t, imageService)
+		reembeddingConfig := config.Default().Reembedding
+		reembeddingConfig.PermanentFailures = config.REEMBEDDING_PERMANENT_FAILURES_DELETE
+		backfillService := NewBackfillService(imageService, &fakeClipService{}, reembeddingConfig)
+
+		if err := backfillService.reembed(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+		remaining, err := mockRepo.GetImagesAfterId(ctx, 0, 10)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(remaining) != 1 || remaining[0].SourceUrl != server.URL+"/red" {
+			t.Fatalf("Images = %v, want the image that can't be re-embedded deleted", remaining)
+		}
+	})
+
+	t.Run("mismatched embeddings are rejected", func(t *testing.T) {
+		mockRepo, _, _ := setup(t, "/red")
+
+		_, err := mockRepo.Create(ctx, &models.Image{Embedding: []float32{1, 0}, EmbeddingModel: MockClipModel.Name})
+		if !errors.Is(err, repositories.EmbeddingDimensionMismatchError) {
+			t.Fatalf("Create error = %v, want = %v", err, repositories.EmbeddingDimensionMismatchError)
+		}
+		_, err = mockRepo.Create(ctx, &models.Image{Embedding: []float32{1, 0, 0}, EmbeddingModel: "other"})
+		if !errors.Is(err, repositories.EmbeddingModelMismatchError) {
+			t.Fatalf("Create error = %v, want = %v", err, repositories.EmbeddingModelMismatchError)
+		}
+	})
+
+	t.Run("backfill", func(t *testing.T) {
+		mockRepo, imageService, _ := setup(t, "/red", "/green")
+		backfillService := NewBackfillService(imageService, &fakeClipService{}, config.Default().Reembedding)
+
+		if err := backfillService.reembed(ctx); err != nil {
+			t.Fatalf(err.Error())
+		}
+		toReembed, err := mockRepo.GetImagesToReembed(ctx, fakeclip.ModelName, 0, 10)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(toReembed) != 0 {
+			t.Fatalf("Images left to embed = %v, want none", toReembed)
+		}
+		active, err := mockRepo.GetActiveEmbeddingModel(ctx)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if *active != MockClipModel {
+			t.Fatalf("Active model = %v, want = %v", active, MockClipModel)
+		}
+
+		imageService.AddClipService(fakeclip.ModelName, &fakeClipService{})
+		query := CompositeQuery{Images: []WeightedImageData{{Data: images["/green"], Weight: 1}}}
+		results, _, err := imageService.GetImagesSimilarToCompositeQuery(ctx, fakeclip.ModelName, query, SearchPage{Limit: 1})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(results) != 1 || results[0].SourceUrl != server.URL+"/green" {
+			t.Fatalf("Results = %v, want the green image", results)
+		}
+	})
+
+	t.Run("stops on shutdown", func(t *testing.T) {
+		_, _, reembeddingService := setup(t, "/red")
+		reembeddingService.target = &failingModelInfoClipService{}
+		reembeddingService.config.RetryInterval = time.Hour
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			reembeddingService.Run(runCtx)
+			close(done)
+		}()
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Run didn't return after its context was cancelled")
+		}
+	})
+}
+
+type failingModelInfoClipService struct {
+	fakeClipService
+}
+
+func (fcs *failingModelInfoClipService) ModelInfo(ctx context.Context) (models.EmbeddingModel, error) {
+	return models.EmbeddingModel{}, DaemonUnreachableError
+}
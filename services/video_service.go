@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bytes"
+	"clipsearch/config"
+	"clipsearch/models"
+	"clipsearch/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var VideoExistsError = errors.New("This video already exists (hash match)")
+var NoFramesError = errors.New("No frames could be extracted from the video")
+var UnreadableVideoError = errors.New("The file is not a video ffmpeg can read")
+
+// Adds videos by extracting frames from them with ffmpeg and storing the frames as images, so searches find them
+type VideoService struct {
+	imageService *ImageService
+	config       config.VideoConfig
+}
+
+func NewVideoService(imageService *ImageService, videoConfig config.VideoConfig) *VideoService {
+	return &VideoService{imageService: imageService, config: videoConfig}
+}
+
+// A video along with its frames, ordered by FrameTime
+type VideoWithFrames struct {
+	models.Video
+	Frames []models.Image
+}
+
+// Downloads the video at url and adds it, returning its id. Fails with utils.FileSizeExceededError, VideoExistsError,
+// UnreadableVideoError or NoFramesError
+func (s *VideoService) AddVideoByURL(ctx context.Context, url string) (int, error) {
+	file, err := os.CreateTemp("", "clipsearch-video-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	err = utils.DownloadFile(ctx, file, url, s.config.MaxFileSize, s.imageService.config.DownloadUserAgent)
+	if err != nil {
+		return 0, err
+	}
+	return s.addVideo(ctx, file.Name(), url)
+}
+
+// Adds the video file at path, stored under its file:// url. Fails like AddVideoByURL
+func (s *VideoService) AddVideoFile(ctx context.Context, path string) (int, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() > int64(s.config.MaxFileSize) {
+		return 0, utils.FileSizeExceededError
+	}
+	return s.addVideo(ctx, path, utils.FileUrl(path))
+}
+
+func (s *VideoService) addVideo(ctx context.Context, path string, sourceUrl string) (int, error) {
+	hashString, err := fileSha256(path)
+	if err != nil {
+		return 0, err
+	}
+	count, err := s.imageService.ImageRepo.CountVideosWithSha256(ctx, hashString)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, VideoExistsError
+	}
+
+	dir, err := os.MkdirTemp("", "clipsearch-frames-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+	frameFiles, frameTimes, err := s.extractFrames(ctx, path, dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(frameFiles) == 0 {
+		return 0, NoFramesError
+	}
+
+	frames := make([]models.Image, len(frameFiles))
+	for i, frameFile := range frameFiles {
+		data, err := os.ReadFile(frameFile)
+		if err != nil {
+			return 0, err
+		}
+		frameTime := frameTimes[i]
+		frames[i].SourceUrl = FrameUrl(sourceUrl, frameTime)
+		frames[i].ThumbnailUrl = frames[i].SourceUrl
+		frames[i].FrameTime = &frameTime
+		if err := s.imageService.embedImage(ctx, data, &frames[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	video := models.Video{SourceUrl: sourceUrl, Sha256: hashString}
+	id, err := s.imageService.ImageRepo.CreateVideo(ctx, &video, frames)
+	if err != nil {
+		return 0, err
+	}
+	slog.InfoContext(ctx, "Added video", "id", id, "url", sourceUrl, "sha256", hashString, "frames", len(frames))
+	return id, nil
+}
+
+// The hex encoded sha256 hash of the file at path
+func fileSha256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Returns the url a frame is stored under: the url of its video with a media fragment pointing at the frame,
+// which makes browsers start playing the video there
+func FrameUrl(videoUrl string, seconds float64) string {
+	if parsed, err := url.Parse(videoUrl); err == nil {
+		parsed.Fragment = ""
+		parsed.RawFragment = ""
+		videoUrl = parsed.String()
+	}
+	return videoUrl + "#t=" + strconv.FormatFloat(seconds, 'f', -1, 64)
+}
+
+// Demuxers of the container formats videos are read in. Playlists and lists of files, like HLS or concat,
+// are left out since ffmpeg would open what they point to
+const videoFormatWhitelist = "mov,matroska,avi,flv,mpegts,ogg,asf,mpeg"
+
+// Matches the pts_time field of the lines ffmpeg's showinfo filter logs for every selected frame
+var showinfoPtsTime = regexp.MustCompile(`\[Parsed_showinfo_[0-9]+ @ [^\]]*\].* pts_time:\s*([0-9.eE+-]+)`)
+
+// Writes the frames of the video at path selected by FrameMode to dir as jpg files, returning their paths
+// and the times they are shown at, in seconds into the video
+func (s *VideoService) extractFrames(ctx context.Context, path string, dir string) ([]string, []float64, error) {
+	// The first frame is always selected, prev_selected_t is NaN until then
+	selection := "isnan(prev_selected_t)+gte(t-prev_selected_t," + strconv.FormatFloat(s.config.FrameInterval.Seconds(), 'f', -1, 64) + ")"
+	if s.config.FrameMode == config.VIDEO_FRAME_MODE_SCENE {
+		selection = "isnan(prev_selected_t)+gt(scene," + strconv.FormatFloat(s.config.SceneThreshold, 'f', -1, 64) + ")"
+	}
+	cmd := exec.CommandContext(ctx, s.config.FfmpegPath,
+		"-hide_banner", "-nostdin", "-loglevel", "info",
+		// The video is a downloaded file that must not make ffmpeg open other files or urls
+		"-protocol_whitelist", "file",
+		"-format_whitelist", videoFormatWhitelist,
+		"-i", path,
+		"-vf", "select='"+selection+"',showinfo",
+		// Only the selected frames are written, -vsync is understood by old and new versions alike
+		"-vsync", "vfr",
+		"-frames:v", strconv.Itoa(s.config.MaxFrames),
+		"-q:v", "2",
+		filepath.Join(dir, "%06d.jpg"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			return nil, nil, fmt.Errorf("%w: %s", UnreadableVideoError, lastLine(stderr.String()))
+		}
+		return nil, nil, fmt.Errorf("Failed to run ffmpeg: %w", err)
+	}
+
+	times := make([]float64, 0, 64)
+	for _, match := range showinfoPtsTime.FindAllStringSubmatch(stderr.String(), -1) {
+		seconds, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unexpected ffmpeg output: %w", err)
+		}
+		times = append(times, seconds)
+	}
+	// The files are numbered in the order the frames were selected in
+	files, err := filepath.Glob(filepath.Join(dir, "*.jpg"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(times) < len(files) {
+		return nil, nil, fmt.Errorf("Unexpected ffmpeg output: %d frames were written but %d were logged", len(files), len(times))
+	}
+	return files, times[:len(files)], nil
+}
+
+// The last non-empty line of the output of a command, which holds the error of ffmpeg
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// Fails with repositories.VideoNotFoundError if there is no such video
+func (s *VideoService) GetVideoById(ctx context.Context, id int) (*VideoWithFrames, error) {
+	video, err := s.imageService.ImageRepo.GetVideoById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	frames, err := s.imageService.ImageRepo.GetVideoFrames(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &VideoWithFrames{Video: *video, Frames: frames}, nil
+}
+
+// Deletes the video along with its frames and their originals
+func (s *VideoService) DeleteVideoById(ctx context.Context, id int) error {
+	frames, err := s.imageService.ImageRepo.GetVideoFrames(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.imageService.ImageRepo.DeleteVideoById(ctx, id); err != nil {
+		return err
+	}
+	for _, frame := range frames {
+		s.imageService.deleteOriginal(ctx, frame)
+	}
+	return nil
+}
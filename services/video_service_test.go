@@ -0,0 +1,181 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/repositories"
+	"clipsearch/utils"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Stands in for ffmpeg: writes three frames, logging them like the showinfo filter does, for inputs starting
+// with VIDEO and fails like ffmpeg for others. The arguments are written to the args file next to it
+const fakeFfmpeg = `#!/bin/sh
+printf '%s\n' "$@" > "$(dirname "$0")/args"
+while [ $# -gt 1 ]; do
+	if [ "$1" = "-i" ]; then input="$2"; fi
+	shift
+done
+if [ "$(head -c 5 "$input")" != "VIDEO" ]; then
+	echo "$input: Invalid data found when processing input" >&2
+	exit 1
+fi
+for n in 1 2 3; do
+	printf 'frame %s of %s' "$n" "$input" > "$(printf "$1" "$n")"
+	echo "[Parsed_showinfo_1 @ 0x55d0c8a0] n:   $((n - 1)) pts:  $((n * 5000)) pts_time:$((n * 5 - 5)).5  duration:512" >&2
+done
+`
+
+func TestVideoService(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake ffmpeg is a shell script")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	ffmpegPath := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(ffmpegPath, []byte(fakeFfmpeg), 0755); err != nil {
+		t.Fatalf(err.Error())
+	}
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf(err.Error())
+		}
+		return path
+	}
+
+	newVideoService := func(videoConfig config.VideoConfig) (*repositories.MockImageRepository, *VideoService) {
+		mockRepo := repositories.NewMockImageRepository()
+		imageService := NewImageService(mockRepo, NewMockClipService(), config.Default().Images)
+		videoConfig.FfmpegPath = ffmpegPath
+		return mockRepo, NewVideoService(imageService, videoConfig)
+	}
+
+	t.Run("frames are stored with their time", func(t *testing.T) {
+		mockRepo, videoService := newVideoService(config.Default().Videos)
+		path := writeFile("clip.mp4", "VIDEO clip")
+		id, err := videoService.AddVideoFile(ctx, path)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		video, err := videoService.GetVideoById(ctx, id)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if video.SourceUrl != utils.FileUrl(path) || len(video.Frames) != 3 {
+			t.Fatalf("Video = %+v, want 3 frames of %s", video, utils.FileUrl(path))
+		}
+		for i, want := range []float64{0.5, 5.5, 10.5} {
+			frame := video.Frames[i]
+			if *frame.FrameTime != want || *frame.VideoID != id {
+				t.Fatalf("Frame %d is at %v of video %d, want %v of video %d", i, *frame.FrameTime, *frame.VideoID, want, id)
+			}
+		}
+		if video.Frames[1].SourceUrl != utils.FileUrl(path)+"#t=5.5" {
+			t.Fatalf("Frame url = %s", video.Frames[1].SourceUrl)
+		}
+
+		// Searches find the frames, which point at their video
+		results, err := videoService.imageService.GetImagesSimilarToText(ctx, "clip", 0, 10)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(results) != 3 || results[0].VideoID == nil || *results[0].VideoID != id {
+			t.Fatalf("Search results = %+v, want the frames of video %d", results, id)
+		}
+
+		if _, err := videoService.AddVideoFile(ctx, path); err != VideoExistsError {
+			t.Fatalf("Expected VideoExistsError, got %v", err)
+		}
+
+		if err := videoService.DeleteVideoById(ctx, id); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if count, _ := mockRepo.Count(ctx); count != 0 {
+			t.Fatalf("Expected the frames to be deleted, %d images are left", count)
+		}
+		if err := videoService.DeleteVideoById(ctx, id); err != repositories.VideoNotFoundError {
+			t.Fatalf("Expected VideoNotFoundError, got %v", err)
+		}
+	})
+
+	t.Run("scene changes", func(t *testing.T) {
+		videoConfig := config.Default().Videos
+		videoConfig.FrameMode = config.VIDEO_FRAME_MODE_SCENE
+		videoConfig.SceneThreshold = 0.4
+		videoConfig.MaxFrames = 20
+		_, videoService := newVideoService(videoConfig)
+		if _, err := videoService.AddVideoFile(ctx, writeFile("scenes.mp4", "VIDEO scenes")); err != nil {
+			t.Fatalf(err.Error())
+		}
+		args, err := os.ReadFile(filepath.Join(dir, "args"))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, want := range []string{"select='isnan(prev_selected_t)+gt(scene,0.4)',showinfo", "-frames:v\n20\n"} {
+			if !strings.Contains(string(args), want) {
+				t.Fatalf("ffmpeg was run with %q, want %q in it", args, want)
+			}
+		}
+	})
+
+	t.Run("only local container files are read", func(t *testing.T) {
+		_, videoService := newVideoService(config.Default().Videos)
+		if _, err := videoService.AddVideoFile(ctx, writeFile("local.mp4", "VIDEO local")); err != nil {
+			t.Fatalf(err.Error())
+		}
+		args, err := os.ReadFile(filepath.Join(dir, "args"))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		input := strings.Index(string(args), "-i\n")
+		for _, want := range []string{"-protocol_whitelist\nfile\n", "-format_whitelist\n" + videoFormatWhitelist + "\n"} {
+			if at := strings.Index(string(args), want); at < 0 || at > input {
+				t.Fatalf("ffmpeg was run with %q, want %q before the input", args, want)
+			}
+		}
+	})
+
+	t.Run("unreadable videos", func(t *testing.T) {
+		_, videoService := newVideoService(config.Default().Videos)
+		_, err := videoService.AddVideoFile(ctx, writeFile("notes.txt", "not a video"))
+		if !errors.Is(err, UnreadableVideoError) {
+			t.Fatalf("Expected UnreadableVideoError, got %v", err)
+		}
+	})
+
+	t.Run("urls", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write([]byte("VIDEO from the web"))
+		}))
+		defer server.Close()
+
+		videoConfig := config.Default().Videos
+		videoConfig.MaxFileSize = 10
+		_, videoService := newVideoService(videoConfig)
+		if _, err := videoService.AddVideoByURL(ctx, server.URL+"/clip.mp4"); err != utils.FileSizeExceededError {
+			t.Fatalf("Expected FileSizeExceededError, got %v", err)
+		}
+
+		_, videoService = newVideoService(config.Default().Videos)
+		id, err := videoService.AddVideoByURL(ctx, server.URL+"/clip.mp4#intro")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		video, err := videoService.GetVideoById(ctx, id)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if video.Frames[0].SourceUrl != server.URL+"/clip.mp4#t=0.5" {
+			t.Fatalf("Frame url = %s, want the video url without its fragment", video.Frames[0].SourceUrl)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Runs background jobs and stops them on shutdown
+// Jobs receive a context that is cancelled when shutdown starts and should return soon after
+type Workers struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mutex   sync.Mutex
+	stopped bool
+}
+
+func NewWorkers() *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{ctx: ctx, cancel: cancel}
+}
+
+// Starts job in a new goroutine. Jobs started after Shutdown are not run
+func (w *Workers) Go(name string, job func(ctx context.Context)) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stopped {
+		slog.Warn("Not starting background job during shutdown", "job", name)
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		job(w.ctx)
+		slog.Debug("Background job finished", "job", name)
+	}()
+}
+
+// Cancels the running jobs and waits for them to return
+// Returns ctx.Err() if ctx is done before all jobs returned
+func (w *Workers) Shutdown(ctx context.Context) error {
+	w.mutex.Lock()
+	w.stopped = true
+	w.mutex.Unlock()
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
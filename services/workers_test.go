@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkers(t *testing.T) {
+	t.Run("shutdown should wait for jobs", func(t *testing.T) {
+		workers := NewWorkers()
+		var finished atomic.Int32
+		for i := 0; i < 3; i++ {
+			workers.Go("test", func(ctx context.Context) {
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+				finished.Add(1)
+			})
+		}
+
+		if err := workers.Shutdown(context.Background()); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if finished.Load() != 3 {
+			t.Fatalf("Finished jobs = %d, want = 3", finished.Load())
+		}
+	})
+
+	t.Run("shutdown should give up at the deadline", func(t *testing.T) {
+		workers := NewWorkers()
+		unblock := make(chan struct{})
+		defer close(unblock)
+		workers.Go("stuck", func(ctx context.Context) {
+			<-unblock
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := workers.Shutdown(ctx); err != context.DeadlineExceeded {
+			t.Fatalf("Shutdown error = %v, want = %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("jobs started after shutdown shouldn't run", func(t *testing.T) {
+		workers := NewWorkers()
+		if err := workers.Shutdown(context.Background()); err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		ran := false
+		workers.Go("late", func(ctx context.Context) {
+			ran = true
+		})
+		if err := workers.Shutdown(context.Background()); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if ran {
+			t.Fatalf("Job started after shutdown was run")
+		}
+	})
+}
@@ -1,31 +1,321 @@
 package services
 
+import (
+	"bytes"
+	"clipsearch/metrics"
+	"clipsearch/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/zeromq/goczmq"
+)
+
+// Returns how long a daemon call may block in milliseconds, the time left until the deadline of ctx
+// or timeout, whichever is shorter
+func zmqTimeoutMs(ctx context.Context, timeout time.Duration) int {
+	timeoutMs := int(timeout.Milliseconds())
+	if deadline, ok := ctx.Deadline(); ok {
+		// Rounded up, so that the socket doesn't time out before the deadline passes
+		left := int((time.Until(deadline) + time.Millisecond - 1).Milliseconds())
+		if left < 1 {
+			left = 1
+		}
+		if left < timeoutMs {
+			timeoutMs = left
+		}
+	}
+	return timeoutMs
+}
+
+// Returns the error of ctx if it was cancelled or its deadline passed, which may be before its Done channel is closed
+func callerError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// The error a call to an endpoint is released with: nil if the call was cut short by its caller, since the deadline
+// of ctx shortens the daemon timeout. Only the endpoints that didn't answer within the timeout of the service are taken out
+func endpointError(ctx context.Context, err error) error {
+	if callerError(ctx) != nil {
+		return nil
+	}
+	return err
+}
+
+// Records the latency and outcome of a daemon call in the metrics and the log
+func observeClipCall(ctx context.Context, daemon string, start time.Time, err error) {
+	metrics.ObserveClipCall(daemon, start, err)
+	if err != nil {
+		slog.WarnContext(ctx, "Embedding daemon call failed", "daemon", daemon, "duration", time.Since(start), "error", err)
+	} else {
+		slog.DebugContext(ctx, "Embedding daemon call", "daemon", daemon, "duration", time.Since(start))
+	}
+}
+
+// The first frame of a request to a daemon names its operation: "encode" is followed by a frame with
+// the image or the text, "info" asks for the model the daemon runs
+const zmqEncodeOp = "encode"
+const zmqInfoOp = "info"
+
+// Sends a request for op with the payload frames and returns the response, a JSend JSON string
+func zmqRequest(sock *goczmq.Sock, op string, payload ...[]byte) ([]byte, error) {
+	frames := append([][]byte{[]byte(op)}, payload...)
+	for i, frame := range frames {
+		flag := goczmq.FlagNone
+		if i < len(frames)-1 {
+			flag = goczmq.FlagMore
+		}
+		if err := sock.SendFrame(frame, flag); err != nil {
+			return nil, fmt.Errorf("%w: %v", DaemonUnreachableError, err)
+		}
+	}
+	rawResponse, err := sock.RecvMessage()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", DaemonUnreachableError, err)
+	}
+	if len(rawResponse) == 0 || len(rawResponse[0]) == 0 {
+		return nil, fmt.Errorf("The daemon sent an empty response")
+	}
+	return rawResponse[0], nil
+}
+
+func requestZmqModelInfo(sock *goczmq.Sock) (models.EmbeddingModel, error) {
+	rawResponse, err := zmqRequest(sock, zmqInfoOp)
+	if err != nil {
+		return models.EmbeddingModel{}, err
+	}
+
+	response := struct {
+		Status  string
+		Message string
+		Data    models.EmbeddingModel
+	}{}
+
+	if err := json.Unmarshal(rawResponse, &response); err != nil {
+		return models.EmbeddingModel{}, fmt.Errorf("The daemon doesn't report its model: %w", err)
+	}
+
+	if response.Status != "success" {
+		if response.Status == "error" {
+			return models.EmbeddingModel{}, fmt.Errorf("Failed to get model info: %s", response.Message)
+		} else {
+			return models.EmbeddingModel{}, fmt.Errorf("Unexpected response format")
+		}
+	}
+	if response.Data.Name == "" || response.Data.Dimension <= 0 {
+		return models.EmbeddingModel{}, fmt.Errorf("The daemon doesn't report its model")
+	}
+
+	return response.Data, nil
+}
+
+var ClipServiceClosedError = errors.New("Clip service was closed")
+var DaemonModelsDifferError = errors.New("The image and text embedding daemons run different models")
+var EmptyInputError = errors.New("There is nothing to encode")
+
 type ZmqClipService struct {
-	imageEmbeddingEndpoints string
-	textEmbeddingEndpoints  string
+	imageEndpoints *zmqEndpointPool
+	textEndpoints  *zmqEndpointPool
+	timeout        time.Duration
+
+	mutex    sync.Mutex
+	closed   bool
+	inFlight sync.WaitGroup
 }
 
-func NewZmqClipService(imageEmbeddingEndpoints string, textEmbeddingEndpoints string) *ZmqClipService {
+// Calls are distributed across the given endpoints of each daemon
+// Daemon calls fail after timeout, or earlier if the deadline of their context passes
+func NewZmqClipService(imageEmbeddingEndpoints []string, textEmbeddingEndpoints []string, timeout time.Duration) *ZmqClipService {
 	return &ZmqClipService{
-		imageEmbeddingEndpoints: imageEmbeddingEndpoints,
-		textEmbeddingEndpoints:  textEmbeddingEndpoints,
+		imageEndpoints: newZmqEndpointPool("image", imageEmbeddingEndpoints),
+		textEndpoints:  newZmqEndpointPool("text", textEmbeddingEndpoints),
+		timeout:        timeout,
 	}
 }
 
-func (zcs *ZmqClipService) EncodeImage(imageData []byte) ([]float32, error) {
-	conn, err := ConnectToZmqImageEmbeddingDaemon(zcs.imageEmbeddingEndpoints)
+func (zcs *ZmqClipService) EncodeImage(ctx context.Context, imageData []byte) ([]float32, error) {
+	if len(imageData) == 0 {
+		return nil, EmptyInputError
+	}
+	start := time.Now()
+	endpoint := zcs.imageEndpoints.acquire()
+	embedding, err := zcs.encodeImageAt(ctx, endpoint.address, imageData)
+	zcs.imageEndpoints.release(endpoint, endpointError(ctx, err))
+	observeClipCall(ctx, "image", start, err)
+	return embedding, err
+}
+
+func (zcs *ZmqClipService) encodeImageAt(ctx context.Context, address string, imageData []byte) ([]float32, error) {
+	var embedding []float32
+	err := zcs.withImageConnection(ctx, address, func(conn *ZmqImageEmbeddingDaemonConnection) (err error) {
+		embedding, err = conn.EncodeImage(imageData)
+		return err
+	})
+	return embedding, err
+}
+
+// Runs call on a connection to the daemon at address
+func (zcs *ZmqClipService) withImageConnection(ctx context.Context, address string, call func(conn *ZmqImageEmbeddingDaemonConnection) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := zcs.acquire(); err != nil {
+		return err
+	}
+	defer zcs.inFlight.Done()
+	conn, err := ConnectToZmqImageEmbeddingDaemon(ctx, address, zcs.timeout)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer conn.Close()
-	return conn.EncodeImage(imageData)
+	err = call(conn)
+	if err != nil {
+		if ctxErr := callerError(ctx); ctxErr != nil {
+			// The socket timed out because the deadline of the request passed
+			return ctxErr
+		}
+	}
+	return err
+}
+
+func (zcs *ZmqClipService) EncodeText(ctx context.Context, text string) ([]float32, error) {
+	if text == "" {
+		return nil, EmptyInputError
+	}
+	start := time.Now()
+	endpoint := zcs.textEndpoints.acquire()
+	embedding, err := zcs.encodeTextAt(ctx, endpoint.address, text)
+	zcs.textEndpoints.release(endpoint, endpointError(ctx, err))
+	observeClipCall(ctx, "text", start, err)
+	return embedding, err
+}
+
+func (zcs *ZmqClipService) encodeTextAt(ctx context.Context, address string, text string) ([]float32, error) {
+	var embedding []float32
+	err := zcs.withTextConnection(ctx, address, func(conn *ZmqTextEmbeddingDaemonConnection) (err error) {
+		embedding, err = conn.EncodeText(text)
+		return err
+	})
+	return embedding, err
 }
 
-func (zcs *ZmqClipService) EncodeText(text string) ([]float32, error) {
-	conn, err := ConnectToZmqTextEmbeddingDaemon(zcs.textEmbeddingEndpoints)
+// Runs call on a connection to the daemon at address
+func (zcs *ZmqClipService) withTextConnection(ctx context.Context, address string, call func(conn *ZmqTextEmbeddingDaemonConnection) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := zcs.acquire(); err != nil {
+		return err
+	}
+	defer zcs.inFlight.Done()
+	conn, err := ConnectToZmqTextEmbeddingDaemon(ctx, address, zcs.timeout)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer conn.Close()
-	return conn.EncodeText(text)
+	err = call(conn)
+	if err != nil {
+		if ctxErr := callerError(ctx); ctxErr != nil {
+			// The socket timed out because the deadline of the request passed
+			return ctxErr
+		}
+	}
+	return err
+}
+
+// Asks a text and an image daemon for their model, which must be the same
+func (zcs *ZmqClipService) ModelInfo(ctx context.Context) (models.EmbeddingModel, error) {
+	var textModel, imageModel models.EmbeddingModel
+
+	endpoint := zcs.textEndpoints.acquire()
+	err := zcs.withTextConnection(ctx, endpoint.address, func(conn *ZmqTextEmbeddingDaemonConnection) (err error) {
+		textModel, err = conn.ModelInfo()
+		return err
+	})
+	zcs.textEndpoints.release(endpoint, endpointError(ctx, err))
+	if err != nil {
+		return models.EmbeddingModel{}, err
+	}
+
+	endpoint = zcs.imageEndpoints.acquire()
+	err = zcs.withImageConnection(ctx, endpoint.address, func(conn *ZmqImageEmbeddingDaemonConnection) (err error) {
+		imageModel, err = conn.ModelInfo()
+		return err
+	})
+	zcs.imageEndpoints.release(endpoint, endpointError(ctx, err))
+	if err != nil {
+		return models.EmbeddingModel{}, err
+	}
+
+	if textModel != imageModel {
+		return models.EmbeddingModel{}, fmt.Errorf("%w: %s and %s", DaemonModelsDifferError, imageModel.Name, textModel.Name)
+	}
+	return textModel, nil
+}
+
+func encodeTinyPng() []byte {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	return buf.Bytes()
+}
+
+var tinyPng = encodeTinyPng()
+
+// Sends a minimal request to every unhealthy endpoint and re-admits the ones that answer
+func (zcs *ZmqClipService) probeUnhealthyEndpoints(ctx context.Context) {
+	for _, address := range zcs.imageEndpoints.unhealthyAddresses() {
+		if _, err := zcs.encodeImageAt(ctx, address, tinyPng); err == nil {
+			zcs.imageEndpoints.markHealthy(address)
+		}
+	}
+	for _, address := range zcs.textEndpoints.unhealthyAddresses() {
+		if _, err := zcs.encodeTextAt(ctx, address, "ping"); err == nil {
+			zcs.textEndpoints.markHealthy(address)
+		}
+	}
+}
+
+// Probes the unhealthy endpoints every interval until ctx is done. Meant to be run as a background job
+func (zcs *ZmqClipService) RunProbes(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			zcs.probeUnhealthyEndpoints(ctx)
+		}
+	}
+}
+
+// Registers an in-flight call, failing if the service was closed
+func (zcs *ZmqClipService) acquire() error {
+	zcs.mutex.Lock()
+	defer zcs.mutex.Unlock()
+	if zcs.closed {
+		return ClipServiceClosedError
+	}
+	zcs.inFlight.Add(1)
+	return nil
+}
+
+// Rejects new calls and waits for the in-flight ones to finish and close their sockets
+func (zcs *ZmqClipService) Close() {
+	zcs.mutex.Lock()
+	zcs.closed = true
+	zcs.mutex.Unlock()
+	zcs.inFlight.Wait()
 }
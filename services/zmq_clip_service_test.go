@@ -0,0 +1,176 @@
+package services
+
+import (
+	"clipsearch/config"
+	"clipsearch/fakeclip"
+	"clipsearch/repositories"
+	"context"
+	"image/color"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startFakeDaemons(t *testing.T) (*fakeclip.ZmqDaemon, *fakeclip.ZmqDaemon) {
+	imageDaemon, err := fakeclip.StartZmqImageDaemon("tcp://127.0.0.1:*")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	t.Cleanup(imageDaemon.Close)
+	textDaemon, err := fakeclip.StartZmqTextDaemon("tcp://127.0.0.1:*")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	t.Cleanup(textDaemon.Close)
+	return imageDaemon, textDaemon
+}
+
+// Returns an endpoint nothing is listening on
+func unusedEndpoint(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	port := lis.Addr().(*net.TCPAddr).Port
+	lis.Close()
+	return "tcp://127.0.0.1:" + strconv.Itoa(port)
+}
+
+func TestZmqClipService(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("protocol", func(t *testing.T) {
+		imageDaemon, textDaemon := startFakeDaemons(t)
+		clip := NewZmqClipService([]string{imageDaemon.Endpoint}, []string{textDaemon.Endpoint}, 5*time.Second)
+		defer clip.Close()
+
+		embedding, err := clip.EncodeText(ctx, "a red car")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(embedding) != fakeclip.Dimension || embedding[0] != fakeclip.EmbedText("a red car")[0] {
+			t.Fatalf("Embedding differs from the one of the daemon")
+		}
+
+		if _, err := clip.EncodeImage(ctx, fakeclip.SolidColorPng(color.White)); err != nil {
+			t.Fatalf(err.Error())
+		}
+		_, err = clip.EncodeImage(ctx, []byte("not an image"))
+		if err == nil || !strings.Contains(err.Error(), "Failed to process image") {
+			t.Fatalf("EncodeImage error = %v, want the error of the daemon", err)
+		}
+
+		model, err := clip.ModelInfo(ctx)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if model.Name != fakeclip.ModelName || model.Dimension != fakeclip.Dimension {
+			t.Fatalf("Model info = %v, want = %s %d", model, fakeclip.ModelName, fakeclip.Dimension)
+		}
+	})
+
+	t.Run("empty input", func(t *testing.T) {
+		clip := NewZmqClipService([]string{unusedEndpoint(t)}, []string{unusedEndpoint(t)}, 5*time.Second)
+		defer clip.Close()
+
+		if _, err := clip.EncodeText(ctx, ""); err != EmptyInputError {
+			t.Fatalf("EncodeText error = %v, want = %v", err, EmptyInputError)
+		}
+		if _, err := clip.EncodeImage(ctx, nil); err != EmptyInputError {
+			t.Fatalf("EncodeImage error = %v, want = %v", err, EmptyInputError)
+		}
+		// Never sent, so the endpoints aren't blamed
+		if unhealthy := append(clip.textEndpoints.unhealthyAddresses(), clip.imageEndpoints.unhealthyAddresses()...); len(unhealthy) != 0 {
+			t.Fatalf("Unhealthy endpoints = %v, want none", unhealthy)
+		}
+	})
+
+	t.Run("unresponsive endpoints", func(t *testing.T) {
+		imageDaemon, textDaemon := startFakeDaemons(t)
+		deadEndpoint := unusedEndpoint(t)
+		clip := NewZmqClipService([]string{imageDaemon.Endpoint}, []string{deadEndpoint, textDaemon.Endpoint}, 200*time.Millisecond)
+		defer clip.Close()
+
+		// The first call goes to the dead endpoint and takes it out
+		if _, err := clip.EncodeText(ctx, "a cat"); err == nil {
+			t.Fatalf("Expected the call to the dead endpoint to fail")
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := clip.EncodeText(ctx, "a cat"); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+
+		revivedDaemon, err := fakeclip.StartZmqTextDaemon(deadEndpoint)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		defer revivedDaemon.Close()
+		clip.probeUnhealthyEndpoints(ctx)
+		if unhealthy := clip.textEndpoints.unhealthyAddresses(); len(unhealthy) != 0 {
+			t.Fatalf("Unhealthy endpoints after probing = %v, want none", unhealthy)
+		}
+	})
+
+	t.Run("calls cut short by the caller", func(t *testing.T) {
+		deadEndpoint := unusedEndpoint(t)
+		clip := NewZmqClipService([]string{deadEndpoint}, []string{deadEndpoint}, time.Second)
+		defer clip.Close()
+
+		shortCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := clip.EncodeText(shortCtx, "a cat"); err == nil {
+			t.Fatalf("Expected the call to the dead endpoint to fail")
+		}
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := clip.EncodeImage(cancelledCtx, tinyPng); err == nil {
+			t.Fatalf("Expected the call with a cancelled context to fail")
+		}
+		if unhealthy := append(clip.textEndpoints.unhealthyAddresses(), clip.imageEndpoints.unhealthyAddresses()...); len(unhealthy) != 0 {
+			t.Fatalf("Unhealthy endpoints = %v, want none", unhealthy)
+		}
+	})
+
+	t.Run("search ordering end-to-end", func(t *testing.T) {
+		imageDaemon, textDaemon := startFakeDaemons(t)
+		clip := NewZmqClipService([]string{imageDaemon.Endpoint}, []string{textDaemon.Endpoint}, 5*time.Second)
+		defer clip.Close()
+
+		images := map[string][]byte{
+			"/red":      fakeclip.SolidColorPng(color.RGBA{R: 255, A: 255}),
+			"/darkred":  fakeclip.SolidColorPng(color.RGBA{R: 160, G: 10, B: 10, A: 255}),
+			"/green":    fakeclip.SolidColorPng(color.RGBA{G: 255, A: 255}),
+			"/blue":     fakeclip.SolidColorPng(color.RGBA{B: 255, A: 255}),
+			"/darkblue": fakeclip.SolidColorPng(color.RGBA{B: 120, A: 255}),
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write(images[req.URL.Path])
+		}))
+		defer server.Close()
+
+		imageService := NewImageService(repositories.NewMockImageRepository(), clip, config.Default().Images)
+		for _, path := range []string{"/blue", "/red", "/green", "/darkblue", "/darkred"} {
+			if err := imageService.AddImageByURL(ctx, server.URL+path, ""); err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+
+		query := CompositeQuery{Images: []WeightedImageData{{Data: fakeclip.SolidColorPng(color.RGBA{R: 220, A: 255}), Weight: 1}}}
+		results, _, err := imageService.GetImagesSimilarToCompositeQuery(ctx, "", query, SearchPage{Limit: 5})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var order []string
+		for _, image := range results {
+			order = append(order, strings.TrimPrefix(image.SourceUrl, server.URL))
+		}
+		if len(order) != 5 || order[0] != "/red" || order[1] != "/darkred" || order[4] != "/blue" && order[4] != "/darkblue" {
+			t.Fatalf("Results for a red query = %v, want red images first and blue ones last", order)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"clipsearch/metrics"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// Returned by the daemon connections when a daemon didn't answer in time or couldn't be reached
+var DaemonUnreachableError = errors.New("Embedding daemon didn't respond")
+
+type zmqEndpoint struct {
+	address     string
+	outstanding int
+	healthy     bool
+}
+
+// Distributes calls across the endpoints of one kind of embedding daemon
+// Endpoints that don't respond are taken out until a probe succeeds
+type zmqEndpointPool struct {
+	daemon    string
+	mutex     sync.Mutex
+	endpoints []*zmqEndpoint
+	next      int
+}
+
+func newZmqEndpointPool(daemon string, addresses []string) *zmqEndpointPool {
+	pool := &zmqEndpointPool{daemon: daemon}
+	for _, address := range addresses {
+		pool.endpoints = append(pool.endpoints, &zmqEndpoint{address: address, healthy: true})
+		metrics.SetEmbeddingDaemonEndpointHealthy(daemon, address, true)
+	}
+	return pool
+}
+
+// Picks the healthy endpoint with the fewest outstanding calls, going round-robin between ties
+// If every endpoint is unhealthy, all of them are considered so requests aren't failed outright
+// release must be called with the result once the call is done
+func (p *zmqEndpointPool) acquire() *zmqEndpoint {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var picked *zmqEndpoint
+	for _, onlyHealthy := range []bool{true, false} {
+		for i := range p.endpoints {
+			endpoint := p.endpoints[(p.next+i)%len(p.endpoints)]
+			if onlyHealthy && !endpoint.healthy {
+				continue
+			}
+			if picked == nil || endpoint.outstanding < picked.outstanding {
+				picked = endpoint
+			}
+		}
+		if picked != nil {
+			break
+		}
+	}
+	p.next = (p.next + 1) % len(p.endpoints)
+	picked.outstanding++
+	return picked
+}
+
+// Ends a call to endpoint, taking the endpoint out if the daemon didn't respond.
+// err must be nil if the call was cut short by its caller, see endpointError
+func (p *zmqEndpointPool) release(endpoint *zmqEndpoint, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	endpoint.outstanding--
+	if errors.Is(err, DaemonUnreachableError) && endpoint.healthy {
+		endpoint.healthy = false
+		metrics.SetEmbeddingDaemonEndpointHealthy(p.daemon, endpoint.address, false)
+		slog.Warn("Embedding daemon endpoint marked unhealthy", "daemon", p.daemon, "endpoint", endpoint.address, "error", err)
+	}
+}
+
+func (p *zmqEndpointPool) unhealthyAddresses() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var addresses []string
+	for _, endpoint := range p.endpoints {
+		if !endpoint.healthy {
+			addresses = append(addresses, endpoint.address)
+		}
+	}
+	return addresses
+}
+
+func (p *zmqEndpointPool) markHealthy(address string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, endpoint := range p.endpoints {
+		if endpoint.address == address && !endpoint.healthy {
+			endpoint.healthy = true
+			metrics.SetEmbeddingDaemonEndpointHealthy(p.daemon, address, true)
+			slog.Info("Embedding daemon endpoint is healthy again", "daemon", p.daemon, "endpoint", address)
+		}
+	}
+}
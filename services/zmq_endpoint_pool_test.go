@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestZmqEndpointPool(t *testing.T) {
+	t.Run("round-robin between idle endpoints", func(t *testing.T) {
+		pool := newZmqEndpointPool("test", []string{"a", "b", "c"})
+		var picked []string
+		for i := 0; i < 6; i++ {
+			endpoint := pool.acquire()
+			picked = append(picked, endpoint.address)
+			pool.release(endpoint, nil)
+		}
+		if fmt.Sprint(picked) != "[a b c a b c]" {
+			t.Fatalf("Picked endpoints = %v, want = [a b c a b c]", picked)
+		}
+	})
+
+	t.Run("least outstanding calls", func(t *testing.T) {
+		pool := newZmqEndpointPool("test", []string{"a", "b"})
+		first := pool.acquire()
+		second := pool.acquire()
+		pool.release(first, nil)
+		// second is still busy, so first should be picked regardless of the round-robin order
+		for i := 0; i < 2; i++ {
+			endpoint := pool.acquire()
+			if endpoint != first {
+				t.Fatalf("Picked endpoint = %s, want = %s", endpoint.address, first.address)
+			}
+			pool.release(endpoint, nil)
+		}
+		pool.release(second, nil)
+	})
+
+	t.Run("unresponsive endpoints are skipped until re-admitted", func(t *testing.T) {
+		pool := newZmqEndpointPool("test", []string{"a", "b"})
+		endpoint := pool.acquire()
+		pool.release(endpoint, fmt.Errorf("%w: timed out", DaemonUnreachableError))
+		if fmt.Sprint(pool.unhealthyAddresses()) != "[a]" {
+			t.Fatalf("Unhealthy endpoints = %v, want = [a]", pool.unhealthyAddresses())
+		}
+		for i := 0; i < 3; i++ {
+			endpoint := pool.acquire()
+			if endpoint.address != "b" {
+				t.Fatalf("Picked endpoint = %s, want = b", endpoint.address)
+			}
+			pool.release(endpoint, nil)
+		}
+
+		pool.markHealthy("a")
+		if len(pool.unhealthyAddresses()) != 0 {
+			t.Fatalf("Unhealthy endpoints = %v, want none", pool.unhealthyAddresses())
+		}
+	})
+
+	t.Run("daemon errors don't make an endpoint unhealthy", func(t *testing.T) {
+		pool := newZmqEndpointPool("test", []string{"a"})
+		endpoint := pool.acquire()
+		pool.release(endpoint, errors.New("Failed to process image"))
+		if len(pool.unhealthyAddresses()) != 0 {
+			t.Fatalf("Unhealthy endpoints = %v, want none", pool.unhealthyAddresses())
+		}
+	})
+
+	t.Run("calls cut short by the caller don't make an endpoint unhealthy", func(t *testing.T) {
+		pool := newZmqEndpointPool("test", []string{"a"})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		endpoint := pool.acquire()
+		pool.release(endpoint, endpointError(ctx, fmt.Errorf("%w: timed out", DaemonUnreachableError)))
+		if len(pool.unhealthyAddresses()) != 0 {
+			t.Fatalf("Unhealthy endpoints = %v, want none", pool.unhealthyAddresses())
+		}
+
+		endpoint = pool.acquire()
+		pool.release(endpoint, endpointError(context.Background(), fmt.Errorf("%w: timed out", DaemonUnreachableError)))
+		if fmt.Sprint(pool.unhealthyAddresses()) != "[a]" {
+			t.Fatalf("Unhealthy endpoints = %v, want = [a]", pool.unhealthyAddresses())
+		}
+	})
+
+	t.Run("all endpoints unhealthy", func(t *testing.T) {
+		pool := newZmqEndpointPool("test", []string{"a"})
+		endpoint := pool.acquire()
+		pool.release(endpoint, DaemonUnreachableError)
+		endpoint = pool.acquire()
+		if endpoint.address != "a" {
+			t.Fatalf("Picked endpoint = %s, want = a", endpoint.address)
+		}
+		pool.release(endpoint, nil)
+	})
+}
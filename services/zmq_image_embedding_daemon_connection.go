@@ -1,8 +1,11 @@
 package services
 
 import (
+	"clipsearch/models"
+	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/zeromq/goczmq"
 )
@@ -11,21 +14,21 @@ type ZmqImageEmbeddingDaemonConnection struct {
 	sock *goczmq.Sock
 }
 
-func ConnectToZmqImageEmbeddingDaemon(endpoints string) (*ZmqImageEmbeddingDaemonConnection, error) {
+// The send and receive timeouts of the connection are the deadline of ctx or timeout, whichever comes first
+func ConnectToZmqImageEmbeddingDaemon(ctx context.Context, endpoints string, timeout time.Duration) (*ZmqImageEmbeddingDaemonConnection, error) {
 	if sock, err := goczmq.NewReq(endpoints); err != nil {
 		return nil, err
 	} else {
+		timeoutMs := zmqTimeoutMs(ctx, timeout)
+		sock.SetRcvtimeo(timeoutMs)
+		sock.SetSndtimeo(timeoutMs)
+		sock.SetLinger(0)
 		return &ZmqImageEmbeddingDaemonConnection{sock: sock}, nil
 	}
 }
 
 func (conn *ZmqImageEmbeddingDaemonConnection) EncodeImage(imageData []byte) ([]float32, error) {
-	err := conn.sock.SendFrame(imageData, goczmq.FlagNone)
-	if err != nil {
-		return nil, err
-	}
-
-	rawResponse, err := conn.sock.RecvMessage()
+	rawResponse, err := zmqRequest(conn.sock, zmqEncodeOp, imageData)
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +39,7 @@ func (conn *ZmqImageEmbeddingDaemonConnection) EncodeImage(imageData []byte) ([]
 		Data    []float32
 	}{}
 
-	if err := json.Unmarshal(rawResponse[0], &response); err != nil {
+	if err := json.Unmarshal(rawResponse, &response); err != nil {
 		return nil, err
 	}
 
@@ -51,6 +54,10 @@ func (conn *ZmqImageEmbeddingDaemonConnection) EncodeImage(imageData []byte) ([]
 	return response.Data, nil
 }
 
+func (conn *ZmqImageEmbeddingDaemonConnection) ModelInfo() (models.EmbeddingModel, error) {
+	return requestZmqModelInfo(conn.sock)
+}
+
 func (conn *ZmqImageEmbeddingDaemonConnection) Close() {
 	conn.sock.Destroy()
 }
@@ -1,8 +1,11 @@
 package services
 
 import (
+	"clipsearch/models"
+	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/zeromq/goczmq"
 )
@@ -11,20 +14,21 @@ type ZmqTextEmbeddingDaemonConnection struct {
 	sock *goczmq.Sock
 }
 
-func ConnectToZmqTextEmbeddingDaemon(endpoints string) (*ZmqTextEmbeddingDaemonConnection, error) {
+// The send and receive timeouts of the connection are the deadline of ctx or timeout, whichever comes first
+func ConnectToZmqTextEmbeddingDaemon(ctx context.Context, endpoints string, timeout time.Duration) (*ZmqTextEmbeddingDaemonConnection, error) {
 	if sock, err := goczmq.NewReq(endpoints); err != nil {
 		return nil, err
 	} else {
+		timeoutMs := zmqTimeoutMs(ctx, timeout)
+		sock.SetRcvtimeo(timeoutMs)
+		sock.SetSndtimeo(timeoutMs)
+		sock.SetLinger(0)
 		return &ZmqTextEmbeddingDaemonConnection{sock: sock}, nil
 	}
 }
 
 func (conn *ZmqTextEmbeddingDaemonConnection) EncodeText(text string) ([]float32, error) {
-	err := conn.sock.SendFrame([]byte(text), goczmq.FlagNone)
-	if err != nil {
-		return nil, err
-	}
-	rawResponse, err := conn.sock.RecvMessage()
+	rawResponse, err := zmqRequest(conn.sock, zmqEncodeOp, []byte(text))
 	if err != nil {
 		return nil, err
 	}
@@ -35,7 +39,7 @@ func (conn *ZmqTextEmbeddingDaemonConnection) EncodeText(text string) ([]float32
 		Data    []float32
 	}{}
 
-	if err := json.Unmarshal(rawResponse[0], &response); err != nil {
+	if err := json.Unmarshal(rawResponse, &response); err != nil {
 		return nil, err
 	}
 
@@ -50,6 +54,10 @@ func (conn *ZmqTextEmbeddingDaemonConnection) EncodeText(text string) ([]float32
 	return response.Data, nil
 }
 
+func (conn *ZmqTextEmbeddingDaemonConnection) ModelInfo() (models.EmbeddingModel, error) {
+	return requestZmqModelInfo(conn.sock)
+}
+
 func (conn *ZmqTextEmbeddingDaemonConnection) Close() {
 	conn.sock.Destroy()
 }
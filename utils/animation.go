@@ -0,0 +1,498 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+
+	"golang.org/x/image/webp"
+)
+
+var CorruptAnimationError = errors.New("The animation is corrupt")
+var AnimationTooLargeError = errors.New("The animation is too large to decode")
+
+// The largest canvas of an animation that is decoded, in pixels. Frames are composited on a canvas of 4 bytes per pixel
+const MaxAnimationPixels = 4096 * 4096
+
+// The most frames an animation that is decoded may have
+const MaxAnimationFrames = 1000
+
+// The most pixels all the frames of an animation that is decoded may cover together, since every frame up to the
+// last sampled one is decoded. A few bytes of a GIF frame can claim the whole canvas
+const MaxAnimationFramePixels = 8 * MaxAnimationPixels
+
+// How a frame is cleared once it was shown
+type frameDisposal int
+
+const (
+	disposeNone frameDisposal = iota
+	// Clears the area of the frame to transparent
+	disposeBackground
+	// Restores the area of the frame to what it was before
+	disposePrevious
+)
+
+// A frame of an animation, decoded lazily since only some are sampled but all have to be composited
+type animationFrame struct {
+	bounds   image.Rectangle
+	disposal frameDisposal
+	// Whether the frame replaces the area it covers instead of being drawn over it
+	replace bool
+	decode  func() (image.Image, error)
+}
+
+// Samples count frames of the animated GIF, APNG or WebP in data, spread evenly from the first frame to the last,
+// and returns them as PNG files, composited the way viewers show them. Returns nil if data is not an animation
+// with more than one frame
+func SampleAnimationFrames(data []byte, count int) ([][]byte, error) {
+	var width, height int
+	var frames []animationFrame
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		width, height, frames, err = gifFrames(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		width, height, frames, err = apngFrames(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		width, height, frames, err = webpFrames(data)
+	}
+	if err != nil || len(frames) < 2 || count < 1 {
+		return nil, err
+	}
+	if err := checkFramesSize(image.Rect(0, 0, width, height), frames); err != nil {
+		return nil, err
+	}
+
+	sampled := make(map[int]bool, count)
+	for i := 0; i < count; i++ {
+		if count == 1 {
+			sampled[0] = true
+		} else {
+			sampled[i*(len(frames)-1)/(count-1)] = true
+		}
+	}
+	last := 0
+	for i := range sampled {
+		if i > last {
+			last = i
+		}
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	var previous *image.RGBA
+	encoded := make([][]byte, 0, len(sampled))
+	for i, frame := range frames[:last+1] {
+		bounds := frame.bounds.Intersect(canvas.Bounds())
+		if frame.disposal == disposePrevious {
+			previous = image.NewRGBA(bounds)
+			draw.Draw(previous, bounds, canvas, bounds.Min, draw.Src)
+		}
+		img, err := frame.decode()
+		if err != nil {
+			return nil, err
+		}
+		op := draw.Over
+		if frame.replace {
+			op = draw.Src
+		}
+		draw.Draw(canvas, bounds, img, img.Bounds().Min.Add(bounds.Min.Sub(frame.bounds.Min)), op)
+
+		if sampled[i] {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, canvas); err != nil {
+				return nil, err
+			}
+			encoded = append(encoded, buf.Bytes())
+		}
+
+		switch frame.disposal {
+		case disposeBackground:
+			draw.Draw(canvas, bounds, image.Transparent, image.Point{}, draw.Src)
+		case disposePrevious:
+			draw.Draw(canvas, bounds, previous, bounds.Min, draw.Src)
+		}
+	}
+	return encoded, nil
+}
+
+func checkCanvasSize(width int, height int) error {
+	if width <= 0 || height <= 0 {
+		return CorruptAnimationError
+	}
+	if width*height > MaxAnimationPixels {
+		return AnimationTooLargeError
+	}
+	return nil
+}
+
+// Fails with AnimationTooLargeError if there are too many frames or they cover too many pixels together
+func checkFramesSize(canvas image.Rectangle, frames []animationFrame) error {
+	if len(frames) > MaxAnimationFrames {
+		return AnimationTooLargeError
+	}
+	pixels := 0
+	for _, frame := range frames {
+		bounds := frame.bounds.Intersect(canvas)
+		pixels += bounds.Dx() * bounds.Dy()
+		if pixels > MaxAnimationFramePixels {
+			return AnimationTooLargeError
+		}
+	}
+	return nil
+}
+
+// Returns the offset right after the data sub-blocks starting at offset
+func skipGifSubBlocks(data []byte, offset int) (int, error) {
+	for {
+		if offset >= len(data) {
+			return 0, CorruptAnimationError
+		}
+		length := int(data[offset])
+		offset++
+		if length == 0 {
+			return offset, nil
+		}
+		offset += length
+	}
+}
+
+// Splits a GIF into its frames without decoding them, each of which is turned into a GIF of its own with the
+// header, the global palette and the graphic control of the GIF. Stops at MaxAnimationFrames frames, so that
+// a file of tiny frames doesn't make a huge list
+func gifFrames(data []byte) (int, int, []animationFrame, error) {
+	if len(data) < 13 {
+		return 0, 0, nil, CorruptAnimationError
+	}
+	width, height := int(binary.LittleEndian.Uint16(data[6:])), int(binary.LittleEndian.Uint16(data[8:]))
+	if err := checkCanvasSize(width, height); err != nil {
+		return 0, 0, nil, err
+	}
+	offset := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		offset += 3 << (flags&0x07 + 1)
+	}
+	if offset > len(data) {
+		return 0, 0, nil, CorruptAnimationError
+	}
+	header := data[:offset]
+
+	var frames []animationFrame
+	// The graphic control extension of the next frame
+	var control []byte
+	for offset < len(data) {
+		switch data[offset] {
+		case 0x21:
+			if offset+2 > len(data) {
+				return 0, 0, nil, CorruptAnimationError
+			}
+			end, err := skipGifSubBlocks(data, offset+2)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			if data[offset+1] == 0xf9 {
+				if end-offset != 8 {
+					return 0, 0, nil, CorruptAnimationError
+				}
+				control = data[offset:end]
+			}
+			offset = end
+		case 0x2c:
+			if offset+10 > len(data) {
+				return 0, 0, nil, CorruptAnimationError
+			}
+			descriptor := data[offset+1 : offset+10]
+			x, y := int(binary.LittleEndian.Uint16(descriptor[0:])), int(binary.LittleEndian.Uint16(descriptor[2:]))
+			frameWidth, frameHeight := int(binary.LittleEndian.Uint16(descriptor[4:])), int(binary.LittleEndian.Uint16(descriptor[6:]))
+			end := offset + 10
+			if flags := descriptor[8]; flags&0x80 != 0 {
+				end += 3 << (flags&0x07 + 1)
+			}
+			// The minimum code size of the LZW data comes before it
+			end, err := skipGifSubBlocks(data, end+1)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			if len(frames) == MaxAnimationFrames {
+				return 0, 0, nil, AnimationTooLargeError
+			}
+
+			frame := animationFrame{bounds: image.Rect(x, y, x+frameWidth, y+frameHeight)}
+			if control != nil {
+				switch control[3] >> 2 & 0x07 {
+				case gif.DisposalBackground:
+					frame.disposal = disposeBackground
+				case gif.DisposalPrevious:
+					frame.disposal = disposePrevious
+				}
+			}
+			file := make([]byte, 0, len(header)+len(control)+end-offset+1)
+			file = append(file, header...)
+			file = append(file, control...)
+			file = append(file, data[offset:end]...)
+			file = append(file, 0x3b)
+			frame.decode = func() (image.Image, error) {
+				img, err := gif.Decode(bytes.NewReader(file))
+				if err != nil {
+					return nil, CorruptAnimationError
+				}
+				return img, nil
+			}
+			frames = append(frames, frame)
+			control = nil
+			offset = end
+		case 0x3b:
+			return width, height, frames, nil
+		default:
+			return 0, 0, nil, CorruptAnimationError
+		}
+	}
+	// Some encoders leave out the trailer
+	return width, height, frames, nil
+}
+
+// A chunk of a PNG file
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+func readPngChunks(data []byte) ([]pngChunk, error) {
+	chunks := make([]pngChunk, 0, 16)
+	for offset := 8; offset < len(data); {
+		if offset+12 > len(data) {
+			return nil, CorruptAnimationError
+		}
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		if offset+12+length > len(data) {
+			return nil, CorruptAnimationError
+		}
+		chunks = append(chunks, pngChunk{kind: string(data[offset+4 : offset+8]), data: data[offset+8 : offset+8+length]})
+		offset += 12 + length
+	}
+	return chunks, nil
+}
+
+func writePngChunk(buf *bytes.Buffer, kind string, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.WriteString(kind)
+	buf.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
+
+// Splits an APNG into its frames, each of which is turned into a PNG of its own with the header and palette
+// of the APNG. Plain PNGs have no frames
+func apngFrames(data []byte) (int, int, []animationFrame, error) {
+	chunks, err := readPngChunks(data)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if len(chunks) == 0 || chunks[0].kind != "IHDR" || len(chunks[0].data) != 13 {
+		return 0, 0, nil, CorruptAnimationError
+	}
+	header := chunks[0].data
+	width, height := int(binary.BigEndian.Uint32(header[0:])), int(binary.BigEndian.Uint32(header[4:]))
+
+	// The chunks every frame needs, like the palette
+	shared := make([]pngChunk, 0, 4)
+	type apngFrame struct {
+		control []byte
+		data    [][]byte
+	}
+	var frames []*apngFrame
+	var current *apngFrame
+	animated, seenData := false, false
+	for _, chunk := range chunks[1:] {
+		switch chunk.kind {
+		case "acTL":
+			animated = true
+		case "fcTL":
+			if len(chunk.data) != 26 {
+				return 0, 0, nil, CorruptAnimationError
+			}
+			current = &apngFrame{control: chunk.data}
+			frames = append(frames, current)
+		case "IDAT":
+			seenData = true
+			// The default image is only the first frame if a frame control precedes it
+			if current != nil {
+				current.data = append(current.data, chunk.data)
+			}
+		case "fdAT":
+			if current == nil || len(chunk.data) < 4 {
+				return 0, 0, nil, CorruptAnimationError
+			}
+			current.data = append(current.data, chunk.data[4:])
+		case "IEND":
+		default:
+			if !seenData {
+				shared = append(shared, chunk)
+			}
+		}
+	}
+	if !animated {
+		return 0, 0, nil, nil
+	}
+	if err := checkCanvasSize(width, height); err != nil {
+		return 0, 0, nil, err
+	}
+
+	animationFrames := make([]animationFrame, 0, len(frames))
+	for i, frame := range frames {
+		control := frame.control
+		frameWidth, frameHeight := int(binary.BigEndian.Uint32(control[4:])), int(binary.BigEndian.Uint32(control[8:]))
+		x, y := int(binary.BigEndian.Uint32(control[12:])), int(binary.BigEndian.Uint32(control[16:]))
+		if frameWidth <= 0 || frameHeight <= 0 || x < 0 || y < 0 || x+frameWidth > width || y+frameHeight > height || len(frame.data) == 0 {
+			return 0, 0, nil, CorruptAnimationError
+		}
+		animationFrame := animationFrame{
+			bounds:  image.Rect(x, y, x+frameWidth, y+frameHeight),
+			replace: control[25] == 0,
+		}
+		switch control[24] {
+		case 1:
+			animationFrame.disposal = disposeBackground
+		case 2:
+			// The first frame has nothing to go back to
+			if i == 0 {
+				animationFrame.disposal = disposeBackground
+			} else {
+				animationFrame.disposal = disposePrevious
+			}
+		}
+
+		var buf bytes.Buffer
+		buf.Write(data[:8])
+		frameHeader := append([]byte(nil), header...)
+		binary.BigEndian.PutUint32(frameHeader[0:], uint32(frameWidth))
+		binary.BigEndian.PutUint32(frameHeader[4:], uint32(frameHeight))
+		writePngChunk(&buf, "IHDR", frameHeader)
+		for _, chunk := range shared {
+			writePngChunk(&buf, chunk.kind, chunk.data)
+		}
+		for _, frameData := range frame.data {
+			writePngChunk(&buf, "IDAT", frameData)
+		}
+		writePngChunk(&buf, "IEND", nil)
+		animationFrame.decode = func() (image.Image, error) {
+			img, err := png.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				return nil, CorruptAnimationError
+			}
+			return img, nil
+		}
+		animationFrames = append(animationFrames, animationFrame)
+	}
+	return width, height, animationFrames, nil
+}
+
+// A chunk of a RIFF container
+type riffChunk struct {
+	kind string
+	data []byte
+}
+
+func readRiffChunks(data []byte) ([]riffChunk, error) {
+	chunks := make([]riffChunk, 0, 16)
+	for offset := 0; offset < len(data); {
+		if offset+8 > len(data) {
+			return nil, CorruptAnimationError
+		}
+		length := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if offset+8+length > len(data) {
+			return nil, CorruptAnimationError
+		}
+		chunks = append(chunks, riffChunk{kind: string(data[offset : offset+4]), data: data[offset+8 : offset+8+length]})
+		// Chunks are padded to an even size
+		offset += 8 + length + length%2
+	}
+	return chunks, nil
+}
+
+func writeRiffChunk(buf *bytes.Buffer, kind string, data []byte) {
+	buf.WriteString(kind)
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// Splits an animated WebP into its frames, each of which is turned into a still WebP. Still WebPs have no frames
+func webpFrames(data []byte) (int, int, []animationFrame, error) {
+	chunks, err := readRiffChunks(data[12:])
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if len(chunks) == 0 || chunks[0].kind != "VP8X" || len(chunks[0].data) < 10 || chunks[0].data[0]&0x02 == 0 {
+		return 0, 0, nil, nil
+	}
+	width, height := uint24(chunks[0].data[4:])+1, uint24(chunks[0].data[7:])+1
+	if err := checkCanvasSize(width, height); err != nil {
+		return 0, 0, nil, err
+	}
+
+	frames := make([]animationFrame, 0, len(chunks))
+	for _, chunk := range chunks[1:] {
+		if chunk.kind != "ANMF" {
+			continue
+		}
+		if len(chunk.data) < 16 {
+			return 0, 0, nil, CorruptAnimationError
+		}
+		x, y := uint24(chunk.data[0:])*2, uint24(chunk.data[3:])*2
+		frameWidth, frameHeight := uint24(chunk.data[6:])+1, uint24(chunk.data[9:])+1
+		flags := chunk.data[15]
+		frame := animationFrame{
+			bounds:  image.Rect(x, y, x+frameWidth, y+frameHeight),
+			replace: flags&0x02 != 0,
+		}
+		if flags&0x01 != 0 {
+			frame.disposal = disposeBackground
+		}
+
+		frameChunks, err := readRiffChunks(chunk.data[16:])
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		var body bytes.Buffer
+		for _, frameChunk := range frameChunks {
+			if frameChunk.kind == "ALPH" {
+				// The alpha of lossy frames is only read from extended files
+				header := make([]byte, 10)
+				header[0] = 0x10
+				copy(header[4:], []byte{byte(frameWidth - 1), byte((frameWidth - 1) >> 8), byte((frameWidth - 1) >> 16)})
+				copy(header[7:], []byte{byte(frameHeight - 1), byte((frameHeight - 1) >> 8), byte((frameHeight - 1) >> 16)})
+				writeRiffChunk(&body, "VP8X", header)
+			}
+			if frameChunk.kind == "ALPH" || frameChunk.kind == "VP8 " || frameChunk.kind == "VP8L" {
+				writeRiffChunk(&body, frameChunk.kind, frameChunk.data)
+			}
+		}
+		var file bytes.Buffer
+		file.WriteString("RIFF")
+		binary.Write(&file, binary.LittleEndian, uint32(4+body.Len()))
+		file.WriteString("WEBP")
+		file.Write(body.Bytes())
+		frame.decode = func() (image.Image, error) {
+			img, err := webp.Decode(bytes.NewReader(file.Bytes()))
+			if err != nil {
+				return nil, CorruptAnimationError
+			}
+			return img, nil
+		}
+		frames = append(frames, frame)
+	}
+	return width, height, frames, nil
+}
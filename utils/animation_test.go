@@ -0,0 +1,269 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+var (
+	red   = color.RGBA{R: 255, A: 255}
+	green = color.RGBA{G: 255, A: 255}
+	blue  = color.RGBA{B: 255, A: 255}
+)
+
+func solidImage(rect image.Rectangle, c color.Color) *image.RGBA {
+	img := image.NewRGBA(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func decodePng(t *testing.T, data []byte) image.Image {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return img
+}
+
+func assertColor(t *testing.T, img image.Image, x int, y int, want color.Color) {
+	t.Helper()
+	r, g, b, a := img.At(x, y).RGBA()
+	wr, wg, wb, wa := want.RGBA()
+	if r != wr || g != wg || b != wb || a != wa {
+		t.Fatalf("Pixel at %d,%d = %v, want %v", x, y, img.At(x, y), want)
+	}
+}
+
+// Builds an APNG of the frames, each placed at its bounds on a canvas of the size of the first one
+func encodeApng(t *testing.T, frames []image.Image, disposals []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	sequence := uint32(0)
+	for i, frame := range frames {
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, frame); err != nil {
+			t.Fatalf(err.Error())
+		}
+		chunks, err := readPngChunks(encoded.Bytes())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if i == 0 {
+			writePngChunk(&buf, "IHDR", chunks[0].data)
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl, uint32(len(frames)))
+			writePngChunk(&buf, "acTL", actl)
+		}
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], sequence)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(frame.Bounds().Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(frame.Bounds().Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(frame.Bounds().Min.X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(frame.Bounds().Min.Y))
+		fctl[24] = disposals[i]
+		// Blended over the canvas
+		fctl[25] = 1
+		writePngChunk(&buf, "fcTL", fctl)
+		sequence++
+		for _, chunk := range chunks {
+			if chunk.kind != "IDAT" {
+				continue
+			}
+			if i == 0 {
+				writePngChunk(&buf, "IDAT", chunk.data)
+				continue
+			}
+			fdat := binary.BigEndian.AppendUint32(nil, sequence)
+			writePngChunk(&buf, "fdAT", append(fdat, chunk.data...))
+			sequence++
+		}
+	}
+	writePngChunk(&buf, "IEND", nil)
+	return buf.Bytes()
+}
+
+func TestSampleAnimationFrames(t *testing.T) {
+	t.Run("gif", func(t *testing.T) {
+		palette := color.Palette{color.Transparent, red, green, blue}
+		newFrame := func(rect image.Rectangle, c color.Color) *image.Paletted {
+			img := image.NewPaletted(rect, palette)
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				for x := rect.Min.X; x < rect.Max.X; x++ {
+					img.Set(x, y, c)
+				}
+			}
+			return img
+		}
+		animation := &gif.GIF{
+			Image: []*image.Paletted{
+				newFrame(image.Rect(0, 0, 4, 4), red),
+				newFrame(image.Rect(2, 2, 4, 4), green),
+				newFrame(image.Rect(0, 0, 2, 2), blue),
+			},
+			Delay:    []int{10, 10, 10},
+			Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, animation); err != nil {
+			t.Fatalf(err.Error())
+		}
+
+		frames, err := SampleAnimationFrames(buf.Bytes(), 3)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(frames) != 3 {
+			t.Fatalf("Sampled %d frames, want 3", len(frames))
+		}
+		second := decodePng(t, frames[1])
+		assertColor(t, second, 0, 0, red)
+		assertColor(t, second, 3, 3, green)
+		// The second frame was disposed to the background
+		third := decodePng(t, frames[2])
+		assertColor(t, third, 0, 0, blue)
+		assertColor(t, third, 3, 3, color.Transparent)
+
+		frames, err = SampleAnimationFrames(buf.Bytes(), 2)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(frames) != 2 {
+			t.Fatalf("Sampled %d frames, want the first and the last", len(frames))
+		}
+		assertColor(t, decodePng(t, frames[1]), 0, 0, blue)
+	})
+
+	t.Run("gif bombs", func(t *testing.T) {
+		// Every frame claims the whole 4096x4096 canvas with a few bytes of data
+		var bomb bytes.Buffer
+		bomb.WriteString("GIF89a")
+		binary.Write(&bomb, binary.LittleEndian, []uint16{4096, 4096})
+		bomb.Write([]byte{0x80, 0, 0, 0, 0, 0, 255, 255, 255})
+		for i := 0; i < 100; i++ {
+			bomb.WriteByte(0x2c)
+			binary.Write(&bomb, binary.LittleEndian, []uint16{0, 0, 4096, 4096})
+			bomb.Write([]byte{0, 2, 2, 0x44, 0x01, 0})
+		}
+		bomb.WriteByte(0x3b)
+		if _, err := SampleAnimationFrames(bomb.Bytes(), 2); err != AnimationTooLargeError {
+			t.Fatalf("Expected AnimationTooLargeError for frames covering too many pixels, got %v", err)
+		}
+
+		animation := &gif.GIF{}
+		for i := 0; i <= MaxAnimationFrames; i++ {
+			animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{red, green}))
+			animation.Delay = append(animation.Delay, 1)
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, animation); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err := SampleAnimationFrames(buf.Bytes(), 2); err != AnimationTooLargeError {
+			t.Fatalf("Expected AnimationTooLargeError for too many frames, got %v", err)
+		}
+	})
+
+	t.Run("apng", func(t *testing.T) {
+		apng := encodeApng(t, []image.Image{
+			solidImage(image.Rect(0, 0, 4, 4), red),
+			solidImage(image.Rect(2, 2, 4, 4), green),
+		}, []byte{0, 0})
+
+		frames, err := SampleAnimationFrames(apng, 8)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(frames) != 2 {
+			t.Fatalf("Sampled %d frames, want 2", len(frames))
+		}
+		second := decodePng(t, frames[1])
+		assertColor(t, second, 0, 0, red)
+		assertColor(t, second, 3, 3, green)
+
+		if _, err := SampleAnimationFrames(apng[:len(apng)-20], 8); err != CorruptAnimationError {
+			t.Fatalf("Expected CorruptAnimationError, got %v", err)
+		}
+	})
+
+	t.Run("webp", func(t *testing.T) {
+		still, err := os.ReadFile("../test/test_frame.webp")
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		decoded, err := webp.Decode(bytes.NewReader(still))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		chunks, err := readRiffChunks(still[12:])
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		width, height := decoded.Bounds().Dx(), decoded.Bounds().Dy()
+		// The second frame is placed right of the first one, at an even offset
+		offset := width + width%2
+
+		var body bytes.Buffer
+		vp8x := make([]byte, 10)
+		vp8x[0] = 0x02
+		copy(vp8x[4:], []byte{byte(offset + width - 1), byte((offset + width - 1) >> 8), 0})
+		copy(vp8x[7:], []byte{byte(height - 1), byte((height - 1) >> 8), 0})
+		writeRiffChunk(&body, "VP8X", vp8x)
+		writeRiffChunk(&body, "ANIM", make([]byte, 6))
+		for _, x := range []int{0, offset} {
+			var frame bytes.Buffer
+			frame.Write([]byte{byte(x / 2), byte(x / 2 >> 8), 0, 0, 0, 0})
+			frame.Write([]byte{byte(width - 1), byte((width - 1) >> 8), 0, byte(height - 1), byte((height - 1) >> 8), 0})
+			frame.Write([]byte{100, 0, 0, 0})
+			writeRiffChunk(&frame, chunks[0].kind, chunks[0].data)
+			writeRiffChunk(&body, "ANMF", frame.Bytes())
+		}
+		var animation bytes.Buffer
+		animation.WriteString("RIFF")
+		binary.Write(&animation, binary.LittleEndian, uint32(4+body.Len()))
+		animation.WriteString("WEBP")
+		animation.Write(body.Bytes())
+
+		frames, err := SampleAnimationFrames(animation.Bytes(), 2)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(frames) != 2 {
+			t.Fatalf("Sampled %d frames, want 2", len(frames))
+		}
+		second := decodePng(t, frames[1])
+		for _, point := range []image.Point{{0, 0}, {width / 2, height / 2}, {width - 1, height - 1}} {
+			assertColor(t, second, point.X, point.Y, decoded.At(point.X, point.Y))
+			assertColor(t, second, offset+point.X, point.Y, decoded.At(point.X, point.Y))
+		}
+
+		// A still WebP is no animation
+		if frames, err := SampleAnimationFrames(still, 2); frames != nil || err != nil {
+			t.Fatalf("Expected no frames for a still image, got %d, %v", len(frames), err)
+		}
+	})
+
+	t.Run("still images", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, solidImage(image.Rect(0, 0, 2, 2), red)); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if frames, err := SampleAnimationFrames(buf.Bytes(), 2); frames != nil || err != nil {
+			t.Fatalf("Expected no frames for a still image, got %d, %v", len(frames), err)
+		}
+		if frames, err := SampleAnimationFrames([]byte("not an image"), 2); frames != nil || err != nil {
+			t.Fatalf("Expected no frames for other files, got %d, %v", len(frames), err)
+		}
+	})
+}
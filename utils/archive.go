@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var UnknownArchiveFormatError = errors.New("Not a zip, tar or tar.gz archive")
+var ArchiveTooLargeError = errors.New("The archive holds more data than allowed")
+var TooManyArchiveEntriesError = errors.New("The archive holds more entries than allowed")
+var CorruptArchiveError = errors.New("The archive is corrupt")
+
+// Limits guarding against archives that unpack to far more data than they take up, like zip bombs
+type ArchiveLimits struct {
+	// How many bytes the entries may unpack to in total
+	MaxTotalSize int64
+	MaxEntries   int
+}
+
+// An entry of an archive passed to the callback of WalkArchive. Only valid during the call
+type ArchiveEntry struct {
+	// The name as stored in the archive, see SafeArchivePath
+	Name string
+	// Whether the entry is a regular file, not a directory or a link
+	IsFile bool
+	// The size stored in the archive, which zip bombs lie about
+	Size int64
+	open func() (io.ReadCloser, error)
+	// Shared by the entries of an archive
+	totalLeft *int64
+}
+
+// Reads the entry, failing with FileSizeExceededError if it's larger than maxFileSize and with
+// ArchiveTooLargeError once the entries read so far exceed the total size limit
+func (e *ArchiveEntry) Read(maxFileSize int) ([]byte, error) {
+	reader, err := e.open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, &LimitedReader{Reader: reader, MaxBytesLeftToRead: maxFileSize})
+	*e.totalLeft -= int64(buf.Len())
+	if *e.totalLeft < 0 {
+		return nil, ArchiveTooLargeError
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Calls fn with every entry of the zip, tar or gzipped tar archive in r, in the order they are stored.
+// Stops at the first error returned by fn
+func WalkArchive(r io.ReaderAt, size int64, limits ArchiveLimits, fn func(entry *ArchiveEntry) error) error {
+	header := make([]byte, 512)
+	n, err := r.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	header = header[:n]
+	totalLeft := limits.MaxTotalSize
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		zipReader, err := zip.NewReader(r, size)
+		if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+			return err
+		}
+		if len(zipReader.File) > limits.MaxEntries {
+			return TooManyArchiveEntriesError
+		}
+		for _, file := range zipReader.File {
+			entry := &ArchiveEntry{
+				Name:      file.Name,
+				IsFile:    file.Mode().IsRegular(),
+				Size:      int64(file.UncompressedSize64),
+				open:      file.Open,
+				totalLeft: &totalLeft,
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		gzipReader, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		// Unpacking the entries that are skipped counts too
+		return walkTar(&totalLimitReader{reader: gzipReader, left: limits.MaxTotalSize}, limits, &totalLeft, fn)
+	case len(header) > 262 && string(header[257:262]) == "ustar":
+		return walkTar(io.NewSectionReader(r, 0, size), limits, &totalLeft, fn)
+	}
+	return UnknownArchiveFormatError
+}
+
+func walkTar(r io.Reader, limits ArchiveLimits, totalLeft *int64, fn func(entry *ArchiveEntry) error) error {
+	tarReader := tar.NewReader(r)
+	for entries := 0; ; entries++ {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !errors.Is(err, tar.ErrInsecurePath) {
+			return err
+		}
+		if entries >= limits.MaxEntries {
+			return TooManyArchiveEntriesError
+		}
+		entry := &ArchiveEntry{
+			Name:   header.Name,
+			IsFile: header.Typeflag == tar.TypeReg,
+			Size:   header.Size,
+			open: func() (io.ReadCloser, error) {
+				return io.NopCloser(tarReader), nil
+			},
+			totalLeft: totalLeft,
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// Fails with ArchiveTooLargeError once more than left bytes were read
+type totalLimitReader struct {
+	reader io.Reader
+	left   int64
+}
+
+func (r *totalLimitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.left -= int64(n)
+	if r.left < 0 {
+		return n, ArchiveTooLargeError
+	}
+	return n, err
+}
+
+// Returns the cleaned path of an archive entry, false if it's absolute or leaves the archive through ".."
+func SafeArchivePath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) || (len(name) > 1 && name[1] == ':') {
+		return "", false
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "", false
+		}
+	}
+	return path.Clean(name), true
+}
+
+// Returns the url the entries of an archive are stored under when they aren't served anywhere
+func ArchiveUrl(archiveName string) string {
+	return (&url.URL{Scheme: "archive", Path: "/" + path.Base(strings.ReplaceAll(archiveName, `\`, "/"))}).String()
+}
+
+// Whether rawUrl is an archive:// url, which can't be loaded
+func IsArchiveUrl(rawUrl string) bool {
+	return strings.HasPrefix(rawUrl, "archive:")
+}
+
+// Appends the slash separated relative path to baseUrl, escaping each of its segments
+func JoinUrlPath(baseUrl string, relative string) string {
+	segments := strings.Split(relative, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(baseUrl, "/") + "/" + strings.Join(segments, "/")
+}
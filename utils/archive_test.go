@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+)
+
+type archiveFile struct {
+	name string
+	data []byte
+}
+
+func zipArchive(t *testing.T, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := writer.Create(file.name)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err := w.Write(file.data); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, gzipped bool, files ...archiveFile) []byte {
+	var buf bytes.Buffer
+	var gzipWriter *gzip.Writer
+	writer := tar.NewWriter(&buf)
+	if gzipped {
+		gzipWriter = gzip.NewWriter(&buf)
+		writer = tar.NewWriter(gzipWriter)
+	}
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.data)), Typeflag: tar.TypeReg}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatalf(err.Error())
+		}
+		if _, err := writer.Write(file.data); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if gzipped {
+		if err := gzipWriter.Close(); err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestWalkArchive(t *testing.T) {
+	files := []archiveFile{{"a.png", []byte("first")}, {"dir/b.png", []byte("second")}}
+	// Tars take up more than their files, with a header per file
+	limits := ArchiveLimits{MaxTotalSize: 64 * 1024, MaxEntries: 10}
+
+	// Returns the contents of the entries keyed by name
+	walk := func(t *testing.T, archive []byte, limits ArchiveLimits) (map[string]string, error) {
+		contents := make(map[string]string)
+		err := WalkArchive(bytes.NewReader(archive), int64(len(archive)), limits, func(entry *ArchiveEntry) error {
+			data, err := entry.Read(1024)
+			if err != nil {
+				return err
+			}
+			contents[entry.Name] = string(data)
+			return nil
+		})
+		return contents, err
+	}
+
+	t.Run("formats", func(t *testing.T) {
+		want := map[string]string{"a.png": "first", "dir/b.png": "second"}
+		for name, archive := range map[string][]byte{
+			"zip":    zipArchive(t, files...),
+			"tar":    tarArchive(t, false, files...),
+			"tar.gz": tarArchive(t, true, files...),
+		} {
+			contents, err := walk(t, archive, limits)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err.Error())
+			}
+			if !reflect.DeepEqual(contents, want) {
+				t.Fatalf("Entries of the %s = %v, want = %v", name, contents, want)
+			}
+		}
+
+		if _, err := walk(t, []byte("not an archive"), limits); err != UnknownArchiveFormatError {
+			t.Fatalf("Expected WalkArchive to fail with UnknownArchiveFormatError, got %v", err)
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		if _, err := walk(t, zipArchive(t, files...), ArchiveLimits{MaxTotalSize: 1024, MaxEntries: 1}); err != TooManyArchiveEntriesError {
+			t.Fatalf("Expected the zip to have too many entries, got %v", err)
+		}
+		if _, err := walk(t, tarArchive(t, false, files...), ArchiveLimits{MaxTotalSize: 1024, MaxEntries: 1}); err != TooManyArchiveEntriesError {
+			t.Fatalf("Expected the tar to have too many entries, got %v", err)
+		}
+		if _, err := walk(t, zipArchive(t, files...), ArchiveLimits{MaxTotalSize: 8, MaxEntries: 10}); err != ArchiveTooLargeError {
+			t.Fatalf("Expected the zip to unpack to too much data, got %v", err)
+		}
+
+		// A megabyte of zeros that isn't read still counts for gzipped tars
+		bomb := tarArchive(t, true, archiveFile{"zeros.bin", make([]byte, 1024*1024)})
+		err := WalkArchive(bytes.NewReader(bomb), int64(len(bomb)), limits, func(entry *ArchiveEntry) error {
+			return nil
+		})
+		if err != ArchiveTooLargeError {
+			t.Fatalf("Expected the gzipped tar to unpack to too much data, got %v", err)
+		}
+	})
+}
+
+func TestSafeArchivePath(t *testing.T) {
+	cases := map[string]string{
+		"a.png":            "a.png",
+		"./dir//b.png":     "dir/b.png",
+		`dir\c.png`:        "dir/c.png",
+		"../evil.png":      "",
+		"dir/../../e.png":  "",
+		"/etc/passwd":      "",
+		`C:\Windows\x.png`: "",
+	}
+	for name, want := range cases {
+		got, ok := SafeArchivePath(name)
+		if ok != (want != "") || got != want {
+			t.Errorf("SafeArchivePath(%s) = %s, %v, want = %s", name, got, ok, want)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package utils
 
 import (
-	"clipsearch/config"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -11,29 +11,33 @@ import (
 
 var FileSizeExceededError = errors.New("Max file size was exceeded")
 
+// Wrapped by the errors of the requests answered with 404 Not Found or 410 Gone
+var UrlGoneError = errors.New("Nothing is found at the url")
+
 var client = &http.Client{}
 
 // Downloads a file, writing to w
 // It checks the content-length header first if it exists
-func DownloadFile(w io.Writer, rawUrl string, maxFileSize int) error {
+// The download is aborted once ctx is done
+func DownloadFile(ctx context.Context, w io.Writer, rawUrl string, maxFileSize int, userAgent string) error {
 	/*url, err := url.Parse(rawUrl)
 	if err != nil {
 		return err
 	}*/
 
-	req, err := http.NewRequest("HEAD", rawUrl, nil)
+	req, err := http.NewRequestWithContext(ctx, "HEAD", rawUrl, nil)
 	if err != nil {
 		return err
 	}
 	//req.Header.Set("Referer", url.Hostname())
-	req.Header.Set("User-Agent", config.FILE_DOWNLOAD_USERAGENT)
+	req.Header.Set("User-Agent", userAgent)
 
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Request wasn't completed successfully, status code %d", resp.StatusCode)
+		return statusError(resp.StatusCode)
 	}
 
 	size, err := strconv.Atoi(resp.Header.Get("Content-Length"))
@@ -42,12 +46,12 @@ func DownloadFile(w io.Writer, rawUrl string, maxFileSize int) error {
 		return FileSizeExceededError
 	}
 
-	req, err = http.NewRequest("GET", rawUrl, nil)
+	req, err = http.NewRequestWithContext(ctx, "GET", rawUrl, nil)
 	if err != nil {
 		return err
 	}
 	//req.Header.Set("Referer", url.Hostname())
-	req.Header.Set("User-Agent", config.FILE_DOWNLOAD_USERAGENT)
+	req.Header.Set("User-Agent", userAgent)
 
 	resp, err = client.Do(req)
 
@@ -57,7 +61,7 @@ func DownloadFile(w io.Writer, rawUrl string, maxFileSize int) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Request wasn't completed successfully, status code %d", resp.StatusCode)
+		return statusError(resp.StatusCode)
 	}
 
 	lr := &LimitedReader{
@@ -73,6 +77,14 @@ func DownloadFile(w io.Writer, rawUrl string, maxFileSize int) error {
 	return nil
 }
 
+// Returns the error of a request answered with another status than 200 OK
+func statusError(statusCode int) error {
+	if statusCode == http.StatusNotFound || statusCode == http.StatusGone {
+		return fmt.Errorf("%w, status code %d", UrlGoneError, statusCode)
+	}
+	return fmt.Errorf("Request wasn't completed successfully, status code %d", statusCode)
+}
+
 type LimitedReader struct {
 	Reader             io.Reader
 	MaxBytesLeftToRead int
@@ -92,3 +104,38 @@ func (lr *LimitedReader) Read(p []byte) (int, error) {
 	}
 	return n, nil
 }
+
+// Checks that the file at rawUrl can be downloaded, without downloading it.
+// Servers that don't allow HEAD requests are sent a GET request whose body is left unread
+func CheckUrl(ctx context.Context, rawUrl string, userAgent string) error {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", rawUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		req, err = http.NewRequestWithContext(ctx, "GET", rawUrl, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", userAgent)
+
+		resp, err = client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp.StatusCode)
+	}
+	return nil
+}
@@ -2,9 +2,12 @@ package utils
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestDownloadFile(t *testing.T) {
@@ -18,12 +21,12 @@ func TestDownloadFile(t *testing.T) {
 		defer server.Close()
 
 		var buf bytes.Buffer
-		err := DownloadFile(&buf, server.URL, 1)
+		err := DownloadFile(context.Background(), &buf, server.URL, 1, "test")
 		if err != FileSizeExceededError {
 			t.Fatalf("Expected download to fail with error FileSizeExceeded")
 		}
 		buf.Reset()
-		err = DownloadFile(&buf, server.URL, 2)
+		err = DownloadFile(context.Background(), &buf, server.URL, 2, "test")
 		if err != nil {
 			t.Fatalf(err.Error())
 		}
@@ -45,7 +48,7 @@ func TestDownloadFile(t *testing.T) {
 			}
 		}))
 		var buf bytes.Buffer
-		err := DownloadFile(&buf, server.URL, 500*1024)
+		err := DownloadFile(context.Background(), &buf, server.URL, 500*1024, "test")
 		if err != nil {
 			t.Fatalf(err.Error())
 		}
@@ -68,9 +71,56 @@ func TestDownloadFile(t *testing.T) {
 			}
 		}))
 		var buf bytes.Buffer
-		err := DownloadFile(&buf, server.URL, 8)
+		err := DownloadFile(context.Background(), &buf, server.URL, 8, "test")
 		if err != FileSizeExceededError {
 			t.Fatalf("Expected download to fail with error FileSizeExceeded")
 		}
 	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		unblock := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			select {
+			case <-req.Context().Done():
+			case <-unblock:
+			}
+		}))
+		defer server.Close()
+		defer close(unblock)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		var buf bytes.Buffer
+		err := DownloadFile(ctx, &buf, server.URL, 8, "test")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("DownloadFile error = %v, want context.DeadlineExceeded", err)
+		}
+	})
+}
+
+func TestCheckUrl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/image":
+			rw.Write([]byte("OK"))
+		case "/no-head":
+			if req.Method == http.MethodHead {
+				rw.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			rw.Write([]byte("OK"))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/image", "/no-head"} {
+		if err := CheckUrl(context.Background(), server.URL+path, "test"); err != nil {
+			t.Fatalf("CheckUrl(%s) error = %v", path, err)
+		}
+	}
+	if err := CheckUrl(context.Background(), server.URL+"/gone", "test"); !errors.Is(err, UrlGoneError) {
+		t.Fatalf("CheckUrl error = %v, want UrlGoneError for a missing file", err)
+	}
 }
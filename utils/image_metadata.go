@@ -0,0 +1,626 @@
+package utils
+
+import (
+	"bytes"
+	"clipsearch/models"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"image"
+	_ "image/jpeg"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "golang.org/x/image/bmp"
+)
+
+// The largest XMP packet that is read, which also bounds what a compressed one in a PNG unpacks to
+const maxXmpSize = 1024 * 1024
+
+// Reads the EXIF, XMP and IPTC metadata of the JPEG, PNG or WebP image file data along with the size of the image,
+// skipping whatever is missing or malformed. Returns nil if there is nothing to read
+func ReadImageMetadata(data []byte) *models.ImageMetadata {
+	var exif, xmp, iptc []byte
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		exif, xmp, iptc = jpegMetadata(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		exif, xmp = pngMetadata(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		exif, xmp = webpMetadata(data)
+	}
+
+	// Each source only fills in the fields the previous ones left empty, except for the caption: the EXIF
+	// description is often a placeholder written by the camera, so the XMP and IPTC captions are preferred
+	var metadata models.ImageMetadata
+	description := readExif(exif, &metadata)
+	readXmp(xmp, &metadata)
+	readIptc(iptc, &metadata)
+	if metadata.Caption == "" {
+		metadata.Caption = description
+	}
+
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		metadata.Width, metadata.Height = config.Width, config.Height
+		// Orientations 5 to 8 turn the image by a quarter
+		if metadata.Orientation >= 5 {
+			metadata.Width, metadata.Height = metadata.Height, metadata.Width
+		}
+	}
+	if metadata.IsEmpty() {
+		return nil
+	}
+	return &metadata
+}
+
+// Returns the EXIF (a TIFF file), XMP and IPTC segments of a JPEG file, which come before the image data
+func jpegMetadata(data []byte) ([]byte, []byte, []byte) {
+	var exif, xmp, iptc []byte
+	for offset := 2; offset+4 <= len(data); {
+		if data[offset] != 0xff {
+			break
+		}
+		marker := data[offset+1]
+		if marker == 0xff {
+			// Fill byte
+			offset++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd8) {
+			// Markers without a segment
+			offset += 2
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			// Start of scan or end of image
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			break
+		}
+		segment := data[offset+4 : offset+2+length]
+		switch {
+		case marker == 0xe1 && exif == nil && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			exif = segment[6:]
+		case marker == 0xe1 && xmp == nil && bytes.HasPrefix(segment, []byte("http://ns.adobe.com/xap/1.0/\x00")):
+			xmp = segment[29:]
+		case marker == 0xed && iptc == nil && bytes.HasPrefix(segment, []byte("Photoshop 3.0\x00")):
+			iptc = photoshopIptc(segment[14:])
+		}
+		offset += 2 + length
+	}
+	return exif, xmp, iptc
+}
+
+// Returns the IPTC block among the Photoshop image resources of a JPEG file
+func photoshopIptc(data []byte) []byte {
+	for offset := 0; offset+7 <= len(data) && string(data[offset:offset+4]) == "8BIM"; {
+		id := binary.BigEndian.Uint16(data[offset+4:])
+		// The name is a Pascal string padded to an even size
+		nameLength := int(data[offset+6]) + 1
+		offset += 6 + nameLength + nameLength%2
+		if offset+4 > len(data) {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(data[offset:]))
+		offset += 4
+		if size < 0 || offset+size > len(data) {
+			return nil
+		}
+		if id == 0x0404 {
+			return data[offset : offset+size]
+		}
+		offset += size + size%2
+	}
+	return nil
+}
+
+// Returns the EXIF (a TIFF file) and XMP chunks of a PNG file
+func pngMetadata(data []byte) ([]byte, []byte) {
+	chunks, err := readPngChunks(data)
+	if err != nil {
+		return nil, nil
+	}
+	var exif, xmp []byte
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "eXIf":
+			exif = chunk.data
+		case "iTXt":
+			if text, ok := pngInternationalText(chunk.data, "XML:com.adobe.xmp"); ok {
+				xmp = text
+			}
+		}
+	}
+	return exif, xmp
+}
+
+// Returns the text of an iTXt chunk if its keyword is the given one, uncompressing it if needed
+func pngInternationalText(data []byte, keyword string) ([]byte, bool) {
+	// keyword, compression flag and method, language tag, translated keyword, text
+	fields := bytes.SplitN(data, []byte{0}, 2)
+	if len(fields) != 2 || string(fields[0]) != keyword || len(fields[1]) < 2 {
+		return nil, false
+	}
+	compressed := fields[1][0] == 1
+	fields = bytes.SplitN(fields[1][2:], []byte{0}, 3)
+	if len(fields) != 3 {
+		return nil, false
+	}
+	text := fields[2]
+	if !compressed {
+		return text, true
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(text))
+	if err != nil {
+		return nil, false
+	}
+	defer reader.Close()
+	text, err = io.ReadAll(io.LimitReader(reader, maxXmpSize))
+	if err != nil {
+		return nil, false
+	}
+	return text, true
+}
+
+// Returns the EXIF (a TIFF file) and XMP chunks of a WebP file
+func webpMetadata(data []byte) ([]byte, []byte) {
+	chunks, err := readRiffChunks(data[12:])
+	if err != nil {
+		return nil, nil
+	}
+	var exif, xmp []byte
+	for _, chunk := range chunks {
+		switch chunk.kind {
+		case "EXIF":
+			// Some encoders keep the prefix of the JPEG segment
+			exif = bytes.TrimPrefix(chunk.data, []byte("Exif\x00\x00"))
+		case "XMP ":
+			xmp = chunk.data
+		}
+	}
+	return exif, xmp
+}
+
+// EXIF tags, by the IFD they are found in
+const (
+	tiffImageDescription  = 0x010e
+	tiffMake              = 0x010f
+	tiffModel             = 0x0110
+	tiffOrientation       = 0x0112
+	tiffExifIfd           = 0x8769
+	tiffGpsIfd            = 0x8825
+	exifDateTimeOriginal  = 0x9003
+	exifDateTimeDigitized = 0x9004
+	exifOffsetTime        = 0x9011
+	exifOffsetDigitized   = 0x9012
+	gpsLatitudeRef        = 0x0001
+	gpsLatitude           = 0x0002
+	gpsLongitudeRef       = 0x0003
+	gpsLongitude          = 0x0004
+	gpsAltitudeRef        = 0x0005
+	gpsAltitude           = 0x0006
+)
+
+// The most entries an IFD is read with, more are a sign of a corrupt file
+const maxIfdEntries = 512
+
+// An entry of a TIFF IFD
+type tiffEntry struct {
+	kind  uint16
+	count int
+	value []byte
+	order binary.ByteOrder
+}
+
+// The sizes of the values of the TIFF types, by type
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8}
+
+// Reads the IFD at offset of the TIFF file data, keyed by tag. Entries pointing outside of data are left out
+func readIfd(data []byte, order binary.ByteOrder, offset uint32) map[uint16]tiffEntry {
+	if uint64(offset)+2 > uint64(len(data)) {
+		return nil
+	}
+	count := int(order.Uint16(data[offset:]))
+	if count > maxIfdEntries || int(offset)+2+count*12 > len(data) {
+		return nil
+	}
+	entries := make(map[uint16]tiffEntry, count)
+	for i := 0; i < count; i++ {
+		entry := data[int(offset)+2+i*12:]
+		tag, kind, valueCount := order.Uint16(entry), order.Uint16(entry[2:]), order.Uint32(entry[4:])
+		size, ok := tiffTypeSizes[kind]
+		if !ok || uint64(valueCount)*uint64(size) > uint64(len(data)) {
+			continue
+		}
+		length := int(valueCount) * size
+		value := entry[8:12]
+		if length > 4 {
+			valueOffset := order.Uint32(entry[8:])
+			if uint64(valueOffset)+uint64(length) > uint64(len(data)) {
+				continue
+			}
+			value = data[valueOffset : int(valueOffset)+length]
+		}
+		entries[tag] = tiffEntry{kind: kind, count: int(valueCount), value: value[:length], order: order}
+	}
+	return entries
+}
+
+func (e tiffEntry) text() string {
+	if e.kind != 2 {
+		return ""
+	}
+	text, _, _ := strings.Cut(string(e.value), "\x00")
+	return cleanText(text)
+}
+
+// Returns the i-th value of a BYTE, SHORT or LONG entry
+func (e tiffEntry) uint(i int) (int, bool) {
+	if i >= e.count {
+		return 0, false
+	}
+	switch e.kind {
+	case 1, 7:
+		return int(e.value[i]), true
+	case 3:
+		return int(e.order.Uint16(e.value[i*2:])), true
+	case 4:
+		return int(e.order.Uint32(e.value[i*4:])), true
+	}
+	return 0, false
+}
+
+// Returns the i-th value of a RATIONAL or SRATIONAL entry
+func (e tiffEntry) rational(i int) (float64, bool) {
+	if i >= e.count || (e.kind != 5 && e.kind != 10) {
+		return 0, false
+	}
+	numerator, denominator := e.order.Uint32(e.value[i*8:]), e.order.Uint32(e.value[i*8+4:])
+	if denominator == 0 {
+		return 0, false
+	}
+	if e.kind == 10 {
+		return float64(int32(numerator)) / float64(int32(denominator)), true
+	}
+	return float64(numerator) / float64(denominator), true
+}
+
+// Fills in metadata from the EXIF TIFF file data and returns the image description
+func readExif(data []byte, metadata *models.ImageMetadata) string {
+	if len(data) < 8 {
+		return ""
+	}
+	var order binary.ByteOrder
+	switch string(data[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return ""
+	}
+	ifd0 := readIfd(data, order, order.Uint32(data[4:]))
+
+	metadata.CameraMake = ifd0[tiffMake].text()
+	metadata.CameraModel = ifd0[tiffModel].text()
+	if orientation, ok := ifd0[tiffOrientation].uint(0); ok && orientation >= 1 && orientation <= 8 {
+		metadata.Orientation = orientation
+	}
+
+	if offset, ok := ifd0[tiffExifIfd].uint(0); ok {
+		exifIfd := readIfd(data, order, uint32(offset))
+		metadata.CapturedAt = exifTime(exifIfd[exifDateTimeOriginal].text(), exifIfd[exifOffsetTime].text())
+		if metadata.CapturedAt == nil {
+			metadata.CapturedAt = exifTime(exifIfd[exifDateTimeDigitized].text(), exifIfd[exifOffsetDigitized].text())
+		}
+	}
+
+	if offset, ok := ifd0[tiffGpsIfd].uint(0); ok {
+		gpsIfd := readIfd(data, order, uint32(offset))
+		latitude, latitudeOk := gpsCoordinate(gpsIfd[gpsLatitude], gpsIfd[gpsLatitudeRef].text(), 90)
+		longitude, longitudeOk := gpsCoordinate(gpsIfd[gpsLongitude], gpsIfd[gpsLongitudeRef].text(), 180)
+		// Cameras without a fix write zeros or nothing, a lone coordinate is no position
+		if latitudeOk && longitudeOk {
+			metadata.Latitude, metadata.Longitude = &latitude, &longitude
+			if altitude, ok := gpsIfd[gpsAltitude].rational(0); ok {
+				if ref, _ := gpsIfd[gpsAltitudeRef].uint(0); ref == 1 {
+					altitude = -altitude
+				}
+				metadata.Altitude = &altitude
+			}
+		}
+	}
+	return ifd0[tiffImageDescription].text()
+}
+
+// Parses an EXIF date and the offset of its time zone, which is UTC if offset is empty
+func exifTime(value string, offset string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.Parse("2006:01:02 15:04:05-07:00", value+offset)
+	if err != nil {
+		parsed, err = time.Parse("2006:01:02 15:04:05", value)
+	}
+	if err != nil || parsed.Year() < 1800 {
+		return nil
+	}
+	return &parsed
+}
+
+// Converts degrees, minutes and seconds to signed degrees, negative for the south and west references
+func gpsCoordinate(entry tiffEntry, ref string, limit float64) (float64, bool) {
+	var coordinate float64
+	for i, unit := range []float64{1, 60, 3600} {
+		value, ok := entry.rational(i)
+		if !ok {
+			return 0, false
+		}
+		coordinate += value / unit
+	}
+	if coordinate == 0 || coordinate > limit {
+		return 0, false
+	}
+	if ref == "S" || ref == "W" {
+		coordinate = -coordinate
+	}
+	return coordinate, true
+}
+
+// XML namespaces of the XMP properties that are read
+const (
+	xmpMetaNamespace   = "adobe:ns:meta/"
+	rdfNamespace       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	dcNamespace        = "http://purl.org/dc/elements/1.1/"
+	xmpNamespace       = "http://ns.adobe.com/xap/1.0/"
+	photoshopNamespace = "http://ns.adobe.com/photoshop/1.0/"
+	exifNamespace      = "http://ns.adobe.com/exif/1.0/"
+	tiffNamespace      = "http://ns.adobe.com/tiff/1.0/"
+)
+
+// Fills in the empty fields of metadata from the XMP packet data
+func readXmp(data []byte, metadata *models.ImageMetadata) {
+	if len(data) == 0 || len(data) > maxXmpSize {
+		return
+	}
+	properties := xmpProperties(data)
+	first := func(namespace string, name string) string {
+		if values := properties[xml.Name{Space: namespace, Local: name}]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	if metadata.CapturedAt == nil {
+		for _, name := range []xml.Name{{Space: exifNamespace, Local: "DateTimeOriginal"}, {Space: photoshopNamespace, Local: "DateCreated"}, {Space: xmpNamespace, Local: "CreateDate"}} {
+			if metadata.CapturedAt = xmpTime(first(name.Space, name.Local)); metadata.CapturedAt != nil {
+				break
+			}
+		}
+	}
+	if metadata.CameraMake == "" {
+		metadata.CameraMake = first(tiffNamespace, "Make")
+	}
+	if metadata.CameraModel == "" {
+		metadata.CameraModel = first(tiffNamespace, "Model")
+	}
+	if metadata.Orientation == 0 {
+		if orientation, err := strconv.Atoi(first(tiffNamespace, "Orientation")); err == nil && orientation >= 1 && orientation <= 8 {
+			metadata.Orientation = orientation
+		}
+	}
+	if metadata.Latitude == nil {
+		latitude, latitudeOk := xmpCoordinate(first(exifNamespace, "GPSLatitude"), 90)
+		longitude, longitudeOk := xmpCoordinate(first(exifNamespace, "GPSLongitude"), 180)
+		if latitudeOk && longitudeOk {
+			metadata.Latitude, metadata.Longitude = &latitude, &longitude
+			if altitude, ok := xmpRational(first(exifNamespace, "GPSAltitude")); ok {
+				if first(exifNamespace, "GPSAltitudeRef") == "1" {
+					altitude = -altitude
+				}
+				metadata.Altitude = &altitude
+			}
+		}
+	}
+	if metadata.Caption == "" {
+		// The first of the alternative languages, which is the default one
+		metadata.Caption = first(dcNamespace, "description")
+	}
+	if len(metadata.Keywords) == 0 {
+		metadata.Keywords = properties[xml.Name{Space: dcNamespace, Local: "subject"}]
+	}
+}
+
+// Returns the values of the properties of an XMP packet, the items of arrays in order. Properties are either
+// attributes of rdf:Description or elements, whose items are rdf:li elements. Values of nested structures are
+// keyed by the innermost property. Whatever was read before a syntax error is returned
+func xmpProperties(data []byte) map[xml.Name][]string {
+	properties := make(map[xml.Name][]string)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// The property elements the decoder is in
+	var stack []xml.Name
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return properties
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Space == xmpMetaNamespace {
+				// The x:xmpmeta wrapper
+				continue
+			}
+			if token.Name.Space != rdfNamespace {
+				stack = append(stack, token.Name)
+				continue
+			}
+			if token.Name.Local == "Description" && len(stack) == 0 {
+				for _, attr := range token.Attr {
+					// Namespace declarations and unqualified attributes are no properties
+					if attr.Name.Space != "" && attr.Name.Space != rdfNamespace && attr.Name.Space != "xmlns" {
+						if value := cleanText(attr.Value); value != "" {
+							properties[attr.Name] = append(properties[attr.Name], value)
+						}
+					}
+				}
+			}
+		case xml.EndElement:
+			if token.Name.Space != rdfNamespace && token.Name.Space != xmpMetaNamespace && len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) == 0 {
+				continue
+			}
+			if value := cleanText(string(token)); value != "" {
+				name := stack[len(stack)-1]
+				properties[name] = append(properties[name], value)
+			}
+		}
+	}
+}
+
+// Parses the ISO 8601 dates of XMP, which may leave out the seconds, the time or the time zone (then UTC)
+func xmpTime(value string) *time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02T15:04:05.999999999", "2006-01-02T15:04", "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &parsed
+		}
+	}
+	return nil
+}
+
+// Parses the "DDD,MM,SSk" or "DDD,MM.mmk" coordinates of XMP, where k is the direction
+func xmpCoordinate(value string, limit float64) (float64, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	direction := value[len(value)-1]
+	parts := strings.Split(value[:len(value)-1], ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var coordinate float64
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, false
+		}
+		coordinate += number / math.Pow(60, float64(i))
+	}
+	if coordinate == 0 || coordinate > limit {
+		return 0, false
+	}
+	switch direction {
+	case 'S', 'W':
+		return -coordinate, true
+	case 'N', 'E':
+		return coordinate, true
+	}
+	return 0, false
+}
+
+// Parses the "numerator/denominator" rationals of XMP
+func xmpRational(value string) (float64, bool) {
+	numerator, denominator, found := strings.Cut(value, "/")
+	n, err := strconv.ParseFloat(numerator, 64)
+	if err != nil {
+		return 0, false
+	}
+	if !found {
+		return n, true
+	}
+	d, err := strconv.ParseFloat(denominator, 64)
+	if err != nil || d == 0 {
+		return 0, false
+	}
+	return n / d, true
+}
+
+// IPTC datasets of the application record
+const (
+	iptcKeywords    = 25
+	iptcDateCreated = 55
+	iptcTimeCreated = 60
+	iptcCaption     = 120
+)
+
+// Fills in the empty fields of metadata from the IPTC IIM block data
+func readIptc(data []byte, metadata *models.ImageMetadata) {
+	var keywords []string
+	var caption, date, clock string
+	utf8Text := false
+	for offset := 0; offset+5 <= len(data) && data[offset] == 0x1c; {
+		record, dataset := data[offset+1], data[offset+2]
+		size := int(binary.BigEndian.Uint16(data[offset+3:]))
+		// Sizes over 32767 are extended ones, which only large binary datasets have
+		if size&0x8000 != 0 || offset+5+size > len(data) {
+			break
+		}
+		value := data[offset+5 : offset+5+size]
+		offset += 5 + size
+
+		if record == 1 && dataset == 90 {
+			// The coded character set, ESC % G is UTF-8
+			utf8Text = bytes.Equal(value, []byte("\x1b%G"))
+			continue
+		}
+		if record != 2 {
+			continue
+		}
+		text := iptcText(value, utf8Text)
+		switch dataset {
+		case iptcKeywords:
+			if text != "" {
+				keywords = append(keywords, text)
+			}
+		case iptcDateCreated:
+			date = text
+		case iptcTimeCreated:
+			clock = text
+		case iptcCaption:
+			caption = text
+		}
+	}
+
+	if metadata.CapturedAt == nil && date != "" {
+		if parsed, err := time.Parse("20060102150405-0700", date+clock); err == nil {
+			metadata.CapturedAt = &parsed
+		} else if parsed, err := time.Parse("20060102", date); err == nil {
+			metadata.CapturedAt = &parsed
+		}
+	}
+	if metadata.Caption == "" {
+		metadata.Caption = caption
+	}
+	if len(metadata.Keywords) == 0 {
+		metadata.Keywords = keywords
+	}
+}
+
+// Decodes IPTC text, which is Latin-1 unless the block declares UTF-8 or the text is valid UTF-8
+func iptcText(value []byte, utf8Text bool) string {
+	if utf8Text || utf8.Valid(value) {
+		return cleanText(string(value))
+	}
+	runes := make([]rune, len(value))
+	for i, b := range value {
+		runes[i] = rune(b)
+	}
+	return cleanText(string(runes))
+}
+
+// Trims the whitespace and the NUL bytes text is often padded with, and drops it if it isn't valid UTF-8
+func cleanText(text string) string {
+	text = strings.TrimSpace(strings.Trim(text, "\x00"))
+	if !utf8.ValidString(text) {
+		return ""
+	}
+	return text
+}
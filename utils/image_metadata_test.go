@@ -0,0 +1,298 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// An entry of an IFD written by encodeTiff
+type testTiffField struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	value []byte
+	// The index of the IFD the entry points to, for the Exif and GPS IFD pointers
+	ifd int
+}
+
+type testTiff struct {
+	order binary.AppendByteOrder
+}
+
+func (tt testTiff) ascii(tag uint16, text string) testTiffField {
+	return testTiffField{tag: tag, kind: 2, count: uint32(len(text) + 1), value: append([]byte(text), 0)}
+}
+
+func (tt testTiff) short(tag uint16, value uint16) testTiffField {
+	return testTiffField{tag: tag, kind: 3, count: 1, value: tt.order.AppendUint16(nil, value)}
+}
+
+func (tt testTiff) pointer(tag uint16, ifd int) testTiffField {
+	return testTiffField{tag: tag, kind: 4, count: 1, ifd: ifd}
+}
+
+// Takes numerator, denominator pairs
+func (tt testTiff) rationals(tag uint16, values ...uint32) testTiffField {
+	field := testTiffField{tag: tag, kind: 5, count: uint32(len(values) / 2)}
+	for _, value := range values {
+		field.value = tt.order.AppendUint32(field.value, value)
+	}
+	return field
+}
+
+// Writes a TIFF file of the IFDs, the first of which is IFD0
+func (tt testTiff) encode(ifds ...[]testTiffField) []byte {
+	offsets := make([]uint32, len(ifds))
+	offset := uint32(8)
+	for i, ifd := range ifds {
+		offsets[i] = offset
+		offset += 2 + uint32(len(ifd))*12 + 4
+		for _, field := range ifd {
+			if len(field.value) > 4 {
+				offset += uint32(len(field.value))
+			}
+		}
+	}
+
+	buf := []byte("MM\x00*")
+	if tt.order == binary.LittleEndian {
+		buf = []byte("II*\x00")
+	}
+	buf = tt.order.AppendUint32(buf, 8)
+	for i, ifd := range ifds {
+		dataOffset := offsets[i] + 2 + uint32(len(ifd))*12 + 4
+		var data []byte
+		buf = tt.order.AppendUint16(buf, uint16(len(ifd)))
+		for _, field := range ifd {
+			buf = tt.order.AppendUint16(buf, field.tag)
+			buf = tt.order.AppendUint16(buf, field.kind)
+			buf = tt.order.AppendUint32(buf, field.count)
+			switch {
+			case field.ifd > 0:
+				buf = tt.order.AppendUint32(buf, offsets[field.ifd])
+			case len(field.value) > 4:
+				buf = tt.order.AppendUint32(buf, dataOffset+uint32(len(data)))
+				data = append(data, field.value...)
+			default:
+				buf = append(buf, field.value...)
+				buf = append(buf, make([]byte, 4-len(field.value))...)
+			}
+		}
+		// No next IFD
+		buf = tt.order.AppendUint32(buf, 0)
+		buf = append(buf, data...)
+	}
+	return buf
+}
+
+// Encodes a JPEG of the given size with the segments inserted after its start of image marker
+func encodeTestJpeg(t *testing.T, width int, height int, segments ...[]byte) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, solidImage(image.Rect(0, 0, width, height), red), nil); err != nil {
+		t.Fatalf(err.Error())
+	}
+	data := []byte{0xff, 0xd8}
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	return append(data, buf.Bytes()[2:]...)
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xff, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// Wraps IPTC datasets, given as record, dataset, value triples, in Photoshop image resources
+func photoshopSegment(datasets ...any) []byte {
+	var iptc []byte
+	for i := 0; i < len(datasets); i += 3 {
+		value := []byte(datasets[i+2].(string))
+		iptc = append(iptc, 0x1c, byte(datasets[i].(int)), byte(datasets[i+1].(int)))
+		iptc = binary.BigEndian.AppendUint16(iptc, uint16(len(value)))
+		iptc = append(iptc, value...)
+	}
+	resources := []byte("Photoshop 3.0\x008BIM\x04\x04\x00\x00")
+	resources = binary.BigEndian.AppendUint32(resources, uint32(len(iptc)))
+	resources = append(resources, iptc...)
+	return jpegSegment(0xed, resources)
+}
+
+func assertClose(t *testing.T, name string, got *float64, want float64) {
+	t.Helper()
+	if got == nil || math.Abs(*got-want) > 1e-6 {
+		t.Fatalf("%s = %v, want %v", name, got, want)
+	}
+}
+
+func assertTime(t *testing.T, got *time.Time, want string) {
+	t.Helper()
+	wantTime, err := time.Parse(time.RFC3339, want)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if got == nil || !got.Equal(wantTime) {
+		t.Fatalf("Capture time = %v, want %v", got, wantTime)
+	}
+}
+
+func TestReadImageMetadata(t *testing.T) {
+	t.Run("jpeg with exif, xmp and iptc", func(t *testing.T) {
+		tiff := testTiff{order: binary.BigEndian}
+		exif := tiff.encode(
+			[]testTiffField{
+				tiff.ascii(tiffImageDescription, "OLYMPUS DIGITAL CAMERA"),
+				tiff.ascii(tiffMake, "Canon"),
+				tiff.ascii(tiffModel, "Canon EOS 5D Mark IV"),
+				tiff.short(tiffOrientation, 6),
+				tiff.pointer(tiffExifIfd, 1),
+				tiff.pointer(tiffGpsIfd, 2),
+			},
+			[]testTiffField{
+				tiff.ascii(exifDateTimeOriginal, "2024:01:02 15:04:05"),
+				tiff.ascii(exifOffsetTime, "+01:00"),
+			},
+			[]testTiffField{
+				tiff.ascii(gpsLatitudeRef, "N"),
+				tiff.rationals(gpsLatitude, 48, 1, 51, 1, 3024, 100),
+				tiff.ascii(gpsLongitudeRef, "E"),
+				tiff.rationals(gpsLongitude, 2, 1, 17, 1, 4020, 100),
+				tiff.short(gpsAltitudeRef, 0),
+				tiff.rationals(gpsAltitude, 35, 1),
+			},
+		)
+		// The EXIF fields take precedence over the XMP ones, except for the caption
+		xmp := `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:tiff="http://ns.adobe.com/tiff/1.0/"
+  xmlns:xmp="http://ns.adobe.com/xap/1.0/" tiff:Model="Another camera" xmp:CreateDate="2020-01-01T00:00:00Z">
+  <dc:description><rdf:Alt><rdf:li xml:lang="x-default">The Eiffel Tower at dusk</rdf:li></rdf:Alt></dc:description>
+  <dc:subject><rdf:Bag><rdf:li>paris</rdf:li><rdf:li>tower</rdf:li></rdf:Bag></dc:subject>
+</rdf:Description></rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+		data := encodeTestJpeg(t, 4, 2,
+			jpegSegment(0xe1, append([]byte("Exif\x00\x00"), exif...)),
+			jpegSegment(0xe1, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), xmp...)),
+			photoshopSegment(2, iptcCaption, "IPTC caption", 2, iptcKeywords, "iptc"))
+
+		metadata := ReadImageMetadata(data)
+		if metadata == nil {
+			t.Fatalf("Expected metadata")
+		}
+		assertTime(t, metadata.CapturedAt, "2024-01-02T15:04:05+01:00")
+		if metadata.CameraMake != "Canon" || metadata.CameraModel != "Canon EOS 5D Mark IV" || metadata.Orientation != 6 {
+			t.Fatalf("Metadata = %+v, want the camera and orientation of the EXIF", metadata)
+		}
+		assertClose(t, "Latitude", metadata.Latitude, 48+51.0/60+30.24/3600)
+		assertClose(t, "Longitude", metadata.Longitude, 2+17.0/60+40.2/3600)
+		assertClose(t, "Altitude", metadata.Altitude, 35)
+		// The orientation turns the 4x2 image by a quarter
+		if metadata.Width != 2 || metadata.Height != 4 {
+			t.Fatalf("Size = %dx%d, want 2x4", metadata.Width, metadata.Height)
+		}
+		if metadata.Caption != "The Eiffel Tower at dusk" || !reflect.DeepEqual(metadata.Keywords, []string{"paris", "tower"}) {
+			t.Fatalf("Caption = %q, keywords = %q, want the XMP ones", metadata.Caption, metadata.Keywords)
+		}
+	})
+
+	t.Run("jpeg with iptc", func(t *testing.T) {
+		// Latin-1, since the character set isn't declared
+		data := encodeTestJpeg(t, 4, 2, photoshopSegment(
+			2, iptcCaption, "Caf\xe9 terrace",
+			2, iptcKeywords, "cafe",
+			2, iptcKeywords, "night",
+			2, iptcDateCreated, "20240102",
+			2, iptcTimeCreated, "150405+0100"))
+
+		metadata := ReadImageMetadata(data)
+		if metadata == nil {
+			t.Fatalf("Expected metadata")
+		}
+		assertTime(t, metadata.CapturedAt, "2024-01-02T15:04:05+01:00")
+		if metadata.Caption != "Café terrace" || !reflect.DeepEqual(metadata.Keywords, []string{"cafe", "night"}) {
+			t.Fatalf("Caption = %q, keywords = %q, want the IPTC ones", metadata.Caption, metadata.Keywords)
+		}
+		if metadata.Width != 4 || metadata.Height != 2 || metadata.Orientation != 0 {
+			t.Fatalf("Metadata = %+v, want an unturned 4x2 image", metadata)
+		}
+	})
+
+	t.Run("png with exif and compressed xmp", func(t *testing.T) {
+		tiff := testTiff{order: binary.LittleEndian}
+		exif := tiff.encode([]testTiffField{tiff.ascii(tiffModel, "Pixel 8"), tiff.short(tiffOrientation, 3)})
+		xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+  exif:GPSLatitude="48,51.504N" exif:GPSLongitude="2,17.67W" photoshop:DateCreated="2024-01-02"/>
+</rdf:RDF></x:xmpmeta>`
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		writer.Write([]byte(xmp))
+		writer.Close()
+
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, solidImage(image.Rect(0, 0, 3, 5), green)); err != nil {
+			t.Fatalf(err.Error())
+		}
+		chunks, err := readPngChunks(encoded.Bytes())
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		var buf bytes.Buffer
+		buf.WriteString("\x89PNG\r\n\x1a\n")
+		writePngChunk(&buf, chunks[0].kind, chunks[0].data)
+		writePngChunk(&buf, "eXIf", exif)
+		writePngChunk(&buf, "iTXt", append([]byte("XML:com.adobe.xmp\x00\x01\x00\x00\x00"), compressed.Bytes()...))
+		for _, chunk := range chunks[1:] {
+			writePngChunk(&buf, chunk.kind, chunk.data)
+		}
+
+		metadata := ReadImageMetadata(buf.Bytes())
+		if metadata == nil {
+			t.Fatalf("Expected metadata")
+		}
+		assertTime(t, metadata.CapturedAt, "2024-01-02T00:00:00Z")
+		assertClose(t, "Latitude", metadata.Latitude, 48+51.504/60)
+		assertClose(t, "Longitude", metadata.Longitude, -(2 + 17.67/60))
+		if metadata.Altitude != nil {
+			t.Fatalf("Altitude = %v, want none", *metadata.Altitude)
+		}
+		if metadata.CameraModel != "Pixel 8" || metadata.Orientation != 3 || metadata.Width != 3 || metadata.Height != 5 {
+			t.Fatalf("Metadata = %+v, want an upside down 3x5 image from a Pixel 8", metadata)
+		}
+	})
+
+	t.Run("broken metadata is skipped", func(t *testing.T) {
+		tiff := testTiff{order: binary.BigEndian}
+		exif := tiff.encode([]testTiffField{tiff.ascii(tiffModel, "Truncated camera model"), tiff.short(tiffOrientation, 9)})
+		// Points the model past the end of the file
+		exif = exif[:len(exif)-4]
+		gpsWithoutFix := tiff.encode(
+			[]testTiffField{tiff.pointer(tiffGpsIfd, 1)},
+			[]testTiffField{tiff.rationals(gpsLatitude, 0, 0, 0, 0, 0, 0), tiff.rationals(gpsLongitude, 0, 0, 0, 0, 0, 0)})
+		data := encodeTestJpeg(t, 4, 2,
+			jpegSegment(0xe1, append([]byte("Exif\x00\x00"), exif...)),
+			jpegSegment(0xe1, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), "<x:xmpmeta><unclosed"...)),
+			photoshopSegment(2, iptcCaption, "Caption that is longer than its dataset")[:30])
+
+		metadata := ReadImageMetadata(data)
+		if metadata == nil || metadata.CameraModel != "" || metadata.Orientation != 0 || metadata.Caption != "" || metadata.Width != 4 {
+			t.Fatalf("Metadata = %+v, want the size only", metadata)
+		}
+		metadata = ReadImageMetadata(encodeTestJpeg(t, 4, 2, jpegSegment(0xe1, append([]byte("Exif\x00\x00"), gpsWithoutFix...))))
+		if metadata == nil || metadata.Latitude != nil || metadata.Longitude != nil {
+			t.Fatalf("Metadata = %+v, want no position", metadata)
+		}
+
+		if metadata := ReadImageMetadata([]byte("not an image")); metadata != nil {
+			t.Fatalf("Metadata = %+v, want none for other files", metadata)
+		}
+	})
+}
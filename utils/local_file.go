@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var LocalFileNotAllowedError = errors.New("The file is outside of the directories files are read from")
+
+// Returns the file:// url of the file at the absolute path
+func FileUrl(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// Returns the path of a file:// url, false if rawUrl is not one
+func LocalFilePath(rawUrl string) (string, bool) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || parsed.Scheme != "file" || parsed.Path == "" {
+		return "", false
+	}
+	return filepath.FromSlash(parsed.Path), true
+}
+
+// Reads the file at path, failing with FileSizeExceededError if it's larger than maxFileSize
+func ReadLocalFile(path string, maxFileSize int) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > int64(maxFileSize) {
+		return nil, FileSizeExceededError
+	}
+	return os.ReadFile(path)
+}
+
+// Whether path is one of the absolute directories or inside of one. ".." elements can't leave them
+func IsInDirectories(path string, directories []string) bool {
+	for _, directory := range directories {
+		relative, err := filepath.Rel(directory, path)
+		if err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
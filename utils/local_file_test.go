@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a photo #1.jpg")
+	if err := os.WriteFile(path, []byte("OK"), 0o644); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	fileUrl := FileUrl(path)
+	parsed, ok := LocalFilePath(fileUrl)
+	if !ok || parsed != path {
+		t.Fatalf("LocalFilePath(%s) = %s, want = %s", fileUrl, parsed, path)
+	}
+	if _, ok := LocalFilePath("http://localhost/image.jpg"); ok {
+		t.Fatalf("Expected http urls not to be local files")
+	}
+
+	if _, err := ReadLocalFile(path, 1); err != FileSizeExceededError {
+		t.Fatalf("Expected ReadLocalFile to fail with error FileSizeExceeded")
+	}
+	data, err := ReadLocalFile(path, 2)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if string(data) != "OK" {
+		t.Fatalf(`File contents = %s, want = "OK"`, string(data))
+	}
+
+	directory := filepath.Dir(path)
+	if !IsInDirectories(path, []string{"/nowhere", directory}) {
+		t.Fatalf("Expected %s to be in %s", path, directory)
+	}
+	for _, outside := range []string{filepath.Dir(directory), filepath.Join(directory, "..", "secret"), "/etc/passwd"} {
+		if IsInDirectories(outside, []string{directory}) {
+			t.Fatalf("Expected %s not to be in %s", outside, directory)
+		}
+	}
+}
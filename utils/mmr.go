@@ -0,0 +1,60 @@
+package utils
+
+// Greedily picks count candidates, each time taking the one that maximizes
+// lambda * sim(query, candidate) - (1 - lambda) * max sim(candidate, already picked).
+// Candidates are expected to be ordered by relevance. Returns indices into candidates in the picked order
+func MaximalMarginalRelevance(query []float32, candidates [][]float32, lambda float32, count int) ([]int, error) {
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+
+	relevance := make([]float32, len(candidates))
+	for i, candidate := range candidates {
+		sim, err := Dot(query, candidate)
+		if err != nil {
+			return nil, err
+		}
+		relevance[i] = sim
+	}
+
+	// maxSimilarity[i] is the highest similarity of candidate i to any picked candidate
+	maxSimilarity := make([]float32, len(candidates))
+	picked := make([]bool, len(candidates))
+	order := make([]int, 0, count)
+
+	for len(order) < count {
+		best := -1
+		var bestScore float32
+		for i := range candidates {
+			if picked[i] {
+				continue
+			}
+			score := lambda * relevance[i]
+			if len(order) > 0 {
+				score -= (1 - lambda) * maxSimilarity[i]
+			}
+			if best == -1 || score > bestScore {
+				best = i
+				bestScore = score
+			}
+		}
+
+		picked[best] = true
+		order = append(order, best)
+
+		for i, candidate := range candidates {
+			if picked[i] {
+				continue
+			}
+			sim, err := Dot(candidates[best], candidate)
+			if err != nil {
+				return nil, err
+			}
+			if len(order) == 1 || sim > maxSimilarity[i] {
+				maxSimilarity[i] = sim
+			}
+		}
+	}
+
+	return order, nil
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestMaximalMarginalRelevance(t *testing.T) {
+	query := []float32{1, 0}
+	candidates := [][]float32{
+		{0.99, 0.14},
+		{0.98, 0.2},
+		{0.6, -0.8},
+	}
+
+	t.Run("no diversity", func(t *testing.T) {
+		order, err := MaximalMarginalRelevance(query, candidates, 1, 3)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if order[0] != 0 || order[1] != 1 || order[2] != 2 {
+			t.Fatalf("Order = %v, want = %v", order, []int{0, 1, 2})
+		}
+	})
+
+	t.Run("diversity", func(t *testing.T) {
+		order, err := MaximalMarginalRelevance(query, candidates, 0.5, 2)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(order) != 2 || order[0] != 0 || order[1] != 2 {
+			t.Fatalf("Order = %v, want = %v", order, []int{0, 2})
+		}
+	})
+
+	t.Run("count larger than candidates", func(t *testing.T) {
+		order, err := MaximalMarginalRelevance(query, candidates, 0.5, 10)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(order) != 3 {
+			t.Fatalf("Returned %d indices, want = %d", len(order), 3)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+var ImageTooLargeError = errors.New("The image is too large to decode")
+
+// The largest image that is turned upright, in pixels, the same as the largest animation canvas.
+// The image is copied twice at 4 bytes per pixel
+const MaxOrientedPixels = MaxAnimationPixels
+
+// Turns the image file data upright according to its EXIF orientation (1 to 8) and returns it re-encoded, as a JPEG
+// file if it was one and as a PNG file otherwise. Returns data as is if it is upright already
+func ApplyOrientation(data []byte, orientation int) ([]byte, error) {
+	if orientation <= 1 || orientation > 8 {
+		return data, nil
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaxOrientedPixels {
+		return nil, ImageTooLargeError
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	oriented := orient(img, orientation)
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, oriented, &jpeg.Options{Quality: 95})
+	} else {
+		err = png.Encode(&buf, oriented)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns img turned upright according to the EXIF orientation, which says how it was stored: 2 mirrored, 3 turned
+// by a half, 4 flipped, 5 transposed, 6 turned counterclockwise by a quarter, 7 transversed and 8 turned clockwise
+func orient(img image.Image, orientation int) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			// The pixel of the stored image shown at x, y
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = width-1-x, y
+			case 3:
+				sx, sy = width-1-x, height-1-y
+			case 4:
+				sx, sy = x, height-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, height-1-x
+			case 7:
+				sx, sy = width-1-y, height-1-x
+			case 8:
+				sx, sy = width-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
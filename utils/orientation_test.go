@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestApplyOrientation(t *testing.T) {
+	// A 3x2 image whose top-left pixel is red, its right neighbor green and the others blue
+	img := solidImage(image.Rect(0, 0, 3, 2), blue)
+	img.Set(0, 0, red)
+	img.Set(1, 0, green)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	t.Run("upright images are left as is", func(t *testing.T) {
+		upright, err := ApplyOrientation(buf.Bytes(), 1)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if &upright[0] != &buf.Bytes()[0] {
+			t.Fatalf("Expected the data of an upright image to be returned as is")
+		}
+	})
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		// Where the red and the green pixels are shown
+		red   image.Point
+		green image.Point
+	}{
+		{2, image.Pt(3, 2), image.Pt(2, 0), image.Pt(1, 0)},
+		{3, image.Pt(3, 2), image.Pt(2, 1), image.Pt(1, 1)},
+		{4, image.Pt(3, 2), image.Pt(0, 1), image.Pt(1, 1)},
+		{5, image.Pt(2, 3), image.Pt(0, 0), image.Pt(0, 1)},
+		{6, image.Pt(2, 3), image.Pt(1, 0), image.Pt(1, 1)},
+		{7, image.Pt(2, 3), image.Pt(1, 2), image.Pt(1, 1)},
+		{8, image.Pt(2, 3), image.Pt(0, 2), image.Pt(0, 1)},
+	}
+	for _, test := range tests {
+		upright, err := ApplyOrientation(buf.Bytes(), test.orientation)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		decoded := decodePng(t, upright)
+		if decoded.Bounds().Size() != test.size {
+			t.Fatalf("Orientation %d: size = %v, want %v", test.orientation, decoded.Bounds().Size(), test.size)
+		}
+		assertColor(t, decoded, test.red.X, test.red.Y, red)
+		assertColor(t, decoded, test.green.X, test.green.Y, green)
+	}
+
+	t.Run("broken images", func(t *testing.T) {
+		if _, err := ApplyOrientation([]byte("not an image"), 6); err == nil {
+			t.Fatalf("Expected an error for data that isn't an image")
+		}
+	})
+
+	t.Run("large images", func(t *testing.T) {
+		// Only the header is read to tell the size
+		var large bytes.Buffer
+		large.WriteString("\x89PNG\r\n\x1a\n")
+		header := make([]byte, 13)
+		binary.BigEndian.PutUint32(header[0:], 4097)
+		binary.BigEndian.PutUint32(header[4:], 4096)
+		header[8], header[9] = 8, 6
+		writePngChunk(&large, "IHDR", header)
+		if _, err := ApplyOrientation(large.Bytes(), 6); err != ImageTooLargeError {
+			t.Fatalf("Expected ImageTooLargeError, got %v", err)
+		}
+	})
+}
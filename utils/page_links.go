@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// The urls found on a web page, absolute and without fragments
+type PageLinks struct {
+	// Targets of <a> and <area> links
+	Links []string
+	// Sources of <img> and <picture> elements, taking the largest candidate of srcsets, and og:image urls
+	Images []string
+}
+
+// Extracts the links and images of the html page at pageUrl. Honors <base href>, rel="nofollow" and the nofollow,
+// noindex and noimageindex values of <meta name="robots">
+func ExtractPageLinks(pageUrl *url.URL, r io.Reader) (PageLinks, error) {
+	var links PageLinks
+	base := pageUrl
+	seen := make(map[string]bool)
+	nofollow, noimages := false, false
+	add := func(list *[]string, rawUrl string) {
+		resolved, ok := resolvePageUrl(base, rawUrl)
+		if !ok || seen[resolved] {
+			return
+		}
+		seen[resolved] = true
+		*list = append(*list, resolved)
+	}
+
+	tokenizer := html.NewTokenizer(r)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return PageLinks{}, err
+			}
+			if nofollow {
+				links.Links = nil
+			}
+			if noimages {
+				links.Images = nil
+			}
+			return links, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			attrs := make(map[string]string, len(token.Attr))
+			for _, attr := range token.Attr {
+				attrs[attr.Key] = strings.TrimSpace(attr.Val)
+			}
+			switch token.Data {
+			case "base":
+				if resolved, err := pageUrl.Parse(attrs["href"]); err == nil && attrs["href"] != "" && base == pageUrl {
+					base = resolved
+				}
+			case "a", "area":
+				if href := attrs["href"]; href != "" && !hasToken(attrs["rel"], "nofollow") {
+					add(&links.Links, href)
+				}
+			case "img", "source":
+				if srcset := largestSrcsetCandidate(attrs["srcset"]); srcset != "" {
+					add(&links.Images, srcset)
+				} else if src := attrs["src"]; src != "" && token.Data == "img" {
+					add(&links.Images, src)
+				}
+			case "meta":
+				switch strings.ToLower(attrs["property"]) {
+				case "og:image", "og:image:url", "og:image:secure_url":
+					if content := attrs["content"]; content != "" {
+						add(&links.Images, content)
+					}
+				}
+				if strings.EqualFold(attrs["name"], "robots") {
+					content := strings.ToLower(attrs["content"])
+					nofollow = nofollow || hasToken(content, "nofollow") || hasToken(content, "none")
+					noimages = noimages || hasToken(content, "noindex") || hasToken(content, "noimageindex") || hasToken(content, "none")
+				}
+			}
+		}
+	}
+}
+
+// Resolves rawUrl against base, keeping only http(s) urls
+func resolvePageUrl(base *url.URL, rawUrl string) (string, bool) {
+	resolved, err := base.Parse(rawUrl)
+	if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") || resolved.Host == "" {
+		return "", false
+	}
+	resolved.Fragment = ""
+	resolved.RawFragment = ""
+	return resolved.String(), true
+}
+
+// Whether value, a list separated by spaces or commas, contains token
+func hasToken(value string, token string) bool {
+	separator := func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}
+	for _, field := range strings.FieldsFunc(strings.ToLower(value), separator) {
+		if field == token {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the url of the widest (or densest) candidate of a srcset attribute, "" if it has none
+func largestSrcsetCandidate(srcset string) string {
+	best, bestSize := "", -1.0
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		// Without a descriptor the candidate is 1x
+		size := 1.0
+		if len(fields) > 1 {
+			descriptor := fields[1]
+			if len(descriptor) < 2 {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64)
+			if err != nil {
+				continue
+			}
+			size = parsed
+		}
+		if size > bestSize {
+			best, bestSize = fields[0], size
+		}
+	}
+	return best
+}
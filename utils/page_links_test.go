@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractPageLinks(t *testing.T) {
+	pageUrl, _ := url.Parse("http://example.com/blog/post.html")
+
+	t.Run("links and images", func(t *testing.T) {
+		page := `<html><head>
+<meta property="og:image" content="/images/cover.jpg">
+</head><body>
+<a href="other.html#comments">Other</a>
+<a href="https://elsewhere.com/">Elsewhere</a>
+<a href="mailto:someone@example.com">Mail</a>
+<a href="/ads" rel="sponsored nofollow">Ad</a>
+<img src="small.jpg" srcset="small.jpg 480w, large.jpg 1080w, medium.jpg 800w">
+<img src="/images/cover.jpg">
+<img src="data:image/png;base64,AAAA">
+<picture><source srcset="photo.webp, photo@2x.webp 2x"><img src="photo.jpg"></picture>
+</body></html>`
+		links, err := ExtractPageLinks(pageUrl, strings.NewReader(page))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		wantLinks := []string{"http://example.com/blog/other.html", "https://elsewhere.com/"}
+		if !reflect.DeepEqual(links.Links, wantLinks) {
+			t.Fatalf("Links = %v, want = %v", links.Links, wantLinks)
+		}
+		wantImages := []string{
+			"http://example.com/images/cover.jpg",
+			"http://example.com/blog/large.jpg",
+			"http://example.com/blog/photo@2x.webp",
+			"http://example.com/blog/photo.jpg",
+		}
+		if !reflect.DeepEqual(links.Images, wantImages) {
+			t.Fatalf("Images = %v, want = %v", links.Images, wantImages)
+		}
+	})
+
+	t.Run("base href", func(t *testing.T) {
+		page := `<base href="http://cdn.example.com/assets/"><img src="a.png"><a href="b.html">B</a>`
+		links, err := ExtractPageLinks(pageUrl, strings.NewReader(page))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(links.Images) != 1 || links.Images[0] != "http://cdn.example.com/assets/a.png" ||
+			len(links.Links) != 1 || links.Links[0] != "http://cdn.example.com/assets/b.html" {
+			t.Fatalf("Links = %v, want urls relative to the base href", links)
+		}
+	})
+
+	t.Run("meta robots", func(t *testing.T) {
+		page := `<meta name="robots" content="noindex, nofollow"><img src="a.png"><a href="b.html">B</a>`
+		links, err := ExtractPageLinks(pageUrl, strings.NewReader(page))
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if len(links.Images) != 0 || len(links.Links) != 0 {
+			t.Fatalf("Links = %v, want none", links)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The rules of a robots.txt that apply to one user agent, see RFC 9309
+type RobotsRules struct {
+	rules []robotsRule
+	// The Crawl-delay of the group of the user agent, 0 if it has none
+	CrawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow bool
+	// Length of the path pattern, the longest matching pattern decides
+	length  int
+	pattern *regexp.Regexp
+}
+
+// Allows everything, used for hosts without a robots.txt
+var AllowAllRobotsRules = &RobotsRules{}
+
+// Disallows everything, used for hosts whose robots.txt failed to load
+var DisallowAllRobotsRules = &RobotsRules{rules: []robotsRule{{length: 1, pattern: regexp.MustCompile(`^/`)}}}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// Parses a robots.txt, keeping the groups of the product token of userAgent (the part before the first "/")
+// or, if there are none, the groups of "*"
+func ParseRobots(data []byte, userAgent string) *RobotsRules {
+	token := strings.ToLower(strings.TrimSpace(strings.SplitN(userAgent, "/", 2)[0]))
+
+	groups := make([]*robotsGroup, 0, 4)
+	var group *robotsGroup
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share a group
+			if group == nil || len(group.rules) > 0 || group.crawlDelay > 0 {
+				group = &robotsGroup{}
+				groups = append(groups, group)
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if group == nil || value == "" {
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{allow: key == "allow", length: len(value), pattern: robotsPattern(value)})
+		case "crawl-delay":
+			if group == nil {
+				continue
+			}
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err == nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	matching := make([]*robotsGroup, 0, 1)
+	wildcard := make([]*robotsGroup, 0, 1)
+	for _, group := range groups {
+		for _, agent := range group.agents {
+			if agent == token && token != "" {
+				matching = append(matching, group)
+				break
+			}
+			if agent == "*" {
+				wildcard = append(wildcard, group)
+				break
+			}
+		}
+	}
+	if len(matching) == 0 {
+		matching = wildcard
+	}
+
+	rules := &RobotsRules{}
+	for _, group := range matching {
+		rules.rules = append(rules.rules, group.rules...)
+		if group.crawlDelay > rules.CrawlDelay {
+			rules.CrawlDelay = group.crawlDelay
+		}
+	}
+	return rules
+}
+
+// Compiles a path pattern, in which "*" matches any characters and a trailing "$" matches the end of the path
+func robotsPattern(path string) *regexp.Regexp {
+	anchored := strings.HasSuffix(path, "$")
+	path = strings.TrimSuffix(path, "$")
+	quoted := strings.ReplaceAll(regexp.QuoteMeta(path), `\*`, `.*`)
+	if anchored {
+		quoted += "$"
+	}
+	return regexp.MustCompile("^" + quoted)
+}
+
+// Whether the rules allow crawling u. The longest matching rule decides, allow rules winning ties
+func (r *RobotsRules) Allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allowed, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > longest || (rule.length == longest && rule.allow) {
+			allowed, longest = rule.allow, rule.length
+		}
+	}
+	return allowed
+}
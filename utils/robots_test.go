@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	robots := []byte(`# Comments are ignored
+User-agent: *
+Disallow: /private/
+Allow: /private/public.jpg
+Disallow: /*.gif$
+Crawl-delay: 2
+
+User-agent: clipsearch
+User-agent: other
+Disallow: /
+Allow: /photos
+`)
+
+	cases := []struct {
+		userAgent string
+		url       string
+		allowed   bool
+	}{
+		{"Mozilla/5.0", "http://example.com/", true},
+		{"Mozilla/5.0", "http://example.com/private/secret.jpg", false},
+		{"Mozilla/5.0", "http://example.com/private/public.jpg", true},
+		{"Mozilla/5.0", "http://example.com/images/cat.gif", false},
+		{"Mozilla/5.0", "http://example.com/images/cat.gif?size=2", true},
+		{"Mozilla/5.0", "http://example.com/robots.txt", true},
+		{"ClipSearch/1.0", "http://example.com/", false},
+		{"ClipSearch/1.0", "http://example.com/photos/cat.jpg", true},
+		{"ClipSearch/1.0", "http://example.com/private/secret.jpg", false},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if allowed := ParseRobots(robots, c.userAgent).Allowed(u); allowed != c.allowed {
+			t.Errorf("Allowed(%s) for %s = %v, want = %v", c.url, c.userAgent, allowed, c.allowed)
+		}
+	}
+
+	if delay := ParseRobots(robots, "Mozilla/5.0").CrawlDelay; delay != 2*time.Second {
+		t.Errorf("Crawl delay = %s, want = 2s", delay)
+	}
+	if delay := ParseRobots(robots, "clipsearch").CrawlDelay; delay != 0 {
+		t.Errorf("Crawl delay of clipsearch = %s, want = 0s", delay)
+	}
+	u, _ := url.Parse("http://example.com/")
+	if DisallowAllRobotsRules.Allowed(u) || !AllowAllRobotsRules.Allowed(u) {
+		t.Errorf("Expected DisallowAllRobotsRules to disallow and AllowAllRobotsRules to allow everything")
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"errors"
+	"math"
+)
+
+var VectorDimensionMismatchError = errors.New("Vectors have different dimensions")
+
+// Returns the inner product of a and b
+func Dot(a []float32, b []float32) (float32, error) {
+	if len(a) != len(b) {
+		return 0, VectorDimensionMismatchError
+	}
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum, nil
+}
+
+// Returns the sum of vectors[i] * weights[i]
+func WeightedSum(vectors [][]float32, weights []float32) ([]float32, error) {
+	if len(vectors) != len(weights) {
+		return nil, errors.New("Expected one weight per vector")
+	}
+	if len(vectors) == 0 {
+		return nil, errors.New("Expected at least one vector")
+	}
+	sum := make([]float32, len(vectors[0]))
+	for i, vector := range vectors {
+		if len(vector) != len(sum) {
+			return nil, VectorDimensionMismatchError
+		}
+		for j, val := range vector {
+			sum[j] += val * weights[i]
+		}
+	}
+	return sum, nil
+}
+
+// Scales v in place so that it has unit length. A zero vector is left as is
+func Normalize(v []float32) {
+	var norm float64
+	for _, val := range v {
+		norm += float64(val) * float64(val)
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] = float32(float64(v[i]) / norm)
+	}
+}
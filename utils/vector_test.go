@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWeightedSum(t *testing.T) {
+	t.Run("weights", func(t *testing.T) {
+		sum, err := WeightedSum([][]float32{{1, 0}, {0, 1}}, []float32{2, -1})
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if sum[0] != 2 || sum[1] != -1 {
+			t.Fatalf("WeightedSum = %v, want = %v", sum, []float32{2, -1})
+		}
+	})
+
+	t.Run("dimension mismatch", func(t *testing.T) {
+		_, err := WeightedSum([][]float32{{1, 0}, {0, 1, 0}}, []float32{1, 1})
+		if err != VectorDimensionMismatchError {
+			t.Fatalf("Expected WeightedSum to fail with VectorDimensionMismatchError")
+		}
+	})
+}
+
+func TestNormalize(t *testing.T) {
+	v := []float32{3, 4}
+	Normalize(v)
+	if math.Abs(float64(v[0])-0.6) > 1e-6 || math.Abs(float64(v[1])-0.8) > 1e-6 {
+		t.Fatalf("Normalized vector = %v, want = %v", v, []float32{0.6, 0.8})
+	}
+
+	zero := []float32{0, 0}
+	Normalize(zero)
+	if zero[0] != 0 || zero[1] != 0 {
+		t.Fatalf("Normalized zero vector = %v, want = %v", zero, []float32{0, 0})
+	}
+}